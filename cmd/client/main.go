@@ -2,23 +2,41 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"compress/flate"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
 	HeaderLen  = 8
 	MaxBodyLen = 65535
+
+	// The top byte of the length word holds packet flags.
+	LenMask        = 1<<24 - 1
+	FlagCompressed = 1 << 0
+
+	// HeartbeatInterval keeps the connection well inside the server's idle
+	// timeout while the user is reading the board.
+	HeartbeatInterval = 30 * time.Second
+
+	ProtocolVersion = 2
+	ClientName      = "gomoku-cli"
+	ClientVersion   = "1.2.0"
 )
 
 const (
 	TypePing            uint16 = 1000
 	TypePong            uint16 = 1001
+	TypeServerShutdown  uint16 = 1002
 	TypeLogin           uint16 = 2001
 	TypeLoginResp       uint16 = 2002
 	TypeRegister        uint16 = 2003
@@ -33,6 +51,9 @@ const (
 	TypeRoomListResp    uint16 = 3014
 	TypePlayerJoin      uint16 = 3015
 	TypePlayerLeave     uint16 = 3016
+	TypeReady           uint16 = 3104
+	TypeReadyResp       uint16 = 3105
+	TypeReadyUpdate     uint16 = 3106
 	TypeMove            uint16 = 4001
 	TypeMoveResp        uint16 = 4002
 	TypeGameOver        uint16 = 4003
@@ -44,10 +65,39 @@ const (
 	TypeLeaderboardResp uint16 = 5002
 	TypeUserStatsReq    uint16 = 5003
 	TypeUserStatsResp   uint16 = 5004
+
+	TypeSystemAnnouncement uint16 = 1003
+	TypeForceDisconnect    uint16 = 1004
+	TypeHello              uint16 = 1005
+	TypeHelloResp          uint16 = 1006
+
+	TypeChat        uint16 = 3201
+	TypeChatResp    uint16 = 3202
+	TypeChatMessage uint16 = 3203
+
+	TypeLogout          uint16 = 2005
+	TypeLogoutResp      uint16 = 2006
+	TypeSessionList     uint16 = 2007
+	TypeSessionListResp uint16 = 2008
+
+	TypeRefreshToken     uint16 = 2009
+	TypeRefreshTokenResp uint16 = 2010
+
+	TypeChangePassword     uint16 = 2011
+	TypeChangePasswordResp uint16 = 2012
+
+	TypeGuestLogin       uint16 = 2013
+	TypeGuestLoginResp   uint16 = 2014
+	TypeClaimAccount     uint16 = 2015
+	TypeClaimAccountResp uint16 = 2016
+
+	TypeUpdateProfile     uint16 = 2017
+	TypeUpdateProfileResp uint16 = 2018
 )
 
 type Packet struct {
 	Len     uint32
+	Flags   uint8
 	Type    uint16
 	Seq     uint16
 	Payload []byte
@@ -61,7 +111,10 @@ type Client struct {
 	userID   int64
 	username string
 	token    string
+	refresh  string
 	roomID   int64
+
+	heartbeats int32
 }
 
 func NewClient(addr string) (*Client, error) {
@@ -113,22 +166,34 @@ func (c *Client) send(msgType uint16, payload interface{}) error {
 
 func (c *Client) recv() (*Packet, error) {
 	header := make([]byte, HeaderLen)
-	if _, err := c.reader.Read(header); err != nil {
+	if _, err := io.ReadFull(c.reader, header); err != nil {
 		return nil, err
 	}
 
+	word := binary.BigEndian.Uint32(header[0:4])
 	pkt := &Packet{
-		Len:  binary.BigEndian.Uint32(header[0:4]),
-		Type: binary.BigEndian.Uint16(header[4:6]),
-		Seq:  binary.BigEndian.Uint16(header[6:8]),
+		Len:   word & LenMask,
+		Flags: uint8(word >> 24),
+		Type:  binary.BigEndian.Uint16(header[4:6]),
+		Seq:   binary.BigEndian.Uint16(header[6:8]),
 	}
 
 	bodyLen := pkt.Len - HeaderLen
 	if bodyLen > 0 {
 		pkt.Payload = make([]byte, bodyLen)
-		if _, err := c.reader.Read(pkt.Payload); err != nil {
+		if _, err := io.ReadFull(c.reader, pkt.Payload); err != nil {
+			return nil, err
+		}
+	}
+
+	if pkt.Flags&FlagCompressed != 0 {
+		r := flate.NewReader(bytes.NewReader(pkt.Payload))
+		payload, err := io.ReadAll(io.LimitReader(r, MaxBodyLen))
+		r.Close()
+		if err != nil {
 			return nil, err
 		}
+		pkt.Payload = payload
 	}
 
 	return pkt, nil
@@ -145,20 +210,109 @@ func (c *Client) recvLoop() {
 	}
 }
 
+func (c *Client) heartbeat() {
+	ticker := time.NewTicker(HeartbeatInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		atomic.AddInt32(&c.heartbeats, 1)
+		if err := c.send(TypePing, struct{}{}); err != nil {
+			return
+		}
+	}
+}
+
 func (c *Client) handlePacket(pkt *Packet) {
+	if pkt.Type == TypePong && atomic.AddInt32(&c.heartbeats, -1) >= 0 {
+		return
+	}
+	atomic.CompareAndSwapInt32(&c.heartbeats, -1, 0)
+
 	switch pkt.Type {
 	case TypePong:
 		fmt.Println("\n[Pong received]")
+	case TypeServerShutdown:
+		var msg map[string]interface{}
+		json.Unmarshal(pkt.Payload, &msg)
+		deadline := time.Unix(int64(msg["deadline"].(float64)), 0)
+		fmt.Printf("\n[Server shutting down] %s (games end at %s)\n", msg["message"], deadline.Format("15:04:05"))
+	case TypeSystemAnnouncement:
+		var msg map[string]interface{}
+		json.Unmarshal(pkt.Payload, &msg)
+		fmt.Printf("\n[Announcement] %s\n", msg["message"])
+	case TypeForceDisconnect:
+		var msg map[string]interface{}
+		json.Unmarshal(pkt.Payload, &msg)
+		fmt.Printf("\n[Disconnected] %s\n", msg["reason"])
+	case TypeHelloResp:
+		var resp map[string]interface{}
+		json.Unmarshal(pkt.Payload, &resp)
+		if resp["code"].(float64) != 200 {
+			fmt.Printf("\n[Hello rejected] %s\n", resp["message"])
+		}
 	case TypeLoginResp:
 		var resp map[string]interface{}
 		json.Unmarshal(pkt.Payload, &resp)
 		if resp["code"].(float64) == 200 {
 			c.token = resp["token"].(string)
+			if refresh, ok := resp["refresh_token"].(string); ok {
+				c.refresh = refresh
+			}
 			c.userID = int64(resp["user_id"].(float64))
-			fmt.Printf("\n[Login success] UserID: %d, Token: %s\n", c.userID, c.token[:16]+"...")
+			fmt.Printf("\n[Login success] UserID: %d, Role: %v, Token: %s\n", c.userID, resp["role"], c.token[:16]+"...")
 		} else {
 			fmt.Printf("\n[Login failed] %s\n", resp["message"])
 		}
+	case TypeRefreshTokenResp:
+		var resp map[string]interface{}
+		json.Unmarshal(pkt.Payload, &resp)
+		if resp["code"].(float64) == 200 {
+			c.token = resp["access_token"].(string)
+			c.refresh = resp["refresh_token"].(string)
+			fmt.Printf("\n[Token refreshed] expires in %ds, Token: %s\n", int(resp["expires_in"].(float64)), c.token[:16]+"...")
+		} else {
+			fmt.Printf("\n[Refresh failed] %s\n", resp["message"])
+		}
+	case TypeGuestLoginResp:
+		var resp map[string]interface{}
+		json.Unmarshal(pkt.Payload, &resp)
+		if resp["code"].(float64) == 200 {
+			c.token = resp["token"].(string)
+			c.refresh = resp["refresh_token"].(string)
+			c.userID = int64(resp["user_id"].(float64))
+			c.username = resp["username"].(string)
+			fmt.Printf("\n[Guest login] UserID: %d, Username: %s (casual rooms only, use claim to keep the account)\n", c.userID, c.username)
+		} else {
+			fmt.Printf("\n[Guest login failed] %s\n", resp["message"])
+		}
+	case TypeClaimAccountResp:
+		var resp map[string]interface{}
+		json.Unmarshal(pkt.Payload, &resp)
+		if resp["code"].(float64) == 200 {
+			c.token = resp["token"].(string)
+			c.username = resp["username"].(string)
+			fmt.Printf("\n[Account claimed] Username: %s, Role: %v\n", c.username, resp["role"])
+		} else {
+			fmt.Printf("\n[Claim failed] %s\n", resp["message"])
+		}
+	case TypeUpdateProfileResp:
+		var resp map[string]interface{}
+		json.Unmarshal(pkt.Payload, &resp)
+		if resp["code"].(float64) == 200 {
+			p := resp["profile"].(map[string]interface{})
+			fmt.Printf("\n[Profile updated] Display Name: %q, Avatar: %d, Country: %q, Bio: %q\n",
+				p["display_name"], int(p["avatar_id"].(float64)), p["country"], p["bio"])
+		} else {
+			fmt.Printf("\n[Update profile failed] %s\n", resp["message"])
+		}
+	case TypeChangePasswordResp:
+		var resp map[string]interface{}
+		json.Unmarshal(pkt.Payload, &resp)
+		if resp["code"].(float64) == 200 {
+			fmt.Printf("\n[Password changed] other sessions ended: %d\n", int(resp["revoked"].(float64)))
+		} else {
+			fmt.Printf("\n[Change password failed] %s\n", resp["message"])
+		}
 	case TypeRegisterResp:
 		var resp map[string]interface{}
 		json.Unmarshal(pkt.Payload, &resp)
@@ -211,13 +365,71 @@ func (c *Client) handlePacket(pkt *Packet) {
 		var msg map[string]interface{}
 		json.Unmarshal(pkt.Payload, &msg)
 		fmt.Printf("\n[Player left] ID: %d, Reason: %s\n", int64(msg["user_id"].(float64)), msg["reason"])
+	case TypeReadyResp:
+		var resp map[string]interface{}
+		json.Unmarshal(pkt.Payload, &resp)
+		if resp["code"].(float64) == 200 {
+			fmt.Printf("\n[Ready] %v\n", resp["ready"])
+		} else {
+			fmt.Printf("\n[Ready failed] %s\n", resp["message"])
+		}
+	case TypeReadyUpdate:
+		var msg map[string]interface{}
+		json.Unmarshal(pkt.Payload, &msg)
+		fmt.Printf("\n[Ready players] %v\n", msg["ready"])
+	case TypeLogoutResp:
+		var resp map[string]interface{}
+		json.Unmarshal(pkt.Payload, &resp)
+		if resp["code"].(float64) == 200 {
+			fmt.Printf("\n[%s] sessions ended: %d\n", resp["message"], int(resp["revoked"].(float64)))
+			if resp["message"] == "logged out" {
+				c.token = ""
+				c.refresh = ""
+				c.userID = 0
+				c.roomID = 0
+			}
+		} else {
+			fmt.Printf("\n[Logout failed] %s\n", resp["message"])
+		}
+	case TypeSessionListResp:
+		var resp map[string]interface{}
+		json.Unmarshal(pkt.Payload, &resp)
+		if resp["code"].(float64) != 200 {
+			fmt.Printf("\n[Sessions failed] %s\n", resp["message"])
+			break
+		}
+		fmt.Println("\n[Sessions]")
+		sessions, _ := resp["sessions"].([]interface{})
+		for _, s := range sessions {
+			sess := s.(map[string]interface{})
+			current := ""
+			if sess["current"] == true {
+				current = " (current)"
+			}
+			created := time.Unix(int64(sess["created_at"].(float64)), 0).Format("2006-01-02 15:04")
+			fmt.Printf("  %s  %-10s %-15s %s%s\n", sess["id"], sess["device"], sess["ip"], created, current)
+		}
+	case TypeChatResp:
+		var resp map[string]interface{}
+		json.Unmarshal(pkt.Payload, &resp)
+		if resp["code"].(float64) != 200 {
+			fmt.Printf("\n[Chat failed] %s\n", resp["message"])
+		}
+	case TypeChatMessage:
+		var msg map[string]interface{}
+		json.Unmarshal(pkt.Payload, &msg)
+		fmt.Printf("\n[%s] %s\n", msg["username"], msg["content"])
 	case TypeGameStart:
 		var msg map[string]interface{}
 		json.Unmarshal(pkt.Payload, &msg)
 		players := msg["players"].([]interface{})
 		first := int64(msg["first_player"].(float64))
 		fmt.Printf("\n[Game started!] Players: %v, First: %d\n", players, first)
-		fmt.Println("Use 'move x y' to place your piece (0-14)")
+		size := 15
+		if settings, ok := msg["settings"].(map[string]interface{}); ok {
+			size = int(settings["board_size"].(float64))
+		}
+		fmt.Printf("Use 'move x y' to place your piece (0-%d)\n", size-1)
 	case TypeBoardUpdate:
 		var msg map[string]interface{}
 		json.Unmarshal(pkt.Payload, &msg)
@@ -268,10 +480,22 @@ func (c *Client) handlePacket(pkt *Packet) {
 		if resp["code"].(float64) == 200 {
 			fmt.Printf("\n[User Stats]\n")
 			fmt.Printf("  Username: %s\n", resp["username"])
+			if name, ok := resp["display_name"].(string); ok {
+				fmt.Printf("  Display Name: %s\n", name)
+			}
+			if country, ok := resp["country"].(string); ok {
+				fmt.Printf("  Country: %s\n", country)
+			}
+			if bio, ok := resp["bio"].(string); ok {
+				fmt.Printf("  Bio: %s\n", bio)
+			}
 			fmt.Printf("  Score: %d\n", int(resp["score"].(float64)))
 			fmt.Printf("  W/L: %d/%d\n", int(resp["win_count"].(float64)), int(resp["lose_count"].(float64)))
 			fmt.Printf("  Win Rate: %s\n", resp["win_rate"])
-			fmt.Printf("  Rank: #%d\n", int(resp["rank"].(float64)))
+			// Guests are not ranked and get no rank field.
+			if rank, ok := resp["rank"].(float64); ok {
+				fmt.Printf("  Rank: #%d\n", int(rank))
+			}
 		} else {
 			fmt.Printf("\n[Get stats failed] %s\n", resp["message"])
 		}
@@ -282,8 +506,11 @@ func (c *Client) handlePacket(pkt *Packet) {
 }
 
 func (c *Client) printBoard(board []interface{}) {
-	fmt.Println("\n   0 1 2 3 4 5 6 7 8 9 0 1 2 3 4")
-	fmt.Println("   ------------------------------")
+	fmt.Print("\n   ")
+	for i := range board {
+		fmt.Printf(" %d", i%10)
+	}
+	fmt.Printf("\n   %s\n", strings.Repeat("--", len(board)))
 	for i, row := range board {
 		fmt.Printf("%2d|", i)
 		for _, cell := range row.([]interface{}) {
@@ -305,14 +532,23 @@ func printPrompt() {
 }
 
 func printHelp() {
-	fmt.Println(`
+	fmt.Print(`
 Commands:
   register <username> <password>  - Register new user
   login <username> <password>     - Login with username/password
   login-token <token>             - Login with token
+  guest                           - Play as a guest (casual rooms only)
+  claim <username> <password>     - Turn the guest account into a regular one
+  refresh [refresh_token]         - Get a new access token
+  logout [all|session_id]         - Log out, everywhere, or end another session
+  sessions                        - List your logged-in sessions
+  passwd <old> <new>              - Change password (ends your other sessions)
+  profile <field> [value]         - Set name, avatar, country or bio (no value clears it)
   create [room_name]              - Create a room
   join <room_id>                  - Join a room
   leave                           - Leave current room
+  ready / unready                 - Toggle ready in current room
+  chat <message>                  - Send a chat message to the current room
   rooms                           - List waiting rooms
   move <x> <y>                    - Make a move (0-14)
   forfeit                         - Forfeit current game
@@ -327,8 +563,9 @@ Game flow:
   2. login user1 123456
   3. create MyRoom
   4. (another client) join <room_id>
-  5. Game starts automatically
-  6. move 7 7  (place at center)
+  5. Both players: ready
+  6. Game starts when both are ready
+  7. move 7 7  (place at center)
 `)
 }
 
@@ -346,8 +583,17 @@ func main() {
 	}
 	defer client.Close()
 
+	client.send(TypeHello, map[string]interface{}{
+		"version":        ProtocolVersion,
+		"client":         ClientName,
+		"client_version": ClientVersion,
+		"codecs":         []string{"json"},
+		"features":       []string{"chat", "compression"},
+	})
+
 	fmt.Println("Connected! Type 'help' for commands.")
 	go client.recvLoop()
+	go client.heartbeat()
 
 	scanner := bufio.NewScanner(os.Stdin)
 	printPrompt()
@@ -388,6 +634,7 @@ func main() {
 				client.send(TypeLogin, map[string]string{
 					"username": args[0],
 					"password": args[1],
+					"device":   "cli",
 				})
 			}
 		case "login-token":
@@ -395,7 +642,67 @@ func main() {
 				fmt.Println("Usage: login-token <token>")
 			} else {
 				client.send(TypeLogin, map[string]string{
-					"token": args[0],
+					"token":  args[0],
+					"device": "cli",
+				})
+			}
+		case "guest":
+			client.send(TypeGuestLogin, map[string]string{
+				"device": "cli",
+			})
+		case "claim":
+			if len(args) < 2 {
+				fmt.Println("Usage: claim <username> <password>")
+			} else {
+				client.send(TypeClaimAccount, map[string]string{
+					"username": args[0],
+					"password": args[1],
+				})
+			}
+		case "refresh":
+			token := client.refresh
+			if len(args) > 0 {
+				token = args[0]
+			}
+			if token == "" {
+				fmt.Println("Usage: refresh <refresh_token>")
+			} else {
+				client.send(TypeRefreshToken, map[string]string{
+					"refresh_token": token,
+				})
+			}
+		case "logout":
+			req := map[string]interface{}{}
+			if len(args) > 0 && args[0] == "all" {
+				req["all"] = true
+			} else if len(args) > 0 {
+				req["session_id"] = args[0]
+			}
+			client.send(TypeLogout, req)
+		case "sessions":
+			client.send(TypeSessionList, struct{}{})
+		case "passwd":
+			if len(args) < 2 {
+				fmt.Println("Usage: passwd <old_password> <new_password>")
+			} else {
+				client.send(TypeChangePassword, map[string]string{
+					"old_password": args[0],
+					"new_password": args[1],
+				})
+			}
+		case "profile":
+			fields := map[string]string{"name": "display_name", "country": "country", "bio": "bio", "avatar": "avatar_id"}
+			if len(args) < 1 || fields[args[0]] == "" {
+				fmt.Println("Usage: profile <name|avatar|country|bio> [value]")
+			} else if args[0] == "avatar" {
+				var id int
+				if len(args) > 1 {
+					fmt.Sscanf(args[1], "%d", &id)
+				}
+				client.send(TypeUpdateProfile, map[string]int{"avatar_id": id})
+			} else {
+				client.send(TypeUpdateProfile, map[string]string{
+					fields[args[0]]: strings.Join(args[1:], " "),
 				})
 			}
 		case "create":
@@ -424,6 +731,26 @@ func main() {
 					"room_id": client.roomID,
 				})
 			}
+		case "ready", "unready":
+			if client.roomID == 0 {
+				fmt.Println("Not in a room")
+			} else {
+				client.send(TypeReady, map[string]interface{}{
+					"room_id": client.roomID,
+					"ready":   cmd == "ready",
+				})
+			}
+		case "chat":
+			if client.roomID == 0 {
+				fmt.Println("Not in a room")
+			} else if len(args) == 0 {
+				fmt.Println("Usage: chat <message>")
+			} else {
+				client.send(TypeChat, map[string]interface{}{
+					"room_id": client.roomID,
+					"content": strings.Join(args, " "),
+				})
+			}
 		case "rooms":
 			client.send(TypeRoomList, struct{}{})
 		case "move":
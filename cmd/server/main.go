@@ -1,19 +1,38 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"game-server/internal/config"
 	"game-server/internal/handler"
 	"game-server/internal/repository"
 	"game-server/internal/router"
+	"game-server/internal/service"
 	"game-server/pkg/redis"
 )
 
+const (
+	defaultShutdownTimeout = 60 * time.Second
+	closeConnsTimeout      = 10 * time.Second
+)
+
+// drainable is implemented by the TCP and WebSocket handlers.
+type drainable interface {
+	NotifyShutdown(deadline time.Time)
+	ActiveGames() int
+	AbortGames() int
+	CloseConnections(ctx context.Context) error
+}
+
 func main() {
 	configPath := os.Getenv("CONFIG_PATH")
 	if configPath == "" {
@@ -24,6 +43,28 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	if err := service.SetSessionPolicy(service.SessionPolicy(config.GlobalConfig.Session.Policy)); err != nil {
+		log.Fatalf("Invalid config: %v", err)
+	}
+	if err := service.InitTokens(config.GlobalConfig.Auth); err != nil {
+		log.Fatalf("Invalid auth config: %v", err)
+	}
+	service.SetLoginLimits(config.GlobalConfig.Limits)
+	if err := service.SetPasswordPolicy(config.GlobalConfig.Password); err != nil {
+		log.Fatalf("Invalid password config: %v", err)
+	}
+	if err := service.SetUsernamePolicy(config.GlobalConfig.Username); err != nil {
+		log.Fatalf("Invalid username config: %v", err)
+	}
+	if err := handler.SetProtocolPolicy(config.GlobalConfig.Protocol); err != nil {
+		log.Fatalf("Invalid protocol config: %v", err)
+	}
+	notifier, err := service.NewResetNotifier(config.GlobalConfig.Password.Notifier, config.GlobalConfig.Password.NotifierFile)
+	if err != nil {
+		log.Fatalf("Invalid password config: %v", err)
+	}
+	service.SetResetNotifier(notifier)
+
 	if err := repository.InitDB(); err != nil {
 		log.Fatalf("Failed to connect database: %v", err)
 	}
@@ -34,33 +75,111 @@ func main() {
 	}
 	defer redis.CloseRedis()
 
-	tcpHandler := handler.NewTCPHandler()
-	go startTCPServer(tcpHandler)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	tournaments := service.NewTournamentService()
+
+	tcpHandler := handler.NewTCPHandler(tournaments)
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", config.GlobalConfig.Server.TCPPort))
+	if err != nil {
+		log.Fatalf("Failed to start TCP server: %v", err)
+	}
+	go serveTCP(listener, tcpHandler)
 
-	r := router.NewRouter()
+	r := router.NewRouter(tournaments)
+	r.AddAdminTarget(tcpHandler)
 	mux := r.Setup()
 
+	janitorCtx, stopJanitor := context.WithCancel(context.Background())
+	defer stopJanitor()
+
+	janitorCfg := config.GlobalConfig.Janitor
+	janitor := service.NewJanitor(janitorCfg.Interval, janitorCfg.HeartbeatTimeout, janitorCfg.RoomTimeout,
+		tcpHandler, r.WSHandler())
+	janitor.Start(janitorCtx)
+	r.SetJanitor(janitor)
+
 	addr := fmt.Sprintf(":%d", config.GlobalConfig.Server.HTTPPort)
-	log.Printf("HTTP server starting on %s", addr)
+	server := &http.Server{Addr: addr, Handler: mux}
 
-	if err := http.ListenAndServe(addr, mux); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	go func() {
+		log.Printf("HTTP server starting on %s", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+
+	shutdown(server, listener, []drainable{tcpHandler, r.WSHandler()})
+	stopJanitor()
+	log.Println("Server stopped")
+}
+
+// shutdown drains the server: no new connections or rooms are accepted,
+// players are warned, running games get until the deadline to finish and the
+// remaining connections are closed once their state has been written.
+func shutdown(server *http.Server, listener net.Listener, handlers []drainable) {
+	timeout := config.GlobalConfig.Server.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	deadline := time.Now().Add(timeout)
+
+	log.Printf("Shutting down, running games have until %s", deadline.Format(time.RFC3339))
+	service.StartDraining()
+	listener.Close()
+
+	// The HTTP server stays up while games finish so /readyz can tell the
+	// load balancer that this instance is draining.
+	for _, h := range handlers {
+		h.NotifyShutdown(deadline)
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for activeGames(handlers) > 0 && time.Now().Before(deadline) {
+		<-ticker.C
+	}
+
+	for _, h := range handlers {
+		if n := h.AbortGames(); n > 0 {
+			log.Printf("Aborted %d unfinished games", n)
+		}
+	}
+
+	closeCtx, cancel := context.WithTimeout(context.Background(), closeConnsTimeout)
+	defer cancel()
+	if err := server.Shutdown(closeCtx); err != nil {
+		log.Printf("HTTP shutdown error: %v", err)
+	}
+	for _, h := range handlers {
+		if err := h.CloseConnections(closeCtx); err != nil {
+			log.Printf("Timed out waiting for connections to close: %v", err)
+		}
 	}
 }
 
-func startTCPServer(h *handler.TCPHandler) {
-	addr := fmt.Sprintf(":%d", config.GlobalConfig.Server.TCPPort)
-	listener, err := net.Listen("tcp", addr)
-	if err != nil {
-		log.Fatalf("Failed to start TCP server: %v", err)
+func activeGames(handlers []drainable) int {
+	count := 0
+	for _, h := range handlers {
+		count += h.ActiveGames()
 	}
-	defer listener.Close()
+	return count
+}
 
-	log.Printf("TCP server starting on %s", addr)
+func serveTCP(listener net.Listener, h *handler.TCPHandler) {
+	log.Printf("TCP server starting on %s", listener.Addr())
 
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
+			if service.IsDraining() {
+				log.Println("TCP server stopped accepting connections")
+				return
+			}
 			log.Printf("Accept error: %v", err)
 			continue
 		}
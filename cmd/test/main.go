@@ -12,6 +12,9 @@ import (
 
 const HeaderLen = 8
 
+// testPassword satisfies the default password policy.
+const testPassword = "autoplay-2048"
+
 type Packet struct {
 	Len     uint32
 	Type    uint16
@@ -143,6 +146,12 @@ func (c *GameClient) joinRoom(roomID int64) bool {
 	return false
 }
 
+func (c *GameClient) ready() bool {
+	c.send(3104, map[string]interface{}{"room_id": c.roomID, "ready": true})
+	resp := c.waitForResponse(3105, 2*time.Second)
+	return resp != nil && resp["code"].(float64) == 200
+}
+
 func (c *GameClient) move(x, y int) bool {
 	c.send(4001, map[string]interface{}{"room_id": c.roomID, "x": x, "y": y})
 	resp := c.waitForResponse(4002, 2*time.Second)
@@ -171,7 +180,7 @@ func (c *GameClient) getLeaderboard() {
 func main() {
 	fmt.Println("╔════════════════════════════════════════╗")
 	fmt.Println("║    五子棋游戏服务器 - 自动化测试       ║")
-	fmt.Println("╚════════════════════════════════════════╝\n")
+	fmt.Print("╚════════════════════════════════════════╝\n\n")
 
 	// 创建两个客户端
 	fmt.Println("【1】创建玩家连接...")
@@ -192,15 +201,15 @@ func main() {
 
 	// 注册用户
 	fmt.Println("\n【2】注册玩家...")
-	player1.register("autoplayer1", "123456")
-	player2.register("autoplayer2", "123456")
+	player1.register("autoplayer1", testPassword)
+	player2.register("autoplayer2", testPassword)
 	fmt.Println("   ✓ 玩家1: autoplayer1")
 	fmt.Println("   ✓ 玩家2: autoplayer2")
 
 	// 登录
 	fmt.Println("\n【3】登录...")
-	player1.login("autoplayer1", "123456")
-	player2.login("autoplayer2", "123456")
+	player1.login("autoplayer1", testPassword)
+	player2.login("autoplayer2", testPassword)
 	fmt.Printf("   ✓ 玩家1登录成功 (ID: %d)\n", player1.userID)
 	fmt.Printf("   ✓ 玩家2登录成功 (ID: %d)\n", player2.userID)
 
@@ -212,7 +221,13 @@ func main() {
 	// 加入房间
 	fmt.Println("\n【5】玩家2加入房间...")
 	player2.joinRoom(roomID)
-	fmt.Println("   ✓ 加入成功，游戏开始!")
+	fmt.Println("   ✓ 加入成功")
+
+	// 双方准备
+	fmt.Println("\n【5.1】双方准备...")
+	player1.ready()
+	player2.ready()
+	fmt.Println("   ✓ 双方已准备，游戏开始!")
 
 	// 模拟对局
 	fmt.Println("\n【6】开始对局...")
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -11,11 +12,20 @@ type Config struct {
 	Server   ServerConfig   `yaml:"server"`
 	Database DatabaseConfig `yaml:"database"`
 	Redis    RedisConfig    `yaml:"redis"`
+	Janitor  JanitorConfig  `yaml:"janitor"`
+	Admin    AdminConfig    `yaml:"admin"`
+	Session  SessionConfig  `yaml:"session"`
+	Auth     AuthConfig     `yaml:"auth"`
+	Limits   LimitsConfig   `yaml:"limits"`
+	Password PasswordConfig `yaml:"password"`
+	Username UsernameConfig `yaml:"username"`
+	Protocol ProtocolConfig `yaml:"protocol"`
 }
 
 type ServerConfig struct {
-	HTTPPort int `yaml:"http_port"`
-	TCPPort  int `yaml:"tcp_port"`
+	HTTPPort        int           `yaml:"http_port"`
+	TCPPort         int           `yaml:"tcp_port"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
 }
 
 type DatabaseConfig struct {
@@ -35,6 +45,89 @@ type RedisConfig struct {
 	DB       int    `yaml:"db"`
 }
 
+type JanitorConfig struct {
+	Interval         time.Duration `yaml:"interval"`
+	HeartbeatTimeout time.Duration `yaml:"heartbeat_timeout"`
+	RoomTimeout      time.Duration `yaml:"room_timeout"`
+}
+
+// AdminConfig holds the operator token, a static bearer token that acts as
+// an admin on the /admin API. It is meant for granting the first staff
+// roles; leave it empty to accept only session tokens.
+type AdminConfig struct {
+	Token string `yaml:"token"`
+}
+
+// SessionConfig selects how many sessions a user may hold: "multi" (the
+// default) or "single", where a new login ends all older sessions.
+type SessionConfig struct {
+	Policy string `yaml:"policy"`
+}
+
+// AuthConfig sets up the signed access tokens. Algorithm is HS256, keyed by
+// Secret, or EdDSA, keyed by an Ed25519 PKCS#8 PEM file.
+type AuthConfig struct {
+	Algorithm      string        `yaml:"algorithm"`
+	Secret         string        `yaml:"secret"`
+	PrivateKeyFile string        `yaml:"private_key_file"`
+	AccessTTL      time.Duration `yaml:"access_ttl"`
+	RefreshTTL     time.Duration `yaml:"refresh_ttl"`
+}
+
+// LimitsConfig throttles logins, registrations and password reset
+// requests. After MaxAttempts failed logins for one username, or
+// IPMaxAttempts from one IP, within Window the username or IP is locked out
+// for Lockout, doubling on every further lockout up to MaxLockout. Zero
+// values take the defaults.
+type LimitsConfig struct {
+	MaxAttempts    int           `yaml:"max_attempts"`
+	IPMaxAttempts  int           `yaml:"ip_max_attempts"`
+	Window         time.Duration `yaml:"window"`
+	Lockout        time.Duration `yaml:"lockout"`
+	MaxLockout     time.Duration `yaml:"max_lockout"`
+	RegisterPerIP  int           `yaml:"register_per_ip"`
+	RegisterWindow time.Duration `yaml:"register_window"`
+	ResetPerIP     int           `yaml:"reset_per_ip"`
+	ResetPerUser   int           `yaml:"reset_per_user"`
+	ResetWindow    time.Duration `yaml:"reset_window"`
+}
+
+// PasswordConfig holds the rules new passwords must follow and how reset
+// tokens reach the user. CommonList is a file with one forbidden password
+// per line. Notifier is "log" or "file"; the file notifier appends to
+// NotifierFile.
+type PasswordConfig struct {
+	MinLength     int           `yaml:"min_length"`
+	RequireLower  bool          `yaml:"require_lower"`
+	RequireUpper  bool          `yaml:"require_upper"`
+	RequireDigit  bool          `yaml:"require_digit"`
+	RequireSymbol bool          `yaml:"require_symbol"`
+	CommonList    string        `yaml:"common_list"`
+	ResetTTL      time.Duration `yaml:"reset_ttl"`
+	Notifier      string        `yaml:"notifier"`
+	NotifierFile  string        `yaml:"notifier_file"`
+}
+
+// UsernameConfig holds the rules for usernames and display names.
+// ReservedList and ProfanityList are files with one word per line;
+// reserved words may not be used as a name, profane words may not appear
+// anywhere in a name or bio.
+type UsernameConfig struct {
+	MinLength     int    `yaml:"min_length"`
+	MaxLength     int    `yaml:"max_length"`
+	ReservedList  string `yaml:"reserved_list"`
+	ProfanityList string `yaml:"profanity_list"`
+}
+
+// ProtocolConfig sets the oldest client protocol version the server still
+// talks to. Raising MinVersion above 1 turns away clients that do not send
+// Hello. Messages of at least CompressThreshold bytes are compressed for
+// clients that support it; 0 turns compression off.
+type ProtocolConfig struct {
+	MinVersion        int `yaml:"min_version"`
+	CompressThreshold int `yaml:"compress_threshold"`
+}
+
 func (c *RedisConfig) Addr() string {
 	return fmt.Sprintf("%s:%d", c.Host, c.Port)
 }
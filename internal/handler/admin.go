@@ -0,0 +1,58 @@
+package handler
+
+import "game-server/internal/model"
+
+// AdminTarget is implemented by the TCP and WebSocket handlers so the admin
+// API can inspect and operate both transports. Room IDs are only unique per
+// transport.
+type AdminTarget interface {
+	Transport() string
+	AdminClients() []*AdminClientView
+	AdminRooms() []*AdminRoomView
+	AdminGames() []*AdminGameView
+	ForceEndGame(roomID, winner int64) error
+	DisconnectUser(userID int64, reason string) bool
+	SetUserRole(userID int64, role model.Role) bool
+	Announce(message string) int
+}
+
+type AdminClientView struct {
+	Transport   string     `json:"transport"`
+	UserID      int64      `json:"user_id"`
+	Username    string     `json:"username"`
+	Role        model.Role `json:"role"`
+	IdleSeconds int64      `json:"idle_seconds"`
+	Rooms       []int64    `json:"rooms"`
+}
+
+type AdminRoomView struct {
+	Transport string `json:"transport"`
+	*model.Room
+}
+
+type AdminGameView struct {
+	Transport      string  `json:"transport"`
+	RoomID         int64   `json:"room_id"`
+	Players        []int64 `json:"players"`
+	CurrentPlayer  int64   `json:"current_player"`
+	MoveCount      int     `json:"move_count"`
+	RuleSet        string  `json:"rule_set"`
+	Correspondence bool    `json:"correspondence"`
+	Board          [][]int `json:"board"`
+}
+
+func toAdminGameView(transport string, game *model.Game, room *model.Room) *AdminGameView {
+	view := &AdminGameView{
+		Transport:     transport,
+		RoomID:        game.RoomID,
+		Players:       game.Players,
+		CurrentPlayer: game.CurrentPlayer(),
+		MoveCount:     game.MoveCount,
+		RuleSet:       string(game.RuleSet),
+		Board:         game.GetBoardCopy(),
+	}
+	if room != nil {
+		view.Correspondence = room.IsCorrespondenceGame()
+	}
+	return view
+}
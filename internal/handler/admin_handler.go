@@ -0,0 +1,412 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"game-server/internal/model"
+	"game-server/internal/repository"
+	"game-server/internal/service"
+)
+
+const (
+	adminActorHeader = "X-Admin-Actor"
+	defaultAdminName = "admin"
+	maxAnnouncement  = 500
+)
+
+type AdminHandler struct {
+	adminService *service.AdminService
+	moderation   *service.ModerationService
+
+	mu      sync.RWMutex
+	targets []AdminTarget
+}
+
+type forceEndRequest struct {
+	WinnerID int64 `json:"winner_id"`
+}
+
+type kickRequest struct {
+	Reason string `json:"reason"`
+}
+
+type banRequest struct {
+	Reason          string `json:"reason"`
+	DurationMinutes int    `json:"duration_minutes"`
+}
+
+type sanctionRequest struct {
+	Kind            string `json:"kind"`
+	Reason          string `json:"reason"`
+	DurationMinutes int    `json:"duration_minutes"`
+}
+
+type roleRequest struct {
+	Role string `json:"role"`
+}
+
+type announceRequest struct {
+	Message string `json:"message"`
+}
+
+// NewAdminHandler serves the /admin API. Routes are expected to be wrapped
+// with Authenticator.Require for the permission each one needs.
+func NewAdminHandler() *AdminHandler {
+	return &AdminHandler{
+		adminService: service.NewAdminService(),
+		moderation:   service.NewModerationService(),
+	}
+}
+
+func (h *AdminHandler) AddTarget(t AdminTarget) {
+	h.mu.Lock()
+	h.targets = append(h.targets, t)
+	h.mu.Unlock()
+}
+
+func (h *AdminHandler) ListOnlineUsers(w http.ResponseWriter, r *http.Request) {
+	users := make([]*AdminClientView, 0)
+	for _, t := range h.allTargets() {
+		users = append(users, t.AdminClients()...)
+	}
+	writeJSON(w, http.StatusOK, "success", users)
+}
+
+func (h *AdminHandler) ListRooms(w http.ResponseWriter, r *http.Request) {
+	rooms := make([]*AdminRoomView, 0)
+	for _, t := range h.allTargets() {
+		rooms = append(rooms, t.AdminRooms()...)
+	}
+	writeJSON(w, http.StatusOK, "success", rooms)
+}
+
+func (h *AdminHandler) ListGames(w http.ResponseWriter, r *http.Request) {
+	games := make([]*AdminGameView, 0)
+	for _, t := range h.allTargets() {
+		games = append(games, t.AdminGames()...)
+	}
+	writeJSON(w, http.StatusOK, "success", games)
+}
+
+func (h *AdminHandler) ForceEndGame(w http.ResponseWriter, r *http.Request) {
+	target := h.target(r.PathValue("transport"))
+	if target == nil {
+		writeJSON(w, http.StatusNotFound, "unknown transport", nil)
+		return
+	}
+
+	roomID, err := strconv.ParseInt(r.PathValue("room_id"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, "invalid room id", nil)
+		return
+	}
+
+	var req forceEndRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, "invalid request body", nil)
+		return
+	}
+
+	err = target.ForceEndGame(roomID, req.WinnerID)
+	h.audit(r, model.AuditActionForceEndGame, fmt.Sprintf("%s:%d", target.Transport(), roomID), req, err)
+
+	switch {
+	case errors.Is(err, service.ErrGameNotFound):
+		writeJSON(w, http.StatusNotFound, err.Error(), nil)
+	case errors.Is(err, service.ErrWinnerNotInGame), errors.Is(err, model.ErrGameAlreadyOver):
+		writeJSON(w, http.StatusBadRequest, err.Error(), nil)
+	case err != nil:
+		writeJSON(w, http.StatusInternalServerError, err.Error(), nil)
+	default:
+		writeJSON(w, http.StatusOK, "game ended", nil)
+	}
+}
+
+func (h *AdminHandler) KickUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, "invalid user id", nil)
+		return
+	}
+
+	var req kickRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, "invalid request body", nil)
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "kicked by an administrator"
+	}
+	if !h.mayModerate(w, r, userID) {
+		return
+	}
+
+	kicked := h.disconnect(userID, req.Reason)
+	if kicked == 0 {
+		h.audit(r, model.AuditActionKickUser, strconv.FormatInt(userID, 10), req, service.ErrUserNotOnline)
+		writeJSON(w, http.StatusNotFound, service.ErrUserNotOnline.Error(), nil)
+		return
+	}
+	h.audit(r, model.AuditActionKickUser, strconv.FormatInt(userID, 10), req, nil)
+
+	writeJSON(w, http.StatusOK, "user kicked", map[string]int{"connections": kicked})
+}
+
+// BanUser bans the user, or suspends them when a duration is given, and
+// drops their connections.
+func (h *AdminHandler) BanUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, "invalid user id", nil)
+		return
+	}
+
+	var req banRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, "invalid request body", nil)
+		return
+	}
+
+	kind := model.SanctionBan
+	if req.DurationMinutes > 0 {
+		kind = model.SanctionSuspension
+	}
+	h.sanction(w, r, userID, kind, req.Reason, req.DurationMinutes, model.AuditActionBanUser, req)
+}
+
+func (h *AdminHandler) CreateSanction(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, "invalid user id", nil)
+		return
+	}
+
+	var req sanctionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, "invalid request body", nil)
+		return
+	}
+
+	h.sanction(w, r, userID, model.SanctionKind(req.Kind), req.Reason, req.DurationMinutes, model.AuditActionSanction, req)
+}
+
+func (h *AdminHandler) ListSanctions(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, "invalid user id", nil)
+		return
+	}
+
+	sanctions, err := h.moderation.List(userID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, "success", sanctions)
+}
+
+func (h *AdminHandler) RevokeSanction(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, "invalid sanction id", nil)
+		return
+	}
+
+	sanction, err := h.moderation.Get(id)
+	if err != nil {
+		h.audit(r, model.AuditActionRevoke, strconv.FormatInt(id, 10), nil, err)
+		if errors.Is(err, repository.ErrSanctionNotFound) {
+			writeJSON(w, http.StatusNotFound, err.Error(), nil)
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	if !h.mayModerate(w, r, sanction.UserID) {
+		return
+	}
+
+	err = h.moderation.Revoke(id)
+	h.audit(r, model.AuditActionRevoke, strconv.FormatInt(id, 10), nil, err)
+	if err != nil {
+		if errors.Is(err, repository.ErrSanctionNotFound) {
+			writeJSON(w, http.StatusNotFound, err.Error(), nil)
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, "sanction revoked", nil)
+}
+
+func (h *AdminHandler) sanction(w http.ResponseWriter, r *http.Request, userID int64, kind model.SanctionKind, reason string, minutes int, action string, req interface{}) {
+	if minutes < 0 {
+		writeJSON(w, http.StatusBadRequest, "invalid duration", nil)
+		return
+	}
+	if !h.mayModerate(w, r, userID) {
+		return
+	}
+
+	sanction, err := h.moderation.Sanction(userID, kind, reason, actor(r), time.Duration(minutes)*time.Minute)
+	h.audit(r, action, strconv.FormatInt(userID, 10), req, err)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrUserNotFound):
+			writeJSON(w, http.StatusNotFound, err.Error(), nil)
+		case errors.Is(err, model.ErrInvalidSanctionKind), errors.Is(err, model.ErrBanHasExpiry),
+			errors.Is(err, model.ErrSuspensionNoExpiry), errors.Is(err, model.ErrReasonTooLong):
+			writeJSON(w, http.StatusBadRequest, err.Error(), nil)
+		default:
+			writeJSON(w, http.StatusInternalServerError, err.Error(), nil)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, "sanction applied", sanction)
+}
+
+func (h *AdminHandler) SetRole(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, "invalid user id", nil)
+		return
+	}
+
+	var req roleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, "invalid request body", nil)
+		return
+	}
+
+	user, err := h.adminService.SetRole(userID, model.Role(req.Role))
+	h.audit(r, model.AuditActionSetRole, strconv.FormatInt(userID, 10), req, err)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrUserNotFound):
+			writeJSON(w, http.StatusNotFound, err.Error(), nil)
+		case errors.Is(err, model.ErrInvalidRole), errors.Is(err, service.ErrGuestRole):
+			writeJSON(w, http.StatusBadRequest, err.Error(), nil)
+		default:
+			writeJSON(w, http.StatusInternalServerError, err.Error(), nil)
+		}
+		return
+	}
+
+	for _, t := range h.allTargets() {
+		t.SetUserRole(userID, user.Role)
+	}
+
+	writeJSON(w, http.StatusOK, "role updated", user)
+}
+
+func (h *AdminHandler) Announce(w http.ResponseWriter, r *http.Request) {
+	var req announceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, "invalid request body", nil)
+		return
+	}
+
+	req.Message = strings.TrimSpace(req.Message)
+	if req.Message == "" || len([]rune(req.Message)) > maxAnnouncement {
+		writeJSON(w, http.StatusBadRequest, "message must be 1-500 characters", nil)
+		return
+	}
+
+	sent := 0
+	for _, t := range h.allTargets() {
+		sent += t.Announce(req.Message)
+	}
+	h.audit(r, model.AuditActionAnnounce, "", req, nil)
+
+	writeJSON(w, http.StatusOK, "announcement sent", map[string]int{"connections": sent})
+}
+
+func (h *AdminHandler) AuditLog(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+
+	entries, err := h.adminService.AuditLog(limit, offset)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, "success", entries)
+}
+
+// mayModerate stops moderators from kicking or sanctioning other staff;
+// only principals that can manage roles may do that. It writes the error
+// response itself.
+func (h *AdminHandler) mayModerate(w http.ResponseWriter, r *http.Request, userID int64) bool {
+	if p := PrincipalFrom(r.Context()); p != nil && p.Role.Can(model.PermManageRoles) {
+		return true
+	}
+
+	target, err := h.adminService.GetUser(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			writeJSON(w, http.StatusNotFound, err.Error(), nil)
+			return false
+		}
+		writeJSON(w, http.StatusInternalServerError, err.Error(), nil)
+		return false
+	}
+	if target.Role.Can(model.PermModerate) {
+		writeJSON(w, http.StatusForbidden, "cannot moderate staff accounts", nil)
+		return false
+	}
+	return true
+}
+
+func (h *AdminHandler) disconnect(userID int64, reason string) int {
+	count := 0
+	for _, t := range h.allTargets() {
+		if t.DisconnectUser(userID, reason) {
+			count++
+		}
+	}
+	return count
+}
+
+// audit records the action together with its request and, if it failed,
+// the error. A failed audit write is logged but does not undo the action.
+func (h *AdminHandler) audit(r *http.Request, action, target string, req interface{}, actionErr error) {
+	detail := map[string]interface{}{"request": req}
+	if actionErr != nil {
+		detail["error"] = actionErr.Error()
+	}
+
+	if err := h.adminService.Audit(actor(r), action, target, detail, r.RemoteAddr); err != nil {
+		log.Printf("Failed to write audit entry for %s: %v", action, err)
+	}
+}
+
+func (h *AdminHandler) allTargets() []AdminTarget {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return append([]AdminTarget(nil), h.targets...)
+}
+
+func (h *AdminHandler) target(transport string) AdminTarget {
+	for _, t := range h.allTargets() {
+		if t.Transport() == transport {
+			return t
+		}
+	}
+	return nil
+}
+
+func actor(r *http.Request) string {
+	if p := PrincipalFrom(r.Context()); p != nil {
+		return p.Username
+	}
+	return defaultAdminName
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"game-server/internal/model"
+	"game-server/internal/service"
+)
+
+// Principal is who an authenticated HTTP request acts as. Requests made
+// with the configured operator token have no UserID and act as an admin.
+type Principal struct {
+	UserID   int64
+	Username string
+	Role     model.Role
+
+	sessionID string
+}
+
+type principalKey struct{}
+
+// PrincipalFrom returns the principal stored by the Authenticator, or
+// nil for unauthenticated routes.
+func PrincipalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+type Authenticator struct {
+	sessions      *service.SessionService
+	operatorToken string
+}
+
+// NewAuthenticator accepts access tokens and, if operatorToken is not
+// empty, that static token as an admin credential for bootstrapping.
+func NewAuthenticator(operatorToken string) *Authenticator {
+	return &Authenticator{
+		sessions:      service.NewSessionService(),
+		operatorToken: operatorToken,
+	}
+}
+
+// Require lets a request through only if its bearer token is valid and its
+// role grants perm. The session is looked up, so a revoked session or a
+// changed role applies at once instead of when the access token expires.
+func (a *Authenticator) Require(perm model.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := a.authenticate(r)
+		if p != nil && p.UserID != 0 && !a.liveSession(p) {
+			p = nil
+		}
+		if p == nil {
+			writeJSON(w, http.StatusUnauthorized, "authentication required", nil)
+			return
+		}
+		if !p.Role.Can(perm) {
+			writeJSON(w, http.StatusForbidden, "permission denied", nil)
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	}
+}
+
+// RequireSession lets a request through only if its bearer token belongs to
+// a user session that still exists. The operator token is not accepted.
+func (a *Authenticator) RequireSession(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := a.authenticate(r)
+		if p == nil || p.UserID == 0 || !a.liveSession(p) {
+			writeJSON(w, http.StatusUnauthorized, "authentication required", nil)
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	}
+}
+
+// liveSession reports whether p's session has not been logged out, revoked
+// or replaced, and refreshes p.Username and p.Role from it.
+func (a *Authenticator) liveSession(p *Principal) bool {
+	sess, err := a.sessions.Get(p.sessionID)
+	if err != nil || sess.UserID != p.UserID {
+		return false
+	}
+	p.Username = sess.Username
+	p.Role = sess.Role
+	return true
+}
+
+// Identify attaches the principal of a valid bearer token, if the request
+// has one, and lets anonymous requests through. A token that is present
+// but invalid, or whose session is gone, is rejected so clients notice an
+// expired session.
+func (a *Authenticator) Identify(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next(w, r)
+			return
+		}
+
+		p := a.authenticate(r)
+		if p != nil && p.UserID != 0 && !a.liveSession(p) {
+			p = nil
+		}
+		if p == nil {
+			writeJSON(w, http.StatusUnauthorized, "invalid or expired token", nil)
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	}
+}
+
+func (a *Authenticator) authenticate(r *http.Request) *Principal {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return nil
+	}
+
+	if a.operatorToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.operatorToken)) == 1 {
+		name := strings.TrimSpace(r.Header.Get(adminActorHeader))
+		if name == "" {
+			name = defaultAdminName
+		}
+		return &Principal{Username: name, Role: model.RoleAdmin}
+	}
+
+	claims, err := service.VerifyAccessToken(token)
+	if err != nil {
+		return nil
+	}
+	return &Principal{UserID: claims.UserID, Username: claims.Username, Role: claims.Role, sessionID: claims.SessionID}
+}
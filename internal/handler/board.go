@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"game-server/internal/model"
+	"game-server/pkg/protocol"
+)
+
+// boardSnapshot is the whole board of game, sent where a client cannot
+// build it from deltas: on opening a game, on reconnecting and on BoardSync.
+func boardSnapshot(game *model.Game) *protocol.BoardUpdate {
+	return &protocol.BoardUpdate{
+		RoomID:        game.RoomID,
+		Board:         game.GetBoardCopy(),
+		LastX:         game.LastX,
+		LastY:         game.LastY,
+		LastPlayer:    game.LastPlayer(),
+		CurrentPlayer: game.CurrentPlayer(),
+		MoveNumber:    game.MoveCount,
+	}
+}
+
+// moveDelta describes move number moveNumber, the stone player put at x, y.
+func moveDelta(game *model.Game, moveNumber, x, y int, player int64) *protocol.BoardDelta {
+	return &protocol.BoardDelta{
+		RoomID:        game.RoomID,
+		MoveNumber:    moveNumber,
+		X:             x,
+		Y:             y,
+		Stone:         game.Board[x][y],
+		Player:        player,
+		CurrentPlayer: game.CurrentPlayer(),
+	}
+}
+
+// moveUpdate is delta as a full BoardUpdate, for clients without
+// FeatureDeltaBoard.
+func moveUpdate(game *model.Game, delta *protocol.BoardDelta) *protocol.BoardUpdate {
+	return &protocol.BoardUpdate{
+		RoomID:        delta.RoomID,
+		Board:         game.GetBoardCopy(),
+		LastX:         delta.X,
+		LastY:         delta.Y,
+		LastPlayer:    delta.Player,
+		CurrentPlayer: delta.CurrentPlayer,
+		MoveNumber:    delta.MoveNumber,
+	}
+}
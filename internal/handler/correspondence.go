@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"game-server/internal/model"
+	"game-server/pkg/protocol"
+)
+
+func toCorrespondenceInfo(g *model.CorrespondenceGame, userID, roomID int64) *protocol.CorrespondenceGameInfo {
+	return &protocol.CorrespondenceGameInfo{
+		GameID:      g.ID,
+		RoomID:      roomID,
+		Black:       g.BlackPlayerID,
+		White:       g.WhitePlayerID,
+		Opponent:    g.Opponent(userID),
+		DaysPerMove: g.DaysPerMove,
+		MoveCount:   g.MoveCount,
+		LastX:       g.LastX,
+		LastY:       g.LastY,
+		YourTurn:    g.IsActive() && g.CurrentPlayer == userID,
+		Deadline:    g.Deadline.Unix(),
+		Finished:    !g.IsActive(),
+		Winner:      g.WinnerID,
+	}
+}
@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"game-server/internal/config"
+	"game-server/pkg/protocol"
+)
+
+// codeUnsupportedVersion rejects a client whose protocol version the server
+// does not speak, as HTTP's Upgrade Required.
+const codeUnsupportedVersion = 426
+
+var (
+	minProtocolVersion atomic.Int32
+	compressThreshold  atomic.Int32
+)
+
+func init() {
+	minProtocolVersion.Store(protocol.ProtocolVersion1)
+}
+
+// SetProtocolPolicy sets the oldest protocol version clients may use and
+// the size from which messages are compressed.
+func SetProtocolPolicy(cfg config.ProtocolConfig) error {
+	v := cfg.MinVersion
+	if v == 0 {
+		v = protocol.ProtocolVersion1
+	}
+	if v < protocol.ProtocolVersion1 || v > protocol.ProtocolVersion {
+		return fmt.Errorf("protocol.min_version must be between %d and %d", protocol.ProtocolVersion1, protocol.ProtocolVersion)
+	}
+	if cfg.CompressThreshold < 0 || cfg.CompressThreshold > protocol.MaxBodyLen {
+		return fmt.Errorf("protocol.compress_threshold must be between 0 and %d", protocol.MaxBodyLen)
+	}
+	minProtocolVersion.Store(int32(v))
+	compressThreshold.Store(int32(cfg.CompressThreshold))
+	return nil
+}
+
+// shouldCompress reports whether a message of n bytes is worth
+// compressing.
+func shouldCompress(n int) bool {
+	threshold := int(compressThreshold.Load())
+	return threshold > 0 && n >= threshold
+}
+
+// serverFeatures are the Hello features this server implements on every
+// transport.
+var serverFeatures = []string{protocol.FeatureChat, protocol.FeatureDeltaBoard}
+
+// tcpFeatures adds what only applies where the server frames packets
+// itself.
+var tcpFeatures = append(append([]string(nil), serverFeatures...), protocol.FeatureCompression)
+
+// legacyFeatures are what a client that never sent Hello gets: everything
+// the protocol did before features could be negotiated.
+var legacyFeatures = map[string]bool{protocol.FeatureChat: true}
+
+// featureOf names the feature a pushed message type needs.
+var featureOf = map[uint16]string{
+	protocol.TypeChatMessage: protocol.FeatureChat,
+	protocol.TypeBoardDelta:  protocol.FeatureDeltaBoard,
+}
+
+// helloInfo is what a client told the server about itself in Hello.
+type helloInfo struct {
+	version       int
+	client        string
+	clientVersion string
+	features      map[string]bool
+}
+
+// connState is what one connection agreed on in Hello. Until then it uses
+// JSON and the version 1 protocol.
+type connState struct {
+	codec atomic.Pointer[protocol.Codec]
+	hello atomic.Pointer[helloInfo]
+
+	// features are the ones offered in Hello on this transport.
+	features []string
+
+	// writeMu serializes writes on transports whose connections allow
+	// only one writer at a time.
+	writeMu sync.Mutex
+}
+
+func newConnState(features []string) *connState {
+	s := &connState{features: features}
+	s.codec.Store(protocol.NewCodec())
+	return s
+}
+
+// legacyConn stands in for connections that are no longer tracked.
+var legacyConn = newConnState(nil)
+
+func (s *connState) Codec() *protocol.Codec {
+	return s.codec.Load()
+}
+
+func (s *connState) Version() int {
+	if info := s.hello.Load(); info != nil {
+		return info.version
+	}
+	return protocol.ProtocolVersion1
+}
+
+// Has reports whether the client supports feature.
+func (s *connState) Has(feature string) bool {
+	if info := s.hello.Load(); info != nil {
+		return info.features[feature]
+	}
+	return legacyFeatures[feature]
+}
+
+// Accepts reports whether a message of type t should be sent to the client
+// at all.
+func (s *connState) Accepts(t uint16) bool {
+	feature, ok := featureOf[t]
+	return !ok || s.Has(feature)
+}
+
+// needsHello reports whether the connection must send Hello before
+// anything else because version 1 clients are no longer accepted.
+func (s *connState) needsHello() bool {
+	return s.hello.Load() == nil && int(minProtocolVersion.Load()) > protocol.ProtocolVersion1
+}
+
+// negotiate answers Hello. Hello is only accepted once and before login,
+// while the client is not yet waiting on anything else; it is only called
+// from the connection's read loop. The returned codec is switched to after
+// the response has been sent and is nil when the request is rejected. A
+// response with codeUnsupportedVersion means the connection should be
+// closed.
+func (s *connState) negotiate(loggedIn bool, req *protocol.HelloReq) (*protocol.HelloResp, *protocol.Codec) {
+	minVersion := int(minProtocolVersion.Load())
+	resp := &protocol.HelloResp{
+		Version:    protocol.ProtocolVersion,
+		MinVersion: minVersion,
+		Codec:      s.Codec().Serializer().Name(),
+	}
+
+	switch {
+	case loggedIn:
+		resp.Code = 400
+		resp.Message = "hello must be sent before login"
+		return resp, nil
+	case s.hello.Load() != nil:
+		resp.Code = 400
+		resp.Message = "hello already sent"
+		return resp, nil
+	case req.Version < minVersion || req.Version > protocol.ProtocolVersion:
+		resp.Code = codeUnsupportedVersion
+		resp.Message = fmt.Sprintf("protocol version %d is not supported, server speaks %d-%d", req.Version, minVersion, protocol.ProtocolVersion)
+		return resp, nil
+	}
+
+	info := &helloInfo{
+		version:       req.Version,
+		client:        req.Client,
+		clientVersion: req.ClientVersion,
+		features:      make(map[string]bool),
+	}
+	threshold := int(compressThreshold.Load())
+	for _, f := range req.Features {
+		if f == protocol.FeatureCompression && threshold == 0 {
+			continue
+		}
+		for _, supported := range s.features {
+			if f == supported && !info.features[f] {
+				info.features[f] = true
+				resp.Features = append(resp.Features, f)
+			}
+		}
+	}
+	s.hello.Store(info)
+
+	serializer := protocol.NegotiateSerializer(req.Codecs)
+	codec := protocol.NewCodecWith(serializer)
+	if info.features[protocol.FeatureCompression] {
+		codec = codec.WithCompression(threshold)
+		resp.CompressThreshold = threshold
+	}
+	resp.Code = 200
+	resp.Message = "hello"
+	resp.Codec = serializer.Name()
+	return resp, codec
+}
+
+// helloRequired is the error sent to a connection that skipped Hello while
+// version 1 clients are turned away.
+func helloRequired() string {
+	return fmt.Sprintf("protocol version %d is not supported, send Hello with version %d-%d", protocol.ProtocolVersion1, minProtocolVersion.Load(), protocol.ProtocolVersion)
+}
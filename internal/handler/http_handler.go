@@ -2,20 +2,35 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"strconv"
 
 	"game-server/internal/model"
+	"game-server/internal/repository"
 	"game-server/internal/service"
+	"game-server/pkg/protocol"
 )
 
 type HTTPHandler struct {
-	userService *service.UserService
+	userService    *service.UserService
+	sessionService *service.SessionService
+	moderation     *service.ModerationService
+	tournaments    *service.TournamentService
+	janitor        *service.Janitor
+	health         *service.HealthService
 }
 
-func NewHTTPHandler() *HTTPHandler {
+func NewHTTPHandler(tournaments *service.TournamentService) *HTTPHandler {
 	return &HTTPHandler{
-		userService: service.NewUserService(),
+		userService:    service.NewUserService(),
+		sessionService: service.NewSessionService(),
+		moderation:     service.NewModerationService(),
+		tournaments:    tournaments,
+		health:         service.NewHealthService(0),
 	}
 }
 
@@ -31,8 +46,16 @@ func (h *HTTPHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	req.IP = hostOnly(r.RemoteAddr)
 	user, err := h.userService.Register(&req)
 	if err != nil {
+		if writeLockout(w, err) {
+			return
+		}
+		if passwordErrorCode(err) == 400 || profileErrorCode(err) == 400 {
+			h.writeResponse(w, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
 		h.writeResponse(w, http.StatusInternalServerError, err.Error(), nil)
 		return
 	}
@@ -47,18 +70,376 @@ func (h *HTTPHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, token, err := h.userService.Login(&req)
+	req.IP = hostOnly(r.RemoteAddr)
+	user, err := h.userService.Login(&req)
 	if err != nil {
+		var se *service.SanctionError
+		if errors.As(err, &se) {
+			h.writeResponse(w, http.StatusForbidden, err.Error(), se.Sanction)
+			return
+		}
+		if writeLockout(w, err) {
+			return
+		}
 		h.writeResponse(w, http.StatusUnauthorized, err.Error(), nil)
 		return
 	}
 
+	sess := &service.Session{
+		UserID:   user.ID,
+		Username: user.Username,
+		Role:     user.Role,
+		Device:   loginDevice(req.Device, "http"),
+		IP:       hostOnly(r.RemoteAddr),
+	}
+	pair, err := h.sessionService.Start(sess)
+	if err != nil {
+		h.writeResponse(w, http.StatusInternalServerError, "failed to create session", nil)
+		return
+	}
+	if _, err := h.sessionService.EnforcePolicy(sess, nil); err != nil {
+		log.Printf("Failed to end older sessions of user %d: %v", user.ID, err)
+	}
+
 	h.writeResponse(w, http.StatusOK, "login success", &model.UserLoginResponse{
-		Token: token,
-		User:  user,
+		Token:        pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		ExpiresIn:    pair.ExpiresIn,
+		User:         user,
+	})
+}
+
+type guestRequest struct {
+	Device string `json:"device"`
+}
+
+// GuestLogin creates a guest account and logs in to it. The body is
+// optional.
+func (h *HTTPHandler) GuestLogin(w http.ResponseWriter, r *http.Request) {
+	var req guestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.writeResponse(w, http.StatusBadRequest, "invalid request body", nil)
+		return
+	}
+
+	user, err := h.userService.CreateGuest(hostOnly(r.RemoteAddr))
+	if err != nil {
+		if writeLockout(w, err) {
+			return
+		}
+		log.Printf("Guest login failed: %v", err)
+		h.writeResponse(w, http.StatusInternalServerError, "failed to create guest account", nil)
+		return
+	}
+
+	pair, err := h.sessionService.Start(&service.Session{
+		UserID:   user.ID,
+		Username: user.Username,
+		Role:     user.Role,
+		Device:   loginDevice(req.Device, "http"),
+		IP:       hostOnly(r.RemoteAddr),
+	})
+	if err != nil {
+		h.writeResponse(w, http.StatusInternalServerError, "failed to create session", nil)
+		return
+	}
+
+	h.writeResponse(w, http.StatusOK, "guest login success", &model.UserLoginResponse{
+		Token:        pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		ExpiresIn:    pair.ExpiresIn,
+		User:         user,
+	})
+}
+
+// ClaimAccount turns the caller's guest account into a player account. The
+// answer carries a new access token with the claimed name.
+func (h *HTTPHandler) ClaimAccount(w http.ResponseWriter, r *http.Request) {
+	p := PrincipalFrom(r.Context())
+
+	var req model.ClaimAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeResponse(w, http.StatusBadRequest, "invalid request body", nil)
+		return
+	}
+
+	user, err := h.userService.ClaimGuest(p.UserID, &req)
+	if err != nil {
+		switch claimErrorCode(err) {
+		case 400:
+			h.writeResponse(w, http.StatusBadRequest, err.Error(), nil)
+		case 403:
+			h.writeResponse(w, http.StatusForbidden, err.Error(), nil)
+		case 409:
+			h.writeResponse(w, http.StatusConflict, err.Error(), nil)
+		default:
+			log.Printf("Claiming guest account %d failed: %v", p.UserID, err)
+			h.writeResponse(w, http.StatusInternalServerError, "failed to claim account", nil)
+		}
+		return
+	}
+
+	token, ttl, err := h.sessionService.Reissue(p.sessionID)
+	if err != nil {
+		h.writeResponse(w, http.StatusInternalServerError, "failed to issue token", nil)
+		return
+	}
+
+	h.writeResponse(w, http.StatusOK, "account claimed", &model.UserLoginResponse{
+		Token:     token,
+		ExpiresIn: int64(ttl.Seconds()),
+		User:      user,
+	})
+}
+
+// UpdateProfile changes the caller's display name, avatar, country or bio.
+func (h *HTTPHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	p := PrincipalFrom(r.Context())
+
+	var req model.UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeResponse(w, http.StatusBadRequest, "invalid request body", nil)
+		return
+	}
+
+	user, err := h.userService.UpdateProfile(p.UserID, &req)
+	if err != nil {
+		if profileErrorCode(err) == 400 {
+			h.writeResponse(w, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		log.Printf("Updating profile of user %d failed: %v", p.UserID, err)
+		h.writeResponse(w, http.StatusInternalServerError, "failed to update profile", nil)
+		return
+	}
+
+	h.writeResponse(w, http.StatusOK, "profile updated", user)
+}
+
+// ExportAccount sends everything stored about the caller as a JSON file.
+func (h *HTTPHandler) ExportAccount(w http.ResponseWriter, r *http.Request) {
+	p := PrincipalFrom(r.Context())
+
+	export, err := h.userService.ExportAccount(p.UserID)
+	if err != nil {
+		log.Printf("Exporting account %d failed: %v", p.UserID, err)
+		h.writeResponse(w, http.StatusInternalServerError, "failed to export account", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="account-%d.json"`, p.UserID))
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(export)
+}
+
+// DeleteAccount deletes the caller's account. Registered users confirm with
+// their password; guests send an empty body.
+func (h *HTTPHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	p := PrincipalFrom(r.Context())
+
+	var req model.DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.writeResponse(w, http.StatusBadRequest, "invalid request body", nil)
+		return
+	}
+	req.IP = hostOnly(r.RemoteAddr)
+
+	if err := h.userService.DeleteAccount(p.UserID, &req); err != nil {
+		if writeLockout(w, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, service.ErrInvalidPassword):
+			h.writeResponse(w, http.StatusUnauthorized, err.Error(), nil)
+		case errors.Is(err, repository.ErrUserNotFound):
+			h.writeResponse(w, http.StatusNotFound, err.Error(), nil)
+		default:
+			log.Printf("Deleting account %d failed: %v", p.UserID, err)
+			h.writeResponse(w, http.StatusInternalServerError, "failed to delete account", nil)
+		}
+		return
+	}
+
+	h.writeResponse(w, http.StatusOK, "account deleted", nil)
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshToken trades a refresh token for a new access and refresh token.
+// Each refresh token works once.
+func (h *HTTPHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		h.writeResponse(w, http.StatusBadRequest, "refresh_token is required", nil)
+		return
+	}
+
+	_, pair, err := h.sessionService.Rotate(req.RefreshToken)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if refreshErrorCode(err) == 401 {
+			code = http.StatusUnauthorized
+		}
+		h.writeResponse(w, code, err.Error(), nil)
+		return
+	}
+
+	h.writeResponse(w, http.StatusOK, "token refreshed", &model.TokenResponse{
+		Token:        pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		ExpiresIn:    pair.ExpiresIn,
 	})
 }
 
+type logoutRequest struct {
+	All bool `json:"all"`
+}
+
+// Logout ends the session of the bearer token, or every session of the user
+// with {"all": true}. Connections using those sessions are closed.
+func (h *HTTPHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	p := PrincipalFrom(r.Context())
+
+	var req logoutRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.writeResponse(w, http.StatusBadRequest, "invalid request body", nil)
+			return
+		}
+	}
+
+	revoked := 1
+	var err error
+	if req.All {
+		revoked, err = h.sessionService.RevokeAll(p.UserID, "", nil, sessionReasonLogoutAll)
+	} else {
+		err = h.sessionService.Revoke(p.sessionID, nil, sessionReasonLogout)
+		if errors.Is(err, service.ErrSessionNotFound) {
+			revoked, err = 0, nil
+		}
+	}
+	if err != nil {
+		h.writeResponse(w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	h.writeResponse(w, http.StatusOK, "logged out", map[string]int{"revoked": revoked})
+}
+
+func (h *HTTPHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	p := PrincipalFrom(r.Context())
+
+	sessions, err := h.sessionService.List(p.UserID)
+	if err != nil {
+		h.writeResponse(w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	h.writeResponse(w, http.StatusOK, "success", toSessionInfos(sessions, p.sessionID))
+}
+
+func (h *HTTPHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	p := PrincipalFrom(r.Context())
+
+	err := h.sessionService.RevokeOwn(p.UserID, r.PathValue("id"), sessionReasonRevoked)
+	if err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			h.writeResponse(w, http.StatusNotFound, err.Error(), nil)
+			return
+		}
+		h.writeResponse(w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	h.writeResponse(w, http.StatusOK, "session ended", nil)
+}
+
+// ChangePassword sets a new password for the bearer's account and ends the
+// user's other sessions.
+func (h *HTTPHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	p := PrincipalFrom(r.Context())
+
+	var req model.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeResponse(w, http.StatusBadRequest, "invalid request body", nil)
+		return
+	}
+	req.IP = hostOnly(r.RemoteAddr)
+
+	revoked, err := h.userService.ChangePassword(p.UserID, p.sessionID, nil, &req)
+	if err != nil {
+		if writeLockout(w, err) {
+			return
+		}
+		h.writePasswordError(w, err)
+		return
+	}
+
+	h.writeResponse(w, http.StatusOK, "password changed", map[string]int{"revoked": revoked})
+}
+
+// RequestPasswordReset sends a reset token through the configured notifier.
+// The answer is the same whether or not the account exists.
+func (h *HTTPHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	var req model.PasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
+		h.writeResponse(w, http.StatusBadRequest, "username is required", nil)
+		return
+	}
+
+	if err := h.userService.RequestPasswordReset(req.Username, hostOnly(r.RemoteAddr)); err != nil {
+		if writeLockout(w, err) {
+			return
+		}
+		log.Printf("Password reset request failed: %v", err)
+		h.writeResponse(w, http.StatusInternalServerError, "failed to send reset token", nil)
+		return
+	}
+
+	h.writeResponse(w, http.StatusOK, "if the account exists, a reset token has been sent", nil)
+}
+
+func (h *HTTPHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req model.PasswordResetConfirm
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		h.writeResponse(w, http.StatusBadRequest, "token and new_password are required", nil)
+		return
+	}
+
+	if err := h.userService.ResetPassword(&req); err != nil {
+		h.writePasswordError(w, err)
+		return
+	}
+
+	h.writeResponse(w, http.StatusOK, "password reset, please log in again", nil)
+}
+
+func (h *HTTPHandler) writePasswordError(w http.ResponseWriter, err error) {
+	switch passwordErrorCode(err) {
+	case 400:
+		h.writeResponse(w, http.StatusBadRequest, err.Error(), nil)
+	case 401:
+		h.writeResponse(w, http.StatusUnauthorized, err.Error(), nil)
+	default:
+		log.Printf("Password update failed: %v", err)
+		h.writeResponse(w, http.StatusInternalServerError, "failed to update password", nil)
+	}
+}
+
+// privateUser is what GET /api/user/{id} returns to the account owner.
+type privateUser struct {
+	*model.User
+	Permissions []model.Permission      `json:"permissions"`
+	Sanctions   []*model.Sanction       `json:"sanctions"`
+	Sessions    []*protocol.SessionInfo `json:"sessions"`
+}
+
+// GetUser returns the public profile. The owner, identified by a bearer
+// token, also gets their permissions, active sanctions and sessions.
 func (h *HTTPHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 	idStr := r.PathValue("id")
 	id, err := strconv.ParseInt(idStr, 10, 64)
@@ -73,10 +454,101 @@ func (h *HTTPHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.writeResponse(w, http.StatusOK, "success", user)
+	p := PrincipalFrom(r.Context())
+	if p == nil || p.UserID != user.ID {
+		h.writeResponse(w, http.StatusOK, "success", user)
+		return
+	}
+
+	sanctions, err := h.moderation.Active(user.ID)
+	if err != nil {
+		h.writeResponse(w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+	sessions, err := h.sessionService.List(user.ID)
+	if err != nil {
+		h.writeResponse(w, http.StatusInternalServerError, err.Error(), nil)
+		return
+	}
+
+	h.writeResponse(w, http.StatusOK, "success", &privateUser{
+		User:        user,
+		Permissions: user.Role.Permissions(),
+		Sanctions:   sanctions,
+		Sessions:    toSessionInfos(sessions, p.sessionID),
+	})
+}
+
+func (h *HTTPHandler) ListTournaments(w http.ResponseWriter, r *http.Request) {
+	tournaments := h.tournaments.ListTournaments()
+
+	list := make([]*model.Bracket, 0, len(tournaments))
+	for _, t := range tournaments {
+		bracket, err := h.tournaments.GetBracket(t.ID)
+		if err != nil {
+			continue
+		}
+		bracket.Rounds = nil
+		list = append(list, bracket)
+	}
+
+	h.writeResponse(w, http.StatusOK, "success", list)
+}
+
+func (h *HTTPHandler) GetTournamentBracket(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		h.writeResponse(w, http.StatusBadRequest, "invalid tournament id", nil)
+		return
+	}
+
+	bracket, err := h.tournaments.GetBracket(id)
+	if err != nil {
+		h.writeResponse(w, http.StatusNotFound, err.Error(), nil)
+		return
+	}
+
+	h.writeResponse(w, http.StatusOK, "success", bracket)
+}
+
+func (h *HTTPHandler) SetJanitor(j *service.Janitor) {
+	h.janitor = j
+}
+
+func (h *HTTPHandler) GetJanitorStats(w http.ResponseWriter, r *http.Request) {
+	if h.janitor == nil {
+		h.writeResponse(w, http.StatusNotFound, "janitor not running", nil)
+		return
+	}
+
+	h.writeResponse(w, http.StatusOK, "success", h.janitor.Stats())
+}
+
+// Healthz is the liveness probe. It reports dependency and drain state but
+// only fails when the process cannot answer, so a database outage does not
+// get the server restarted.
+func (h *HTTPHandler) Healthz(w http.ResponseWriter, r *http.Request) {
+	report := h.health.Check(r.Context())
+	h.writeResponse(w, http.StatusOK, report.Status, report)
+}
+
+// Readyz is the readiness probe: 503 while draining or while MySQL or Redis
+// is unreachable.
+func (h *HTTPHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	report := h.health.Check(r.Context())
+	if !report.Ready() {
+		h.writeResponse(w, http.StatusServiceUnavailable, report.Status, report)
+		return
+	}
+	h.writeResponse(w, http.StatusOK, report.Status, report)
 }
 
 func (h *HTTPHandler) writeResponse(w http.ResponseWriter, code int, message string, data interface{}) {
+	writeJSON(w, code, message, data)
+}
+
+func writeJSON(w http.ResponseWriter, code int, message string, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
 	json.NewEncoder(w).Encode(&model.UserResponse{
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"game-server/internal/service"
+	"game-server/pkg/protocol"
+)
+
+// lockoutResponse maps a *service.LockoutError to its response code and the
+// seconds the client has to wait. ok is false for any other error.
+func lockoutResponse(err error) (code int, retryAfter int64, ok bool) {
+	var le *service.LockoutError
+	if !errors.As(err, &le) {
+		return 0, 0, false
+	}
+
+	retryAfter = int64(math.Ceil(le.RetryAfter.Seconds()))
+	switch le.Scope {
+	case service.LockoutIP:
+		return protocol.CodeIPLocked, retryAfter, true
+	case service.LockoutRegister:
+		return protocol.CodeRegisterLimited, retryAfter, true
+	case service.LockoutReset:
+		return protocol.CodeResetLimited, retryAfter, true
+	default:
+		return protocol.CodeUsernameLocked, retryAfter, true
+	}
+}
+
+type lockoutInfo struct {
+	Code       int   `json:"code"`
+	RetryAfter int64 `json:"retry_after"`
+}
+
+// writeLockout answers an HTTP request rejected by the login limiter with
+// 429, a Retry-After header and the same code the socket transports use.
+// It reports false if err is not a lockout.
+func writeLockout(w http.ResponseWriter, err error) bool {
+	code, retryAfter, ok := lockoutResponse(err)
+	if !ok {
+		return false
+	}
+
+	w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+	writeJSON(w, http.StatusTooManyRequests, err.Error(), &lockoutInfo{Code: code, RetryAfter: retryAfter})
+	return true
+}
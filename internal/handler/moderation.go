@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"errors"
+
+	"game-server/internal/model"
+	"game-server/internal/service"
+	"game-server/pkg/protocol"
+)
+
+const MaxChatLength = 200
+
+// sanctionResponse maps a *service.SanctionError to its response code and
+// the details shown to the user.
+func sanctionResponse(err error) (int, *protocol.SanctionInfo, bool) {
+	var se *service.SanctionError
+	if !errors.As(err, &se) {
+		return 0, nil, false
+	}
+
+	info := &protocol.SanctionInfo{
+		Kind:   string(se.Sanction.Kind),
+		Reason: se.Sanction.Reason,
+	}
+	if se.Sanction.ExpiresAt != nil {
+		info.ExpiresAt = se.Sanction.ExpiresAt.Unix()
+	}
+
+	switch se.Sanction.Kind {
+	case model.SanctionBan:
+		return protocol.CodeAccountBanned, info, true
+	case model.SanctionSuspension:
+		return protocol.CodeAccountSuspended, info, true
+	default:
+		return protocol.CodeMuted, info, true
+	}
+}
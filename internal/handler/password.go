@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"errors"
+
+	"game-server/internal/repository"
+	"game-server/internal/service"
+)
+
+// passwordErrorCode maps a failed password change or reset to a response
+// code. Lockouts are handled separately by lockoutResponse.
+func passwordErrorCode(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidPassword), errors.Is(err, service.ErrResetTokenInvalid):
+		return 401
+	case errors.Is(err, service.ErrPasswordTooShort), errors.Is(err, service.ErrPasswordTooLong),
+		errors.Is(err, service.ErrPasswordWeak), errors.Is(err, service.ErrPasswordCommon),
+		errors.Is(err, service.ErrPasswordIsUsername), errors.Is(err, service.ErrSamePassword):
+		return 400
+	default:
+		return 500
+	}
+}
+
+// claimErrorCode maps a failed guest account claim to a response code.
+func claimErrorCode(err error) int {
+	if code := passwordErrorCode(err); code != 500 {
+		return code
+	}
+	switch {
+	case errors.Is(err, repository.ErrUserAlreadyExists):
+		return 409
+	case errors.Is(err, service.ErrNotGuest):
+		return 403
+	case profileErrorCode(err) == 400:
+		return 400
+	default:
+		return 500
+	}
+}
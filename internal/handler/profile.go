@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"errors"
+
+	"game-server/internal/model"
+	"game-server/internal/service"
+	"game-server/pkg/protocol"
+)
+
+// profileErrorCode maps a rejected username or profile field to a response
+// code.
+func profileErrorCode(err error) int {
+	switch {
+	case errors.Is(err, service.ErrUsernameRequired), errors.Is(err, service.ErrUsernameTooShort),
+		errors.Is(err, service.ErrUsernameTooLong), errors.Is(err, service.ErrUsernameInvalid),
+		errors.Is(err, service.ErrNameMixedScript), errors.Is(err, service.ErrNameReserved),
+		errors.Is(err, service.ErrProfanity), errors.Is(err, service.ErrDisplayNameTooLong),
+		errors.Is(err, service.ErrDisplayNameInvalid), errors.Is(err, service.ErrDisplayNameTaken),
+		errors.Is(err, service.ErrBioTooLong),
+		errors.Is(err, service.ErrBioInvalid), errors.Is(err, service.ErrInvalidCountry),
+		errors.Is(err, service.ErrInvalidAvatar), errors.Is(err, service.ErrEmptyProfileRequest):
+		return 400
+	default:
+		return 500
+	}
+}
+
+func profileInfo(user *model.User) *protocol.ProfileInfo {
+	return &protocol.ProfileInfo{
+		UserID:      user.ID,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		AvatarID:    user.AvatarID,
+		Country:     user.Country,
+		Bio:         user.Bio,
+	}
+}
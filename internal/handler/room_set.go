@@ -0,0 +1,82 @@
+package handler
+
+import "sync"
+
+const MaxRoomsPerUser = 10
+
+type RoomSet struct {
+	mu  sync.Mutex
+	ids []int64
+}
+
+func (s *RoomSet) Add(roomID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range s.ids {
+		if id == roomID {
+			return
+		}
+	}
+	s.ids = append(s.ids, roomID)
+}
+
+func (s *RoomSet) Remove(roomID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, id := range s.ids {
+		if id == roomID {
+			s.ids = append(s.ids[:i], s.ids[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *RoomSet) Has(roomID int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range s.ids {
+		if id == roomID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *RoomSet) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.ids)
+}
+
+func (s *RoomSet) List() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]int64, len(s.ids))
+	copy(ids, s.ids)
+	return ids
+}
+
+// Resolve picks the room a request refers to. Older clients send no room id,
+// which is accepted as long as the user sits in exactly one room.
+func (s *RoomSet) Resolve(roomID int64) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if roomID == 0 {
+		if len(s.ids) == 1 {
+			return s.ids[0], true
+		}
+		return 0, false
+	}
+
+	for _, id := range s.ids {
+		if id == roomID {
+			return id, true
+		}
+	}
+	return 0, false
+}
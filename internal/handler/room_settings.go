@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"game-server/internal/model"
+	"game-server/pkg/protocol"
+)
+
+func toRoomSettings(s model.RoomSettings) *protocol.RoomSettings {
+	return &protocol.RoomSettings{
+		RuleSet:       string(s.RuleSet),
+		BoardSize:     s.BoardSize,
+		MoveTimeLimit: s.MoveTimeLimit,
+		Rated:         s.Rated,
+		CreatorColor:  string(s.CreatorColor),
+	}
+}
+
+func fromRoomSettings(s protocol.RoomSettings) model.RoomSettings {
+	return model.RoomSettings{
+		RuleSet:       model.RuleSet(s.RuleSet),
+		BoardSize:     s.BoardSize,
+		MoveTimeLimit: s.MoveTimeLimit,
+		Rated:         s.Rated,
+		CreatorColor:  model.ColorPreference(s.CreatorColor),
+	}
+}
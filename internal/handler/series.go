@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"game-server/internal/model"
+	"game-server/pkg/protocol"
+)
+
+func toSeriesScore(room *model.Room) *protocol.SeriesScore {
+	wins := make([]int, len(room.Players))
+	for i, p := range room.Players {
+		wins[i] = room.SeriesWins[p]
+	}
+
+	players := make([]int64, len(room.Players))
+	copy(players, room.Players)
+
+	return &protocol.SeriesScore{
+		Players: players,
+		Wins:    wins,
+		Draws:   room.SeriesDraws,
+		Games:   room.SeriesGames,
+	}
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"errors"
+	"net"
+	"strings"
+
+	"game-server/internal/service"
+	"game-server/pkg/protocol"
+)
+
+const (
+	sessionReasonLogout    = "logged out"
+	sessionReasonLogoutAll = "logged out everywhere"
+	sessionReasonRevoked   = "session ended from another device"
+)
+
+// loginDevice is the label stored with a new session. Clients that do not
+// name themselves are listed by transport.
+func loginDevice(device, transport string) string {
+	if device = strings.TrimSpace(device); device != "" {
+		return device
+	}
+	return transport
+}
+
+func remoteIP(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return hostOnly(addr.String())
+}
+
+func hostOnly(hostport string) string {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return hostport
+	}
+	return host
+}
+
+func toSessionInfos(sessions []*service.Session, currentID string) []*protocol.SessionInfo {
+	infos := make([]*protocol.SessionInfo, 0, len(sessions))
+	for _, sess := range sessions {
+		infos = append(infos, &protocol.SessionInfo{
+			ID:        sess.ID,
+			Device:    sess.Device,
+			IP:        sess.IP,
+			CreatedAt: sess.CreatedAt,
+			Current:   sess.ID == currentID,
+		})
+	}
+	return infos
+}
+
+// refreshErrorCode maps a failed token refresh to a response code. An
+// unknown or reused refresh token means the client has to log in again.
+func refreshErrorCode(err error) int {
+	if errors.Is(err, service.ErrRefreshTokenInvalid) || errors.Is(err, service.ErrRefreshTokenReused) {
+		return 401
+	}
+	return 500
+}
@@ -1,14 +1,20 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
+	"game-server/internal/metrics"
 	"game-server/internal/model"
+	"game-server/internal/repository"
 	"game-server/internal/service"
 	"game-server/pkg/protocol"
 )
@@ -19,36 +25,101 @@ type TCPHandler struct {
 	roomService    *service.RoomService
 	gameService    *service.GameService
 	rankService    *service.RankService
-	codec          *protocol.Codec
-	clients        map[int64]*Client
+	tournaments    *service.TournamentService
+	corrService    *service.CorrespondenceService
+	moderation     *service.ModerationService
+	clients        map[int64][]*Client
 	mu             sync.RWMutex
 	seqCounter     uint64
+
+	conns  map[net.Conn]*connState
+	connMu sync.RWMutex
+	connWG sync.WaitGroup
 }
 
 type Client struct {
 	Conn       net.Conn
 	UserID     int64
-	Token      string
-	Username   string
+	SessionID  string
 	LastActive time.Time
-	RoomID     int64
+	Rooms      RoomSet
+
+	activeMu sync.Mutex
+	// identMu guards the fields that can change while connected.
+	identMu  sync.RWMutex
+	username string
+	role     model.Role
+}
+
+func (c *Client) Touch() {
+	c.activeMu.Lock()
+	c.LastActive = time.Now()
+	c.activeMu.Unlock()
+}
+
+func (c *Client) IdleFor() time.Duration {
+	c.activeMu.Lock()
+	defer c.activeMu.Unlock()
+	return time.Since(c.LastActive)
+}
+
+func (c *Client) Username() string {
+	c.identMu.RLock()
+	defer c.identMu.RUnlock()
+	return c.username
+}
+
+func (c *Client) SetUsername(name string) {
+	c.identMu.Lock()
+	c.username = name
+	c.identMu.Unlock()
+}
+
+func (c *Client) Role() model.Role {
+	c.identMu.RLock()
+	defer c.identMu.RUnlock()
+	return c.role
+}
+
+func (c *Client) SetRole(role model.Role) {
+	c.identMu.Lock()
+	c.role = role
+	c.identMu.Unlock()
+}
+
+func (c *Client) Can(p model.Permission) bool {
+	return c.Role().Can(p)
 }
 
-func NewTCPHandler() *TCPHandler {
-	return &TCPHandler{
+func NewTCPHandler(tournaments *service.TournamentService) *TCPHandler {
+	h := &TCPHandler{
 		userService:    service.NewUserService(),
 		sessionService: service.NewSessionService(),
 		roomService:    service.NewRoomService(),
 		gameService:    service.NewGameService(),
 		rankService:    service.NewRankService(),
-		codec:          protocol.NewCodec(),
-		clients:        make(map[int64]*Client),
+		tournaments:    tournaments,
+		corrService:    service.NewCorrespondenceService(),
+		moderation:     service.NewModerationService(),
+		clients:        make(map[int64][]*Client),
+		conns:          make(map[net.Conn]*connState),
 	}
+	tournaments.Subscribe(h.onTournamentEvent)
+	service.SubscribeSessionEvents(h.onSessionEvent)
+	service.SubscribeAccountEvents(h.onAccountEvent)
+	metrics.RegisterSource(metrics.TransportTCP, h)
+	return h
 }
 
 func (h *TCPHandler) HandleConn(conn net.Conn) {
 	defer conn.Close()
 
+	state, ok := h.trackConn(conn)
+	if !ok {
+		return
+	}
+	defer h.untrackConn(conn)
+
 	log.Printf("New connection from %s", conn.RemoteAddr())
 
 	var client *Client
@@ -58,33 +129,61 @@ func (h *TCPHandler) HandleConn(conn net.Conn) {
 		if err != nil {
 			log.Printf("Read packet error: %v", err)
 			if client != nil {
-				h.RemoveClient(client.UserID)
-				h.sessionService.SetUserOffline(client.UserID)
-				if client.RoomID != 0 {
-					h.handleDisconnect(client)
-				}
+				h.dropClient(client)
 			}
 			return
 		}
 
-		msg, err := h.codec.Decode(pkt)
+		metrics.PacketsIn.WithLabelValues(metrics.TransportTCP, protocol.TypeName(pkt.Type)).Inc()
+
+		msg, err := state.Codec().Decode(pkt)
 		if err != nil {
 			log.Printf("Decode error: %v", err)
+			metrics.DecodeErrors.WithLabelValues(metrics.TransportTCP).Inc()
 			h.sendError(conn, pkt.Seq, 400, err.Error())
 			continue
 		}
 
+		if _, ok := msg.(*protocol.HelloReq); !ok && state.needsHello() {
+			h.sendError(conn, pkt.Seq, codeUnsupportedVersion, helloRequired())
+			return
+		}
+
 		if client != nil {
-			client.LastActive = time.Now()
+			client.Touch()
 		}
 
 		switch m := msg.(type) {
 		case *protocol.PingReq:
 			h.handlePing(conn, pkt.Seq, client)
+		case *protocol.HelloReq:
+			if !h.handleHello(conn, pkt.Seq, client, state, m) {
+				return
+			}
 		case *protocol.LoginReq:
+			if client != nil {
+				h.sendError(conn, pkt.Seq, 400, "already logged in")
+				continue
+			}
 			client = h.handleLogin(conn, pkt.Seq, m)
+		case *protocol.GuestLoginReq:
+			if client != nil {
+				h.sendError(conn, pkt.Seq, 400, "already logged in")
+				continue
+			}
+			client = h.handleGuestLogin(conn, pkt.Seq, m)
+		case *protocol.LogoutReq:
+			if client == nil {
+				h.sendError(conn, pkt.Seq, 401, "please login first")
+				continue
+			}
+			if h.handleLogout(conn, pkt.Seq, client, m) {
+				client = nil
+			}
 		case *protocol.RegisterReq:
 			h.handleRegister(conn, pkt.Seq, m)
+		case *protocol.RefreshTokenReq:
+			h.handleRefreshToken(conn, pkt.Seq, m)
 		default:
 			if client == nil {
 				h.sendError(conn, pkt.Seq, 401, "please login first")
@@ -109,10 +208,48 @@ func (h *TCPHandler) handleAuthMessage(conn net.Conn, seq uint16, client *Client
 		h.handleMove(conn, seq, client, m)
 	case *protocol.ForfeitReq:
 		h.handleForfeit(conn, seq, client, m)
+	case *protocol.BoardSyncReq:
+		h.handleBoardSync(conn, seq, client, m)
+	case *protocol.RoomSettingsReq:
+		h.handleRoomSettings(conn, seq, client, m)
+	case *protocol.ReadyReq:
+		h.handleReady(conn, seq, client, m)
+	case *protocol.KickPlayerReq:
+		h.handleKickPlayer(conn, seq, client, m)
+	case *protocol.LockRoomReq:
+		h.handleLockRoom(conn, seq, client, m)
+	case *protocol.SessionListReq:
+		h.handleSessionList(conn, seq, client, m)
+	case *protocol.ChangePasswordReq:
+		h.handleChangePassword(conn, seq, client, m)
+	case *protocol.ClaimAccountReq:
+		h.handleClaimAccount(conn, seq, client, m)
+	case *protocol.UpdateProfileReq:
+		h.handleUpdateProfile(conn, seq, client, m)
+	case *protocol.ChatReq:
+		h.handleChat(conn, seq, client, m)
+	case *protocol.RematchRequest:
+		h.handleRematchRequest(conn, seq, client, m)
+	case *protocol.RematchAccept:
+		h.handleRematchAccept(conn, seq, client, m)
+	case *protocol.CorrespondenceListReq:
+		h.handleCorrespondenceList(conn, seq, client, m)
+	case *protocol.CorrespondenceOpenReq:
+		h.handleCorrespondenceOpen(conn, seq, client, m)
 	case *protocol.LeaderboardReq:
 		h.handleLeaderboard(conn, seq, client, m)
 	case *protocol.UserStatsReq:
 		h.handleUserStats(conn, seq, client, m)
+	case *protocol.TournamentCreateReq:
+		h.handleTournamentCreate(conn, seq, client, m)
+	case *protocol.TournamentJoinReq:
+		h.handleTournamentJoin(conn, seq, client, m)
+	case *protocol.TournamentStartReq:
+		h.handleTournamentStart(conn, seq, client, m)
+	case *protocol.TournamentBracketReq:
+		h.handleTournamentBracket(conn, seq, client, m)
+	case *protocol.TournamentCheckInReq:
+		h.handleTournamentCheckIn(conn, seq, client, m)
 	default:
 		log.Printf("Unhandled message type: %T", m)
 		h.sendError(conn, seq, 400, "unknown message type")
@@ -120,8 +257,8 @@ func (h *TCPHandler) handleAuthMessage(conn net.Conn, seq uint16, client *Client
 }
 
 func (h *TCPHandler) handlePing(conn net.Conn, seq uint16, client *Client) {
-	if client != nil && client.Token != "" {
-		h.sessionService.Refresh(client.Token)
+	if client != nil && client.SessionID != "" {
+		h.sessionService.Refresh(client.SessionID, client.UserID)
 	}
 	resp := &protocol.PongResp{}
 	h.sendMessage(conn, seq, resp)
@@ -131,7 +268,7 @@ func (h *TCPHandler) handleLogin(conn net.Conn, seq uint16, req *protocol.LoginR
 	resp := &protocol.LoginResp{}
 
 	if req.Token != "" {
-		sess, err := h.sessionService.Validate(req.Token)
+		claims, err := service.VerifyAccessToken(req.Token)
 		if err != nil {
 			resp.Code = 401
 			resp.Message = "invalid or expired token"
@@ -139,41 +276,83 @@ func (h *TCPHandler) handleLogin(conn net.Conn, seq uint16, req *protocol.LoginR
 			return nil
 		}
 
+		if err := h.moderation.CheckLogin(claims.UserID); err != nil {
+			resp.Code = 500
+			resp.Message = "failed to check account status"
+			if code, info, ok := sanctionResponse(err); ok {
+				resp.Code = code
+				resp.Message = err.Error()
+				resp.Sanction = info
+				h.sessionService.Delete(claims.SessionID)
+			}
+			h.sendMessage(conn, seq, resp)
+			return nil
+		}
+
+		// The token outlives a logout or revocation, the session does not.
+		sess, err := h.sessionService.Get(claims.SessionID)
+		if err != nil || sess.UserID != claims.UserID {
+			resp.Code = 401
+			resp.Message = "session expired or revoked"
+			h.sendMessage(conn, seq, resp)
+			return nil
+		}
+
 		resp.Code = 200
 		resp.Message = "login success via token"
-		resp.Token = sess.Token
-		resp.UserID = sess.UserID
+		resp.Token = req.Token
+		resp.UserID = claims.UserID
+		resp.Role = string(sess.Role)
 
 		client := &Client{
 			Conn:       conn,
-			UserID:     sess.UserID,
-			Token:      sess.Token,
-			Username:   sess.Username,
+			UserID:     claims.UserID,
+			SessionID:  claims.SessionID,
+			username:   sess.Username,
 			LastActive: time.Now(),
+			role:       sess.Role,
 		}
 
-		h.mu.Lock()
-		h.clients[sess.UserID] = client
-		h.mu.Unlock()
+		h.addClient(client)
 
-		h.sessionService.SetUserOnline(sess.UserID, sess.Token)
+		h.sessionService.SetUserOnline(claims.UserID, claims.SessionID)
 		h.sendMessage(conn, seq, resp)
-		log.Printf("User %d logged in via token", sess.UserID)
+		h.enforceSessionPolicy(client)
+		h.sendBoardSnapshots(conn, client)
+		h.notifyCorrespondenceTurn(conn, claims.UserID)
+		log.Printf("User %d logged in via token", claims.UserID)
 		return client
 	}
 
-	user, token, err := h.userService.Login(&model.UserLoginRequest{
+	user, err := h.userService.Login(&model.UserLoginRequest{
 		Username: req.Username,
 		Password: req.Password,
+		IP:       remoteIP(conn.RemoteAddr()),
 	})
 	if err != nil {
 		resp.Code = 401
 		resp.Message = err.Error()
+		if code, info, ok := sanctionResponse(err); ok {
+			resp.Code = code
+			resp.Sanction = info
+		}
+		if code, retryAfter, ok := lockoutResponse(err); ok {
+			resp.Code = code
+			resp.RetryAfter = retryAfter
+		}
 		h.sendMessage(conn, seq, resp)
 		return nil
 	}
 
-	if err := h.sessionService.Create(user.ID, user.Username, token); err != nil {
+	sess := &service.Session{
+		UserID:   user.ID,
+		Username: user.Username,
+		Role:     user.Role,
+		Device:   loginDevice(req.Device, metrics.TransportTCP),
+		IP:       remoteIP(conn.RemoteAddr()),
+	}
+	pair, err := h.sessionService.Start(sess)
+	if err != nil {
 		resp.Code = 500
 		resp.Message = "failed to create session"
 		h.sendMessage(conn, seq, resp)
@@ -182,37 +361,105 @@ func (h *TCPHandler) handleLogin(conn net.Conn, seq uint16, req *protocol.LoginR
 
 	resp.Code = 200
 	resp.Message = "login success"
-	resp.Token = token
+	resp.Token = pair.AccessToken
+	resp.RefreshToken = pair.RefreshToken
+	resp.ExpiresIn = pair.ExpiresIn
 	resp.UserID = user.ID
+	resp.Role = string(user.Role)
 
 	client := &Client{
 		Conn:       conn,
 		UserID:     user.ID,
-		Token:      token,
-		Username:   user.Username,
+		SessionID:  sess.ID,
+		username:   user.Username,
 		LastActive: time.Now(),
+		role:       user.Role,
 	}
 
-	h.mu.Lock()
-	h.clients[user.ID] = client
-	h.mu.Unlock()
+	h.addClient(client)
 
-	h.sessionService.SetUserOnline(user.ID, token)
+	h.sessionService.SetUserOnline(user.ID, sess.ID)
 	h.sendMessage(conn, seq, resp)
+	h.enforceSessionPolicy(client)
+	h.sendBoardSnapshots(conn, client)
+	h.notifyCorrespondenceTurn(conn, user.ID)
 	log.Printf("User %d logged in", user.ID)
 	return client
 }
 
+// handleGuestLogin creates a guest account and logs the connection in to it.
+func (h *TCPHandler) handleGuestLogin(conn net.Conn, seq uint16, req *protocol.GuestLoginReq) *Client {
+	resp := &protocol.GuestLoginResp{}
+
+	user, err := h.userService.CreateGuest(remoteIP(conn.RemoteAddr()))
+	if err != nil {
+		resp.Code = 500
+		resp.Message = "failed to create guest account"
+		if code, retryAfter, ok := lockoutResponse(err); ok {
+			resp.Code = code
+			resp.Message = err.Error()
+			resp.RetryAfter = retryAfter
+		}
+		h.sendMessage(conn, seq, resp)
+		return nil
+	}
+
+	sess := &service.Session{
+		UserID:   user.ID,
+		Username: user.Username,
+		Role:     user.Role,
+		Device:   loginDevice(req.Device, metrics.TransportTCP),
+		IP:       remoteIP(conn.RemoteAddr()),
+	}
+	pair, err := h.sessionService.Start(sess)
+	if err != nil {
+		resp.Code = 500
+		resp.Message = "failed to create session"
+		h.sendMessage(conn, seq, resp)
+		return nil
+	}
+
+	resp.Code = 200
+	resp.Message = "guest login success"
+	resp.Token = pair.AccessToken
+	resp.RefreshToken = pair.RefreshToken
+	resp.ExpiresIn = pair.ExpiresIn
+	resp.UserID = user.ID
+	resp.Username = user.Username
+	resp.Role = string(user.Role)
+
+	client := &Client{
+		Conn:       conn,
+		UserID:     user.ID,
+		SessionID:  sess.ID,
+		username:   user.Username,
+		LastActive: time.Now(),
+		role:       user.Role,
+	}
+
+	h.addClient(client)
+
+	h.sessionService.SetUserOnline(user.ID, sess.ID)
+	h.sendMessage(conn, seq, resp)
+	log.Printf("Guest %d (%s) logged in", user.ID, user.Username)
+	return client
+}
+
 func (h *TCPHandler) handleRegister(conn net.Conn, seq uint16, req *protocol.RegisterReq) {
 	resp := &protocol.RegisterResp{}
 
 	user, err := h.userService.Register(&model.UserRegisterRequest{
 		Username: req.Username,
 		Password: req.Password,
+		IP:       remoteIP(conn.RemoteAddr()),
 	})
 	if err != nil {
 		resp.Code = 400
 		resp.Message = err.Error()
+		if code, retryAfter, ok := lockoutResponse(err); ok {
+			resp.Code = code
+			resp.RetryAfter = retryAfter
+		}
 		h.sendMessage(conn, seq, resp)
 		return
 	}
@@ -225,8 +472,47 @@ func (h *TCPHandler) handleRegister(conn net.Conn, seq uint16, req *protocol.Reg
 	log.Printf("User %d registered", user.ID)
 }
 
+func (h *TCPHandler) handleRefreshToken(conn net.Conn, seq uint16, req *protocol.RefreshTokenReq) {
+	resp := &protocol.RefreshTokenResp{}
+
+	_, pair, err := h.sessionService.Rotate(req.RefreshToken)
+	if err != nil {
+		resp.Code = refreshErrorCode(err)
+		resp.Message = err.Error()
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "token refreshed"
+	resp.AccessToken = pair.AccessToken
+	resp.RefreshToken = pair.RefreshToken
+	resp.ExpiresIn = pair.ExpiresIn
+	h.sendMessage(conn, seq, resp)
+}
+
+// handleHello reports false when the client's protocol version is refused
+// and the connection should be closed.
+func (h *TCPHandler) handleHello(conn net.Conn, seq uint16, client *Client, state *connState, req *protocol.HelloReq) bool {
+	resp, codec := state.negotiate(client != nil, req)
+	h.sendMessage(conn, seq, resp)
+	if codec == nil {
+		return resp.Code != codeUnsupportedVersion
+	}
+	state.codec.Store(codec)
+	metrics.Handshakes.WithLabelValues(metrics.TransportTCP, resp.Codec).Inc()
+	log.Printf("Hello from %s: %s %s, protocol %d, codec %s, features %v",
+		conn.RemoteAddr(), req.Client, req.ClientVersion, req.Version, resp.Codec, resp.Features)
+	return true
+}
+
 func (h *TCPHandler) sendMessage(conn net.Conn, seq uint16, msg protocol.Message) {
-	data, err := h.codec.Encode(msg, seq)
+	state := h.stateOf(conn)
+	if !state.Accepts(msg.MessageType()) {
+		return
+	}
+
+	data, err := state.Codec().Encode(msg, seq)
 	if err != nil {
 		log.Printf("Encode error: %v", err)
 		return
@@ -234,7 +520,9 @@ func (h *TCPHandler) sendMessage(conn net.Conn, seq uint16, msg protocol.Message
 
 	if _, err := conn.Write(data); err != nil {
 		log.Printf("Write error: %v", err)
+		return
 	}
+	metrics.PacketsOut.WithLabelValues(metrics.TransportTCP, protocol.TypeName(msg.MessageType())).Inc()
 }
 
 func (h *TCPHandler) sendError(conn net.Conn, seq uint16, code int, message string) {
@@ -249,16 +537,69 @@ func (h *TCPHandler) nextSeq() uint16 {
 	return uint16(atomic.AddUint64(&h.seqCounter, 1))
 }
 
-func (h *TCPHandler) RemoveClient(userID int64) {
+// addClient registers a logged-in connection. Under the single-session
+// policy the rooms of the user's older connections move to the new one, so
+// their games continue there once the old connections are closed.
+func (h *TCPHandler) addClient(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if service.CurrentSessionPolicy() == service.SessionPolicySingle {
+		for _, old := range h.clients[client.UserID] {
+			for _, roomID := range old.Rooms.List() {
+				old.Rooms.Remove(roomID)
+				client.Rooms.Add(roomID)
+			}
+		}
+	}
+	h.clients[client.UserID] = append(h.clients[client.UserID], client)
+}
+
+// RemoveClient forgets one connection of a user. It reports whether that was
+// the user's last connection on this transport.
+func (h *TCPHandler) RemoveClient(client *Client) bool {
 	h.mu.Lock()
-	delete(h.clients, userID)
-	h.mu.Unlock()
+	defer h.mu.Unlock()
+
+	clients := h.clients[client.UserID]
+	for i, c := range clients {
+		if c == client {
+			clients = append(clients[:i:i], clients[i+1:]...)
+			break
+		}
+	}
+	if len(clients) == 0 {
+		delete(h.clients, client.UserID)
+		return true
+	}
+	h.clients[client.UserID] = clients
+	return false
+}
+
+// dropClient forgets a logged-in connection and leaves the rooms it joined.
+func (h *TCPHandler) dropClient(client *Client) {
+	if h.RemoveClient(client) {
+		h.sessionService.SetUserOffline(client.UserID, client.SessionID)
+	}
+	h.handleDisconnect(client)
 }
 
+// GetClient returns the user's most recent connection.
 func (h *TCPHandler) GetClient(userID int64) *Client {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-	return h.clients[userID]
+
+	clients := h.clients[userID]
+	if len(clients) == 0 {
+		return nil
+	}
+	return clients[len(clients)-1]
+}
+
+func (h *TCPHandler) clientsOf(userID int64) []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return append([]*Client(nil), h.clients[userID]...)
 }
 
 func (h *TCPHandler) GetOnlineUsers() []int64 {
@@ -272,22 +613,54 @@ func (h *TCPHandler) GetOnlineUsers() []int64 {
 	return users
 }
 
+func (h *TCPHandler) ClientCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	n := 0
+	for _, clients := range h.clients {
+		n += len(clients)
+	}
+	return n
+}
+
+func (h *TCPHandler) RoomCount() int {
+	return len(h.roomService.ListRooms())
+}
+
+func (h *TCPHandler) GameCount() int {
+	return len(h.gameService.RoomIDs())
+}
+
 func (h *TCPHandler) handleCreateRoom(conn net.Conn, seq uint16, client *Client, req *protocol.CreateRoomReq) {
 	resp := &protocol.CreateRoomResp{}
 
-	if client.RoomID != 0 {
+	if service.IsDraining() {
+		resp.Code = 503
+		resp.Message = service.ErrServerDraining.Error()
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	if client.Rooms.Len() >= MaxRoomsPerUser {
 		resp.Code = 400
-		resp.Message = "already in a room, please leave first"
+		resp.Message = "too many rooms, please leave one first"
 		h.sendMessage(conn, seq, resp)
 		return
 	}
 
 	roomName := req.RoomName
 	if roomName == "" {
-		roomName = client.Username + "'s room"
+		roomName = client.Username() + "'s room"
 	}
 
-	room, err := h.roomService.CreateRoom(roomName, client.UserID)
+	var room *model.Room
+	var err error
+	if req.Correspondence {
+		room, err = h.roomService.CreateCorrespondenceRoom(roomName, client.UserID, service.NormalizeDaysPerMove(req.DaysPerMove))
+	} else {
+		room, err = h.roomService.CreateRoom(roomName, client.UserID)
+	}
 	if err != nil {
 		resp.Code = 500
 		resp.Message = err.Error()
@@ -295,7 +668,11 @@ func (h *TCPHandler) handleCreateRoom(conn net.Conn, seq uint16, client *Client,
 		return
 	}
 
-	client.RoomID = room.ID
+	if !client.Can(model.PermRanked) {
+		h.roomService.MakeCasual(room.ID)
+	}
+
+	client.Rooms.Add(room.ID)
 
 	resp.Code = 200
 	resp.Message = "room created"
@@ -308,9 +685,16 @@ func (h *TCPHandler) handleCreateRoom(conn net.Conn, seq uint16, client *Client,
 func (h *TCPHandler) handleJoinRoom(conn net.Conn, seq uint16, client *Client, req *protocol.JoinRoomReq) {
 	resp := &protocol.JoinRoomResp{}
 
-	if client.RoomID != 0 {
+	if client.Rooms.Has(req.RoomID) {
+		resp.Code = 400
+		resp.Message = "already in this room"
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	if client.Rooms.Len() >= MaxRoomsPerUser {
 		resp.Code = 400
-		resp.Message = "already in a room, please leave first"
+		resp.Message = "too many rooms, please leave one first"
 		h.sendMessage(conn, seq, resp)
 		return
 	}
@@ -323,14 +707,28 @@ func (h *TCPHandler) handleJoinRoom(conn net.Conn, seq uint16, client *Client, r
 		return
 	}
 
-	if err := h.roomService.JoinRoom(req.RoomID, client.UserID); err != nil {
+	if room.IsTournament() {
+		resp.Code = 403
+		resp.Message = "tournament rooms can only be entered by checking in"
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	join := h.roomService.JoinRoom
+	if !client.Can(model.PermRanked) {
+		join = h.roomService.JoinRoomCasual
+	}
+	if err := join(req.RoomID, client.UserID); err != nil {
 		resp.Code = 400
+		if errors.Is(err, service.ErrRoomRated) {
+			resp.Code = 403
+		}
 		resp.Message = err.Error()
 		h.sendMessage(conn, seq, resp)
 		return
 	}
 
-	client.RoomID = room.ID
+	client.Rooms.Add(room.ID)
 
 	resp.Code = 200
 	resp.Message = "joined room"
@@ -341,32 +739,35 @@ func (h *TCPHandler) handleJoinRoom(conn net.Conn, seq uint16, client *Client, r
 	h.broadcastToRoom(room.ID, &protocol.PlayerJoin{
 		RoomID:   room.ID,
 		UserID:   client.UserID,
-		Username: client.Username,
+		Username: client.Username(),
 	}, client.UserID)
 
 	log.Printf("User %d joined room %d", client.UserID, room.ID)
-
-	room, _ = h.roomService.GetRoom(room.ID)
-	if room != nil && room.IsFull() {
-		h.startGame(room)
-	}
 }
 
 func (h *TCPHandler) handleLeaveRoom(conn net.Conn, seq uint16, client *Client, req *protocol.LeaveRoomReq) {
 	resp := &protocol.LeaveRoomResp{}
 
-	if client.RoomID == 0 {
+	roomID, ok := client.Rooms.Resolve(req.RoomID)
+	if !ok {
 		resp.Code = 400
-		resp.Message = "not in any room"
+		resp.Message = "not in this room"
 		h.sendMessage(conn, seq, resp)
 		return
 	}
 
-	roomID := client.RoomID
-
-	_, err := h.roomService.GetRoom(roomID)
+	room, err := h.roomService.GetRoom(roomID)
+	if err == nil && room.IsCorrespondenceGame() {
+		if game, _ := h.gameService.GetGame(roomID); game != nil && !game.IsFinished() {
+			client.Rooms.Remove(roomID)
+			resp.Code = 200
+			resp.Message = "left room, correspondence game continues"
+			h.sendMessage(conn, seq, resp)
+			return
+		}
+	}
 	if err != nil {
-		client.RoomID = 0
+		client.Rooms.Remove(roomID)
 		resp.Code = 200
 		resp.Message = "left room"
 		h.sendMessage(conn, seq, resp)
@@ -379,6 +780,7 @@ func (h *TCPHandler) handleLeaveRoom(conn net.Conn, seq uint16, client *Client,
 		Reason: "player left",
 	}, 0)
 
+	owner := room.CreatorID
 	if err := h.roomService.LeaveRoom(roomID, client.UserID); err != nil {
 		resp.Code = 400
 		resp.Message = err.Error()
@@ -386,7 +788,8 @@ func (h *TCPHandler) handleLeaveRoom(conn net.Conn, seq uint16, client *Client,
 		return
 	}
 
-	client.RoomID = 0
+	client.Rooms.Remove(roomID)
+	h.announceOwner(roomID, owner)
 
 	resp.Code = 200
 	resp.Message = "left room"
@@ -403,11 +806,16 @@ func (h *TCPHandler) handleRoomList(conn net.Conn, seq uint16, client *Client, r
 	roomInfos := make([]*protocol.RoomInfo, 0, len(rooms))
 	for _, room := range rooms {
 		roomInfos = append(roomInfos, &protocol.RoomInfo{
-			RoomID:    room.ID,
-			RoomName:  room.Name,
-			Players:   room.Players,
-			CreatorID: room.CreatorID,
-			Status:    int(room.Status),
+			RoomID:         room.ID,
+			RoomName:       room.Name,
+			Players:        room.Players,
+			CreatorID:      room.CreatorID,
+			Status:         int(room.Status),
+			Correspondence: room.Correspondence,
+			DaysPerMove:    room.DaysPerMove,
+			Settings:       toRoomSettings(room.Settings),
+			Ready:          room.ReadyPlayers(),
+			Locked:         room.Locked,
 		})
 	}
 
@@ -431,41 +839,82 @@ func (h *TCPHandler) broadcastToRoom(roomID int64, msg protocol.Message, exclude
 		if playerID == excludeUserID {
 			continue
 		}
-		if client, ok := h.clients[playerID]; ok {
+		for _, client := range h.clients[playerID] {
 			h.sendMessage(client.Conn, h.nextSeq(), msg)
 		}
 	}
 }
 
+// broadcastMove sends a move to the room: as a BoardDelta to connections
+// that negotiated FeatureDeltaBoard and as a full BoardUpdate to the rest.
+func (h *TCPHandler) broadcastMove(roomID int64, game *model.Game, delta *protocol.BoardDelta) {
+	players, err := h.roomService.GetRoomPlayers(roomID)
+	if err != nil {
+		return
+	}
+
+	var update *protocol.BoardUpdate
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, playerID := range players {
+		for _, client := range h.clients[playerID] {
+			if h.stateOf(client.Conn).Has(protocol.FeatureDeltaBoard) {
+				h.sendMessage(client.Conn, h.nextSeq(), delta)
+				continue
+			}
+			if update == nil {
+				update = moveUpdate(game, delta)
+			}
+			h.sendMessage(client.Conn, h.nextSeq(), update)
+		}
+	}
+}
+
 func (h *TCPHandler) broadcastToAll(msg protocol.Message, excludeUserID int64) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
-	for userID, client := range h.clients {
+	for userID, clients := range h.clients {
 		if userID == excludeUserID {
 			continue
 		}
-		h.sendMessage(client.Conn, h.nextSeq(), msg)
+		for _, client := range clients {
+			h.sendMessage(client.Conn, h.nextSeq(), msg)
+		}
 	}
 }
 
 func (h *TCPHandler) handleDisconnect(client *Client) {
-	if client.RoomID == 0 {
-		return
+	for _, roomID := range client.Rooms.List() {
+		h.leaveOnDisconnect(client, roomID)
 	}
+}
 
-	roomID := client.RoomID
-
+func (h *TCPHandler) leaveOnDisconnect(client *Client, roomID int64) {
 	game, _ := h.gameService.GetGame(roomID)
+	if room, err := h.roomService.GetRoom(roomID); err == nil && room.IsCorrespondenceGame() && game != nil && !game.IsFinished() {
+		client.Rooms.Remove(roomID)
+		log.Printf("User %d disconnected, correspondence game %d stays open", client.UserID, room.GameID)
+		return
+	}
+
 	if game != nil && !game.IsFinished() {
 		winner, _ := h.gameService.Forfeit(roomID, client.UserID)
 		if winner != 0 {
+			metrics.GameOutcomes.WithLabelValues(metrics.TransportTCP, metrics.OutcomeDisconnect).Inc()
+			h.roomService.RecordResult(roomID, winner)
 			h.broadcastToRoom(roomID, &protocol.GameOver{
 				RoomID: roomID,
 				Winner: winner,
+				Series: h.seriesScore(roomID),
 			}, 0)
 		}
 		h.gameService.EndGame(roomID)
+		if winner != 0 {
+			h.finishTournamentGame(roomID, winner)
+		}
 	}
 
 	h.broadcastToRoom(roomID, &protocol.PlayerLeave{
@@ -474,14 +923,19 @@ func (h *TCPHandler) handleDisconnect(client *Client) {
 		Reason: "player disconnected",
 	}, 0)
 
+	var owner int64
+	if room, err := h.roomService.GetRoom(roomID); err == nil {
+		owner = room.CreatorID
+	}
 	h.roomService.LeaveRoom(roomID, client.UserID)
-	client.RoomID = 0
+	client.Rooms.Remove(roomID)
+	h.announceOwner(roomID, owner)
 
 	log.Printf("User %d disconnected from room %d", client.UserID, roomID)
 }
 
 func (h *TCPHandler) startGame(room *model.Room) {
-	game, err := h.gameService.StartGame(room.ID, room.Players)
+	game, err := h.gameService.StartGame(room.ID, room.Players, room.Settings)
 	if err != nil {
 		log.Printf("Failed to start game: %v", err)
 		return
@@ -489,28 +943,40 @@ func (h *TCPHandler) startGame(room *model.Room) {
 
 	h.roomService.SetRoomStatus(room.ID, model.RoomStatusPlaying)
 
+	if room.Correspondence {
+		cg, err := h.corrService.Create(game, room.DaysPerMove, room.Settings.Rated)
+		if err != nil {
+			log.Printf("Failed to store correspondence game: %v", err)
+		} else {
+			h.roomService.SetRoomGameID(room.ID, cg.ID)
+		}
+	}
+
 	gameStart := &protocol.GameStart{
 		RoomID:      room.ID,
 		Players:     room.Players,
 		FirstPlayer: game.CurrentPlayer(),
+		Settings:    toRoomSettings(room.Settings),
+		Series:      h.seriesScore(room.ID),
 	}
 
 	h.broadcastToRoom(room.ID, gameStart, 0)
+	h.armMoveTimer(room.ID, game)
 	log.Printf("Game started in room %d, first player: %d", room.ID, game.CurrentPlayer())
 }
 
 func (h *TCPHandler) handleMove(conn net.Conn, seq uint16, client *Client, req *protocol.MoveReq) {
+	start := time.Now()
 	resp := &protocol.MoveResp{}
 
-	if client.RoomID == 0 {
+	roomID, ok := client.Rooms.Resolve(req.RoomID)
+	if !ok {
 		resp.Code = 400
-		resp.Message = "not in any room"
+		resp.Message = "not in this room"
 		h.sendMessage(conn, seq, resp)
 		return
 	}
 
-	roomID := client.RoomID
-
 	game, err := h.gameService.GetGame(roomID)
 	if err != nil {
 		resp.Code = 404
@@ -526,7 +992,35 @@ func (h *TCPHandler) handleMove(conn net.Conn, seq uint16, client *Client, req *
 		return
 	}
 
-	if err := h.gameService.MakeMove(roomID, client.UserID, req.X, req.Y); err != nil {
+	// A correspondence move is stored before it is played, so the live game
+	// never gets ahead of the database. Should the live move then fail, the
+	// next move hits the stale check and the game is reopened from storage.
+	if room, err := h.roomService.GetRoom(roomID); err == nil && room.IsCorrespondenceGame() {
+		next := game.Clone()
+		if err := next.MakeMove(client.UserID, req.X, req.Y); err != nil {
+			resp.Code = 400
+			resp.Message = err.Error()
+			h.sendMessage(conn, seq, resp)
+			return
+		}
+		if err := h.corrService.RecordMove(room.GameID, room.DaysPerMove, next, req.X, req.Y); err != nil {
+			log.Printf("Failed to store correspondence move: %v", err)
+			if errors.Is(err, repository.ErrCorrespondenceStale) {
+				h.dropCorrespondenceRoom(room)
+				resp.Code = 409
+				resp.Message = "game was updated elsewhere, please reopen it"
+				h.sendMessage(conn, seq, resp)
+				return
+			}
+			resp.Code = 500
+			resp.Message = "failed to save move"
+			h.sendMessage(conn, seq, resp)
+			return
+		}
+	}
+
+	moveNumber, err := h.gameService.MakeMove(roomID, client.UserID, req.X, req.Y)
+	if err != nil {
 		resp.Code = 400
 		resp.Message = err.Error()
 		h.sendMessage(conn, seq, resp)
@@ -546,45 +1040,70 @@ func (h *TCPHandler) handleMove(conn net.Conn, seq uint16, client *Client, req *
 		return
 	}
 
-	boardUpdate := &protocol.BoardUpdate{
-		RoomID:        roomID,
-		Board:         game.GetBoardCopy(),
-		LastX:         req.X,
-		LastY:         req.Y,
-		LastPlayer:    client.UserID,
-		CurrentPlayer: game.CurrentPlayer(),
-	}
-
-	h.broadcastToRoom(roomID, boardUpdate, 0)
+	h.broadcastMove(roomID, game, moveDelta(game, moveNumber, req.X, req.Y, client.UserID))
+	metrics.MoveLatency.WithLabelValues(metrics.TransportTCP).Observe(time.Since(start).Seconds())
 
 	if game.IsFinished() {
+		metrics.GameOutcomes.WithLabelValues(metrics.TransportTCP, metrics.OutcomeFiveInRow).Inc()
+		h.roomService.RecordResult(roomID, game.Winner)
 		gameOver := &protocol.GameOver{
 			RoomID:  roomID,
 			Winner:  game.Winner,
 			WinLine: game.WinLine,
+			Series:  h.seriesScore(roomID),
 		}
 		h.broadcastToRoom(roomID, gameOver, 0)
 		h.gameService.EndGame(roomID)
 		h.roomService.SetRoomStatus(roomID, model.RoomStatusFinished)
 
-		h.updateGameResult(roomID, game.Players, game.Winner)
+		h.updateGameResult(roomID, game, game.Winner)
+		h.finishTournamentGame(roomID, game.Winner)
 
 		log.Printf("Game finished in room %d, winner: %d", roomID, game.Winner)
+		return
+	}
+
+	h.armMoveTimer(roomID, game)
+}
+
+// handleBoardSync answers a client that missed a move with the full board.
+func (h *TCPHandler) handleBoardSync(conn net.Conn, seq uint16, client *Client, req *protocol.BoardSyncReq) {
+	roomID, ok := client.Rooms.Resolve(req.RoomID)
+	if !ok {
+		h.sendError(conn, seq, 400, "not in this room")
+		return
+	}
+
+	game, err := h.gameService.GetGame(roomID)
+	if err != nil {
+		h.sendError(conn, seq, 404, "game not found")
+		return
+	}
+
+	h.sendMessage(conn, seq, boardSnapshot(game))
+}
+
+// sendBoardSnapshots sends the board of every game the connection took
+// over from the user's older connections when it logged in.
+func (h *TCPHandler) sendBoardSnapshots(conn net.Conn, client *Client) {
+	for _, roomID := range client.Rooms.List() {
+		if game, err := h.gameService.GetGame(roomID); err == nil {
+			h.sendMessage(conn, h.nextSeq(), boardSnapshot(game))
+		}
 	}
 }
 
 func (h *TCPHandler) handleForfeit(conn net.Conn, seq uint16, client *Client, req *protocol.ForfeitReq) {
 	resp := &protocol.ForfeitResp{}
 
-	if client.RoomID == 0 {
+	roomID, ok := client.Rooms.Resolve(req.RoomID)
+	if !ok {
 		resp.Code = 400
-		resp.Message = "not in any room"
+		resp.Message = "not in this room"
 		h.sendMessage(conn, seq, resp)
 		return
 	}
 
-	roomID := client.RoomID
-
 	winner, err := h.gameService.Forfeit(roomID, client.UserID)
 	if err != nil {
 		resp.Code = 400
@@ -593,27 +1112,36 @@ func (h *TCPHandler) handleForfeit(conn net.Conn, seq uint16, client *Client, re
 		return
 	}
 
+	if room, err := h.roomService.GetRoom(roomID); err == nil && room.IsCorrespondenceGame() && winner != 0 {
+		if err := h.corrService.Resign(room.GameID, winner); err != nil {
+			log.Printf("Failed to store correspondence resignation: %v", err)
+		}
+	}
+
 	resp.Code = 200
 	resp.Message = "forfeit success"
 	resp.Winner = winner
 
 	h.sendMessage(conn, seq, resp)
 
+	metrics.GameOutcomes.WithLabelValues(metrics.TransportTCP, metrics.OutcomeForfeit).Inc()
+	h.roomService.RecordResult(roomID, winner)
 	gameOver := &protocol.GameOver{
 		RoomID: roomID,
 		Winner: winner,
+		Series: h.seriesScore(roomID),
 	}
 	h.broadcastToRoom(roomID, gameOver, 0)
 
+	game, _ := h.gameService.GetGame(roomID)
 	h.gameService.EndGame(roomID)
 	h.roomService.SetRoomStatus(roomID, model.RoomStatusFinished)
 
-	game, _ := h.gameService.GetGame(roomID)
 	if game != nil {
-		h.updateGameResult(roomID, game.Players, winner)
-	} else {
-		players, _ := h.roomService.GetRoomPlayers(roomID)
-		h.updateGameResult(roomID, players, winner)
+		h.updateGameResult(roomID, game, winner)
+	}
+	if winner != 0 {
+		h.finishTournamentGame(roomID, winner)
 	}
 
 	log.Printf("User %d forfeited, winner: %d in room %d", client.UserID, winner, roomID)
@@ -638,13 +1166,14 @@ func (h *TCPHandler) handleLeaderboard(conn net.Conn, seq uint16, client *Client
 	ranks := make([]*protocol.RankEntry, 0, len(entries))
 	for _, e := range entries {
 		ranks = append(ranks, &protocol.RankEntry{
-			UserID:    e.UserID,
-			Username:  e.Username,
-			Score:     e.Score,
-			WinCount:  e.WinCount,
-			LoseCount: e.LoseCount,
-			WinRate:   e.WinRate,
-			Rank:      e.Rank,
+			UserID:      e.UserID,
+			Username:    e.Username,
+			DisplayName: e.DisplayName,
+			Score:       e.Score,
+			WinCount:    e.WinCount,
+			LoseCount:   e.LoseCount,
+			WinRate:     e.WinRate,
+			Rank:        e.Rank,
 		})
 	}
 
@@ -685,6 +1214,10 @@ func (h *TCPHandler) handleUserStats(conn net.Conn, seq uint16, client *Client,
 	resp.Message = "success"
 	resp.UserID = user.ID
 	resp.Username = user.Username
+	resp.DisplayName = user.DisplayName
+	resp.AvatarID = user.AvatarID
+	resp.Country = user.Country
+	resp.Bio = user.Bio
 	resp.Score = score
 	resp.WinCount = winCount
 	resp.LoseCount = loseCount
@@ -694,11 +1227,34 @@ func (h *TCPHandler) handleUserStats(conn net.Conn, seq uint16, client *Client,
 	h.sendMessage(conn, seq, resp)
 }
 
-func (h *TCPHandler) updateGameResult(roomID int64, players []int64, winner int64) {
+// updateGameResult stores a finished live game with its moves and applies
+// the rating change if the room is rated. Correspondence games are stored
+// move by move already.
+func (h *TCPHandler) updateGameResult(roomID int64, game *model.Game, winner int64) {
+	players := game.Players
 	if len(players) < 2 {
 		return
 	}
 
+	rated := true
+	gameType, gameID := model.GameTypeLive, int64(0)
+	if room, err := h.roomService.GetRoom(roomID); err == nil {
+		rated = room.Settings.Rated
+		if room.IsCorrespondenceGame() {
+			gameType, gameID = model.GameTypeCorrespondence, room.GameID
+		}
+	}
+	if gameType == model.GameTypeLive {
+		id, err := h.gameService.Record(game, winner)
+		if err != nil {
+			log.Printf("Failed to store game of room %d: %v", roomID, err)
+		}
+		gameID = id
+	}
+	if !rated {
+		return
+	}
+
 	loser := int64(0)
 	for _, p := range players {
 		if p != winner {
@@ -708,9 +1264,1267 @@ func (h *TCPHandler) updateGameResult(roomID int64, players []int64, winner int6
 	}
 
 	if winner != 0 && loser != 0 {
-		h.userService.UpdateScore(winner, 25, true)
-		h.userService.UpdateScore(loser, -20, false)
+		h.userService.UpdateScore(winner, 25, true, gameType, gameID)
+		h.userService.UpdateScore(loser, -20, false, gameType, gameID)
 
 		log.Printf("Score updated: winner %d (+25), loser %d (-20)", winner, loser)
 	}
 }
+
+func (h *TCPHandler) handleTournamentCreate(conn net.Conn, seq uint16, client *Client, req *protocol.TournamentCreateReq) {
+	resp := &protocol.TournamentCreateResp{}
+
+	if service.IsDraining() {
+		resp.Code = 503
+		resp.Message = service.ErrServerDraining.Error()
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	name := req.Name
+	if name == "" {
+		name = client.Username() + "'s tournament"
+	}
+
+	t, err := h.tournaments.CreateTournament(name, model.TournamentFormat(req.Format), client.UserID,
+		req.MaxPlayers, time.Duration(req.NoShowSeconds)*time.Second)
+	if err != nil {
+		resp.Code = 400
+		resp.Message = err.Error()
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "tournament created"
+	resp.TournamentID = t.ID
+
+	h.sendMessage(conn, seq, resp)
+	log.Printf("User %d created tournament %d", client.UserID, t.ID)
+}
+
+func (h *TCPHandler) handleTournamentJoin(conn net.Conn, seq uint16, client *Client, req *protocol.TournamentJoinReq) {
+	resp := &protocol.TournamentJoinResp{}
+
+	if !client.Can(model.PermRanked) {
+		resp.Code = 403
+		resp.Message = "guests cannot join tournaments"
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	if err := h.tournaments.Register(req.TournamentID, client.UserID); err != nil {
+		resp.Code = 400
+		resp.Message = err.Error()
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "joined tournament"
+	resp.TournamentID = req.TournamentID
+
+	h.sendMessage(conn, seq, resp)
+	log.Printf("User %d joined tournament %d", client.UserID, req.TournamentID)
+}
+
+func (h *TCPHandler) handleTournamentStart(conn net.Conn, seq uint16, client *Client, req *protocol.TournamentStartReq) {
+	resp := &protocol.TournamentStartResp{}
+
+	if err := h.tournaments.Start(req.TournamentID, client.UserID); err != nil {
+		resp.Code = 400
+		if errors.Is(err, service.ErrNotTournamentOwner) {
+			resp.Code = 403
+		}
+		resp.Message = err.Error()
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "tournament started"
+
+	h.sendMessage(conn, seq, resp)
+	log.Printf("User %d started tournament %d", client.UserID, req.TournamentID)
+}
+
+func (h *TCPHandler) handleTournamentBracket(conn net.Conn, seq uint16, client *Client, req *protocol.TournamentBracketReq) {
+	bracket, err := h.tournaments.GetBracket(req.TournamentID)
+	if err != nil {
+		h.sendMessage(conn, seq, &protocol.TournamentBracketResp{Code: 404, Message: err.Error()})
+		return
+	}
+
+	h.sendMessage(conn, seq, toBracketResp(bracket))
+}
+
+func (h *TCPHandler) handleTournamentCheckIn(conn net.Conn, seq uint16, client *Client, req *protocol.TournamentCheckInReq) {
+	resp := &protocol.TournamentCheckInResp{}
+
+	if service.IsDraining() {
+		resp.Code = 503
+		resp.Message = service.ErrServerDraining.Error()
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	if client.Rooms.Len() >= MaxRoomsPerUser {
+		resp.Code = 400
+		resp.Message = "too many rooms, please leave one first"
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	joined := false
+	match, ready, err := h.tournaments.CheckIn(req.TournamentID, req.MatchID, client.UserID, metrics.TransportTCP, func(roomID int64) (int64, error) {
+		if roomID != 0 {
+			if err := h.roomService.JoinRoom(roomID, client.UserID); err == nil {
+				joined = true
+				return roomID, nil
+			} else if !errors.Is(err, service.ErrRoomNotFound) {
+				return 0, err
+			}
+		}
+
+		name := fmt.Sprintf("tournament %d match %d", req.TournamentID, req.MatchID)
+		room, err := h.roomService.CreateTournamentRoom(name, client.UserID, req.TournamentID, req.MatchID)
+		if err != nil {
+			return 0, err
+		}
+		return room.ID, nil
+	})
+	if err != nil {
+		resp.Code = 400
+		resp.Message = err.Error()
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	client.Rooms.Add(match.RoomID)
+
+	resp.Code = 200
+	resp.Message = "checked in"
+	resp.RoomID = match.RoomID
+
+	h.sendMessage(conn, seq, resp)
+
+	if joined {
+		h.broadcastToRoom(match.RoomID, &protocol.PlayerJoin{
+			RoomID:   match.RoomID,
+			UserID:   client.UserID,
+			Username: client.Username(),
+		}, client.UserID)
+	}
+
+	log.Printf("User %d checked in for tournament %d match %d", client.UserID, req.TournamentID, req.MatchID)
+
+	if ready {
+		match, err = h.tournaments.StartMatch(req.TournamentID, req.MatchID)
+		if err != nil {
+			log.Printf("Failed to start tournament match: %v", err)
+			return
+		}
+		h.startMatchGame(match)
+	}
+}
+
+func (h *TCPHandler) startMatchGame(match model.TournamentMatch) {
+	room, err := h.roomService.GetRoom(match.RoomID)
+	if err != nil {
+		log.Printf("Failed to start tournament game: %v", err)
+		return
+	}
+
+	players := []int64{match.Black, match.White()}
+	game, err := h.gameService.StartGame(match.RoomID, players, room.Settings)
+	if err != nil {
+		log.Printf("Failed to start game: %v", err)
+		return
+	}
+
+	h.roomService.SetRoomStatus(match.RoomID, model.RoomStatusPlaying)
+
+	h.broadcastToRoom(match.RoomID, &protocol.GameStart{
+		RoomID:      match.RoomID,
+		Players:     players,
+		FirstPlayer: game.CurrentPlayer(),
+		Settings:    toRoomSettings(room.Settings),
+		Series:      h.seriesScore(match.RoomID),
+	}, 0)
+	log.Printf("Tournament game %d started in room %d, first player: %d", match.Games, match.RoomID, game.CurrentPlayer())
+}
+
+func (h *TCPHandler) finishTournamentGame(roomID, winner int64) {
+	room, err := h.roomService.GetRoom(roomID)
+	if err != nil || !room.IsTournament() {
+		return
+	}
+
+	match, tiebreak, err := h.tournaments.ReportResult(room.TournamentID, room.MatchID, winner)
+	if err != nil {
+		log.Printf("Failed to report tournament result: %v", err)
+		return
+	}
+
+	if tiebreak {
+		h.startMatchGame(match)
+	}
+}
+
+func (h *TCPHandler) onTournamentEvent(e service.TournamentEvent) {
+	match := e.Match
+
+	switch e.Type {
+	case service.TournamentEventMatchReady:
+		for _, p := range []int64{match.Player1, match.Player2} {
+			h.sendToUser(p, &protocol.TournamentMatchReady{
+				TournamentID: e.TournamentID,
+				MatchID:      match.ID,
+				Opponent:     match.Opponent(p),
+				Black:        match.Black,
+				Deadline:     e.Deadline.Unix(),
+			})
+		}
+	case service.TournamentEventTiebreak:
+		for _, p := range []int64{match.Player1, match.Player2} {
+			h.sendToUser(p, &protocol.TournamentMatchResult{
+				TournamentID: e.TournamentID,
+				MatchID:      match.ID,
+				Tiebreak:     true,
+			})
+		}
+	case service.TournamentEventMatchFinished:
+		result := &protocol.TournamentMatchResult{
+			TournamentID: e.TournamentID,
+			MatchID:      match.ID,
+			Winner:       match.Winner,
+			Loser:        match.Loser,
+			Forfeit:      match.Forfeit,
+		}
+		for _, p := range []int64{match.Player1, match.Player2} {
+			h.sendToUser(p, result)
+		}
+		h.closeMatchRoom(e.TournamentID, match)
+	case service.TournamentEventFinished:
+		for _, p := range h.tournaments.Players(e.TournamentID) {
+			h.sendToUser(p, &protocol.TournamentMatchResult{
+				TournamentID: e.TournamentID,
+				Champion:     e.Champion,
+			})
+		}
+		log.Printf("Tournament %d finished, champion: %d", e.TournamentID, e.Champion)
+	}
+}
+
+func (h *TCPHandler) closeMatchRoom(tournamentID int64, match model.TournamentMatch) {
+	if match.RoomID == 0 {
+		return
+	}
+
+	room, err := h.roomService.GetRoom(match.RoomID)
+	if err != nil || room.TournamentID != tournamentID || room.MatchID != match.ID {
+		return
+	}
+
+	h.gameService.EndGame(room.ID)
+	h.roomService.DeleteRoom(room.ID)
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, p := range []int64{match.Player1, match.Player2} {
+		for _, client := range h.clients[p] {
+			client.Rooms.Remove(room.ID)
+		}
+	}
+}
+
+func (h *TCPHandler) sendToUser(userID int64, msg protocol.Message) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, client := range h.clients[userID] {
+		h.sendMessage(client.Conn, h.nextSeq(), msg)
+	}
+}
+
+func (h *TCPHandler) handleCorrespondenceList(conn net.Conn, seq uint16, client *Client, req *protocol.CorrespondenceListReq) {
+	resp := &protocol.CorrespondenceListResp{}
+
+	games, err := h.corrService.ListActive(client.UserID)
+	if err != nil {
+		resp.Code = 500
+		resp.Message = err.Error()
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "success"
+	resp.Games = h.correspondenceInfos(games, client.UserID)
+
+	h.sendMessage(conn, seq, resp)
+}
+
+func (h *TCPHandler) handleCorrespondenceOpen(conn net.Conn, seq uint16, client *Client, req *protocol.CorrespondenceOpenReq) {
+	resp := &protocol.CorrespondenceOpenResp{}
+
+	cg, err := h.corrService.GetGame(req.GameID, client.UserID)
+	if err != nil {
+		resp.Code = 404
+		if errors.Is(err, service.ErrNotCorrespondencePlayer) {
+			resp.Code = 403
+		}
+		resp.Message = err.Error()
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	if !cg.IsActive() {
+		resp.Code = 200
+		resp.Message = "game finished"
+		resp.Game = toCorrespondenceInfo(cg, client.UserID, 0)
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	room, err := h.roomService.GetRoomByGameID(cg.ID)
+	if (err != nil || !client.Rooms.Has(room.ID)) && client.Rooms.Len() >= MaxRoomsPerUser {
+		resp.Code = 400
+		resp.Message = "too many rooms, please leave one first"
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	if err != nil {
+		room, err = h.roomService.RestoreCorrespondenceRoom(fmt.Sprintf("correspondence %d", cg.ID), cg)
+		if err != nil {
+			resp.Code = 500
+			resp.Message = err.Error()
+			h.sendMessage(conn, seq, resp)
+			return
+		}
+	}
+
+	game, err := h.gameService.GetGame(room.ID)
+	if err != nil || game.MoveCount != cg.MoveCount {
+		h.gameService.EndGame(room.ID)
+		game = cg.ToGame(room.ID)
+		h.gameService.RestoreGame(game)
+	}
+
+	client.Rooms.Add(room.ID)
+
+	resp.Code = 200
+	resp.Message = "game opened"
+	resp.Game = toCorrespondenceInfo(cg, client.UserID, room.ID)
+
+	h.sendMessage(conn, seq, resp)
+
+	h.sendMessage(conn, h.nextSeq(), boardSnapshot(game))
+	log.Printf("User %d opened correspondence game %d in room %d", client.UserID, cg.ID, room.ID)
+}
+
+func (h *TCPHandler) notifyCorrespondenceTurn(conn net.Conn, userID int64) {
+	games, err := h.corrService.ListYourTurn(userID)
+	if err != nil {
+		log.Printf("Failed to load correspondence games: %v", err)
+		return
+	}
+	if len(games) == 0 {
+		return
+	}
+
+	h.sendMessage(conn, h.nextSeq(), &protocol.CorrespondenceTurn{
+		Games: h.correspondenceInfos(games, userID),
+	})
+}
+
+func (h *TCPHandler) correspondenceInfos(games []*model.CorrespondenceGame, userID int64) []*protocol.CorrespondenceGameInfo {
+	infos := make([]*protocol.CorrespondenceGameInfo, 0, len(games))
+	for _, g := range games {
+		roomID := int64(0)
+		if room, err := h.roomService.GetRoomByGameID(g.ID); err == nil {
+			roomID = room.ID
+		}
+		infos = append(infos, toCorrespondenceInfo(g, userID, roomID))
+	}
+	return infos
+}
+
+func (h *TCPHandler) dropCorrespondenceRoom(room *model.Room) {
+	h.gameService.EndGame(room.ID)
+	h.roomService.DeleteRoom(room.ID)
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, p := range room.Players {
+		for _, client := range h.clients[p] {
+			client.Rooms.Remove(room.ID)
+		}
+	}
+}
+
+func (h *TCPHandler) handleRematchRequest(conn net.Conn, seq uint16, client *Client, req *protocol.RematchRequest) {
+	resp := &protocol.RematchResp{}
+
+	if service.IsDraining() {
+		resp.Code = 503
+		resp.Message = service.ErrServerDraining.Error()
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	roomID, ok := client.Rooms.Resolve(req.RoomID)
+	if !ok {
+		resp.Code = 400
+		resp.Message = "not in this room"
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	accepted, err := h.roomService.RequestRematch(roomID, client.UserID)
+	if err != nil {
+		resp.Code = 400
+		resp.Message = err.Error()
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.RoomID = roomID
+
+	if accepted {
+		resp.Message = "rematch accepted"
+		h.sendMessage(conn, seq, resp)
+		h.startRematch(roomID)
+		return
+	}
+
+	resp.Message = "rematch requested"
+	h.sendMessage(conn, seq, resp)
+
+	h.broadcastToRoom(roomID, &protocol.RematchRequest{
+		RoomID:   roomID,
+		FromUser: client.UserID,
+	}, client.UserID)
+
+	log.Printf("User %d requested a rematch in room %d", client.UserID, roomID)
+}
+
+func (h *TCPHandler) handleRematchAccept(conn net.Conn, seq uint16, client *Client, req *protocol.RematchAccept) {
+	resp := &protocol.RematchResp{}
+
+	if service.IsDraining() {
+		resp.Code = 503
+		resp.Message = service.ErrServerDraining.Error()
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	roomID, ok := client.Rooms.Resolve(req.RoomID)
+	if !ok {
+		resp.Code = 400
+		resp.Message = "not in this room"
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	if err := h.roomService.AcceptRematch(roomID, client.UserID); err != nil {
+		resp.Code = 400
+		resp.Message = err.Error()
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "rematch accepted"
+	resp.RoomID = roomID
+
+	h.sendMessage(conn, seq, resp)
+	h.startRematch(roomID)
+}
+
+func (h *TCPHandler) startRematch(roomID int64) {
+	room, err := h.roomService.GetRoom(roomID)
+	if err != nil {
+		return
+	}
+
+	h.gameService.EndGame(roomID)
+	h.startGame(room)
+	log.Printf("Rematch started in room %d", roomID)
+}
+
+func (h *TCPHandler) seriesScore(roomID int64) *protocol.SeriesScore {
+	room, err := h.roomService.GetRoom(roomID)
+	if err != nil || room.SeriesGames == 0 {
+		return nil
+	}
+	return toSeriesScore(room)
+}
+
+func (h *TCPHandler) handleRoomSettings(conn net.Conn, seq uint16, client *Client, req *protocol.RoomSettingsReq) {
+	resp := &protocol.RoomSettingsResp{}
+
+	roomID, ok := client.Rooms.Resolve(req.RoomID)
+	if !ok {
+		resp.Code = 400
+		resp.Message = "not in this room"
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	room, err := h.roomService.UpdateSettings(roomID, client.UserID, fromRoomSettings(req.Settings))
+	if err != nil {
+		resp.Code = 400
+		if errors.Is(err, service.ErrNotRoomCreator) {
+			resp.Code = 403
+		}
+		resp.Message = err.Error()
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	settings := toRoomSettings(room.Settings)
+
+	resp.Code = 200
+	resp.Message = "settings updated"
+	resp.RoomID = roomID
+	resp.Settings = settings
+
+	h.sendMessage(conn, seq, resp)
+
+	h.broadcastToRoom(roomID, &protocol.RoomSettingsUpdate{
+		RoomID:   roomID,
+		Settings: settings,
+	}, client.UserID)
+
+	log.Printf("User %d updated settings of room %d", client.UserID, roomID)
+}
+
+func (h *TCPHandler) handleReady(conn net.Conn, seq uint16, client *Client, req *protocol.ReadyReq) {
+	resp := &protocol.ReadyResp{}
+
+	if req.Ready && service.IsDraining() {
+		resp.Code = 503
+		resp.Message = service.ErrServerDraining.Error()
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	roomID, ok := client.Rooms.Resolve(req.RoomID)
+	if !ok {
+		resp.Code = 400
+		resp.Message = "not in this room"
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	start, err := h.roomService.SetReady(roomID, client.UserID, req.Ready)
+	if err != nil {
+		resp.Code = 400
+		resp.Message = err.Error()
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "ready updated"
+	resp.RoomID = roomID
+	resp.Ready = req.Ready
+
+	h.sendMessage(conn, seq, resp)
+
+	room, err := h.roomService.GetRoom(roomID)
+	if err != nil {
+		return
+	}
+
+	ready := room.ReadyPlayers()
+	if start {
+		ready = room.Players
+	}
+	h.broadcastToRoom(roomID, &protocol.ReadyUpdate{
+		RoomID: roomID,
+		UserID: client.UserID,
+		Ready:  ready,
+	}, 0)
+
+	if start {
+		h.startGame(room)
+	}
+}
+
+// armMoveTimer forfeits the player to move if they have not moved within the
+// room's time control. Timers are never cancelled; a stale one finds that a
+// move was made in the meantime and does nothing.
+func (h *TCPHandler) armMoveTimer(roomID int64, game *model.Game) {
+	room, err := h.roomService.GetRoom(roomID)
+	if err != nil || room.Correspondence || room.Settings.MoveTimeLimit <= 0 {
+		return
+	}
+
+	moveCount := game.MoveCount
+	time.AfterFunc(time.Duration(room.Settings.MoveTimeLimit)*time.Second, func() {
+		h.moveTimeout(roomID, game, moveCount)
+	})
+}
+
+func (h *TCPHandler) moveTimeout(roomID int64, game *model.Game, moveCount int) {
+	loser := game.CurrentPlayer()
+	winner, ok := h.gameService.ExpireTurn(roomID, game, moveCount)
+	if !ok {
+		return
+	}
+
+	metrics.GameOutcomes.WithLabelValues(metrics.TransportTCP, metrics.OutcomeTimeout).Inc()
+	h.roomService.RecordResult(roomID, winner)
+	h.broadcastToRoom(roomID, &protocol.GameOver{
+		RoomID: roomID,
+		Winner: winner,
+		Reason: "timeout",
+		Series: h.seriesScore(roomID),
+	}, 0)
+
+	h.gameService.EndGame(roomID)
+	h.roomService.SetRoomStatus(roomID, model.RoomStatusFinished)
+
+	h.updateGameResult(roomID, game, winner)
+	h.finishTournamentGame(roomID, winner)
+
+	log.Printf("User %d ran out of time in room %d, winner: %d", loser, roomID, winner)
+}
+
+func (h *TCPHandler) handleKickPlayer(conn net.Conn, seq uint16, client *Client, req *protocol.KickPlayerReq) {
+	resp := &protocol.KickPlayerResp{}
+
+	roomID, ok := client.Rooms.Resolve(req.RoomID)
+	if !ok {
+		resp.Code = 400
+		resp.Message = "not in this room"
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	if err := h.roomService.KickPlayer(roomID, client.UserID, req.UserID); err != nil {
+		resp.Code = 400
+		if errors.Is(err, service.ErrNotRoomCreator) {
+			resp.Code = 403
+		}
+		resp.Message = err.Error()
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "player kicked"
+	resp.RoomID = roomID
+	resp.UserID = req.UserID
+
+	h.sendMessage(conn, seq, resp)
+
+	notice := &protocol.PlayerLeave{
+		RoomID: roomID,
+		UserID: req.UserID,
+		Reason: "kicked",
+	}
+	h.broadcastToRoom(roomID, notice, 0)
+
+	for _, kicked := range h.clientsOf(req.UserID) {
+		kicked.Rooms.Remove(roomID)
+	}
+	h.sendToUser(req.UserID, notice)
+
+	log.Printf("User %d kicked user %d from room %d", client.UserID, req.UserID, roomID)
+}
+
+func (h *TCPHandler) handleLockRoom(conn net.Conn, seq uint16, client *Client, req *protocol.LockRoomReq) {
+	resp := &protocol.LockRoomResp{}
+
+	roomID, ok := client.Rooms.Resolve(req.RoomID)
+	if !ok {
+		resp.Code = 400
+		resp.Message = "not in this room"
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	if err := h.roomService.SetLocked(roomID, client.UserID, req.Locked); err != nil {
+		resp.Code = 400
+		if errors.Is(err, service.ErrNotRoomCreator) {
+			resp.Code = 403
+		}
+		resp.Message = err.Error()
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "room lock updated"
+	resp.RoomID = roomID
+	resp.Locked = req.Locked
+
+	h.sendMessage(conn, seq, resp)
+
+	h.broadcastToRoom(roomID, &protocol.RoomLockUpdate{
+		RoomID: roomID,
+		Locked: req.Locked,
+	}, client.UserID)
+
+	log.Printf("User %d set lock of room %d to %v", client.UserID, roomID, req.Locked)
+}
+
+// announceOwner tells the remaining players who owns the room after
+// prevOwner left it.
+func (h *TCPHandler) announceOwner(roomID, prevOwner int64) {
+	room, err := h.roomService.GetRoom(roomID)
+	if err != nil || room.CreatorID == prevOwner {
+		return
+	}
+
+	h.broadcastToRoom(roomID, &protocol.RoomOwnerChange{
+		RoomID:      roomID,
+		OwnerID:     room.CreatorID,
+		PrevOwnerID: prevOwner,
+	}, 0)
+	log.Printf("Room %d ownership passed from %d to %d", roomID, prevOwner, room.CreatorID)
+}
+
+// EvictIdle closes connections that sent nothing for longer than timeout. The
+// read loop then fails and runs the usual disconnect handling.
+func (h *TCPHandler) EvictIdle(timeout time.Duration) int {
+	h.mu.RLock()
+	idle := make([]*Client, 0)
+	for _, clients := range h.clients {
+		for _, client := range clients {
+			if client.IdleFor() > timeout {
+				idle = append(idle, client)
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, client := range idle {
+		log.Printf("Evicting idle user %d", client.UserID)
+		client.Conn.Close()
+	}
+	return len(idle)
+}
+
+func (h *TCPHandler) CleanRooms(inactiveTimeout time.Duration) (int, int) {
+	empty := h.roomService.CleanEmptyRooms()
+	inactive := h.roomService.CleanInactiveRooms(inactiveTimeout)
+	if inactive > 0 {
+		h.dropClosedRooms()
+	}
+	return empty, inactive
+}
+
+func (h *TCPHandler) IsOnline(userID int64) bool {
+	return h.GetClient(userID) != nil
+}
+
+// dropClosedRooms forgets rooms that were removed underneath their players
+// and tells those players the room is gone.
+func (h *TCPHandler) dropClosedRooms() {
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.clients))
+	for _, userClients := range h.clients {
+		clients = append(clients, userClients...)
+	}
+	h.mu.RUnlock()
+
+	for _, client := range clients {
+		for _, roomID := range client.Rooms.List() {
+			if _, err := h.roomService.GetRoom(roomID); err == nil {
+				continue
+			}
+			client.Rooms.Remove(roomID)
+			h.sendMessage(client.Conn, h.nextSeq(), &protocol.PlayerLeave{
+				RoomID: roomID,
+				UserID: client.UserID,
+				Reason: "room closed",
+			})
+		}
+	}
+}
+
+// trackConn registers a new connection so a shutdown can close it. It refuses
+// connections that arrive once draining has started.
+func (h *TCPHandler) trackConn(conn net.Conn) (*connState, bool) {
+	h.connMu.Lock()
+	defer h.connMu.Unlock()
+
+	if service.IsDraining() {
+		return nil, false
+	}
+	state := newConnState(tcpFeatures)
+	h.conns[conn] = state
+	h.connWG.Add(1)
+	return state, true
+}
+
+// stateOf returns what conn agreed on in Hello.
+func (h *TCPHandler) stateOf(conn net.Conn) *connState {
+	h.connMu.RLock()
+	state := h.conns[conn]
+	h.connMu.RUnlock()
+	if state == nil {
+		return legacyConn
+	}
+	return state
+}
+
+func (h *TCPHandler) untrackConn(conn net.Conn) {
+	h.connMu.Lock()
+	delete(h.conns, conn)
+	h.connMu.Unlock()
+	h.connWG.Done()
+}
+
+// NotifyShutdown tells every player the server is going away and when their
+// running games will be stopped.
+func (h *TCPHandler) NotifyShutdown(deadline time.Time) {
+	h.broadcastToAll(&protocol.ServerShutdown{
+		Message:  "server is shutting down, please finish your game",
+		Deadline: deadline.Unix(),
+	}, 0)
+}
+
+// ActiveGames counts the live games still being played. Correspondence games
+// are stored after every move, so they never hold up a shutdown.
+func (h *TCPHandler) ActiveGames() int {
+	return len(h.liveGames())
+}
+
+// AbortGames ends the live games still running at the shutdown deadline. No
+// score is changed for an aborted game.
+func (h *TCPHandler) AbortGames() int {
+	rooms := h.liveGames()
+	for _, roomID := range rooms {
+		metrics.GameOutcomes.WithLabelValues(metrics.TransportTCP, metrics.OutcomeAborted).Inc()
+		h.broadcastToRoom(roomID, &protocol.GameOver{
+			RoomID: roomID,
+			Reason: "server shutdown",
+			Series: h.seriesScore(roomID),
+		}, 0)
+		h.gameService.EndGame(roomID)
+		h.roomService.SetRoomStatus(roomID, model.RoomStatusFinished)
+	}
+	return len(rooms)
+}
+
+// CloseConnections closes every connection and waits until their disconnect
+// handling, including the database writes it makes, has finished.
+func (h *TCPHandler) CloseConnections(ctx context.Context) error {
+	h.connMu.Lock()
+	for conn := range h.conns {
+		conn.Close()
+	}
+	h.connMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.connWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h *TCPHandler) liveGames() []int64 {
+	rooms := make([]int64, 0)
+	for _, roomID := range h.gameService.RoomIDs() {
+		if room, err := h.roomService.GetRoom(roomID); err == nil && room.Correspondence {
+			continue
+		}
+		if game, err := h.gameService.GetGame(roomID); err == nil && !game.IsFinished() {
+			rooms = append(rooms, roomID)
+		}
+	}
+	return rooms
+}
+
+func (h *TCPHandler) Transport() string {
+	return metrics.TransportTCP
+}
+
+func (h *TCPHandler) AdminClients() []*AdminClientView {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	views := make([]*AdminClientView, 0, len(h.clients))
+	for _, clients := range h.clients {
+		for _, client := range clients {
+			views = append(views, &AdminClientView{
+				Transport:   metrics.TransportTCP,
+				UserID:      client.UserID,
+				Username:    client.Username(),
+				Role:        client.Role(),
+				IdleSeconds: int64(client.IdleFor().Seconds()),
+				Rooms:       client.Rooms.List(),
+			})
+		}
+	}
+	return views
+}
+
+func (h *TCPHandler) AdminRooms() []*AdminRoomView {
+	rooms := h.roomService.ListRooms()
+	views := make([]*AdminRoomView, 0, len(rooms))
+	for _, room := range rooms {
+		views = append(views, &AdminRoomView{Transport: metrics.TransportTCP, Room: room})
+	}
+	return views
+}
+
+func (h *TCPHandler) AdminGames() []*AdminGameView {
+	views := make([]*AdminGameView, 0)
+	for _, roomID := range h.gameService.RoomIDs() {
+		game, err := h.gameService.GetGame(roomID)
+		if err != nil || game.IsFinished() {
+			continue
+		}
+		room, _ := h.roomService.GetRoom(roomID)
+		views = append(views, toAdminGameView(metrics.TransportTCP, game, room))
+	}
+	return views
+}
+
+// ForceEndGame ends a running game on an operator's behalf. winner must be
+// one of the players, or 0 to end the game without a winner. Scores,
+// series, tournaments and correspondence records are updated as for a
+// normal finish.
+func (h *TCPHandler) ForceEndGame(roomID, winner int64) error {
+	game, err := h.gameService.GetGame(roomID)
+	if err != nil {
+		return err
+	}
+	if err := h.gameService.Finish(roomID, winner); err != nil {
+		return err
+	}
+
+	if room, err := h.roomService.GetRoom(roomID); err == nil && room.IsCorrespondenceGame() {
+		if err := h.corrService.Resign(room.GameID, winner); err != nil {
+			log.Printf("Failed to store correspondence result: %v", err)
+		}
+	}
+
+	metrics.GameOutcomes.WithLabelValues(metrics.TransportTCP, metrics.OutcomeAdmin).Inc()
+	h.roomService.RecordResult(roomID, winner)
+	h.broadcastToRoom(roomID, &protocol.GameOver{
+		RoomID: roomID,
+		Winner: winner,
+		Reason: "admin",
+		Series: h.seriesScore(roomID),
+	}, 0)
+
+	h.gameService.EndGame(roomID)
+	h.roomService.SetRoomStatus(roomID, model.RoomStatusFinished)
+
+	h.updateGameResult(roomID, game, winner)
+	h.finishTournamentGame(roomID, winner)
+
+	log.Printf("Game in room %d ended by admin, winner: %d", roomID, winner)
+	return nil
+}
+
+// DisconnectUser tells the user why and closes all their connections. The
+// normal disconnect handling then runs, so a running game is forfeited.
+func (h *TCPHandler) DisconnectUser(userID int64, reason string) bool {
+	clients := h.clientsOf(userID)
+	for _, client := range clients {
+		h.kickClient(client, reason)
+	}
+	if len(clients) > 0 {
+		log.Printf("User %d disconnected by admin: %s", userID, reason)
+	}
+	return len(clients) > 0
+}
+
+// kickClient tells a connection why it is being closed and closes it. The
+// read loop then runs the disconnect handling.
+func (h *TCPHandler) kickClient(client *Client, reason string) {
+	h.sendMessage(client.Conn, h.nextSeq(), &protocol.ForceDisconnect{Reason: reason})
+	client.Conn.Close()
+}
+
+// Announce sends a system message to every open connection, including ones
+// that have not logged in yet.
+func (h *TCPHandler) Announce(message string) int {
+	msg := &protocol.SystemAnnouncement{
+		Message:   message,
+		Timestamp: time.Now().Unix(),
+	}
+
+	h.connMu.Lock()
+	conns := make([]net.Conn, 0, len(h.conns))
+	for conn := range h.conns {
+		conns = append(conns, conn)
+	}
+	h.connMu.Unlock()
+
+	for _, conn := range conns {
+		h.sendMessage(conn, h.nextSeq(), msg)
+	}
+	return len(conns)
+}
+
+func (h *TCPHandler) handleChat(conn net.Conn, seq uint16, client *Client, req *protocol.ChatReq) {
+	resp := &protocol.ChatResp{}
+
+	roomID, ok := client.Rooms.Resolve(req.RoomID)
+	if !ok {
+		resp.Code = 400
+		resp.Message = "not in this room"
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	content := strings.TrimSpace(req.Content)
+	if content == "" || utf8.RuneCountInString(content) > MaxChatLength {
+		resp.Code = 400
+		resp.Message = fmt.Sprintf("message must be 1-%d characters", MaxChatLength)
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	if !client.Can(model.PermChat) {
+		resp.Code = 403
+		resp.Message = "permission denied"
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	if err := h.moderation.CheckChat(client.UserID); err != nil {
+		resp.Code = 500
+		resp.Message = "failed to check chat permission"
+		if code, info, ok := sanctionResponse(err); ok {
+			resp.Code = code
+			resp.Message = err.Error()
+			resp.Sanction = info
+		}
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "chat sent"
+	h.sendMessage(conn, seq, resp)
+
+	h.broadcastToRoom(roomID, &protocol.ChatMessage{
+		RoomID:    roomID,
+		UserID:    client.UserID,
+		Username:  client.Username(),
+		Content:   content,
+		Timestamp: time.Now().Unix(),
+	}, 0)
+}
+
+// SetUserRole applies a role change to the user's live connection.
+func (h *TCPHandler) SetUserRole(userID int64, role model.Role) bool {
+	clients := h.clientsOf(userID)
+	for _, client := range clients {
+		client.SetRole(role)
+	}
+	return len(clients) > 0
+}
+
+// handleLogout ends the current session, every session of the user (All) or
+// one other session (SessionID). It reports whether this connection is now
+// logged out.
+func (h *TCPHandler) handleLogout(conn net.Conn, seq uint16, client *Client, req *protocol.LogoutReq) bool {
+	resp := &protocol.LogoutResp{}
+
+	if req.SessionID != "" && req.SessionID != client.SessionID {
+		if err := h.sessionService.RevokeOwn(client.UserID, req.SessionID, sessionReasonRevoked); err != nil {
+			resp.Code = 500
+			resp.Message = "failed to end session"
+			if errors.Is(err, service.ErrSessionNotFound) {
+				resp.Code = 404
+				resp.Message = err.Error()
+			}
+			h.sendMessage(conn, seq, resp)
+			return false
+		}
+
+		resp.Code = 200
+		resp.Message = "session ended"
+		resp.Revoked = 1
+		h.sendMessage(conn, seq, resp)
+		return false
+	}
+
+	if req.All {
+		n, err := h.sessionService.RevokeAll(client.UserID, "", client, sessionReasonLogoutAll)
+		if err != nil {
+			resp.Code = 500
+			resp.Message = "failed to log out"
+			h.sendMessage(conn, seq, resp)
+			return false
+		}
+		resp.Revoked = n
+	} else {
+		err := h.sessionService.Revoke(client.SessionID, client, sessionReasonLogout)
+		if err != nil && !errors.Is(err, service.ErrSessionNotFound) {
+			resp.Code = 500
+			resp.Message = "failed to log out"
+			h.sendMessage(conn, seq, resp)
+			return false
+		}
+		if err == nil {
+			resp.Revoked = 1
+		}
+	}
+
+	resp.Code = 200
+	resp.Message = "logged out"
+	h.sendMessage(conn, seq, resp)
+
+	h.dropClient(client)
+	log.Printf("User %d logged out (all: %v)", client.UserID, req.All)
+	return true
+}
+
+func (h *TCPHandler) handleSessionList(conn net.Conn, seq uint16, client *Client, req *protocol.SessionListReq) {
+	resp := &protocol.SessionListResp{}
+
+	sessions, err := h.sessionService.List(client.UserID)
+	if err != nil {
+		resp.Code = 500
+		resp.Message = "failed to list sessions"
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "success"
+	resp.Sessions = toSessionInfos(sessions, client.SessionID)
+	h.sendMessage(conn, seq, resp)
+}
+
+func (h *TCPHandler) handleChangePassword(conn net.Conn, seq uint16, client *Client, req *protocol.ChangePasswordReq) {
+	resp := &protocol.ChangePasswordResp{}
+
+	n, err := h.userService.ChangePassword(client.UserID, client.SessionID, client, &model.ChangePasswordRequest{
+		OldPassword: req.OldPassword,
+		NewPassword: req.NewPassword,
+		IP:          remoteIP(conn.RemoteAddr()),
+	})
+	if err != nil {
+		resp.Code = passwordErrorCode(err)
+		resp.Message = err.Error()
+		if resp.Code == 500 {
+			resp.Message = "failed to change password"
+		}
+		if code, retryAfter, ok := lockoutResponse(err); ok {
+			resp.Code = code
+			resp.Message = err.Error()
+			resp.RetryAfter = retryAfter
+		}
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "password changed"
+	resp.Revoked = n
+	h.sendMessage(conn, seq, resp)
+	log.Printf("User %d changed password, %d other sessions ended", client.UserID, n)
+}
+
+// handleClaimAccount turns the guest account of client into a player
+// account. Other connections of the user are renamed by onAccountEvent.
+func (h *TCPHandler) handleClaimAccount(conn net.Conn, seq uint16, client *Client, req *protocol.ClaimAccountReq) {
+	resp := &protocol.ClaimAccountResp{}
+
+	user, err := h.userService.ClaimGuest(client.UserID, &model.ClaimAccountRequest{
+		Username: req.Username,
+		Password: req.Password,
+	})
+	if err != nil {
+		resp.Code = claimErrorCode(err)
+		resp.Message = err.Error()
+		if resp.Code == 500 {
+			resp.Message = "failed to claim account"
+		}
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "account claimed"
+	resp.Username = user.Username
+	resp.Role = string(user.Role)
+	if token, ttl, err := h.sessionService.Reissue(client.SessionID); err == nil {
+		resp.Token = token
+		resp.ExpiresIn = int64(ttl.Seconds())
+	}
+	h.sendMessage(conn, seq, resp)
+	log.Printf("User %d claimed guest account as %s", client.UserID, user.Username)
+}
+
+func (h *TCPHandler) handleUpdateProfile(conn net.Conn, seq uint16, client *Client, req *protocol.UpdateProfileReq) {
+	resp := &protocol.UpdateProfileResp{}
+
+	user, err := h.userService.UpdateProfile(client.UserID, &model.UpdateProfileRequest{
+		DisplayName: req.DisplayName,
+		AvatarID:    req.AvatarID,
+		Country:     req.Country,
+		Bio:         req.Bio,
+	})
+	if err != nil {
+		resp.Code = profileErrorCode(err)
+		resp.Message = err.Error()
+		if resp.Code == 500 {
+			resp.Message = "failed to update profile"
+		}
+		h.sendMessage(conn, seq, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "profile updated"
+	resp.Profile = profileInfo(user)
+	h.sendMessage(conn, seq, resp)
+}
+
+// enforceSessionPolicy ends the user's other sessions and connections, on
+// every transport, when only one session per user is allowed.
+func (h *TCPHandler) enforceSessionPolicy(client *Client) {
+	sess := &service.Session{ID: client.SessionID, UserID: client.UserID}
+	n, err := h.sessionService.EnforcePolicy(sess, client)
+	if err != nil {
+		log.Printf("Failed to end older sessions of user %d: %v", client.UserID, err)
+		return
+	}
+	if n > 0 {
+		log.Printf("Ended %d older sessions of user %d", n, client.UserID)
+	}
+}
+
+// onAccountEvent shows a renamed account under its new name and role on
+// every live connection of the user.
+func (h *TCPHandler) onAccountEvent(e service.AccountEvent) {
+	for _, client := range h.clientsOf(e.UserID) {
+		client.SetUsername(e.Username)
+		client.SetRole(e.Role)
+	}
+}
+
+// onSessionEvent closes the connections whose sessions were revoked, no
+// matter which transport or request revoked them.
+func (h *TCPHandler) onSessionEvent(e service.SessionEvent) {
+	for _, client := range h.clientsOf(e.UserID) {
+		if e.Matches(client, client.SessionID) {
+			h.kickClient(client, e.Reason)
+		}
+	}
+}
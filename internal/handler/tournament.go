@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"game-server/internal/model"
+	"game-server/pkg/protocol"
+)
+
+func toBracketResp(b *model.Bracket) *protocol.TournamentBracketResp {
+	rounds := make([]*protocol.TournamentRoundInfo, 0, len(b.Rounds))
+	for _, r := range b.Rounds {
+		matches := make([]*protocol.TournamentMatchInfo, 0, len(r.Matches))
+		for _, m := range r.Matches {
+			matches = append(matches, &protocol.TournamentMatchInfo{
+				MatchID: m.ID,
+				Bracket: m.Bracket,
+				Round:   m.Round,
+				Player1: m.Player1,
+				Player2: m.Player2,
+				Black:   m.Black,
+				Winner:  m.Winner,
+				Status:  int(m.Status),
+				Games:   m.Games,
+				Bye:     m.Bye,
+				Forfeit: m.Forfeit,
+			})
+		}
+		rounds = append(rounds, &protocol.TournamentRoundInfo{
+			Bracket: r.Bracket,
+			Round:   r.Round,
+			Matches: matches,
+		})
+	}
+
+	return &protocol.TournamentBracketResp{
+		Code:         200,
+		Message:      "success",
+		TournamentID: b.TournamentID,
+		Name:         b.Name,
+		Format:       int(b.Format),
+		Status:       int(b.Status),
+		Seeds:        b.Seeds,
+		Rounds:       rounds,
+		Champion:     b.Champion,
+	}
+}
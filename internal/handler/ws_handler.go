@@ -1,13 +1,20 @@
 package handler
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
+	"game-server/internal/metrics"
 	"game-server/internal/model"
+	"game-server/internal/repository"
 	"game-server/internal/service"
 	"game-server/pkg/protocol"
 
@@ -20,17 +27,69 @@ type WSHandler struct {
 	roomService    *service.RoomService
 	gameService    *service.GameService
 	rankService    *service.RankService
-	clients        map[int64]*WSClient
+	tournaments    *service.TournamentService
+	corrService    *service.CorrespondenceService
+	moderation     *service.ModerationService
+	clients        map[int64][]*WSClient
 	mu             sync.RWMutex
+
+	conns  map[*websocket.Conn]*connState
+	connMu sync.RWMutex
+	connWG sync.WaitGroup
 }
 
 type WSClient struct {
 	Conn       *websocket.Conn
 	UserID     int64
-	Token      string
-	Username   string
+	SessionID  string
 	LastActive time.Time
-	RoomID     int64
+	Rooms      RoomSet
+
+	activeMu sync.Mutex
+	// identMu guards the fields that can change while connected.
+	identMu  sync.RWMutex
+	username string
+	role     model.Role
+}
+
+func (c *WSClient) Touch() {
+	c.activeMu.Lock()
+	c.LastActive = time.Now()
+	c.activeMu.Unlock()
+}
+
+func (c *WSClient) IdleFor() time.Duration {
+	c.activeMu.Lock()
+	defer c.activeMu.Unlock()
+	return time.Since(c.LastActive)
+}
+
+func (c *WSClient) Username() string {
+	c.identMu.RLock()
+	defer c.identMu.RUnlock()
+	return c.username
+}
+
+func (c *WSClient) SetUsername(name string) {
+	c.identMu.Lock()
+	c.username = name
+	c.identMu.Unlock()
+}
+
+func (c *WSClient) Role() model.Role {
+	c.identMu.RLock()
+	defer c.identMu.RUnlock()
+	return c.role
+}
+
+func (c *WSClient) SetRole(role model.Role) {
+	c.identMu.Lock()
+	c.role = role
+	c.identMu.Unlock()
+}
+
+func (c *WSClient) Can(p model.Permission) bool {
+	return c.Role().Can(p)
 }
 
 type WSMessage struct {
@@ -43,106 +102,189 @@ type WSResponse struct {
 	Payload interface{} `json:"payload"`
 }
 
-func NewWSHandler() *WSHandler {
-	return &WSHandler{
+func NewWSHandler(tournaments *service.TournamentService) *WSHandler {
+	h := &WSHandler{
 		userService:    service.NewUserService(),
 		sessionService: service.NewSessionService(),
 		roomService:    service.NewRoomService(),
 		gameService:    service.NewGameService(),
 		rankService:    service.NewRankService(),
-		clients:        make(map[int64]*WSClient),
+		tournaments:    tournaments,
+		corrService:    service.NewCorrespondenceService(),
+		moderation:     service.NewModerationService(),
+		clients:        make(map[int64][]*WSClient),
+		conns:          make(map[*websocket.Conn]*connState),
 	}
+	tournaments.Subscribe(h.onTournamentEvent)
+	service.SubscribeSessionEvents(h.onSessionEvent)
+	service.SubscribeAccountEvents(h.onAccountEvent)
+	metrics.RegisterSource(metrics.TransportWS, h)
+	return h
 }
 
 func (h *WSHandler) HandleWS(conn *websocket.Conn) {
 	defer conn.Close()
 
+	state, ok := h.trackConn(conn)
+	if !ok {
+		return
+	}
+	defer h.untrackConn(conn)
+
 	log.Printf("New WebSocket connection from %s", conn.RemoteAddr())
 
 	var client *WSClient
 
 	for {
-		_, data, err := conn.ReadMessage()
+		frameType, data, err := conn.ReadMessage()
 		if err != nil {
 			log.Printf("WebSocket read error: %v", err)
 			if client != nil {
-				h.RemoveClient(client.UserID)
-				h.sessionService.SetUserOffline(client.UserID)
-				if client.RoomID != 0 {
-					h.handleDisconnect(client)
-				}
+				h.dropClient(client)
 			}
 			return
 		}
 
-		var wsMsg WSMessage
-		if err := json.Unmarshal(data, &wsMsg); err != nil {
-			h.sendError(conn, 400, "invalid message format")
+		var msg protocol.Message
+		if frameType == websocket.BinaryMessage {
+			msg, err = decodeBinaryFrame(state, data)
+		} else {
+			msg, err = decodeTextFrame(data)
+		}
+		if err != nil {
+			metrics.DecodeErrors.WithLabelValues(metrics.TransportWS).Inc()
+			if errors.Is(err, protocol.ErrUnknownMsgType) {
+				h.sendError(conn, 400, "unknown message type")
+			} else {
+				h.sendError(conn, 400, "invalid message format")
+			}
 			continue
 		}
+		metrics.PacketsIn.WithLabelValues(metrics.TransportWS, protocol.TypeName(msg.MessageType())).Inc()
+
+		if _, ok := msg.(*protocol.HelloReq); !ok && state.needsHello() {
+			h.sendError(conn, codeUnsupportedVersion, helloRequired())
+			return
+		}
 
 		if client != nil {
-			client.LastActive = time.Now()
+			client.Touch()
 		}
 
-		switch wsMsg.Type {
-		case protocol.TypePing:
+		switch m := msg.(type) {
+		case *protocol.PingReq:
 			h.handlePing(conn, client)
-		case protocol.TypeLogin:
-			client = h.handleLogin(conn, wsMsg.Payload)
-		case protocol.TypeRegister:
-			h.handleRegister(conn, wsMsg.Payload)
+		case *protocol.HelloReq:
+			if !h.handleHello(conn, client, state, m) {
+				return
+			}
+		case *protocol.LoginReq:
+			if client != nil {
+				h.sendError(conn, 400, "already logged in")
+				continue
+			}
+			client = h.handleLogin(conn, m)
+		case *protocol.GuestLoginReq:
+			if client != nil {
+				h.sendError(conn, 400, "already logged in")
+				continue
+			}
+			client = h.handleGuestLogin(conn, m)
+		case *protocol.LogoutReq:
+			if client == nil {
+				h.sendError(conn, 401, "please login first")
+				continue
+			}
+			if h.handleLogout(conn, client, m) {
+				client = nil
+			}
+		case *protocol.RegisterReq:
+			h.handleRegister(conn, m)
+		case *protocol.RefreshTokenReq:
+			h.handleRefreshToken(conn, m)
 		default:
 			if client == nil {
 				h.sendError(conn, 401, "please login first")
 				continue
 			}
-			h.handleAuthMessage(conn, client, wsMsg.Type, wsMsg.Payload)
-		}
-	}
-}
-
-func (h *WSHandler) handleAuthMessage(conn *websocket.Conn, client *WSClient, msgType uint16, payload json.RawMessage) {
-	switch msgType {
-	case protocol.TypeCreateRoom:
-		h.handleCreateRoom(conn, client, payload)
-	case protocol.TypeJoinRoom:
-		h.handleJoinRoom(conn, client, payload)
-	case protocol.TypeLeaveRoom:
-		h.handleLeaveRoom(conn, client, payload)
-	case protocol.TypeRoomList:
-		h.handleRoomList(conn, client, payload)
-	case protocol.TypeMove:
-		h.handleMove(conn, client, payload)
-	case protocol.TypeForfeitReq:
-		h.handleForfeit(conn, client, payload)
-	case protocol.TypeLeaderboardReq:
-		h.handleLeaderboard(conn, client, payload)
-	case protocol.TypeUserStatsReq:
-		h.handleUserStats(conn, client, payload)
+			h.handleAuthMessage(conn, client, msg)
+		}
+	}
+}
+
+func (h *WSHandler) handleAuthMessage(conn *websocket.Conn, client *WSClient, msg protocol.Message) {
+	switch m := msg.(type) {
+	case *protocol.CreateRoomReq:
+		h.handleCreateRoom(conn, client, m)
+	case *protocol.JoinRoomReq:
+		h.handleJoinRoom(conn, client, m)
+	case *protocol.LeaveRoomReq:
+		h.handleLeaveRoom(conn, client, m)
+	case *protocol.RoomListReq:
+		h.handleRoomList(conn, client, m)
+	case *protocol.MoveReq:
+		h.handleMove(conn, client, m)
+	case *protocol.ForfeitReq:
+		h.handleForfeit(conn, client, m)
+	case *protocol.BoardSyncReq:
+		h.handleBoardSync(conn, client, m)
+	case *protocol.RoomSettingsReq:
+		h.handleRoomSettings(conn, client, m)
+	case *protocol.ReadyReq:
+		h.handleReady(conn, client, m)
+	case *protocol.KickPlayerReq:
+		h.handleKickPlayer(conn, client, m)
+	case *protocol.LockRoomReq:
+		h.handleLockRoom(conn, client, m)
+	case *protocol.SessionListReq:
+		h.handleSessionList(conn, client, m)
+	case *protocol.ChangePasswordReq:
+		h.handleChangePassword(conn, client, m)
+	case *protocol.ClaimAccountReq:
+		h.handleClaimAccount(conn, client, m)
+	case *protocol.UpdateProfileReq:
+		h.handleUpdateProfile(conn, client, m)
+	case *protocol.ChatReq:
+		h.handleChat(conn, client, m)
+	case *protocol.RematchRequest:
+		h.handleRematchRequest(conn, client, m)
+	case *protocol.RematchAccept:
+		h.handleRematchAccept(conn, client, m)
+	case *protocol.CorrespondenceListReq:
+		h.handleCorrespondenceList(conn, client, m)
+	case *protocol.CorrespondenceOpenReq:
+		h.handleCorrespondenceOpen(conn, client, m)
+	case *protocol.LeaderboardReq:
+		h.handleLeaderboard(conn, client, m)
+	case *protocol.UserStatsReq:
+		h.handleUserStats(conn, client, m)
+	case *protocol.TournamentCreateReq:
+		h.handleTournamentCreate(conn, client, m)
+	case *protocol.TournamentJoinReq:
+		h.handleTournamentJoin(conn, client, m)
+	case *protocol.TournamentStartReq:
+		h.handleTournamentStart(conn, client, m)
+	case *protocol.TournamentBracketReq:
+		h.handleTournamentBracket(conn, client, m)
+	case *protocol.TournamentCheckInReq:
+		h.handleTournamentCheckIn(conn, client, m)
 	default:
 		h.sendError(conn, 400, "unknown message type")
 	}
 }
 
 func (h *WSHandler) handlePing(conn *websocket.Conn, client *WSClient) {
-	if client != nil && client.Token != "" {
-		h.sessionService.Refresh(client.Token)
+	if client != nil && client.SessionID != "" {
+		h.sessionService.Refresh(client.SessionID, client.UserID)
 	}
 	h.sendMessage(conn, protocol.TypePong, &protocol.PongResp{})
 }
 
-func (h *WSHandler) handleLogin(conn *websocket.Conn, payload json.RawMessage) *WSClient {
-	var req protocol.LoginReq
-	if err := json.Unmarshal(payload, &req); err != nil {
-		h.sendMessage(conn, protocol.TypeLoginResp, &protocol.LoginResp{Code: 400, Message: "invalid payload"})
-		return nil
-	}
-
+func (h *WSHandler) handleLogin(conn *websocket.Conn, req *protocol.LoginReq) *WSClient {
 	resp := &protocol.LoginResp{}
 
 	if req.Token != "" {
-		sess, err := h.sessionService.Validate(req.Token)
+		claims, err := service.VerifyAccessToken(req.Token)
 		if err != nil {
 			resp.Code = 401
 			resp.Message = "invalid or expired token"
@@ -150,41 +292,83 @@ func (h *WSHandler) handleLogin(conn *websocket.Conn, payload json.RawMessage) *
 			return nil
 		}
 
+		if err := h.moderation.CheckLogin(claims.UserID); err != nil {
+			resp.Code = 500
+			resp.Message = "failed to check account status"
+			if code, info, ok := sanctionResponse(err); ok {
+				resp.Code = code
+				resp.Message = err.Error()
+				resp.Sanction = info
+				h.sessionService.Delete(claims.SessionID)
+			}
+			h.sendMessage(conn, protocol.TypeLoginResp, resp)
+			return nil
+		}
+
+		// The token outlives a logout or revocation, the session does not.
+		sess, err := h.sessionService.Get(claims.SessionID)
+		if err != nil || sess.UserID != claims.UserID {
+			resp.Code = 401
+			resp.Message = "session expired or revoked"
+			h.sendMessage(conn, protocol.TypeLoginResp, resp)
+			return nil
+		}
+
 		resp.Code = 200
 		resp.Message = "login success via token"
-		resp.Token = sess.Token
-		resp.UserID = sess.UserID
+		resp.Token = req.Token
+		resp.UserID = claims.UserID
+		resp.Role = string(sess.Role)
 
 		client := &WSClient{
 			Conn:       conn,
-			UserID:     sess.UserID,
-			Token:      sess.Token,
-			Username:   sess.Username,
+			UserID:     claims.UserID,
+			SessionID:  claims.SessionID,
+			username:   sess.Username,
 			LastActive: time.Now(),
+			role:       sess.Role,
 		}
 
-		h.mu.Lock()
-		h.clients[sess.UserID] = client
-		h.mu.Unlock()
+		h.addClient(client)
 
-		h.sessionService.SetUserOnline(sess.UserID, sess.Token)
+		h.sessionService.SetUserOnline(claims.UserID, claims.SessionID)
 		h.sendMessage(conn, protocol.TypeLoginResp, resp)
-		log.Printf("WebSocket User %d logged in via token", sess.UserID)
+		h.enforceSessionPolicy(client)
+		h.sendBoardSnapshots(conn, client)
+		h.notifyCorrespondenceTurn(conn, claims.UserID)
+		log.Printf("WebSocket User %d logged in via token", claims.UserID)
 		return client
 	}
 
-	user, token, err := h.userService.Login(&model.UserLoginRequest{
+	user, err := h.userService.Login(&model.UserLoginRequest{
 		Username: req.Username,
 		Password: req.Password,
+		IP:       remoteIP(conn.RemoteAddr()),
 	})
 	if err != nil {
 		resp.Code = 401
 		resp.Message = err.Error()
+		if code, info, ok := sanctionResponse(err); ok {
+			resp.Code = code
+			resp.Sanction = info
+		}
+		if code, retryAfter, ok := lockoutResponse(err); ok {
+			resp.Code = code
+			resp.RetryAfter = retryAfter
+		}
 		h.sendMessage(conn, protocol.TypeLoginResp, resp)
 		return nil
 	}
 
-	if err := h.sessionService.Create(user.ID, user.Username, token); err != nil {
+	sess := &service.Session{
+		UserID:   user.ID,
+		Username: user.Username,
+		Role:     user.Role,
+		Device:   loginDevice(req.Device, metrics.TransportWS),
+		IP:       remoteIP(conn.RemoteAddr()),
+	}
+	pair, err := h.sessionService.Start(sess)
+	if err != nil {
 		resp.Code = 500
 		resp.Message = "failed to create session"
 		h.sendMessage(conn, protocol.TypeLoginResp, resp)
@@ -193,43 +377,105 @@ func (h *WSHandler) handleLogin(conn *websocket.Conn, payload json.RawMessage) *
 
 	resp.Code = 200
 	resp.Message = "login success"
-	resp.Token = token
+	resp.Token = pair.AccessToken
+	resp.RefreshToken = pair.RefreshToken
+	resp.ExpiresIn = pair.ExpiresIn
 	resp.UserID = user.ID
+	resp.Role = string(user.Role)
 
 	client := &WSClient{
 		Conn:       conn,
 		UserID:     user.ID,
-		Token:      token,
-		Username:   user.Username,
+		SessionID:  sess.ID,
+		username:   user.Username,
 		LastActive: time.Now(),
+		role:       user.Role,
 	}
 
-	h.mu.Lock()
-	h.clients[user.ID] = client
-	h.mu.Unlock()
+	h.addClient(client)
 
-	h.sessionService.SetUserOnline(user.ID, token)
+	h.sessionService.SetUserOnline(user.ID, sess.ID)
 	h.sendMessage(conn, protocol.TypeLoginResp, resp)
+	h.enforceSessionPolicy(client)
+	h.sendBoardSnapshots(conn, client)
+	h.notifyCorrespondenceTurn(conn, user.ID)
 	log.Printf("WebSocket User %d logged in", user.ID)
 	return client
 }
 
-func (h *WSHandler) handleRegister(conn *websocket.Conn, payload json.RawMessage) {
-	var req protocol.RegisterReq
-	if err := json.Unmarshal(payload, &req); err != nil {
-		h.sendMessage(conn, protocol.TypeRegisterResp, &protocol.RegisterResp{Code: 400, Message: "invalid payload"})
-		return
+// handleGuestLogin creates a guest account and logs the connection in to it.
+func (h *WSHandler) handleGuestLogin(conn *websocket.Conn, req *protocol.GuestLoginReq) *WSClient {
+	resp := &protocol.GuestLoginResp{}
+
+	user, err := h.userService.CreateGuest(remoteIP(conn.RemoteAddr()))
+	if err != nil {
+		resp.Code = 500
+		resp.Message = "failed to create guest account"
+		if code, retryAfter, ok := lockoutResponse(err); ok {
+			resp.Code = code
+			resp.Message = err.Error()
+			resp.RetryAfter = retryAfter
+		}
+		h.sendMessage(conn, protocol.TypeGuestLoginResp, resp)
+		return nil
+	}
+
+	sess := &service.Session{
+		UserID:   user.ID,
+		Username: user.Username,
+		Role:     user.Role,
+		Device:   loginDevice(req.Device, metrics.TransportWS),
+		IP:       remoteIP(conn.RemoteAddr()),
+	}
+	pair, err := h.sessionService.Start(sess)
+	if err != nil {
+		resp.Code = 500
+		resp.Message = "failed to create session"
+		h.sendMessage(conn, protocol.TypeGuestLoginResp, resp)
+		return nil
+	}
+
+	resp.Code = 200
+	resp.Message = "guest login success"
+	resp.Token = pair.AccessToken
+	resp.RefreshToken = pair.RefreshToken
+	resp.ExpiresIn = pair.ExpiresIn
+	resp.UserID = user.ID
+	resp.Username = user.Username
+	resp.Role = string(user.Role)
+
+	client := &WSClient{
+		Conn:       conn,
+		UserID:     user.ID,
+		SessionID:  sess.ID,
+		username:   user.Username,
+		LastActive: time.Now(),
+		role:       user.Role,
 	}
 
+	h.addClient(client)
+
+	h.sessionService.SetUserOnline(user.ID, sess.ID)
+	h.sendMessage(conn, protocol.TypeGuestLoginResp, resp)
+	log.Printf("WebSocket guest %d (%s) logged in", user.ID, user.Username)
+	return client
+}
+
+func (h *WSHandler) handleRegister(conn *websocket.Conn, req *protocol.RegisterReq) {
 	resp := &protocol.RegisterResp{}
 
 	user, err := h.userService.Register(&model.UserRegisterRequest{
 		Username: req.Username,
 		Password: req.Password,
+		IP:       remoteIP(conn.RemoteAddr()),
 	})
 	if err != nil {
 		resp.Code = 400
 		resp.Message = err.Error()
+		if code, retryAfter, ok := lockoutResponse(err); ok {
+			resp.Code = code
+			resp.RetryAfter = retryAfter
+		}
 		h.sendMessage(conn, protocol.TypeRegisterResp, resp)
 		return
 	}
@@ -242,25 +488,54 @@ func (h *WSHandler) handleRegister(conn *websocket.Conn, payload json.RawMessage
 	log.Printf("WebSocket User %d registered", user.ID)
 }
 
-func (h *WSHandler) handleCreateRoom(conn *websocket.Conn, client *WSClient, payload json.RawMessage) {
-	var req protocol.CreateRoomReq
-	json.Unmarshal(payload, &req)
+func (h *WSHandler) handleRefreshToken(conn *websocket.Conn, req *protocol.RefreshTokenReq) {
+	resp := &protocol.RefreshTokenResp{}
+
+	_, pair, err := h.sessionService.Rotate(req.RefreshToken)
+	if err != nil {
+		resp.Code = refreshErrorCode(err)
+		resp.Message = err.Error()
+		h.sendMessage(conn, protocol.TypeRefreshTokenResp, resp)
+		return
+	}
 
+	resp.Code = 200
+	resp.Message = "token refreshed"
+	resp.AccessToken = pair.AccessToken
+	resp.RefreshToken = pair.RefreshToken
+	resp.ExpiresIn = pair.ExpiresIn
+	h.sendMessage(conn, protocol.TypeRefreshTokenResp, resp)
+}
+
+func (h *WSHandler) handleCreateRoom(conn *websocket.Conn, client *WSClient, req *protocol.CreateRoomReq) {
 	resp := &protocol.CreateRoomResp{}
 
-	if client.RoomID != 0 {
+	if service.IsDraining() {
+		resp.Code = 503
+		resp.Message = service.ErrServerDraining.Error()
+		h.sendMessage(conn, protocol.TypeCreateRoomResp, resp)
+		return
+	}
+
+	if client.Rooms.Len() >= MaxRoomsPerUser {
 		resp.Code = 400
-		resp.Message = "already in a room, please leave first"
+		resp.Message = "too many rooms, please leave one first"
 		h.sendMessage(conn, protocol.TypeCreateRoomResp, resp)
 		return
 	}
 
 	roomName := req.RoomName
 	if roomName == "" {
-		roomName = client.Username + "'s room"
+		roomName = client.Username() + "'s room"
 	}
 
-	room, err := h.roomService.CreateRoom(roomName, client.UserID)
+	var room *model.Room
+	var err error
+	if req.Correspondence {
+		room, err = h.roomService.CreateCorrespondenceRoom(roomName, client.UserID, service.NormalizeDaysPerMove(req.DaysPerMove))
+	} else {
+		room, err = h.roomService.CreateRoom(roomName, client.UserID)
+	}
 	if err != nil {
 		resp.Code = 500
 		resp.Message = err.Error()
@@ -268,7 +543,11 @@ func (h *WSHandler) handleCreateRoom(conn *websocket.Conn, client *WSClient, pay
 		return
 	}
 
-	client.RoomID = room.ID
+	if !client.Can(model.PermRanked) {
+		h.roomService.MakeCasual(room.ID)
+	}
+
+	client.Rooms.Add(room.ID)
 
 	resp.Code = 200
 	resp.Message = "room created"
@@ -278,15 +557,19 @@ func (h *WSHandler) handleCreateRoom(conn *websocket.Conn, client *WSClient, pay
 	log.Printf("WebSocket User %d created room %d", client.UserID, room.ID)
 }
 
-func (h *WSHandler) handleJoinRoom(conn *websocket.Conn, client *WSClient, payload json.RawMessage) {
-	var req protocol.JoinRoomReq
-	json.Unmarshal(payload, &req)
-
+func (h *WSHandler) handleJoinRoom(conn *websocket.Conn, client *WSClient, req *protocol.JoinRoomReq) {
 	resp := &protocol.JoinRoomResp{}
 
-	if client.RoomID != 0 {
+	if client.Rooms.Has(req.RoomID) {
 		resp.Code = 400
-		resp.Message = "already in a room, please leave first"
+		resp.Message = "already in this room"
+		h.sendMessage(conn, protocol.TypeJoinRoomResp, resp)
+		return
+	}
+
+	if client.Rooms.Len() >= MaxRoomsPerUser {
+		resp.Code = 400
+		resp.Message = "too many rooms, please leave one first"
 		h.sendMessage(conn, protocol.TypeJoinRoomResp, resp)
 		return
 	}
@@ -299,14 +582,28 @@ func (h *WSHandler) handleJoinRoom(conn *websocket.Conn, client *WSClient, paylo
 		return
 	}
 
-	if err := h.roomService.JoinRoom(req.RoomID, client.UserID); err != nil {
+	if room.IsTournament() {
+		resp.Code = 403
+		resp.Message = "tournament rooms can only be entered by checking in"
+		h.sendMessage(conn, protocol.TypeJoinRoomResp, resp)
+		return
+	}
+
+	join := h.roomService.JoinRoom
+	if !client.Can(model.PermRanked) {
+		join = h.roomService.JoinRoomCasual
+	}
+	if err := join(req.RoomID, client.UserID); err != nil {
 		resp.Code = 400
+		if errors.Is(err, service.ErrRoomRated) {
+			resp.Code = 403
+		}
 		resp.Message = err.Error()
 		h.sendMessage(conn, protocol.TypeJoinRoomResp, resp)
 		return
 	}
 
-	client.RoomID = room.ID
+	client.Rooms.Add(room.ID)
 
 	resp.Code = 200
 	resp.Message = "joined room"
@@ -317,32 +614,35 @@ func (h *WSHandler) handleJoinRoom(conn *websocket.Conn, client *WSClient, paylo
 	h.broadcastToRoom(room.ID, &protocol.PlayerJoin{
 		RoomID:   room.ID,
 		UserID:   client.UserID,
-		Username: client.Username,
+		Username: client.Username(),
 	}, client.UserID)
 
 	log.Printf("WebSocket User %d joined room %d", client.UserID, room.ID)
-
-	room, _ = h.roomService.GetRoom(room.ID)
-	if room != nil && room.IsFull() {
-		h.startGame(room)
-	}
 }
 
-func (h *WSHandler) handleLeaveRoom(conn *websocket.Conn, client *WSClient, payload json.RawMessage) {
+func (h *WSHandler) handleLeaveRoom(conn *websocket.Conn, client *WSClient, req *protocol.LeaveRoomReq) {
 	resp := &protocol.LeaveRoomResp{}
 
-	if client.RoomID == 0 {
+	roomID, ok := client.Rooms.Resolve(req.RoomID)
+	if !ok {
 		resp.Code = 400
-		resp.Message = "not in any room"
+		resp.Message = "not in this room"
 		h.sendMessage(conn, protocol.TypeLeaveRoomResp, resp)
 		return
 	}
 
-	roomID := client.RoomID
-
-	_, err := h.roomService.GetRoom(roomID)
+	room, err := h.roomService.GetRoom(roomID)
+	if err == nil && room.IsCorrespondenceGame() {
+		if game, _ := h.gameService.GetGame(roomID); game != nil && !game.IsFinished() {
+			client.Rooms.Remove(roomID)
+			resp.Code = 200
+			resp.Message = "left room, correspondence game continues"
+			h.sendMessage(conn, protocol.TypeLeaveRoomResp, resp)
+			return
+		}
+	}
 	if err != nil {
-		client.RoomID = 0
+		client.Rooms.Remove(roomID)
 		resp.Code = 200
 		resp.Message = "left room"
 		h.sendMessage(conn, protocol.TypeLeaveRoomResp, resp)
@@ -355,6 +655,7 @@ func (h *WSHandler) handleLeaveRoom(conn *websocket.Conn, client *WSClient, payl
 		Reason: "player left",
 	}, 0)
 
+	owner := room.CreatorID
 	if err := h.roomService.LeaveRoom(roomID, client.UserID); err != nil {
 		resp.Code = 400
 		resp.Message = err.Error()
@@ -362,7 +663,8 @@ func (h *WSHandler) handleLeaveRoom(conn *websocket.Conn, client *WSClient, payl
 		return
 	}
 
-	client.RoomID = 0
+	client.Rooms.Remove(roomID)
+	h.announceOwner(roomID, owner)
 
 	resp.Code = 200
 	resp.Message = "left room"
@@ -371,7 +673,7 @@ func (h *WSHandler) handleLeaveRoom(conn *websocket.Conn, client *WSClient, payl
 	log.Printf("WebSocket User %d left room %d", client.UserID, roomID)
 }
 
-func (h *WSHandler) handleRoomList(conn *websocket.Conn, client *WSClient, payload json.RawMessage) {
+func (h *WSHandler) handleRoomList(conn *websocket.Conn, client *WSClient, req *protocol.RoomListReq) {
 	resp := &protocol.RoomListResp{}
 
 	rooms := h.roomService.ListWaitingRooms()
@@ -379,11 +681,16 @@ func (h *WSHandler) handleRoomList(conn *websocket.Conn, client *WSClient, paylo
 	roomInfos := make([]*protocol.RoomInfo, 0, len(rooms))
 	for _, room := range rooms {
 		roomInfos = append(roomInfos, &protocol.RoomInfo{
-			RoomID:    room.ID,
-			RoomName:  room.Name,
-			Players:   room.Players,
-			CreatorID: room.CreatorID,
-			Status:    int(room.Status),
+			RoomID:         room.ID,
+			RoomName:       room.Name,
+			Players:        room.Players,
+			CreatorID:      room.CreatorID,
+			Status:         int(room.Status),
+			Correspondence: room.Correspondence,
+			DaysPerMove:    room.DaysPerMove,
+			Settings:       toRoomSettings(room.Settings),
+			Ready:          room.ReadyPlayers(),
+			Locked:         room.Locked,
 		})
 	}
 
@@ -394,21 +701,18 @@ func (h *WSHandler) handleRoomList(conn *websocket.Conn, client *WSClient, paylo
 	h.sendMessage(conn, protocol.TypeRoomListResp, resp)
 }
 
-func (h *WSHandler) handleMove(conn *websocket.Conn, client *WSClient, payload json.RawMessage) {
-	var req protocol.MoveReq
-	json.Unmarshal(payload, &req)
-
+func (h *WSHandler) handleMove(conn *websocket.Conn, client *WSClient, req *protocol.MoveReq) {
+	start := time.Now()
 	resp := &protocol.MoveResp{}
 
-	if client.RoomID == 0 {
+	roomID, ok := client.Rooms.Resolve(req.RoomID)
+	if !ok {
 		resp.Code = 400
-		resp.Message = "not in any room"
+		resp.Message = "not in this room"
 		h.sendMessage(conn, protocol.TypeMoveResp, resp)
 		return
 	}
 
-	roomID := client.RoomID
-
 	game, err := h.gameService.GetGame(roomID)
 	if err != nil {
 		resp.Code = 404
@@ -424,7 +728,35 @@ func (h *WSHandler) handleMove(conn *websocket.Conn, client *WSClient, payload j
 		return
 	}
 
-	if err := h.gameService.MakeMove(roomID, client.UserID, req.X, req.Y); err != nil {
+	// A correspondence move is stored before it is played, so the live game
+	// never gets ahead of the database. Should the live move then fail, the
+	// next move hits the stale check and the game is reopened from storage.
+	if room, err := h.roomService.GetRoom(roomID); err == nil && room.IsCorrespondenceGame() {
+		next := game.Clone()
+		if err := next.MakeMove(client.UserID, req.X, req.Y); err != nil {
+			resp.Code = 400
+			resp.Message = err.Error()
+			h.sendMessage(conn, protocol.TypeMoveResp, resp)
+			return
+		}
+		if err := h.corrService.RecordMove(room.GameID, room.DaysPerMove, next, req.X, req.Y); err != nil {
+			log.Printf("Failed to store correspondence move: %v", err)
+			if errors.Is(err, repository.ErrCorrespondenceStale) {
+				h.dropCorrespondenceRoom(room)
+				resp.Code = 409
+				resp.Message = "game was updated elsewhere, please reopen it"
+				h.sendMessage(conn, protocol.TypeMoveResp, resp)
+				return
+			}
+			resp.Code = 500
+			resp.Message = "failed to save move"
+			h.sendMessage(conn, protocol.TypeMoveResp, resp)
+			return
+		}
+	}
+
+	moveNumber, err := h.gameService.MakeMove(roomID, client.UserID, req.X, req.Y)
+	if err != nil {
 		resp.Code = 400
 		resp.Message = err.Error()
 		h.sendMessage(conn, protocol.TypeMoveResp, resp)
@@ -444,48 +776,70 @@ func (h *WSHandler) handleMove(conn *websocket.Conn, client *WSClient, payload j
 		return
 	}
 
-	boardUpdate := &protocol.BoardUpdate{
-		RoomID:        roomID,
-		Board:         game.GetBoardCopy(),
-		LastX:         req.X,
-		LastY:         req.Y,
-		LastPlayer:    client.UserID,
-		CurrentPlayer: game.CurrentPlayer(),
-	}
-
-	h.broadcastToRoom(roomID, boardUpdate, 0)
+	h.broadcastMove(roomID, game, moveDelta(game, moveNumber, req.X, req.Y, client.UserID))
+	metrics.MoveLatency.WithLabelValues(metrics.TransportWS).Observe(time.Since(start).Seconds())
 
 	if game.IsFinished() {
+		metrics.GameOutcomes.WithLabelValues(metrics.TransportWS, metrics.OutcomeFiveInRow).Inc()
+		h.roomService.RecordResult(roomID, game.Winner)
 		gameOver := &protocol.GameOver{
 			RoomID:  roomID,
 			Winner:  game.Winner,
 			WinLine: game.WinLine,
+			Series:  h.seriesScore(roomID),
 		}
 		h.broadcastToRoom(roomID, gameOver, 0)
 		h.gameService.EndGame(roomID)
 		h.roomService.SetRoomStatus(roomID, model.RoomStatusFinished)
 
-		h.updateGameResult(roomID, game.Players, game.Winner)
+		h.updateGameResult(roomID, game, game.Winner)
+		h.finishTournamentGame(roomID, game.Winner)
 
 		log.Printf("Game finished in room %d, winner: %d", roomID, game.Winner)
+		return
+	}
+
+	h.armMoveTimer(roomID, game)
+}
+
+// handleBoardSync answers a client that missed a move with the full board.
+func (h *WSHandler) handleBoardSync(conn *websocket.Conn, client *WSClient, req *protocol.BoardSyncReq) {
+	roomID, ok := client.Rooms.Resolve(req.RoomID)
+	if !ok {
+		h.sendError(conn, 400, "not in this room")
+		return
+	}
+
+	game, err := h.gameService.GetGame(roomID)
+	if err != nil {
+		h.sendError(conn, 404, "game not found")
+		return
 	}
+
+	h.sendMessage(conn, protocol.TypeBoardUpdate, boardSnapshot(game))
 }
 
-func (h *WSHandler) handleForfeit(conn *websocket.Conn, client *WSClient, payload json.RawMessage) {
-	var req protocol.ForfeitReq
-	json.Unmarshal(payload, &req)
+// sendBoardSnapshots sends the board of every game the connection took
+// over from the user's older connections when it logged in.
+func (h *WSHandler) sendBoardSnapshots(conn *websocket.Conn, client *WSClient) {
+	for _, roomID := range client.Rooms.List() {
+		if game, err := h.gameService.GetGame(roomID); err == nil {
+			h.sendMessage(conn, protocol.TypeBoardUpdate, boardSnapshot(game))
+		}
+	}
+}
 
+func (h *WSHandler) handleForfeit(conn *websocket.Conn, client *WSClient, req *protocol.ForfeitReq) {
 	resp := &protocol.ForfeitResp{}
 
-	if client.RoomID == 0 {
+	roomID, ok := client.Rooms.Resolve(req.RoomID)
+	if !ok {
 		resp.Code = 400
-		resp.Message = "not in any room"
+		resp.Message = "not in this room"
 		h.sendMessage(conn, protocol.TypeForfeitResp, resp)
 		return
 	}
 
-	roomID := client.RoomID
-
 	winner, err := h.gameService.Forfeit(roomID, client.UserID)
 	if err != nil {
 		resp.Code = 400
@@ -494,36 +848,42 @@ func (h *WSHandler) handleForfeit(conn *websocket.Conn, client *WSClient, payloa
 		return
 	}
 
+	if room, err := h.roomService.GetRoom(roomID); err == nil && room.IsCorrespondenceGame() && winner != 0 {
+		if err := h.corrService.Resign(room.GameID, winner); err != nil {
+			log.Printf("Failed to store correspondence resignation: %v", err)
+		}
+	}
+
 	resp.Code = 200
 	resp.Message = "forfeit success"
 	resp.Winner = winner
 
 	h.sendMessage(conn, protocol.TypeForfeitResp, resp)
 
+	metrics.GameOutcomes.WithLabelValues(metrics.TransportWS, metrics.OutcomeForfeit).Inc()
+	h.roomService.RecordResult(roomID, winner)
 	gameOver := &protocol.GameOver{
 		RoomID: roomID,
 		Winner: winner,
+		Series: h.seriesScore(roomID),
 	}
 	h.broadcastToRoom(roomID, gameOver, 0)
 
+	game, _ := h.gameService.GetGame(roomID)
 	h.gameService.EndGame(roomID)
 	h.roomService.SetRoomStatus(roomID, model.RoomStatusFinished)
 
-	game, _ := h.gameService.GetGame(roomID)
 	if game != nil {
-		h.updateGameResult(roomID, game.Players, winner)
-	} else {
-		players, _ := h.roomService.GetRoomPlayers(roomID)
-		h.updateGameResult(roomID, players, winner)
+		h.updateGameResult(roomID, game, winner)
+	}
+	if winner != 0 {
+		h.finishTournamentGame(roomID, winner)
 	}
 
 	log.Printf("WebSocket User %d forfeited, winner: %d in room %d", client.UserID, winner, roomID)
 }
 
-func (h *WSHandler) handleLeaderboard(conn *websocket.Conn, client *WSClient, payload json.RawMessage) {
-	var req protocol.LeaderboardReq
-	json.Unmarshal(payload, &req)
-
+func (h *WSHandler) handleLeaderboard(conn *websocket.Conn, client *WSClient, req *protocol.LeaderboardReq) {
 	resp := &protocol.LeaderboardResp{}
 
 	limit := req.Limit
@@ -542,13 +902,14 @@ func (h *WSHandler) handleLeaderboard(conn *websocket.Conn, client *WSClient, pa
 	ranks := make([]*protocol.RankEntry, 0, len(entries))
 	for _, e := range entries {
 		ranks = append(ranks, &protocol.RankEntry{
-			UserID:    e.UserID,
-			Username:  e.Username,
-			Score:     e.Score,
-			WinCount:  e.WinCount,
-			LoseCount: e.LoseCount,
-			WinRate:   e.WinRate,
-			Rank:      e.Rank,
+			UserID:      e.UserID,
+			Username:    e.Username,
+			DisplayName: e.DisplayName,
+			Score:       e.Score,
+			WinCount:    e.WinCount,
+			LoseCount:   e.LoseCount,
+			WinRate:     e.WinRate,
+			Rank:        e.Rank,
 		})
 	}
 
@@ -559,10 +920,7 @@ func (h *WSHandler) handleLeaderboard(conn *websocket.Conn, client *WSClient, pa
 	h.sendMessage(conn, protocol.TypeLeaderboardResp, resp)
 }
 
-func (h *WSHandler) handleUserStats(conn *websocket.Conn, client *WSClient, payload json.RawMessage) {
-	var req protocol.UserStatsReq
-	json.Unmarshal(payload, &req)
-
+func (h *WSHandler) handleUserStats(conn *websocket.Conn, client *WSClient, req *protocol.UserStatsReq) {
 	resp := &protocol.UserStatsResp{}
 
 	userID := req.UserID
@@ -592,6 +950,10 @@ func (h *WSHandler) handleUserStats(conn *websocket.Conn, client *WSClient, payl
 	resp.Message = "success"
 	resp.UserID = user.ID
 	resp.Username = user.Username
+	resp.DisplayName = user.DisplayName
+	resp.AvatarID = user.AvatarID
+	resp.Country = user.Country
+	resp.Bio = user.Bio
 	resp.Score = score
 	resp.WinCount = winCount
 	resp.LoseCount = loseCount
@@ -602,22 +964,34 @@ func (h *WSHandler) handleUserStats(conn *websocket.Conn, client *WSClient, payl
 }
 
 func (h *WSHandler) handleDisconnect(client *WSClient) {
-	if client.RoomID == 0 {
-		return
+	for _, roomID := range client.Rooms.List() {
+		h.leaveOnDisconnect(client, roomID)
 	}
+}
 
-	roomID := client.RoomID
-
+func (h *WSHandler) leaveOnDisconnect(client *WSClient, roomID int64) {
 	game, _ := h.gameService.GetGame(roomID)
+	if room, err := h.roomService.GetRoom(roomID); err == nil && room.IsCorrespondenceGame() && game != nil && !game.IsFinished() {
+		client.Rooms.Remove(roomID)
+		log.Printf("WebSocket User %d disconnected, correspondence game %d stays open", client.UserID, room.GameID)
+		return
+	}
+
 	if game != nil && !game.IsFinished() {
 		winner, _ := h.gameService.Forfeit(roomID, client.UserID)
 		if winner != 0 {
+			metrics.GameOutcomes.WithLabelValues(metrics.TransportWS, metrics.OutcomeDisconnect).Inc()
+			h.roomService.RecordResult(roomID, winner)
 			h.broadcastToRoom(roomID, &protocol.GameOver{
 				RoomID: roomID,
 				Winner: winner,
+				Series: h.seriesScore(roomID),
 			}, 0)
 		}
 		h.gameService.EndGame(roomID)
+		if winner != 0 {
+			h.finishTournamentGame(roomID, winner)
+		}
 	}
 
 	h.broadcastToRoom(roomID, &protocol.PlayerLeave{
@@ -626,14 +1000,19 @@ func (h *WSHandler) handleDisconnect(client *WSClient) {
 		Reason: "player disconnected",
 	}, 0)
 
+	var owner int64
+	if room, err := h.roomService.GetRoom(roomID); err == nil {
+		owner = room.CreatorID
+	}
 	h.roomService.LeaveRoom(roomID, client.UserID)
-	client.RoomID = 0
+	client.Rooms.Remove(roomID)
+	h.announceOwner(roomID, owner)
 
 	log.Printf("WebSocket User %d disconnected from room %d", client.UserID, roomID)
 }
 
 func (h *WSHandler) startGame(room *model.Room) {
-	game, err := h.gameService.StartGame(room.ID, room.Players)
+	game, err := h.gameService.StartGame(room.ID, room.Players, room.Settings)
 	if err != nil {
 		log.Printf("Failed to start game: %v", err)
 		return
@@ -641,13 +1020,25 @@ func (h *WSHandler) startGame(room *model.Room) {
 
 	h.roomService.SetRoomStatus(room.ID, model.RoomStatusPlaying)
 
+	if room.Correspondence {
+		cg, err := h.corrService.Create(game, room.DaysPerMove, room.Settings.Rated)
+		if err != nil {
+			log.Printf("Failed to store correspondence game: %v", err)
+		} else {
+			h.roomService.SetRoomGameID(room.ID, cg.ID)
+		}
+	}
+
 	gameStart := &protocol.GameStart{
 		RoomID:      room.ID,
 		Players:     room.Players,
 		FirstPlayer: game.CurrentPlayer(),
+		Settings:    toRoomSettings(room.Settings),
+		Series:      h.seriesScore(room.ID),
 	}
 
 	h.broadcastToRoom(room.ID, gameStart, 0)
+	h.armMoveTimer(room.ID, game)
 	log.Printf("Game started in room %d, first player: %d", room.ID, game.CurrentPlayer())
 }
 
@@ -664,18 +1055,146 @@ func (h *WSHandler) broadcastToRoom(roomID int64, msg protocol.Message, excludeU
 		if playerID == excludeUserID {
 			continue
 		}
-		if client, ok := h.clients[playerID]; ok {
+		for _, client := range h.clients[playerID] {
+			h.sendMessage(client.Conn, msg.MessageType(), msg)
+		}
+	}
+}
+
+// broadcastMove sends a move to the room: as a BoardDelta to connections
+// that negotiated FeatureDeltaBoard and as a full BoardUpdate to the rest.
+func (h *WSHandler) broadcastMove(roomID int64, game *model.Game, delta *protocol.BoardDelta) {
+	players, err := h.roomService.GetRoomPlayers(roomID)
+	if err != nil {
+		return
+	}
+
+	var update *protocol.BoardUpdate
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, playerID := range players {
+		for _, client := range h.clients[playerID] {
+			if h.stateOf(client.Conn).Has(protocol.FeatureDeltaBoard) {
+				h.sendMessage(client.Conn, protocol.TypeBoardDelta, delta)
+				continue
+			}
+			if update == nil {
+				update = moveUpdate(game, delta)
+			}
+			h.sendMessage(client.Conn, protocol.TypeBoardUpdate, update)
+		}
+	}
+}
+
+func (h *WSHandler) broadcastToAll(msg protocol.Message, excludeUserID int64) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for userID, clients := range h.clients {
+		if userID == excludeUserID {
+			continue
+		}
+		for _, client := range clients {
 			h.sendMessage(client.Conn, msg.MessageType(), msg)
 		}
 	}
 }
 
+// textCodec decodes the payload of text frames, which are always JSON.
+var textCodec = protocol.NewCodecWith(protocol.JSON)
+
+// decodeTextFrame reads a text frame, a JSON WSMessage envelope. The
+// payload may be left out for requests without fields.
+func decodeTextFrame(data []byte) (protocol.Message, error) {
+	var wsMsg WSMessage
+	if err := json.Unmarshal(data, &wsMsg); err != nil {
+		return nil, err
+	}
+	if len(wsMsg.Payload) == 0 {
+		wsMsg.Payload = json.RawMessage("{}")
+	}
+	return textCodec.Decode(protocol.NewPacket(wsMsg.Type, 0, wsMsg.Payload))
+}
+
+// decodeBinaryFrame reads a binary frame, which carries one packet laid out
+// as on TCP and encoded with the connection's codec.
+func decodeBinaryFrame(state *connState, data []byte) (protocol.Message, error) {
+	pkt, err := protocol.ReadPacket(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return state.Codec().Decode(pkt)
+}
+
+// writePacket sends msg as a binary frame holding one packet.
+func writePacket(conn *websocket.Conn, state *connState, codec *protocol.Codec, msgType uint16, msg protocol.Message) error {
+	payload, err := codec.Serializer().Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if len(payload) > protocol.MaxBodyLen {
+		return protocol.ErrPacketTooLarge
+	}
+	data, err := protocol.NewPacket(msgType, 0, payload).Encode()
+	if err != nil {
+		return err
+	}
+	return writeFrame(conn, state, websocket.BinaryMessage, data)
+}
+
+// writeFrame sends one frame, deflated if the client negotiated
+// permessage-deflate when connecting and the frame is large enough to be
+// worth it. The compression setting applies to the next write, so both
+// calls happen under the connection's write lock.
+func writeFrame(conn *websocket.Conn, state *connState, frameType int, data []byte) error {
+	state.writeMu.Lock()
+	defer state.writeMu.Unlock()
+	conn.EnableWriteCompression(shouldCompress(len(data)))
+	return conn.WriteMessage(frameType, data)
+}
+
+// handleHello reports false when the client's protocol version is refused
+// and the connection should be closed.
+func (h *WSHandler) handleHello(conn *websocket.Conn, client *WSClient, state *connState, req *protocol.HelloReq) bool {
+	resp, codec := state.negotiate(client != nil, req)
+	h.sendMessage(conn, protocol.TypeHelloResp, resp)
+	if codec == nil {
+		return resp.Code != codeUnsupportedVersion
+	}
+	state.codec.Store(codec)
+	metrics.Handshakes.WithLabelValues(metrics.TransportWS, resp.Codec).Inc()
+	log.Printf("Hello from %s: %s %s, protocol %d, codec %s, features %v",
+		conn.RemoteAddr(), req.Client, req.ClientVersion, req.Version, resp.Codec, resp.Features)
+	return true
+}
+
+// sendMessage writes msg as a JSON text frame, or as a binary packet once
+// the connection has negotiated another codec.
 func (h *WSHandler) sendMessage(conn *websocket.Conn, msgType uint16, msg protocol.Message) {
-	resp := WSResponse{
-		Type:    msgType,
-		Payload: msg,
+	state := h.stateOf(conn)
+	if !state.Accepts(msgType) {
+		return
+	}
+
+	var err error
+	if codec := state.Codec(); codec.Serializer() == protocol.JSON {
+		var data []byte
+		data, err = json.Marshal(WSResponse{
+			Type:    msgType,
+			Payload: msg,
+		})
+		if err == nil {
+			err = writeFrame(conn, state, websocket.TextMessage, data)
+		}
+	} else {
+		err = writePacket(conn, state, codec, msgType, msg)
+	}
+	if err != nil {
+		return
 	}
-	conn.WriteJSON(resp)
+	metrics.PacketsOut.WithLabelValues(metrics.TransportWS, protocol.TypeName(msgType)).Inc()
 }
 
 func (h *WSHandler) sendError(conn *websocket.Conn, code int, message string) {
@@ -685,35 +1204,1388 @@ func (h *WSHandler) sendError(conn *websocket.Conn, code int, message string) {
 	})
 }
 
-func (h *WSHandler) RemoveClient(userID int64) {
-	h.mu.Lock()
-	delete(h.clients, userID)
-	h.mu.Unlock()
-}
-
-func (h *WSHandler) GetClient(userID int64) *WSClient {
+func (h *WSHandler) ClientCount() int {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-	return h.clients[userID]
+
+	n := 0
+	for _, clients := range h.clients {
+		n += len(clients)
+	}
+	return n
 }
 
-func (h *WSHandler) updateGameResult(roomID int64, players []int64, winner int64) {
-	if len(players) < 2 {
-		return
+func (h *WSHandler) RoomCount() int {
+	return len(h.roomService.ListRooms())
+}
+
+func (h *WSHandler) GameCount() int {
+	return len(h.gameService.RoomIDs())
+}
+
+// addClient registers a logged-in connection. Under the single-session
+// policy the rooms of the user's older connections move to the new one, so
+// their games continue there once the old connections are closed.
+func (h *WSHandler) addClient(client *WSClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if service.CurrentSessionPolicy() == service.SessionPolicySingle {
+		for _, old := range h.clients[client.UserID] {
+			for _, roomID := range old.Rooms.List() {
+				old.Rooms.Remove(roomID)
+				client.Rooms.Add(roomID)
+			}
+		}
 	}
+	h.clients[client.UserID] = append(h.clients[client.UserID], client)
+}
 
-	loser := int64(0)
-	for _, p := range players {
-		if p != winner {
-			loser = p
+// RemoveClient forgets one connection of a user. It reports whether that was
+// the user's last connection on this transport.
+func (h *WSHandler) RemoveClient(client *WSClient) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	clients := h.clients[client.UserID]
+	for i, c := range clients {
+		if c == client {
+			clients = append(clients[:i:i], clients[i+1:]...)
 			break
 		}
 	}
+	if len(clients) == 0 {
+		delete(h.clients, client.UserID)
+		return true
+	}
+	h.clients[client.UserID] = clients
+	return false
+}
+
+// dropClient forgets a logged-in connection and leaves the rooms it joined.
+func (h *WSHandler) dropClient(client *WSClient) {
+	if h.RemoveClient(client) {
+		h.sessionService.SetUserOffline(client.UserID, client.SessionID)
+	}
+	h.handleDisconnect(client)
+}
+
+// GetClient returns the user's most recent connection.
+func (h *WSHandler) GetClient(userID int64) *WSClient {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	clients := h.clients[userID]
+	if len(clients) == 0 {
+		return nil
+	}
+	return clients[len(clients)-1]
+}
+
+func (h *WSHandler) clientsOf(userID int64) []*WSClient {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return append([]*WSClient(nil), h.clients[userID]...)
+}
+
+// updateGameResult stores a finished live game with its moves and applies
+// the rating change if the room is rated. Correspondence games are stored
+// move by move already.
+func (h *WSHandler) updateGameResult(roomID int64, game *model.Game, winner int64) {
+	players := game.Players
+	if len(players) < 2 {
+		return
+	}
+
+	rated := true
+	gameType, gameID := model.GameTypeLive, int64(0)
+	if room, err := h.roomService.GetRoom(roomID); err == nil {
+		rated = room.Settings.Rated
+		if room.IsCorrespondenceGame() {
+			gameType, gameID = model.GameTypeCorrespondence, room.GameID
+		}
+	}
+	if gameType == model.GameTypeLive {
+		id, err := h.gameService.Record(game, winner)
+		if err != nil {
+			log.Printf("Failed to store game of room %d: %v", roomID, err)
+		}
+		gameID = id
+	}
+	if !rated {
+		return
+	}
+
+	loser := int64(0)
+	for _, p := range players {
+		if p != winner {
+			loser = p
+			break
+		}
+	}
+
+	if winner != 0 && loser != 0 {
+		h.userService.UpdateScore(winner, 25, true, gameType, gameID)
+		h.userService.UpdateScore(loser, -20, false, gameType, gameID)
 
-	if winner != 0 && loser != 0 {
-		h.userService.UpdateScore(winner, 25, true)
-		h.userService.UpdateScore(loser, -20, false)
-
 		log.Printf("Score updated: winner %d (+25), loser %d (-20)", winner, loser)
 	}
 }
+
+func (h *WSHandler) handleTournamentCreate(conn *websocket.Conn, client *WSClient, req *protocol.TournamentCreateReq) {
+	resp := &protocol.TournamentCreateResp{}
+
+	if service.IsDraining() {
+		resp.Code = 503
+		resp.Message = service.ErrServerDraining.Error()
+		h.sendMessage(conn, protocol.TypeTournamentCreateResp, resp)
+		return
+	}
+
+	name := req.Name
+	if name == "" {
+		name = client.Username() + "'s tournament"
+	}
+
+	t, err := h.tournaments.CreateTournament(name, model.TournamentFormat(req.Format), client.UserID,
+		req.MaxPlayers, time.Duration(req.NoShowSeconds)*time.Second)
+	if err != nil {
+		resp.Code = 400
+		resp.Message = err.Error()
+		h.sendMessage(conn, protocol.TypeTournamentCreateResp, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "tournament created"
+	resp.TournamentID = t.ID
+
+	h.sendMessage(conn, protocol.TypeTournamentCreateResp, resp)
+	log.Printf("WebSocket User %d created tournament %d", client.UserID, t.ID)
+}
+
+func (h *WSHandler) handleTournamentJoin(conn *websocket.Conn, client *WSClient, req *protocol.TournamentJoinReq) {
+	resp := &protocol.TournamentJoinResp{}
+
+	if !client.Can(model.PermRanked) {
+		resp.Code = 403
+		resp.Message = "guests cannot join tournaments"
+		h.sendMessage(conn, protocol.TypeTournamentJoinResp, resp)
+		return
+	}
+
+	if err := h.tournaments.Register(req.TournamentID, client.UserID); err != nil {
+		resp.Code = 400
+		resp.Message = err.Error()
+		h.sendMessage(conn, protocol.TypeTournamentJoinResp, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "joined tournament"
+	resp.TournamentID = req.TournamentID
+
+	h.sendMessage(conn, protocol.TypeTournamentJoinResp, resp)
+	log.Printf("WebSocket User %d joined tournament %d", client.UserID, req.TournamentID)
+}
+
+func (h *WSHandler) handleTournamentStart(conn *websocket.Conn, client *WSClient, req *protocol.TournamentStartReq) {
+	resp := &protocol.TournamentStartResp{}
+
+	if err := h.tournaments.Start(req.TournamentID, client.UserID); err != nil {
+		resp.Code = 400
+		if errors.Is(err, service.ErrNotTournamentOwner) {
+			resp.Code = 403
+		}
+		resp.Message = err.Error()
+		h.sendMessage(conn, protocol.TypeTournamentStartResp, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "tournament started"
+
+	h.sendMessage(conn, protocol.TypeTournamentStartResp, resp)
+	log.Printf("WebSocket User %d started tournament %d", client.UserID, req.TournamentID)
+}
+
+func (h *WSHandler) handleTournamentBracket(conn *websocket.Conn, client *WSClient, req *protocol.TournamentBracketReq) {
+	bracket, err := h.tournaments.GetBracket(req.TournamentID)
+	if err != nil {
+		h.sendMessage(conn, protocol.TypeTournamentBracketResp, &protocol.TournamentBracketResp{Code: 404, Message: err.Error()})
+		return
+	}
+
+	h.sendMessage(conn, protocol.TypeTournamentBracketResp, toBracketResp(bracket))
+}
+
+func (h *WSHandler) handleTournamentCheckIn(conn *websocket.Conn, client *WSClient, req *protocol.TournamentCheckInReq) {
+	resp := &protocol.TournamentCheckInResp{}
+
+	if service.IsDraining() {
+		resp.Code = 503
+		resp.Message = service.ErrServerDraining.Error()
+		h.sendMessage(conn, protocol.TypeTournamentCheckInResp, resp)
+		return
+	}
+
+	if client.Rooms.Len() >= MaxRoomsPerUser {
+		resp.Code = 400
+		resp.Message = "too many rooms, please leave one first"
+		h.sendMessage(conn, protocol.TypeTournamentCheckInResp, resp)
+		return
+	}
+
+	joined := false
+	match, ready, err := h.tournaments.CheckIn(req.TournamentID, req.MatchID, client.UserID, metrics.TransportWS, func(roomID int64) (int64, error) {
+		if roomID != 0 {
+			if err := h.roomService.JoinRoom(roomID, client.UserID); err == nil {
+				joined = true
+				return roomID, nil
+			} else if !errors.Is(err, service.ErrRoomNotFound) {
+				return 0, err
+			}
+		}
+
+		name := fmt.Sprintf("tournament %d match %d", req.TournamentID, req.MatchID)
+		room, err := h.roomService.CreateTournamentRoom(name, client.UserID, req.TournamentID, req.MatchID)
+		if err != nil {
+			return 0, err
+		}
+		return room.ID, nil
+	})
+	if err != nil {
+		resp.Code = 400
+		resp.Message = err.Error()
+		h.sendMessage(conn, protocol.TypeTournamentCheckInResp, resp)
+		return
+	}
+
+	client.Rooms.Add(match.RoomID)
+
+	resp.Code = 200
+	resp.Message = "checked in"
+	resp.RoomID = match.RoomID
+
+	h.sendMessage(conn, protocol.TypeTournamentCheckInResp, resp)
+
+	if joined {
+		h.broadcastToRoom(match.RoomID, &protocol.PlayerJoin{
+			RoomID:   match.RoomID,
+			UserID:   client.UserID,
+			Username: client.Username(),
+		}, client.UserID)
+	}
+
+	log.Printf("WebSocket User %d checked in for tournament %d match %d", client.UserID, req.TournamentID, req.MatchID)
+
+	if ready {
+		match, err = h.tournaments.StartMatch(req.TournamentID, req.MatchID)
+		if err != nil {
+			log.Printf("Failed to start tournament match: %v", err)
+			return
+		}
+		h.startMatchGame(match)
+	}
+}
+
+func (h *WSHandler) startMatchGame(match model.TournamentMatch) {
+	room, err := h.roomService.GetRoom(match.RoomID)
+	if err != nil {
+		log.Printf("Failed to start tournament game: %v", err)
+		return
+	}
+
+	players := []int64{match.Black, match.White()}
+	game, err := h.gameService.StartGame(match.RoomID, players, room.Settings)
+	if err != nil {
+		log.Printf("Failed to start game: %v", err)
+		return
+	}
+
+	h.roomService.SetRoomStatus(match.RoomID, model.RoomStatusPlaying)
+
+	h.broadcastToRoom(match.RoomID, &protocol.GameStart{
+		RoomID:      match.RoomID,
+		Players:     players,
+		FirstPlayer: game.CurrentPlayer(),
+		Settings:    toRoomSettings(room.Settings),
+		Series:      h.seriesScore(match.RoomID),
+	}, 0)
+	log.Printf("Tournament game %d started in room %d, first player: %d", match.Games, match.RoomID, game.CurrentPlayer())
+}
+
+func (h *WSHandler) finishTournamentGame(roomID, winner int64) {
+	room, err := h.roomService.GetRoom(roomID)
+	if err != nil || !room.IsTournament() {
+		return
+	}
+
+	match, tiebreak, err := h.tournaments.ReportResult(room.TournamentID, room.MatchID, winner)
+	if err != nil {
+		log.Printf("Failed to report tournament result: %v", err)
+		return
+	}
+
+	if tiebreak {
+		h.startMatchGame(match)
+	}
+}
+
+func (h *WSHandler) onTournamentEvent(e service.TournamentEvent) {
+	match := e.Match
+
+	switch e.Type {
+	case service.TournamentEventMatchReady:
+		for _, p := range []int64{match.Player1, match.Player2} {
+			h.sendToUser(p, &protocol.TournamentMatchReady{
+				TournamentID: e.TournamentID,
+				MatchID:      match.ID,
+				Opponent:     match.Opponent(p),
+				Black:        match.Black,
+				Deadline:     e.Deadline.Unix(),
+			})
+		}
+	case service.TournamentEventTiebreak:
+		for _, p := range []int64{match.Player1, match.Player2} {
+			h.sendToUser(p, &protocol.TournamentMatchResult{
+				TournamentID: e.TournamentID,
+				MatchID:      match.ID,
+				Tiebreak:     true,
+			})
+		}
+	case service.TournamentEventMatchFinished:
+		result := &protocol.TournamentMatchResult{
+			TournamentID: e.TournamentID,
+			MatchID:      match.ID,
+			Winner:       match.Winner,
+			Loser:        match.Loser,
+			Forfeit:      match.Forfeit,
+		}
+		for _, p := range []int64{match.Player1, match.Player2} {
+			h.sendToUser(p, result)
+		}
+		h.closeMatchRoom(e.TournamentID, match)
+	case service.TournamentEventFinished:
+		for _, p := range h.tournaments.Players(e.TournamentID) {
+			h.sendToUser(p, &protocol.TournamentMatchResult{
+				TournamentID: e.TournamentID,
+				Champion:     e.Champion,
+			})
+		}
+		log.Printf("Tournament %d finished, champion: %d", e.TournamentID, e.Champion)
+	}
+}
+
+func (h *WSHandler) closeMatchRoom(tournamentID int64, match model.TournamentMatch) {
+	if match.RoomID == 0 {
+		return
+	}
+
+	room, err := h.roomService.GetRoom(match.RoomID)
+	if err != nil || room.TournamentID != tournamentID || room.MatchID != match.ID {
+		return
+	}
+
+	h.gameService.EndGame(room.ID)
+	h.roomService.DeleteRoom(room.ID)
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, p := range []int64{match.Player1, match.Player2} {
+		for _, client := range h.clients[p] {
+			client.Rooms.Remove(room.ID)
+		}
+	}
+}
+
+func (h *WSHandler) sendToUser(userID int64, msg protocol.Message) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, client := range h.clients[userID] {
+		h.sendMessage(client.Conn, msg.MessageType(), msg)
+	}
+}
+
+func (h *WSHandler) handleCorrespondenceList(conn *websocket.Conn, client *WSClient, req *protocol.CorrespondenceListReq) {
+	resp := &protocol.CorrespondenceListResp{}
+
+	games, err := h.corrService.ListActive(client.UserID)
+	if err != nil {
+		resp.Code = 500
+		resp.Message = err.Error()
+		h.sendMessage(conn, protocol.TypeCorrespondenceListResp, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "success"
+	resp.Games = h.correspondenceInfos(games, client.UserID)
+
+	h.sendMessage(conn, protocol.TypeCorrespondenceListResp, resp)
+}
+
+func (h *WSHandler) handleCorrespondenceOpen(conn *websocket.Conn, client *WSClient, req *protocol.CorrespondenceOpenReq) {
+	resp := &protocol.CorrespondenceOpenResp{}
+
+	cg, err := h.corrService.GetGame(req.GameID, client.UserID)
+	if err != nil {
+		resp.Code = 404
+		if errors.Is(err, service.ErrNotCorrespondencePlayer) {
+			resp.Code = 403
+		}
+		resp.Message = err.Error()
+		h.sendMessage(conn, protocol.TypeCorrespondenceOpenResp, resp)
+		return
+	}
+
+	if !cg.IsActive() {
+		resp.Code = 200
+		resp.Message = "game finished"
+		resp.Game = toCorrespondenceInfo(cg, client.UserID, 0)
+		h.sendMessage(conn, protocol.TypeCorrespondenceOpenResp, resp)
+		return
+	}
+
+	room, err := h.roomService.GetRoomByGameID(cg.ID)
+	if (err != nil || !client.Rooms.Has(room.ID)) && client.Rooms.Len() >= MaxRoomsPerUser {
+		resp.Code = 400
+		resp.Message = "too many rooms, please leave one first"
+		h.sendMessage(conn, protocol.TypeCorrespondenceOpenResp, resp)
+		return
+	}
+
+	if err != nil {
+		room, err = h.roomService.RestoreCorrespondenceRoom(fmt.Sprintf("correspondence %d", cg.ID), cg)
+		if err != nil {
+			resp.Code = 500
+			resp.Message = err.Error()
+			h.sendMessage(conn, protocol.TypeCorrespondenceOpenResp, resp)
+			return
+		}
+	}
+
+	game, err := h.gameService.GetGame(room.ID)
+	if err != nil || game.MoveCount != cg.MoveCount {
+		h.gameService.EndGame(room.ID)
+		game = cg.ToGame(room.ID)
+		h.gameService.RestoreGame(game)
+	}
+
+	client.Rooms.Add(room.ID)
+
+	resp.Code = 200
+	resp.Message = "game opened"
+	resp.Game = toCorrespondenceInfo(cg, client.UserID, room.ID)
+
+	h.sendMessage(conn, protocol.TypeCorrespondenceOpenResp, resp)
+
+	h.sendMessage(conn, protocol.TypeBoardUpdate, boardSnapshot(game))
+	log.Printf("WebSocket User %d opened correspondence game %d in room %d", client.UserID, cg.ID, room.ID)
+}
+
+func (h *WSHandler) notifyCorrespondenceTurn(conn *websocket.Conn, userID int64) {
+	games, err := h.corrService.ListYourTurn(userID)
+	if err != nil {
+		log.Printf("Failed to load correspondence games: %v", err)
+		return
+	}
+	if len(games) == 0 {
+		return
+	}
+
+	h.sendMessage(conn, protocol.TypeCorrespondenceTurn, &protocol.CorrespondenceTurn{
+		Games: h.correspondenceInfos(games, userID),
+	})
+}
+
+func (h *WSHandler) correspondenceInfos(games []*model.CorrespondenceGame, userID int64) []*protocol.CorrespondenceGameInfo {
+	infos := make([]*protocol.CorrespondenceGameInfo, 0, len(games))
+	for _, g := range games {
+		roomID := int64(0)
+		if room, err := h.roomService.GetRoomByGameID(g.ID); err == nil {
+			roomID = room.ID
+		}
+		infos = append(infos, toCorrespondenceInfo(g, userID, roomID))
+	}
+	return infos
+}
+
+func (h *WSHandler) dropCorrespondenceRoom(room *model.Room) {
+	h.gameService.EndGame(room.ID)
+	h.roomService.DeleteRoom(room.ID)
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, p := range room.Players {
+		for _, client := range h.clients[p] {
+			client.Rooms.Remove(room.ID)
+		}
+	}
+}
+
+func (h *WSHandler) handleRematchRequest(conn *websocket.Conn, client *WSClient, req *protocol.RematchRequest) {
+	resp := &protocol.RematchResp{}
+
+	if service.IsDraining() {
+		resp.Code = 503
+		resp.Message = service.ErrServerDraining.Error()
+		h.sendMessage(conn, protocol.TypeRematchResp, resp)
+		return
+	}
+
+	roomID, ok := client.Rooms.Resolve(req.RoomID)
+	if !ok {
+		resp.Code = 400
+		resp.Message = "not in this room"
+		h.sendMessage(conn, protocol.TypeRematchResp, resp)
+		return
+	}
+
+	accepted, err := h.roomService.RequestRematch(roomID, client.UserID)
+	if err != nil {
+		resp.Code = 400
+		resp.Message = err.Error()
+		h.sendMessage(conn, protocol.TypeRematchResp, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.RoomID = roomID
+
+	if accepted {
+		resp.Message = "rematch accepted"
+		h.sendMessage(conn, protocol.TypeRematchResp, resp)
+		h.startRematch(roomID)
+		return
+	}
+
+	resp.Message = "rematch requested"
+	h.sendMessage(conn, protocol.TypeRematchResp, resp)
+
+	h.broadcastToRoom(roomID, &protocol.RematchRequest{
+		RoomID:   roomID,
+		FromUser: client.UserID,
+	}, client.UserID)
+
+	log.Printf("WebSocket User %d requested a rematch in room %d", client.UserID, roomID)
+}
+
+func (h *WSHandler) handleRematchAccept(conn *websocket.Conn, client *WSClient, req *protocol.RematchAccept) {
+	resp := &protocol.RematchResp{}
+
+	if service.IsDraining() {
+		resp.Code = 503
+		resp.Message = service.ErrServerDraining.Error()
+		h.sendMessage(conn, protocol.TypeRematchResp, resp)
+		return
+	}
+
+	roomID, ok := client.Rooms.Resolve(req.RoomID)
+	if !ok {
+		resp.Code = 400
+		resp.Message = "not in this room"
+		h.sendMessage(conn, protocol.TypeRematchResp, resp)
+		return
+	}
+
+	if err := h.roomService.AcceptRematch(roomID, client.UserID); err != nil {
+		resp.Code = 400
+		resp.Message = err.Error()
+		h.sendMessage(conn, protocol.TypeRematchResp, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "rematch accepted"
+	resp.RoomID = roomID
+
+	h.sendMessage(conn, protocol.TypeRematchResp, resp)
+	h.startRematch(roomID)
+}
+
+func (h *WSHandler) startRematch(roomID int64) {
+	room, err := h.roomService.GetRoom(roomID)
+	if err != nil {
+		return
+	}
+
+	h.gameService.EndGame(roomID)
+	h.startGame(room)
+	log.Printf("Rematch started in room %d", roomID)
+}
+
+func (h *WSHandler) seriesScore(roomID int64) *protocol.SeriesScore {
+	room, err := h.roomService.GetRoom(roomID)
+	if err != nil || room.SeriesGames == 0 {
+		return nil
+	}
+	return toSeriesScore(room)
+}
+
+func (h *WSHandler) handleRoomSettings(conn *websocket.Conn, client *WSClient, req *protocol.RoomSettingsReq) {
+	resp := &protocol.RoomSettingsResp{}
+
+	roomID, ok := client.Rooms.Resolve(req.RoomID)
+	if !ok {
+		resp.Code = 400
+		resp.Message = "not in this room"
+		h.sendMessage(conn, protocol.TypeRoomSettingsResp, resp)
+		return
+	}
+
+	room, err := h.roomService.UpdateSettings(roomID, client.UserID, fromRoomSettings(req.Settings))
+	if err != nil {
+		resp.Code = 400
+		if errors.Is(err, service.ErrNotRoomCreator) {
+			resp.Code = 403
+		}
+		resp.Message = err.Error()
+		h.sendMessage(conn, protocol.TypeRoomSettingsResp, resp)
+		return
+	}
+
+	settings := toRoomSettings(room.Settings)
+
+	resp.Code = 200
+	resp.Message = "settings updated"
+	resp.RoomID = roomID
+	resp.Settings = settings
+
+	h.sendMessage(conn, protocol.TypeRoomSettingsResp, resp)
+
+	h.broadcastToRoom(roomID, &protocol.RoomSettingsUpdate{
+		RoomID:   roomID,
+		Settings: settings,
+	}, client.UserID)
+
+	log.Printf("WebSocket User %d updated settings of room %d", client.UserID, roomID)
+}
+
+func (h *WSHandler) handleReady(conn *websocket.Conn, client *WSClient, req *protocol.ReadyReq) {
+	resp := &protocol.ReadyResp{}
+
+	if req.Ready && service.IsDraining() {
+		resp.Code = 503
+		resp.Message = service.ErrServerDraining.Error()
+		h.sendMessage(conn, protocol.TypeReadyResp, resp)
+		return
+	}
+
+	roomID, ok := client.Rooms.Resolve(req.RoomID)
+	if !ok {
+		resp.Code = 400
+		resp.Message = "not in this room"
+		h.sendMessage(conn, protocol.TypeReadyResp, resp)
+		return
+	}
+
+	start, err := h.roomService.SetReady(roomID, client.UserID, req.Ready)
+	if err != nil {
+		resp.Code = 400
+		resp.Message = err.Error()
+		h.sendMessage(conn, protocol.TypeReadyResp, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "ready updated"
+	resp.RoomID = roomID
+	resp.Ready = req.Ready
+
+	h.sendMessage(conn, protocol.TypeReadyResp, resp)
+
+	room, err := h.roomService.GetRoom(roomID)
+	if err != nil {
+		return
+	}
+
+	ready := room.ReadyPlayers()
+	if start {
+		ready = room.Players
+	}
+	h.broadcastToRoom(roomID, &protocol.ReadyUpdate{
+		RoomID: roomID,
+		UserID: client.UserID,
+		Ready:  ready,
+	}, 0)
+
+	if start {
+		h.startGame(room)
+	}
+}
+
+// armMoveTimer forfeits the player to move if they have not moved within the
+// room's time control. Timers are never cancelled; a stale one finds that a
+// move was made in the meantime and does nothing.
+func (h *WSHandler) armMoveTimer(roomID int64, game *model.Game) {
+	room, err := h.roomService.GetRoom(roomID)
+	if err != nil || room.Correspondence || room.Settings.MoveTimeLimit <= 0 {
+		return
+	}
+
+	moveCount := game.MoveCount
+	time.AfterFunc(time.Duration(room.Settings.MoveTimeLimit)*time.Second, func() {
+		h.moveTimeout(roomID, game, moveCount)
+	})
+}
+
+func (h *WSHandler) moveTimeout(roomID int64, game *model.Game, moveCount int) {
+	loser := game.CurrentPlayer()
+	winner, ok := h.gameService.ExpireTurn(roomID, game, moveCount)
+	if !ok {
+		return
+	}
+
+	metrics.GameOutcomes.WithLabelValues(metrics.TransportWS, metrics.OutcomeTimeout).Inc()
+	h.roomService.RecordResult(roomID, winner)
+	h.broadcastToRoom(roomID, &protocol.GameOver{
+		RoomID: roomID,
+		Winner: winner,
+		Reason: "timeout",
+		Series: h.seriesScore(roomID),
+	}, 0)
+
+	h.gameService.EndGame(roomID)
+	h.roomService.SetRoomStatus(roomID, model.RoomStatusFinished)
+
+	h.updateGameResult(roomID, game, winner)
+	h.finishTournamentGame(roomID, winner)
+
+	log.Printf("WebSocket User %d ran out of time in room %d, winner: %d", loser, roomID, winner)
+}
+
+func (h *WSHandler) handleKickPlayer(conn *websocket.Conn, client *WSClient, req *protocol.KickPlayerReq) {
+	resp := &protocol.KickPlayerResp{}
+
+	roomID, ok := client.Rooms.Resolve(req.RoomID)
+	if !ok {
+		resp.Code = 400
+		resp.Message = "not in this room"
+		h.sendMessage(conn, protocol.TypeKickPlayerResp, resp)
+		return
+	}
+
+	if err := h.roomService.KickPlayer(roomID, client.UserID, req.UserID); err != nil {
+		resp.Code = 400
+		if errors.Is(err, service.ErrNotRoomCreator) {
+			resp.Code = 403
+		}
+		resp.Message = err.Error()
+		h.sendMessage(conn, protocol.TypeKickPlayerResp, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "player kicked"
+	resp.RoomID = roomID
+	resp.UserID = req.UserID
+
+	h.sendMessage(conn, protocol.TypeKickPlayerResp, resp)
+
+	notice := &protocol.PlayerLeave{
+		RoomID: roomID,
+		UserID: req.UserID,
+		Reason: "kicked",
+	}
+	h.broadcastToRoom(roomID, notice, 0)
+
+	for _, kicked := range h.clientsOf(req.UserID) {
+		kicked.Rooms.Remove(roomID)
+	}
+	h.sendToUser(req.UserID, notice)
+
+	log.Printf("WebSocket User %d kicked user %d from room %d", client.UserID, req.UserID, roomID)
+}
+
+func (h *WSHandler) handleLockRoom(conn *websocket.Conn, client *WSClient, req *protocol.LockRoomReq) {
+	resp := &protocol.LockRoomResp{}
+
+	roomID, ok := client.Rooms.Resolve(req.RoomID)
+	if !ok {
+		resp.Code = 400
+		resp.Message = "not in this room"
+		h.sendMessage(conn, protocol.TypeLockRoomResp, resp)
+		return
+	}
+
+	if err := h.roomService.SetLocked(roomID, client.UserID, req.Locked); err != nil {
+		resp.Code = 400
+		if errors.Is(err, service.ErrNotRoomCreator) {
+			resp.Code = 403
+		}
+		resp.Message = err.Error()
+		h.sendMessage(conn, protocol.TypeLockRoomResp, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "room lock updated"
+	resp.RoomID = roomID
+	resp.Locked = req.Locked
+
+	h.sendMessage(conn, protocol.TypeLockRoomResp, resp)
+
+	h.broadcastToRoom(roomID, &protocol.RoomLockUpdate{
+		RoomID: roomID,
+		Locked: req.Locked,
+	}, client.UserID)
+
+	log.Printf("WebSocket User %d set lock of room %d to %v", client.UserID, roomID, req.Locked)
+}
+
+// announceOwner tells the remaining players who owns the room after
+// prevOwner left it.
+func (h *WSHandler) announceOwner(roomID, prevOwner int64) {
+	room, err := h.roomService.GetRoom(roomID)
+	if err != nil || room.CreatorID == prevOwner {
+		return
+	}
+
+	h.broadcastToRoom(roomID, &protocol.RoomOwnerChange{
+		RoomID:      roomID,
+		OwnerID:     room.CreatorID,
+		PrevOwnerID: prevOwner,
+	}, 0)
+	log.Printf("Room %d ownership passed from %d to %d", roomID, prevOwner, room.CreatorID)
+}
+
+// EvictIdle closes connections that sent nothing for longer than timeout. The
+// read loop then fails and runs the usual disconnect handling.
+func (h *WSHandler) EvictIdle(timeout time.Duration) int {
+	h.mu.RLock()
+	idle := make([]*WSClient, 0)
+	for _, clients := range h.clients {
+		for _, client := range clients {
+			if client.IdleFor() > timeout {
+				idle = append(idle, client)
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, client := range idle {
+		log.Printf("Evicting idle user %d", client.UserID)
+		client.Conn.Close()
+	}
+	return len(idle)
+}
+
+func (h *WSHandler) CleanRooms(inactiveTimeout time.Duration) (int, int) {
+	empty := h.roomService.CleanEmptyRooms()
+	inactive := h.roomService.CleanInactiveRooms(inactiveTimeout)
+	if inactive > 0 {
+		h.dropClosedRooms()
+	}
+	return empty, inactive
+}
+
+func (h *WSHandler) IsOnline(userID int64) bool {
+	return h.GetClient(userID) != nil
+}
+
+// dropClosedRooms forgets rooms that were removed underneath their players
+// and tells those players the room is gone.
+func (h *WSHandler) dropClosedRooms() {
+	h.mu.RLock()
+	clients := make([]*WSClient, 0, len(h.clients))
+	for _, userClients := range h.clients {
+		clients = append(clients, userClients...)
+	}
+	h.mu.RUnlock()
+
+	for _, client := range clients {
+		for _, roomID := range client.Rooms.List() {
+			if _, err := h.roomService.GetRoom(roomID); err == nil {
+				continue
+			}
+			client.Rooms.Remove(roomID)
+			h.sendMessage(client.Conn, protocol.TypePlayerLeave, &protocol.PlayerLeave{
+				RoomID: roomID,
+				UserID: client.UserID,
+				Reason: "room closed",
+			})
+		}
+	}
+}
+
+// trackConn registers a new connection so a shutdown can close it. It refuses
+// connections that arrive once draining has started.
+func (h *WSHandler) trackConn(conn *websocket.Conn) (*connState, bool) {
+	h.connMu.Lock()
+	defer h.connMu.Unlock()
+
+	if service.IsDraining() {
+		return nil, false
+	}
+	state := newConnState(serverFeatures)
+	h.conns[conn] = state
+	h.connWG.Add(1)
+	return state, true
+}
+
+// stateOf returns what conn agreed on in Hello.
+func (h *WSHandler) stateOf(conn *websocket.Conn) *connState {
+	h.connMu.RLock()
+	state := h.conns[conn]
+	h.connMu.RUnlock()
+	if state == nil {
+		return legacyConn
+	}
+	return state
+}
+
+func (h *WSHandler) untrackConn(conn *websocket.Conn) {
+	h.connMu.Lock()
+	delete(h.conns, conn)
+	h.connMu.Unlock()
+	h.connWG.Done()
+}
+
+// NotifyShutdown tells every player the server is going away and when their
+// running games will be stopped.
+func (h *WSHandler) NotifyShutdown(deadline time.Time) {
+	h.broadcastToAll(&protocol.ServerShutdown{
+		Message:  "server is shutting down, please finish your game",
+		Deadline: deadline.Unix(),
+	}, 0)
+}
+
+// ActiveGames counts the live games still being played. Correspondence games
+// are stored after every move, so they never hold up a shutdown.
+func (h *WSHandler) ActiveGames() int {
+	return len(h.liveGames())
+}
+
+// AbortGames ends the live games still running at the shutdown deadline. No
+// score is changed for an aborted game.
+func (h *WSHandler) AbortGames() int {
+	rooms := h.liveGames()
+	for _, roomID := range rooms {
+		metrics.GameOutcomes.WithLabelValues(metrics.TransportWS, metrics.OutcomeAborted).Inc()
+		h.broadcastToRoom(roomID, &protocol.GameOver{
+			RoomID: roomID,
+			Reason: "server shutdown",
+			Series: h.seriesScore(roomID),
+		}, 0)
+		h.gameService.EndGame(roomID)
+		h.roomService.SetRoomStatus(roomID, model.RoomStatusFinished)
+	}
+	return len(rooms)
+}
+
+// CloseConnections closes every connection and waits until their disconnect
+// handling, including the database writes it makes, has finished.
+func (h *WSHandler) CloseConnections(ctx context.Context) error {
+	h.connMu.Lock()
+	for conn := range h.conns {
+		conn.Close()
+	}
+	h.connMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.connWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (h *WSHandler) liveGames() []int64 {
+	rooms := make([]int64, 0)
+	for _, roomID := range h.gameService.RoomIDs() {
+		if room, err := h.roomService.GetRoom(roomID); err == nil && room.Correspondence {
+			continue
+		}
+		if game, err := h.gameService.GetGame(roomID); err == nil && !game.IsFinished() {
+			rooms = append(rooms, roomID)
+		}
+	}
+	return rooms
+}
+
+func (h *WSHandler) Transport() string {
+	return metrics.TransportWS
+}
+
+func (h *WSHandler) AdminClients() []*AdminClientView {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	views := make([]*AdminClientView, 0, len(h.clients))
+	for _, clients := range h.clients {
+		for _, client := range clients {
+			views = append(views, &AdminClientView{
+				Transport:   metrics.TransportWS,
+				UserID:      client.UserID,
+				Username:    client.Username(),
+				Role:        client.Role(),
+				IdleSeconds: int64(client.IdleFor().Seconds()),
+				Rooms:       client.Rooms.List(),
+			})
+		}
+	}
+	return views
+}
+
+func (h *WSHandler) AdminRooms() []*AdminRoomView {
+	rooms := h.roomService.ListRooms()
+	views := make([]*AdminRoomView, 0, len(rooms))
+	for _, room := range rooms {
+		views = append(views, &AdminRoomView{Transport: metrics.TransportWS, Room: room})
+	}
+	return views
+}
+
+func (h *WSHandler) AdminGames() []*AdminGameView {
+	views := make([]*AdminGameView, 0)
+	for _, roomID := range h.gameService.RoomIDs() {
+		game, err := h.gameService.GetGame(roomID)
+		if err != nil || game.IsFinished() {
+			continue
+		}
+		room, _ := h.roomService.GetRoom(roomID)
+		views = append(views, toAdminGameView(metrics.TransportWS, game, room))
+	}
+	return views
+}
+
+// ForceEndGame ends a running game on an operator's behalf. winner must be
+// one of the players, or 0 to end the game without a winner. Scores,
+// series, tournaments and correspondence records are updated as for a
+// normal finish.
+func (h *WSHandler) ForceEndGame(roomID, winner int64) error {
+	game, err := h.gameService.GetGame(roomID)
+	if err != nil {
+		return err
+	}
+	if err := h.gameService.Finish(roomID, winner); err != nil {
+		return err
+	}
+
+	if room, err := h.roomService.GetRoom(roomID); err == nil && room.IsCorrespondenceGame() {
+		if err := h.corrService.Resign(room.GameID, winner); err != nil {
+			log.Printf("Failed to store correspondence result: %v", err)
+		}
+	}
+
+	metrics.GameOutcomes.WithLabelValues(metrics.TransportWS, metrics.OutcomeAdmin).Inc()
+	h.roomService.RecordResult(roomID, winner)
+	h.broadcastToRoom(roomID, &protocol.GameOver{
+		RoomID: roomID,
+		Winner: winner,
+		Reason: "admin",
+		Series: h.seriesScore(roomID),
+	}, 0)
+
+	h.gameService.EndGame(roomID)
+	h.roomService.SetRoomStatus(roomID, model.RoomStatusFinished)
+
+	h.updateGameResult(roomID, game, winner)
+	h.finishTournamentGame(roomID, winner)
+
+	log.Printf("Game in room %d ended by admin, winner: %d", roomID, winner)
+	return nil
+}
+
+// DisconnectUser tells the user why and closes all their connections. The
+// normal disconnect handling then runs, so a running game is forfeited.
+func (h *WSHandler) DisconnectUser(userID int64, reason string) bool {
+	clients := h.clientsOf(userID)
+	for _, client := range clients {
+		h.kickClient(client, reason)
+	}
+	if len(clients) > 0 {
+		log.Printf("WebSocket User %d disconnected by admin: %s", userID, reason)
+	}
+	return len(clients) > 0
+}
+
+// kickClient tells a connection why it is being closed and closes it. The
+// read loop then runs the disconnect handling.
+func (h *WSHandler) kickClient(client *WSClient, reason string) {
+	h.sendMessage(client.Conn, protocol.TypeForceDisconnect, &protocol.ForceDisconnect{Reason: reason})
+	client.Conn.Close()
+}
+
+// Announce sends a system message to every open connection, including ones
+// that have not logged in yet.
+func (h *WSHandler) Announce(message string) int {
+	msg := &protocol.SystemAnnouncement{
+		Message:   message,
+		Timestamp: time.Now().Unix(),
+	}
+
+	h.connMu.Lock()
+	conns := make([]*websocket.Conn, 0, len(h.conns))
+	for conn := range h.conns {
+		conns = append(conns, conn)
+	}
+	h.connMu.Unlock()
+
+	for _, conn := range conns {
+		h.sendMessage(conn, protocol.TypeSystemAnnouncement, msg)
+	}
+	return len(conns)
+}
+
+func (h *WSHandler) handleChat(conn *websocket.Conn, client *WSClient, req *protocol.ChatReq) {
+	resp := &protocol.ChatResp{}
+
+	roomID, ok := client.Rooms.Resolve(req.RoomID)
+	if !ok {
+		resp.Code = 400
+		resp.Message = "not in this room"
+		h.sendMessage(conn, protocol.TypeChatResp, resp)
+		return
+	}
+
+	content := strings.TrimSpace(req.Content)
+	if content == "" || utf8.RuneCountInString(content) > MaxChatLength {
+		resp.Code = 400
+		resp.Message = fmt.Sprintf("message must be 1-%d characters", MaxChatLength)
+		h.sendMessage(conn, protocol.TypeChatResp, resp)
+		return
+	}
+
+	if !client.Can(model.PermChat) {
+		resp.Code = 403
+		resp.Message = "permission denied"
+		h.sendMessage(conn, protocol.TypeChatResp, resp)
+		return
+	}
+
+	if err := h.moderation.CheckChat(client.UserID); err != nil {
+		resp.Code = 500
+		resp.Message = "failed to check chat permission"
+		if code, info, ok := sanctionResponse(err); ok {
+			resp.Code = code
+			resp.Message = err.Error()
+			resp.Sanction = info
+		}
+		h.sendMessage(conn, protocol.TypeChatResp, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "chat sent"
+	h.sendMessage(conn, protocol.TypeChatResp, resp)
+
+	h.broadcastToRoom(roomID, &protocol.ChatMessage{
+		RoomID:    roomID,
+		UserID:    client.UserID,
+		Username:  client.Username(),
+		Content:   content,
+		Timestamp: time.Now().Unix(),
+	}, 0)
+}
+
+// SetUserRole applies a role change to the user's live connection.
+func (h *WSHandler) SetUserRole(userID int64, role model.Role) bool {
+	clients := h.clientsOf(userID)
+	for _, client := range clients {
+		client.SetRole(role)
+	}
+	return len(clients) > 0
+}
+
+// handleLogout ends the current session, every session of the user (All) or
+// one other session (SessionID). It reports whether this connection is now
+// logged out.
+func (h *WSHandler) handleLogout(conn *websocket.Conn, client *WSClient, req *protocol.LogoutReq) bool {
+	resp := &protocol.LogoutResp{}
+
+	if req.SessionID != "" && req.SessionID != client.SessionID {
+		if err := h.sessionService.RevokeOwn(client.UserID, req.SessionID, sessionReasonRevoked); err != nil {
+			resp.Code = 500
+			resp.Message = "failed to end session"
+			if errors.Is(err, service.ErrSessionNotFound) {
+				resp.Code = 404
+				resp.Message = err.Error()
+			}
+			h.sendMessage(conn, protocol.TypeLogoutResp, resp)
+			return false
+		}
+
+		resp.Code = 200
+		resp.Message = "session ended"
+		resp.Revoked = 1
+		h.sendMessage(conn, protocol.TypeLogoutResp, resp)
+		return false
+	}
+
+	if req.All {
+		n, err := h.sessionService.RevokeAll(client.UserID, "", client, sessionReasonLogoutAll)
+		if err != nil {
+			resp.Code = 500
+			resp.Message = "failed to log out"
+			h.sendMessage(conn, protocol.TypeLogoutResp, resp)
+			return false
+		}
+		resp.Revoked = n
+	} else {
+		err := h.sessionService.Revoke(client.SessionID, client, sessionReasonLogout)
+		if err != nil && !errors.Is(err, service.ErrSessionNotFound) {
+			resp.Code = 500
+			resp.Message = "failed to log out"
+			h.sendMessage(conn, protocol.TypeLogoutResp, resp)
+			return false
+		}
+		if err == nil {
+			resp.Revoked = 1
+		}
+	}
+
+	resp.Code = 200
+	resp.Message = "logged out"
+	h.sendMessage(conn, protocol.TypeLogoutResp, resp)
+
+	h.dropClient(client)
+	log.Printf("WebSocket User %d logged out (all: %v)", client.UserID, req.All)
+	return true
+}
+
+func (h *WSHandler) handleSessionList(conn *websocket.Conn, client *WSClient, req *protocol.SessionListReq) {
+	resp := &protocol.SessionListResp{}
+
+	sessions, err := h.sessionService.List(client.UserID)
+	if err != nil {
+		resp.Code = 500
+		resp.Message = "failed to list sessions"
+		h.sendMessage(conn, protocol.TypeSessionListResp, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "success"
+	resp.Sessions = toSessionInfos(sessions, client.SessionID)
+	h.sendMessage(conn, protocol.TypeSessionListResp, resp)
+}
+
+func (h *WSHandler) handleChangePassword(conn *websocket.Conn, client *WSClient, req *protocol.ChangePasswordReq) {
+	resp := &protocol.ChangePasswordResp{}
+
+	n, err := h.userService.ChangePassword(client.UserID, client.SessionID, client, &model.ChangePasswordRequest{
+		OldPassword: req.OldPassword,
+		NewPassword: req.NewPassword,
+		IP:          remoteIP(conn.RemoteAddr()),
+	})
+	if err != nil {
+		resp.Code = passwordErrorCode(err)
+		resp.Message = err.Error()
+		if resp.Code == 500 {
+			resp.Message = "failed to change password"
+		}
+		if code, retryAfter, ok := lockoutResponse(err); ok {
+			resp.Code = code
+			resp.Message = err.Error()
+			resp.RetryAfter = retryAfter
+		}
+		h.sendMessage(conn, protocol.TypeChangePasswordResp, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "password changed"
+	resp.Revoked = n
+	h.sendMessage(conn, protocol.TypeChangePasswordResp, resp)
+	log.Printf("WebSocket User %d changed password, %d other sessions ended", client.UserID, n)
+}
+
+// handleClaimAccount turns the guest account of client into a player
+// account. Other connections of the user are renamed by onAccountEvent.
+func (h *WSHandler) handleClaimAccount(conn *websocket.Conn, client *WSClient, req *protocol.ClaimAccountReq) {
+	resp := &protocol.ClaimAccountResp{}
+
+	user, err := h.userService.ClaimGuest(client.UserID, &model.ClaimAccountRequest{
+		Username: req.Username,
+		Password: req.Password,
+	})
+	if err != nil {
+		resp.Code = claimErrorCode(err)
+		resp.Message = err.Error()
+		if resp.Code == 500 {
+			resp.Message = "failed to claim account"
+		}
+		h.sendMessage(conn, protocol.TypeClaimAccountResp, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "account claimed"
+	resp.Username = user.Username
+	resp.Role = string(user.Role)
+	if token, ttl, err := h.sessionService.Reissue(client.SessionID); err == nil {
+		resp.Token = token
+		resp.ExpiresIn = int64(ttl.Seconds())
+	}
+	h.sendMessage(conn, protocol.TypeClaimAccountResp, resp)
+	log.Printf("WebSocket User %d claimed guest account as %s", client.UserID, user.Username)
+}
+
+func (h *WSHandler) handleUpdateProfile(conn *websocket.Conn, client *WSClient, req *protocol.UpdateProfileReq) {
+	resp := &protocol.UpdateProfileResp{}
+
+	user, err := h.userService.UpdateProfile(client.UserID, &model.UpdateProfileRequest{
+		DisplayName: req.DisplayName,
+		AvatarID:    req.AvatarID,
+		Country:     req.Country,
+		Bio:         req.Bio,
+	})
+	if err != nil {
+		resp.Code = profileErrorCode(err)
+		resp.Message = err.Error()
+		if resp.Code == 500 {
+			resp.Message = "failed to update profile"
+		}
+		h.sendMessage(conn, protocol.TypeUpdateProfileResp, resp)
+		return
+	}
+
+	resp.Code = 200
+	resp.Message = "profile updated"
+	resp.Profile = profileInfo(user)
+	h.sendMessage(conn, protocol.TypeUpdateProfileResp, resp)
+}
+
+// enforceSessionPolicy ends the user's other sessions and connections, on
+// every transport, when only one session per user is allowed.
+func (h *WSHandler) enforceSessionPolicy(client *WSClient) {
+	sess := &service.Session{ID: client.SessionID, UserID: client.UserID}
+	n, err := h.sessionService.EnforcePolicy(sess, client)
+	if err != nil {
+		log.Printf("Failed to end older sessions of user %d: %v", client.UserID, err)
+		return
+	}
+	if n > 0 {
+		log.Printf("Ended %d older sessions of user %d", n, client.UserID)
+	}
+}
+
+// onAccountEvent shows a renamed account under its new name and role on
+// every live connection of the user.
+func (h *WSHandler) onAccountEvent(e service.AccountEvent) {
+	for _, client := range h.clientsOf(e.UserID) {
+		client.SetUsername(e.Username)
+		client.SetRole(e.Role)
+	}
+}
+
+// onSessionEvent closes the connections whose sessions were revoked, no
+// matter which transport or request revoked them.
+func (h *WSHandler) onSessionEvent(e service.SessionEvent) {
+	for _, client := range h.clientsOf(e.UserID) {
+		if e.Matches(client, client.SessionID) {
+			h.kickClient(client, e.Reason)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "gomoku"
+
+const (
+	TransportTCP = "tcp"
+	TransportWS  = "ws"
+)
+
+var (
+	PacketsIn = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "packets_in_total",
+		Help:      "Packets received from clients, by transport and message type.",
+	}, []string{"transport", "type"})
+
+	PacketsOut = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "packets_out_total",
+		Help:      "Packets written to clients, by transport and message type.",
+	}, []string{"transport", "type"})
+
+	DecodeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "decode_errors_total",
+		Help:      "Incoming packets that could not be decoded.",
+	}, []string{"transport"})
+
+	Handshakes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "handshakes_total",
+		Help:      "Completed Hello handshakes, by transport and negotiated codec.",
+	}, []string{"transport", "codec"})
+
+	MoveLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "move_duration_seconds",
+		Help:      "Time from receiving a move to the board update being broadcast.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"transport"})
+
+	GameOutcomes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "game_outcomes_total",
+		Help:      "Finished games, by transport and how they ended.",
+	}, []string{"transport", "reason"})
+
+	DBLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "MySQL call latency by repository operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "status"})
+
+	RedisLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "redis_command_duration_seconds",
+		Help:      "Redis command latency by command name.",
+		Buckets:   []float64{.0001, .0005, .001, .0025, .005, .01, .025, .05, .1, .5, 1},
+	}, []string{"command", "status"})
+)
+
+// Game outcome reasons. The empty GameOver reason used for a normal win is
+// reported as OutcomeFiveInRow.
+const (
+	OutcomeFiveInRow  = "five_in_row"
+	OutcomeForfeit    = "forfeit"
+	OutcomeDisconnect = "disconnect"
+	OutcomeTimeout    = "timeout"
+	OutcomeAborted    = "aborted"
+	OutcomeAdmin      = "admin"
+)
+
+// Source reports the live state of one transport's handler.
+type Source interface {
+	ClientCount() int
+	RoomCount() int
+	GameCount() int
+}
+
+// RegisterSource exposes clients, rooms and games of a handler as gauges
+// labelled with its transport. The values are read at scrape time.
+func RegisterSource(transport string, src Source) {
+	labels := prometheus.Labels{"transport": transport}
+	gauges := []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "connected_clients",
+			Help:        "Logged-in clients.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(src.ClientCount()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "active_rooms",
+			Help:        "Rooms currently held in memory.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(src.RoomCount()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "active_games",
+			Help:        "Games currently in progress.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(src.GameCount()) }),
+	}
+
+	for _, g := range gauges {
+		if err := prometheus.Register(g); err != nil {
+			var dup prometheus.AlreadyRegisteredError
+			if !errors.As(err, &dup) {
+				log.Printf("Failed to register %s metrics: %v", transport, err)
+			}
+		}
+	}
+}
+
+// ObserveDB records the latency of a repository call started at start.
+func ObserveDB(operation string, start time.Time, err error) {
+	DBLatency.WithLabelValues(operation, status(err)).Observe(time.Since(start).Seconds())
+}
+
+// ObserveRedis records the latency of a Redis command started at start.
+func ObserveRedis(command string, start time.Time, err error) {
+	RedisLatency.WithLabelValues(command, status(err)).Observe(time.Since(start).Seconds())
+}
+
+func status(err error) string {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "error"
+	}
+	return "ok"
+}
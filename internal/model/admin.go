@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+const (
+	AuditActionForceEndGame = "force_end_game"
+	AuditActionKickUser     = "kick_user"
+	AuditActionBanUser      = "ban_user"
+	AuditActionSanction     = "sanction_user"
+	AuditActionRevoke       = "revoke_sanction"
+	AuditActionAnnounce     = "announce"
+	AuditActionSetRole      = "set_role"
+)
+
+// AuditEntry records one operator action. Detail holds the request as JSON.
+type AuditEntry struct {
+	ID         int64     `json:"id"`
+	Actor      string    `json:"actor"`
+	Action     string    `json:"action"`
+	Target     string    `json:"target"`
+	Detail     string    `json:"detail"`
+	RemoteAddr string    `json:"remote_addr"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,79 @@
+package model
+
+import "time"
+
+const (
+	DefaultDaysPerMove = 3
+	MaxDaysPerMove     = 14
+)
+
+type CorrespondenceStatus int
+
+const (
+	CorrespondenceStatusActive CorrespondenceStatus = iota
+	CorrespondenceStatusFinished
+)
+
+type CorrespondenceGame struct {
+	ID            int64                `json:"id"`
+	BlackPlayerID int64                `json:"black_player_id"`
+	WhitePlayerID int64                `json:"white_player_id"`
+	DaysPerMove   int                  `json:"days_per_move"`
+	RuleSet       RuleSet              `json:"rule_set"`
+	Rated         bool                 `json:"rated"`
+	Board         [][]int              `json:"board"`
+	Moves         []Move               `json:"moves"`
+	CurrentPlayer int64                `json:"current_player"`
+	MoveCount     int                  `json:"move_count"`
+	LastX         int                  `json:"last_x"`
+	LastY         int                  `json:"last_y"`
+	Status        CorrespondenceStatus `json:"status"`
+	WinnerID      int64                `json:"winner_id"`
+	Deadline      time.Time            `json:"deadline"`
+	CreatedAt     time.Time            `json:"created_at"`
+	UpdatedAt     time.Time            `json:"updated_at"`
+}
+
+func (g *CorrespondenceGame) Players() []int64 {
+	return []int64{g.BlackPlayerID, g.WhitePlayerID}
+}
+
+func (g *CorrespondenceGame) HasPlayer(userID int64) bool {
+	return g.BlackPlayerID == userID || g.WhitePlayerID == userID
+}
+
+func (g *CorrespondenceGame) Opponent(userID int64) int64 {
+	if g.BlackPlayerID == userID {
+		return g.WhitePlayerID
+	}
+	return g.BlackPlayerID
+}
+
+func (g *CorrespondenceGame) IsActive() bool {
+	return g.Status == CorrespondenceStatusActive
+}
+
+func (g *CorrespondenceGame) IsOverdue(now time.Time) bool {
+	return g.IsActive() && !g.Deadline.IsZero() && now.After(g.Deadline)
+}
+
+// ToGame rebuilds the in-memory game so a stored correspondence game can be
+// played again after a reconnect or a server restart.
+func (g *CorrespondenceGame) ToGame(roomID int64) *Game {
+	game := NewGameWithRules(roomID, g.Players(), len(g.Board), g.RuleSet)
+	for i := range g.Board {
+		copy(game.Board[i], g.Board[i])
+	}
+	game.MoveCount = g.MoveCount
+	game.LastX, game.LastY = g.LastX, g.LastY
+	game.Moves = append([]Move(nil), g.Moves...)
+	game.StartedAt = g.CreatedAt
+	if g.CurrentPlayer == g.WhitePlayerID {
+		game.Current = 1
+	}
+	if !g.IsActive() {
+		game.State = GameStateFinished
+		game.Winner = g.WinnerID
+	}
+	return game
+}
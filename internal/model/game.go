@@ -2,6 +2,7 @@ package model
 
 import (
 	"errors"
+	"time"
 )
 
 const (
@@ -26,6 +27,12 @@ var (
 	ErrInvalidPosition = errors.New("invalid position")
 )
 
+// Move is one stone placed on the board.
+type Move struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
 type Game struct {
 	RoomID    int64
 	Board     [][]int
@@ -35,22 +42,38 @@ type Game struct {
 	Winner    int64
 	WinLine   []int
 	MoveCount int
+	Size      int
+	RuleSet   RuleSet
+	// LastX and LastY are the last stone placed; only meaningful once
+	// MoveCount is above zero.
+	LastX int
+	LastY int
+	// Moves are the stones placed so far, in order.
+	Moves     []Move
+	StartedAt time.Time
 }
 
 func NewGame(roomID int64, players []int64) *Game {
-	board := make([][]int, BoardSize)
+	return NewGameWithRules(roomID, players, BoardSize, RuleFreestyle)
+}
+
+func NewGameWithRules(roomID int64, players []int64, size int, ruleSet RuleSet) *Game {
+	board := make([][]int, size)
 	for i := range board {
-		board[i] = make([]int, BoardSize)
+		board[i] = make([]int, size)
 	}
 
 	return &Game{
-		RoomID:  roomID,
-		Board:   board,
-		Players: players,
-		Current: 0,
-		State:   GameStatePlaying,
-		Winner:  0,
-		WinLine: nil,
+		RoomID:    roomID,
+		Board:     board,
+		Players:   players,
+		Current:   0,
+		State:     GameStatePlaying,
+		Winner:    0,
+		WinLine:   nil,
+		Size:      size,
+		RuleSet:   ruleSet,
+		StartedAt: time.Now(),
 	}
 }
 
@@ -66,7 +89,7 @@ func (g *Game) NextTurn() {
 }
 
 func (g *Game) IsValidPosition(x, y int) bool {
-	return x >= 0 && x < BoardSize && y >= 0 && y < BoardSize
+	return x >= 0 && x < g.Size && y >= 0 && y < g.Size
 }
 
 func (g *Game) IsEmpty(x, y int) bool {
@@ -100,11 +123,13 @@ func (g *Game) MakeMove(playerID int64, x, y int) error {
 	playerIndex := g.Current + 1
 	g.Board[x][y] = playerIndex
 	g.MoveCount++
+	g.LastX, g.LastY = x, y
+	g.Moves = append(g.Moves, Move{X: x, Y: y})
 
 	if g.CheckWin(x, y, playerIndex) {
 		g.Winner = playerID
 		g.State = GameStateFinished
-	} else if g.MoveCount >= BoardSize*BoardSize {
+	} else if g.MoveCount >= g.Size*g.Size {
 		g.State = GameStateFinished
 	} else {
 		g.NextTurn()
@@ -132,27 +157,29 @@ func (g *Game) CheckWin(x, y, player int) bool {
 
 func (g *Game) checkDirection(x, y, dx, dy, player int) bool {
 	count := 1
-	line := []int{x*BoardSize + y}
+	line := []int{x*g.Size + y}
 
-	for i := 1; i < 5; i++ {
+	// The standard rule needs the whole run to spot overlines, so the scan
+	// only stops at the first foreign stone or the edge of the board.
+	for i := 1; ; i++ {
 		nx, ny := x+dx*i, y+dy*i
 		if !g.IsValidPosition(nx, ny) || g.Board[nx][ny] != player {
 			break
 		}
 		count++
-		line = append(line, nx*BoardSize+ny)
+		line = append(line, nx*g.Size+ny)
 	}
 
-	for i := 1; i < 5; i++ {
+	for i := 1; ; i++ {
 		nx, ny := x-dx*i, y-dy*i
 		if !g.IsValidPosition(nx, ny) || g.Board[nx][ny] != player {
 			break
 		}
 		count++
-		line = append(line, nx*BoardSize+ny)
+		line = append(line, nx*g.Size+ny)
 	}
 
-	if count >= 5 {
+	if count == 5 || (count > 5 && g.RuleSet != RuleStandard) {
 		g.WinLine = line
 		return true
 	}
@@ -168,10 +195,32 @@ func (g *Game) IsDraw() bool {
 	return g.State == GameStateFinished && g.Winner == 0
 }
 
+// LastPlayer returns who placed the last stone, or 0 before the first move.
+func (g *Game) LastPlayer() int64 {
+	if g.MoveCount == 0 {
+		return 0
+	}
+	stone := g.Board[g.LastX][g.LastY]
+	if stone < 1 || stone > len(g.Players) {
+		return 0
+	}
+	return g.Players[stone-1]
+}
+
+// Clone returns a deep copy of g, for trying a move without playing it.
+func (g *Game) Clone() *Game {
+	c := *g
+	c.Board = g.GetBoardCopy()
+	c.Players = append([]int64(nil), g.Players...)
+	c.WinLine = append([]int(nil), g.WinLine...)
+	c.Moves = append([]Move(nil), g.Moves...)
+	return &c
+}
+
 func (g *Game) GetBoardCopy() [][]int {
-	board := make([][]int, BoardSize)
+	board := make([][]int, len(g.Board))
 	for i := range board {
-		board[i] = make([]int, BoardSize)
+		board[i] = make([]int, len(g.Board[i]))
 		copy(board[i], g.Board[i])
 	}
 	return board
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// GameType says which table a rating change's GameID refers to.
+type GameType string
+
+const (
+	GameTypeLive           GameType = "live"
+	GameTypeCorrespondence GameType = "correspondence"
+)
+
+// RatingChange is one change of a user's score. Score is the score after
+// the change.
+type RatingChange struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	GameType  GameType  `json:"game_type"`
+	GameID    int64     `json:"game_id"`
+	Delta     int       `json:"delta"`
+	Score     int       `json:"score"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,68 @@
+package model
+
+import "errors"
+
+type Role string
+
+const (
+	RolePlayer    Role = "player"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+	// RoleBot is an automated account. It can play but not chat.
+	RoleBot Role = "bot"
+	// RoleGuest is a temporary account created without registration. It
+	// plays casual games only until it is claimed.
+	RoleGuest Role = "guest"
+)
+
+var ErrInvalidRole = errors.New("invalid role")
+
+// Permission is a capability that handlers and HTTP routes can require.
+type Permission string
+
+const (
+	PermChat Permission = "chat"
+	// PermRanked plays rated games and appears on the leaderboard.
+	PermRanked Permission = "ranked"
+	// PermViewServer lists online users, rooms and games.
+	PermViewServer Permission = "view_server"
+	// PermModerate kicks users and issues or revokes sanctions.
+	PermModerate    Permission = "moderate"
+	PermManageGames Permission = "manage_games"
+	PermAnnounce    Permission = "announce"
+	PermViewAudit   Permission = "view_audit"
+	PermManageRoles Permission = "manage_roles"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RolePlayer:    {PermChat, PermRanked},
+	RoleModerator: {PermChat, PermRanked, PermViewServer, PermModerate},
+	RoleAdmin: {
+		PermChat, PermRanked, PermViewServer, PermModerate, PermManageGames,
+		PermAnnounce, PermViewAudit, PermManageRoles,
+	},
+	RoleBot:   {PermRanked},
+	RoleGuest: {PermChat},
+}
+
+func ParseRole(s string) (Role, error) {
+	r := Role(s)
+	if _, ok := rolePermissions[r]; !ok {
+		return "", ErrInvalidRole
+	}
+	return r, nil
+}
+
+func (r Role) Can(p Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions lists what the role may do, for clients that adapt their UI.
+func (r Role) Permissions() []Permission {
+	return append([]Permission(nil), rolePermissions[r]...)
+}
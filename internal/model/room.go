@@ -1,6 +1,9 @@
 package model
 
-import "time"
+import (
+	"math/rand"
+	"time"
+)
 
 type RoomStatus int
 
@@ -11,12 +14,25 @@ const (
 )
 
 type Room struct {
-	ID        int64      `json:"id"`
-	Name      string     `json:"name"`
-	CreatorID int64      `json:"creator_id"`
-	Players   []int64    `json:"players"`
-	Status    RoomStatus `json:"status"`
-	CreatedAt time.Time  `json:"created_at"`
+	ID             int64          `json:"id"`
+	Name           string         `json:"name"`
+	CreatorID      int64          `json:"creator_id"`
+	Players        []int64        `json:"players"`
+	Status         RoomStatus     `json:"status"`
+	TournamentID   int64          `json:"tournament_id,omitempty"`
+	MatchID        int            `json:"match_id,omitempty"`
+	Correspondence bool           `json:"correspondence,omitempty"`
+	DaysPerMove    int            `json:"days_per_move,omitempty"`
+	GameID         int64          `json:"game_id,omitempty"`
+	SeriesWins     map[int64]int  `json:"series_wins,omitempty"`
+	SeriesDraws    int            `json:"series_draws,omitempty"`
+	SeriesGames    int            `json:"series_games,omitempty"`
+	RematchFrom    int64          `json:"rematch_from,omitempty"`
+	Settings       RoomSettings   `json:"settings"`
+	Ready          map[int64]bool `json:"ready,omitempty"`
+	Locked         bool           `json:"locked,omitempty"`
+	CasualOnly     bool           `json:"casual_only,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
 }
 
 func NewRoom(id int64, name string, creatorID int64) *Room {
@@ -26,10 +42,19 @@ func NewRoom(id int64, name string, creatorID int64) *Room {
 		CreatorID: creatorID,
 		Players:   []int64{creatorID},
 		Status:    RoomStatusWaiting,
+		Settings:  DefaultRoomSettings(),
 		CreatedAt: time.Now(),
 	}
 }
 
+func (r *Room) IsTournament() bool {
+	return r.TournamentID != 0
+}
+
+func (r *Room) IsCorrespondenceGame() bool {
+	return r.Correspondence && r.GameID != 0
+}
+
 func (r *Room) IsFull() bool {
 	return len(r.Players) >= 2
 }
@@ -48,6 +73,7 @@ func (r *Room) AddPlayer(userID int64) bool {
 		return false
 	}
 	r.Players = append(r.Players, userID)
+	r.ResetSeries()
 	return true
 }
 
@@ -55,6 +81,11 @@ func (r *Room) RemovePlayer(userID int64) bool {
 	for i, p := range r.Players {
 		if p == userID {
 			r.Players = append(r.Players[:i], r.Players[i+1:]...)
+			r.RematchFrom = 0
+			delete(r.Ready, userID)
+			if r.CreatorID == userID && len(r.Players) > 0 {
+				r.CreatorID = r.Players[0]
+			}
 			return true
 		}
 	}
@@ -77,3 +108,90 @@ func (r *Room) OtherPlayer(userID int64) int64 {
 	}
 	return 0
 }
+
+func (r *Room) RecordResult(winner int64) {
+	if r.SeriesWins == nil {
+		r.SeriesWins = make(map[int64]int)
+	}
+	r.SeriesGames++
+	if winner == 0 {
+		r.SeriesDraws++
+		return
+	}
+	r.SeriesWins[winner]++
+}
+
+func (r *Room) ResetSeries() {
+	r.SeriesWins = nil
+	r.SeriesDraws = 0
+	r.SeriesGames = 0
+	r.RematchFrom = 0
+}
+
+func (r *Room) SwapColors() {
+	for i, j := 0, len(r.Players)-1; i < j; i, j = i+1, j-1 {
+		r.Players[i], r.Players[j] = r.Players[j], r.Players[i]
+	}
+}
+
+func (r *Room) SetReady(userID int64, ready bool) {
+	if r.Ready == nil {
+		r.Ready = make(map[int64]bool)
+	}
+	if ready {
+		r.Ready[userID] = true
+	} else {
+		delete(r.Ready, userID)
+	}
+}
+
+func (r *Room) AllReady() bool {
+	if !r.IsFull() {
+		return false
+	}
+	for _, p := range r.Players {
+		if !r.Ready[p] {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Room) ReadyPlayers() []int64 {
+	ready := make([]int64, 0, len(r.Players))
+	for _, p := range r.Players {
+		if r.Ready[p] {
+			ready = append(ready, p)
+		}
+	}
+	return ready
+}
+
+func (r *Room) ClearReady() {
+	r.Ready = nil
+}
+
+// AssignColors orders Players so that Players[0] plays black, following the
+// creator's colour preference. Rematches alternate colours instead, so this is
+// only applied to the first game of a series.
+func (r *Room) AssignColors() {
+	if r.SeriesGames > 0 || len(r.Players) < 2 || !r.HasPlayer(r.CreatorID) {
+		return
+	}
+
+	creatorBlack := r.Players[0] == r.CreatorID
+	switch r.Settings.CreatorColor {
+	case ColorBlack:
+		if !creatorBlack {
+			r.SwapColors()
+		}
+	case ColorWhite:
+		if creatorBlack {
+			r.SwapColors()
+		}
+	default:
+		if rand.Intn(2) == 1 {
+			r.SwapColors()
+		}
+	}
+}
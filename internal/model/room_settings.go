@@ -0,0 +1,79 @@
+package model
+
+import "errors"
+
+type RuleSet string
+
+const (
+	// RuleFreestyle wins with five or more stones in a row.
+	RuleFreestyle RuleSet = "freestyle"
+	// RuleStandard wins with exactly five; overlines do not count.
+	RuleStandard RuleSet = "standard"
+)
+
+type ColorPreference string
+
+const (
+	ColorRandom ColorPreference = "random"
+	ColorBlack  ColorPreference = "black"
+	ColorWhite  ColorPreference = "white"
+)
+
+const (
+	MinBoardSize     = 9
+	MaxBoardSize     = 19
+	MaxMoveTimeLimit = 600
+)
+
+var (
+	ErrInvalidRuleSet         = errors.New("invalid rule set")
+	ErrInvalidBoardSize       = errors.New("invalid board size")
+	ErrInvalidTimeControl     = errors.New("invalid time control")
+	ErrInvalidColorPreference = errors.New("invalid colour preference")
+)
+
+type RoomSettings struct {
+	RuleSet       RuleSet         `json:"rule_set"`
+	BoardSize     int             `json:"board_size"`
+	MoveTimeLimit int             `json:"move_time_limit"`
+	Rated         bool            `json:"rated"`
+	CreatorColor  ColorPreference `json:"creator_color"`
+}
+
+func DefaultRoomSettings() RoomSettings {
+	return RoomSettings{
+		RuleSet:      RuleFreestyle,
+		BoardSize:    BoardSize,
+		Rated:        true,
+		CreatorColor: ColorBlack,
+	}
+}
+
+// Normalize fills unset fields with their defaults.
+func (s *RoomSettings) Normalize() {
+	if s.RuleSet == "" {
+		s.RuleSet = RuleFreestyle
+	}
+	if s.BoardSize == 0 {
+		s.BoardSize = BoardSize
+	}
+	if s.CreatorColor == "" {
+		s.CreatorColor = ColorBlack
+	}
+}
+
+func (s *RoomSettings) Validate() error {
+	if s.RuleSet != RuleFreestyle && s.RuleSet != RuleStandard {
+		return ErrInvalidRuleSet
+	}
+	if s.BoardSize < MinBoardSize || s.BoardSize > MaxBoardSize {
+		return ErrInvalidBoardSize
+	}
+	if s.MoveTimeLimit < 0 || s.MoveTimeLimit > MaxMoveTimeLimit {
+		return ErrInvalidTimeControl
+	}
+	if s.CreatorColor != ColorRandom && s.CreatorColor != ColorBlack && s.CreatorColor != ColorWhite {
+		return ErrInvalidColorPreference
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+type SanctionKind string
+
+const (
+	// SanctionBan blocks login permanently.
+	SanctionBan SanctionKind = "ban"
+	// SanctionSuspension blocks login until it expires.
+	SanctionSuspension SanctionKind = "suspension"
+	// SanctionMute blocks chat. Without an expiry it lasts until revoked.
+	SanctionMute SanctionKind = "mute"
+)
+
+var (
+	ErrInvalidSanctionKind = errors.New("invalid sanction kind")
+	ErrBanHasExpiry        = errors.New("a ban is permanent, use a suspension for a limited time")
+	ErrSuspensionNoExpiry  = errors.New("a suspension needs a duration")
+	ErrReasonTooLong       = errors.New("reason is too long")
+)
+
+// SanctionReasonMaxLength matches the reason column of user_sanctions.
+const SanctionReasonMaxLength = 255
+
+// Sanction is one moderation action against a user. A nil ExpiresAt never
+// expires; a revoked sanction no longer applies.
+type Sanction struct {
+	ID        int64        `json:"id"`
+	UserID    int64        `json:"user_id"`
+	Kind      SanctionKind `json:"kind"`
+	Reason    string       `json:"reason"`
+	IssuedBy  string       `json:"issued_by"`
+	CreatedAt time.Time    `json:"created_at"`
+	ExpiresAt *time.Time   `json:"expires_at,omitempty"`
+	RevokedAt *time.Time   `json:"revoked_at,omitempty"`
+}
+
+func (s *Sanction) ActiveAt(now time.Time) bool {
+	if s.RevokedAt != nil {
+		return false
+	}
+	return s.ExpiresAt == nil || s.ExpiresAt.After(now)
+}
+
+// BlocksLogin reports whether the sanction keeps the user from logging in.
+func (s *Sanction) BlocksLogin() bool {
+	return s.Kind == SanctionBan || s.Kind == SanctionSuspension
+}
+
+// ValidateSanction checks that kind is known, that the duration fits it
+// and that reason fits the column it is stored in.
+func ValidateSanction(kind SanctionKind, reason string, duration time.Duration) error {
+	if utf8.RuneCountInString(reason) > SanctionReasonMaxLength {
+		return fmt.Errorf("%w: at most %d characters", ErrReasonTooLong, SanctionReasonMaxLength)
+	}
+	switch kind {
+	case SanctionBan:
+		if duration != 0 {
+			return ErrBanHasExpiry
+		}
+	case SanctionSuspension:
+		if duration <= 0 {
+			return ErrSuspensionNoExpiry
+		}
+	case SanctionMute:
+	default:
+		return ErrInvalidSanctionKind
+	}
+	return nil
+}
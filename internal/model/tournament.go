@@ -0,0 +1,455 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+type TournamentFormat int
+
+const (
+	TournamentSingleElimination TournamentFormat = iota
+	TournamentDoubleElimination
+)
+
+type TournamentStatus int
+
+const (
+	TournamentStatusRegistering TournamentStatus = iota
+	TournamentStatusRunning
+	TournamentStatusFinished
+)
+
+type MatchStatus int
+
+const (
+	MatchStatusPending MatchStatus = iota
+	MatchStatusReady
+	MatchStatusPlaying
+	MatchStatusFinished
+)
+
+const (
+	BracketWinners = "winners"
+	BracketLosers  = "losers"
+	BracketFinal   = "final"
+)
+
+var (
+	ErrTournamentFull       = errors.New("tournament is full")
+	ErrTournamentStarted    = errors.New("tournament already started")
+	ErrNotEnoughPlayers     = errors.New("not enough players")
+	ErrAlreadyRegistered    = errors.New("already registered")
+	ErrMatchNotFound        = errors.New("match not found")
+	ErrMatchNotReady        = errors.New("match not ready")
+	ErrNotInMatch           = errors.New("not a player of this match")
+	ErrInvalidMatchResult   = errors.New("invalid match result")
+	ErrInvalidBracketFormat = errors.New("invalid bracket format")
+)
+
+type TournamentMatch struct {
+	ID      int         `json:"id"`
+	Bracket string      `json:"bracket"`
+	Round   int         `json:"round"`
+	Player1 int64       `json:"player1"`
+	Player2 int64       `json:"player2"`
+	Black   int64       `json:"black"`
+	Winner  int64       `json:"winner"`
+	Loser   int64       `json:"loser"`
+	Status  MatchStatus `json:"status"`
+	Games   int         `json:"games"`
+	Bye     bool        `json:"bye"`
+	Forfeit bool        `json:"forfeit"`
+	RoomID  int64       `json:"room_id,omitempty"`
+	// Transport is where RoomID lives; room IDs are per transport, so both
+	// players must check in over the same one.
+	Transport    string    `json:"transport,omitempty"`
+	ReadyAt      time.Time `json:"ready_at,omitempty"`
+	NextMatchID  int       `json:"next_match_id,omitempty"`
+	NextSlot     int       `json:"next_slot,omitempty"`
+	LoserMatchID int       `json:"loser_match_id,omitempty"`
+	LoserSlot    int       `json:"loser_slot,omitempty"`
+
+	filled    [2]bool
+	checkedIn [2]bool
+	// present marks players who tried to check in but were turned away
+	// because the match room is on the other transport.
+	present [2]bool
+}
+
+func (m *TournamentMatch) HasPlayer(userID int64) bool {
+	return userID != 0 && (m.Player1 == userID || m.Player2 == userID)
+}
+
+func (m *TournamentMatch) Opponent(userID int64) int64 {
+	if m.Player1 == userID {
+		return m.Player2
+	}
+	return m.Player1
+}
+
+func (m *TournamentMatch) White() int64 {
+	return m.Opponent(m.Black)
+}
+
+func (m *TournamentMatch) CheckIn(userID int64) bool {
+	if m.Player1 == userID {
+		m.checkedIn[0] = true
+	} else if m.Player2 == userID {
+		m.checkedIn[1] = true
+	}
+	return m.checkedIn[0] && m.checkedIn[1]
+}
+
+func (m *TournamentMatch) CheckedIn(userID int64) bool {
+	if m.Player1 == userID {
+		return m.checkedIn[0]
+	}
+	if m.Player2 == userID {
+		return m.checkedIn[1]
+	}
+	return false
+}
+
+// MarkPresent records that userID turned up for the match without being
+// able to check in, so a no-show does not count against them.
+func (m *TournamentMatch) MarkPresent(userID int64) {
+	if m.Player1 == userID {
+		m.present[0] = true
+	} else if m.Player2 == userID {
+		m.present[1] = true
+	}
+}
+
+// Present reports whether userID checked in or turned up trying to.
+func (m *TournamentMatch) Present(userID int64) bool {
+	if m.Player1 == userID {
+		return m.checkedIn[0] || m.present[0]
+	}
+	if m.Player2 == userID {
+		return m.checkedIn[1] || m.present[1]
+	}
+	return false
+}
+
+// Renew starts a new check-in period. Players already checked in stay
+// checked in; the others have to turn up again.
+func (m *TournamentMatch) Renew() {
+	m.present = [2]bool{}
+	m.ReadyAt = time.Now()
+}
+
+// Tiebreak sets the match up for another game after a draw, with the
+// colours swapped.
+func (m *TournamentMatch) Tiebreak() {
+	m.Black = m.White()
+	m.Games++
+}
+
+func (m *TournamentMatch) IsFinished() bool {
+	return m.Status == MatchStatusFinished
+}
+
+type Tournament struct {
+	ID            int64              `json:"id"`
+	Name          string             `json:"name"`
+	Format        TournamentFormat   `json:"format"`
+	Status        TournamentStatus   `json:"status"`
+	CreatorID     int64              `json:"creator_id"`
+	MaxPlayers    int                `json:"max_players"`
+	NoShowTimeout time.Duration      `json:"no_show_timeout"`
+	Players       []int64            `json:"players"`
+	Seeds         []int64            `json:"seeds,omitempty"`
+	Matches       []*TournamentMatch `json:"matches,omitempty"`
+	Champion      int64              `json:"champion"`
+	CreatedAt     time.Time          `json:"created_at"`
+}
+
+func NewTournament(id int64, name string, format TournamentFormat, creatorID int64, maxPlayers int, noShowTimeout time.Duration) *Tournament {
+	return &Tournament{
+		ID:            id,
+		Name:          name,
+		Format:        format,
+		Status:        TournamentStatusRegistering,
+		CreatorID:     creatorID,
+		MaxPlayers:    maxPlayers,
+		NoShowTimeout: noShowTimeout,
+		Players:       []int64{},
+		CreatedAt:     time.Now(),
+	}
+}
+
+func (t *Tournament) HasPlayer(userID int64) bool {
+	for _, p := range t.Players {
+		if p == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Tournament) AddPlayer(userID int64) error {
+	if t.Status != TournamentStatusRegistering {
+		return ErrTournamentStarted
+	}
+	if t.HasPlayer(userID) {
+		return ErrAlreadyRegistered
+	}
+	if t.MaxPlayers > 0 && len(t.Players) >= t.MaxPlayers {
+		return ErrTournamentFull
+	}
+	t.Players = append(t.Players, userID)
+	return nil
+}
+
+func (t *Tournament) GetMatch(matchID int) *TournamentMatch {
+	if matchID <= 0 || matchID > len(t.Matches) {
+		return nil
+	}
+	return t.Matches[matchID-1]
+}
+
+func (t *Tournament) PlayerMatch(userID int64) *TournamentMatch {
+	for _, m := range t.Matches {
+		if (m.Status == MatchStatusReady || m.Status == MatchStatusPlaying) && m.HasPlayer(userID) {
+			return m
+		}
+	}
+	return nil
+}
+
+// BuildBracket lays out every match of the tournament from the seeded player
+// list. Seeds must already be sorted from strongest to weakest; missing seeds
+// up to the next power of two become byes for the top seeds.
+func (t *Tournament) BuildBracket(seeds []int64) ([]*TournamentMatch, error) {
+	if len(seeds) < 2 {
+		return nil, ErrNotEnoughPlayers
+	}
+	if t.Format != TournamentSingleElimination && t.Format != TournamentDoubleElimination {
+		return nil, ErrInvalidBracketFormat
+	}
+
+	size := 2
+	rounds := 1
+	for size < len(seeds) {
+		size *= 2
+		rounds++
+	}
+
+	t.Seeds = seeds
+	t.Matches = nil
+
+	winners := make([][]*TournamentMatch, rounds)
+	for r := 0; r < rounds; r++ {
+		winners[r] = t.addRound(BracketWinners, r+1, size>>(r+1))
+	}
+	for r := 0; r < rounds-1; r++ {
+		for i, m := range winners[r] {
+			m.NextMatchID = winners[r+1][i/2].ID
+			m.NextSlot = i%2 + 1
+		}
+	}
+
+	order := seedOrder(size)
+	for i, m := range winners[0] {
+		m.Player1 = seedAt(seeds, order[2*i])
+		m.Player2 = seedAt(seeds, order[2*i+1])
+		m.filled = [2]bool{true, true}
+	}
+
+	if t.Format == TournamentDoubleElimination && rounds > 1 {
+		losers := make([][]*TournamentMatch, 2*(rounds-1))
+		for j := 1; j <= len(losers); j++ {
+			var count int
+			if j%2 == 0 {
+				count = size >> (j/2 + 1)
+			} else {
+				count = size >> ((j+1)/2 + 1)
+			}
+			losers[j-1] = t.addRound(BracketLosers, j, count)
+		}
+
+		for i, m := range winners[0] {
+			m.LoserMatchID = losers[0][i/2].ID
+			m.LoserSlot = i%2 + 1
+		}
+		for j := 1; j <= len(losers); j++ {
+			round := losers[j-1]
+			if j < len(losers) {
+				next := losers[j]
+				for i, m := range round {
+					if j%2 == 1 {
+						m.NextMatchID = next[i].ID
+						m.NextSlot = 1
+					} else {
+						m.NextMatchID = next[i/2].ID
+						m.NextSlot = i%2 + 1
+					}
+				}
+			}
+			if j%2 == 0 {
+				for i, m := range winners[j/2] {
+					m.LoserMatchID = round[i].ID
+					m.LoserSlot = 2
+				}
+			}
+		}
+
+		final := t.addRound(BracketFinal, 1, 1)[0]
+		winners[rounds-1][0].NextMatchID = final.ID
+		winners[rounds-1][0].NextSlot = 1
+		losers[len(losers)-1][0].NextMatchID = final.ID
+		losers[len(losers)-1][0].NextSlot = 2
+	}
+
+	t.Status = TournamentStatusRunning
+
+	ready := make([]*TournamentMatch, 0)
+	for _, m := range winners[0] {
+		ready = append(ready, t.resolve(m)...)
+	}
+	return ready, nil
+}
+
+func (t *Tournament) addRound(bracket string, round, count int) []*TournamentMatch {
+	matches := make([]*TournamentMatch, count)
+	for i := range matches {
+		m := &TournamentMatch{
+			ID:      len(t.Matches) + 1,
+			Bracket: bracket,
+			Round:   round,
+			Status:  MatchStatusPending,
+		}
+		t.Matches = append(t.Matches, m)
+		matches[i] = m
+	}
+	return matches
+}
+
+// FinishMatch records the winner of a match and advances both players through
+// the bracket. It returns every match that became playable as a result.
+func (t *Tournament) FinishMatch(m *TournamentMatch, winner int64, forfeit bool) ([]*TournamentMatch, error) {
+	if m.IsFinished() {
+		return nil, ErrInvalidMatchResult
+	}
+	if !m.HasPlayer(winner) {
+		return nil, ErrInvalidMatchResult
+	}
+
+	m.Winner = winner
+	m.Loser = m.Opponent(winner)
+	m.Forfeit = forfeit
+	m.Status = MatchStatusFinished
+
+	return t.advance(m), nil
+}
+
+func (t *Tournament) advance(m *TournamentMatch) []*TournamentMatch {
+	ready := make([]*TournamentMatch, 0)
+
+	if m.NextMatchID == 0 {
+		t.Champion = m.Winner
+		t.Status = TournamentStatusFinished
+		return ready
+	}
+
+	ready = append(ready, t.deliver(m.NextMatchID, m.NextSlot, m.Winner)...)
+	if m.LoserMatchID != 0 {
+		ready = append(ready, t.deliver(m.LoserMatchID, m.LoserSlot, m.Loser)...)
+	}
+	return ready
+}
+
+func (t *Tournament) deliver(matchID, slot int, player int64) []*TournamentMatch {
+	m := t.GetMatch(matchID)
+	if m == nil {
+		return nil
+	}
+	if slot == 1 {
+		m.Player1 = player
+	} else {
+		m.Player2 = player
+	}
+	m.filled[slot-1] = true
+	return t.resolve(m)
+}
+
+func (t *Tournament) resolve(m *TournamentMatch) []*TournamentMatch {
+	if !m.filled[0] || !m.filled[1] || m.Status != MatchStatusPending {
+		return nil
+	}
+
+	if m.Player1 != 0 && m.Player2 != 0 {
+		m.Status = MatchStatusReady
+		m.Black = m.Player1
+		m.ReadyAt = time.Now()
+		return []*TournamentMatch{m}
+	}
+
+	m.Bye = true
+	m.Status = MatchStatusFinished
+	if m.Player1 != 0 {
+		m.Winner = m.Player1
+	} else {
+		m.Winner = m.Player2
+	}
+	return t.advance(m)
+}
+
+type BracketRound struct {
+	Bracket string             `json:"bracket"`
+	Round   int                `json:"round"`
+	Matches []*TournamentMatch `json:"matches"`
+}
+
+type Bracket struct {
+	TournamentID int64            `json:"tournament_id"`
+	Name         string           `json:"name"`
+	Format       TournamentFormat `json:"format"`
+	Status       TournamentStatus `json:"status"`
+	Seeds        []int64          `json:"seeds"`
+	Rounds       []*BracketRound  `json:"rounds"`
+	Champion     int64            `json:"champion"`
+}
+
+func (t *Tournament) Bracket() *Bracket {
+	b := &Bracket{
+		TournamentID: t.ID,
+		Name:         t.Name,
+		Format:       t.Format,
+		Status:       t.Status,
+		Seeds:        t.Seeds,
+		Rounds:       make([]*BracketRound, 0),
+		Champion:     t.Champion,
+	}
+
+	var current *BracketRound
+	for _, m := range t.Matches {
+		if current == nil || current.Bracket != m.Bracket || current.Round != m.Round {
+			current = &BracketRound{Bracket: m.Bracket, Round: m.Round}
+			b.Rounds = append(b.Rounds, current)
+		}
+		mc := *m
+		current.Matches = append(current.Matches, &mc)
+	}
+	return b
+}
+
+func seedOrder(size int) []int {
+	order := []int{1}
+	for n := 2; n <= size; n *= 2 {
+		next := make([]int, 0, n)
+		for _, s := range order {
+			next = append(next, s, n+1-s)
+		}
+		order = next
+	}
+	return order
+}
+
+func seedAt(seeds []int64, seed int) int64 {
+	if seed > len(seeds) {
+		return 0
+	}
+	return seeds[seed-1]
+}
@@ -0,0 +1,267 @@
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var formats = map[TournamentFormat]string{
+	TournamentSingleElimination: "single",
+	TournamentDoubleElimination: "double",
+}
+
+// newBracket builds a tournament of n players whose IDs are their seeds,
+// 1 being the strongest.
+func newBracket(t *testing.T, format TournamentFormat, n int) (*Tournament, []*TournamentMatch) {
+	t.Helper()
+	tour := NewTournament(1, "test", format, 1, n, time.Minute)
+	seeds := make([]int64, n)
+	for i := range seeds {
+		seeds[i] = int64(i + 1)
+	}
+	ready, err := tour.BuildBracket(seeds)
+	if err != nil {
+		t.Fatalf("BuildBracket: %v", err)
+	}
+	return tour, ready
+}
+
+// play finishes ready matches until none are left. pick returns the
+// winner of each match.
+func play(t *testing.T, tour *Tournament, ready []*TournamentMatch, pick func(m *TournamentMatch) int64) {
+	t.Helper()
+	for len(ready) > 0 {
+		m := ready[0]
+		ready = ready[1:]
+		if m.Status != MatchStatusReady {
+			t.Fatalf("match %d reported ready with status %d", m.ID, m.Status)
+		}
+		next, err := tour.FinishMatch(m, pick(m), false)
+		if err != nil {
+			t.Fatalf("FinishMatch %d: %v", m.ID, err)
+		}
+		ready = append(ready, next...)
+	}
+}
+
+func higherSeed(m *TournamentMatch) int64 {
+	return min(m.Player1, m.Player2)
+}
+
+func pairs(matches []*TournamentMatch) [][2]int64 {
+	p := make([][2]int64, len(matches))
+	for i, m := range matches {
+		p[i] = [2]int64{m.Player1, m.Player2}
+	}
+	return p
+}
+
+func TestBuildBracket(t *testing.T) {
+	tests := []struct {
+		format  TournamentFormat
+		players int
+		matches int
+		// ready are the first matches to play; byes the players advanced
+		// without playing.
+		ready [][2]int64
+		byes  []int64
+	}{
+		{TournamentSingleElimination, 2, 1, [][2]int64{{1, 2}}, nil},
+		{TournamentSingleElimination, 3, 3, [][2]int64{{2, 3}}, []int64{1}},
+		{TournamentSingleElimination, 5, 7, [][2]int64{{4, 5}, {2, 3}}, []int64{1, 2, 3}},
+		{TournamentSingleElimination, 8, 7, [][2]int64{{1, 8}, {4, 5}, {2, 7}, {3, 6}}, nil},
+		{TournamentDoubleElimination, 2, 1, [][2]int64{{1, 2}}, nil},
+		{TournamentDoubleElimination, 3, 6, [][2]int64{{2, 3}}, []int64{1}},
+		{TournamentDoubleElimination, 5, 14, [][2]int64{{4, 5}, {2, 3}}, []int64{1, 2, 3}},
+		{TournamentDoubleElimination, 8, 14, [][2]int64{{1, 8}, {4, 5}, {2, 7}, {3, 6}}, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(fmt.Sprintf("%s/%d", formats[tc.format], tc.players), func(t *testing.T) {
+			tour, ready := newBracket(t, tc.format, tc.players)
+
+			if tour.Status != TournamentStatusRunning {
+				t.Errorf("status %d, want running", tour.Status)
+			}
+			if len(tour.Matches) != tc.matches {
+				t.Errorf("%d matches, want %d", len(tour.Matches), tc.matches)
+			}
+			if got := pairs(ready); !reflect.DeepEqual(got, tc.ready) {
+				t.Errorf("ready matches %v, want %v", got, tc.ready)
+			}
+			for _, m := range ready {
+				if m.Black != m.Player1 {
+					t.Errorf("match %d: black is %d, want the higher seed %d", m.ID, m.Black, m.Player1)
+				}
+			}
+
+			var byes []int64
+			for _, m := range tour.Matches {
+				if m.Bracket == BracketWinners && m.Round == 1 && m.Bye {
+					if m.Status != MatchStatusFinished {
+						t.Errorf("bye match %d not finished", m.ID)
+					}
+					byes = append(byes, m.Winner)
+				}
+			}
+			if !reflect.DeepEqual(byes, tc.byes) {
+				t.Errorf("byes for %v, want %v", byes, tc.byes)
+			}
+		})
+	}
+}
+
+func TestBuildBracketErrors(t *testing.T) {
+	tour := NewTournament(1, "test", TournamentSingleElimination, 1, 8, time.Minute)
+	if _, err := tour.BuildBracket([]int64{1}); err != ErrNotEnoughPlayers {
+		t.Errorf("one player: got %v, want %v", err, ErrNotEnoughPlayers)
+	}
+
+	tour = NewTournament(1, "test", TournamentFormat(9), 1, 8, time.Minute)
+	if _, err := tour.BuildBracket([]int64{1, 2}); err != ErrInvalidBracketFormat {
+		t.Errorf("bad format: got %v, want %v", err, ErrInvalidBracketFormat)
+	}
+}
+
+func TestPlayThrough(t *testing.T) {
+	for _, format := range []TournamentFormat{TournamentSingleElimination, TournamentDoubleElimination} {
+		for _, n := range []int{2, 3, 5, 8} {
+			t.Run(fmt.Sprintf("%s/%d", formats[format], n), func(t *testing.T) {
+				tour, ready := newBracket(t, format, n)
+				play(t, tour, ready, higherSeed)
+
+				if tour.Status != TournamentStatusFinished {
+					t.Fatalf("status %d, want finished", tour.Status)
+				}
+				if tour.Champion != 1 {
+					t.Errorf("champion %d, want seed 1", tour.Champion)
+				}
+
+				// A player is out after one loss, or two in double
+				// elimination once there is a losers bracket.
+				lives := 1
+				if format == TournamentDoubleElimination && n > 2 {
+					lives = 2
+				}
+				losses := make(map[int64]int)
+				for _, m := range tour.Matches {
+					if m.Status != MatchStatusFinished {
+						t.Errorf("match %d left with status %d", m.ID, m.Status)
+					}
+					if !m.Bye {
+						losses[m.Loser]++
+					}
+				}
+				for p := int64(1); p <= int64(n); p++ {
+					want := lives
+					if p == tour.Champion {
+						want = 0
+					}
+					if losses[p] != want {
+						t.Errorf("seed %d lost %d times, want %d", p, losses[p], want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestDoubleEliminationLosersBracket(t *testing.T) {
+	tour, ready := newBracket(t, TournamentDoubleElimination, 8)
+
+	// Seed 2 beats seed 1 in the winners final; the higher seed wins
+	// everything else.
+	play(t, tour, ready, func(m *TournamentMatch) int64 {
+		if m.Bracket == BracketWinners && m.HasPlayer(1) && m.HasPlayer(2) {
+			return 2
+		}
+		return higherSeed(m)
+	})
+
+	for _, m := range tour.Matches {
+		if m.Bracket == BracketLosers && m.Round == 1 {
+			// First round losers meet in pairs: 8 and 5, then 7 and 6.
+			if got := [2]int64{m.Player1, m.Player2}; got != [2]int64{8, 5} && got != [2]int64{7, 6} {
+				t.Errorf("losers round 1 match %d is %v", m.ID, got)
+			}
+		}
+	}
+
+	final := tour.Matches[len(tour.Matches)-1]
+	if final.Bracket != BracketFinal {
+		t.Fatalf("last match is in %q, want the final", final.Bracket)
+	}
+	if final.Player1 != 2 || final.Player2 != 1 {
+		t.Errorf("final is %d v %d, want winners champion 2 v losers champion 1", final.Player1, final.Player2)
+	}
+	if tour.Champion != 1 {
+		t.Errorf("champion %d, want 1 through the losers bracket", tour.Champion)
+	}
+}
+
+func TestFinishMatchErrors(t *testing.T) {
+	tour, ready := newBracket(t, TournamentSingleElimination, 4)
+	m := ready[0]
+
+	if _, err := tour.FinishMatch(m, 99, false); err != ErrInvalidMatchResult {
+		t.Errorf("outsider as winner: got %v, want %v", err, ErrInvalidMatchResult)
+	}
+	if _, err := tour.FinishMatch(m, m.Player1, true); err != nil {
+		t.Fatalf("forfeit: %v", err)
+	}
+	if !m.Forfeit || m.Loser != m.Player2 {
+		t.Errorf("forfeit recorded as %+v", m)
+	}
+	if _, err := tour.FinishMatch(m, m.Player1, false); err != ErrInvalidMatchResult {
+		t.Errorf("finishing twice: got %v, want %v", err, ErrInvalidMatchResult)
+	}
+}
+
+func TestTiebreak(t *testing.T) {
+	tests := []struct {
+		draws     int
+		wantBlack int64
+	}{
+		{0, 1},
+		{1, 2},
+		{2, 1},
+		{3, 2},
+	}
+
+	for _, tc := range tests {
+		m := &TournamentMatch{Player1: 1, Player2: 2, Black: 1, Games: 1}
+		for i := 0; i < tc.draws; i++ {
+			m.Tiebreak()
+		}
+		if m.Black != tc.wantBlack || m.White() != 3-tc.wantBlack {
+			t.Errorf("%d draws: black %d white %d, want black %d", tc.draws, m.Black, m.White(), tc.wantBlack)
+		}
+		if m.Games != 1+tc.draws {
+			t.Errorf("%d draws: %d games, want %d", tc.draws, m.Games, 1+tc.draws)
+		}
+	}
+}
+
+func TestCheckIn(t *testing.T) {
+	m := &TournamentMatch{Player1: 1, Player2: 2}
+
+	if m.CheckIn(3) {
+		t.Error("outsider completed the check-in")
+	}
+	if m.CheckIn(1) {
+		t.Error("one player completed the check-in")
+	}
+	m.MarkPresent(2)
+	if !m.Present(2) || m.CheckedIn(2) {
+		t.Error("player turned away should be present but not checked in")
+	}
+	m.Renew()
+	if m.Present(2) || !m.CheckedIn(1) {
+		t.Error("Renew should keep check-ins and forget the rest")
+	}
+	if !m.CheckIn(2) {
+		t.Error("both players checked in")
+	}
+}
@@ -2,29 +2,100 @@ package model
 
 import "time"
 
+// DeletedUserID stands in for a deleted account in the game records it
+// leaves behind.
+const DeletedUserID int64 = -1
+
 type User struct {
-	ID        int64     `json:"id"`
-	Username  string    `json:"username"`
-	Password  string    `json:"-"`
-	Score     int       `json:"score"`
-	WinCount  int       `json:"win_count"`
-	LoseCount int       `json:"lose_count"`
-	CreatedAt time.Time `json:"created_at"`
+	ID          int64     `json:"id"`
+	Username    string    `json:"username"`
+	Password    string    `json:"-"`
+	Role        Role      `json:"role"`
+	DisplayName string    `json:"display_name"`
+	AvatarID    int       `json:"avatar_id"`
+	Country     string    `json:"country"`
+	Bio         string    `json:"bio"`
+	Score       int       `json:"score"`
+	WinCount    int       `json:"win_count"`
+	LoseCount   int       `json:"lose_count"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Name is what other players see: the display name if set, otherwise the
+// username.
+func (u *User) Name() string {
+	if u.DisplayName != "" {
+		return u.DisplayName
+	}
+	return u.Username
+}
+
+// UpdateProfileRequest changes the editable profile fields. Nil fields are
+// left as they are; an empty string clears a field.
+type UpdateProfileRequest struct {
+	DisplayName *string `json:"display_name,omitempty"`
+	AvatarID    *int    `json:"avatar_id,omitempty"`
+	Country     *string `json:"country,omitempty"`
+	Bio         *string `json:"bio,omitempty"`
 }
 
 type UserRegisterRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	// IP is filled in by the transport for rate limiting.
+	IP string `json:"-"`
 }
 
 type UserLoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Device   string `json:"device,omitempty"`
+	// IP is filled in by the transport for brute-force protection.
+	IP string `json:"-"`
+}
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+	// IP is filled in by the transport for brute-force protection.
+	IP string `json:"-"`
+}
+
+type PasswordResetRequest struct {
+	Username string `json:"username"`
+}
+
+type PasswordResetConfirm struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+// ClaimAccountRequest turns a guest into a registered account.
+type ClaimAccountRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// DeleteAccountRequest confirms account deletion. Guests have no password
+// and leave it empty.
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+	// IP is filled in by the transport for brute-force protection.
+	IP string `json:"-"`
 }
 
 type UserLoginResponse struct {
-	Token string `json:"token"`
-	User  *User  `json:"user"`
+	// Token is a short-lived access token; RefreshToken renews it.
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in"`
+	User         *User  `json:"user"`
+}
+
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
 }
 
 type UserResponse struct {
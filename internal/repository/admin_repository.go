@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"time"
+
+	"game-server/internal/metrics"
+	"game-server/internal/model"
+)
+
+func CreateAuditEntry(e *model.AuditEntry) error {
+	query := `INSERT INTO admin_audit_log (actor, action, target, detail, remote_addr, created_at) VALUES (?, ?, ?, ?, ?, ?)`
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	start := time.Now()
+	result, err := DB.Exec(query, e.Actor, e.Action, e.Target, e.Detail, e.RemoteAddr, e.CreatedAt)
+	metrics.ObserveDB("create_audit_entry", start, err)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	e.ID = id
+	return nil
+}
+
+func ListAuditEntries(limit, offset int) ([]*model.AuditEntry, error) {
+	query := `SELECT id, actor, action, target, detail, remote_addr, created_at
+			  FROM admin_audit_log
+			  ORDER BY id DESC
+			  LIMIT ? OFFSET ?`
+
+	start := time.Now()
+	rows, err := DB.Query(query, limit, offset)
+	metrics.ObserveDB("list_audit_entries", start, err)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]*model.AuditEntry, 0)
+	for rows.Next() {
+		e := &model.AuditEntry{}
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.Target, &e.Detail, &e.RemoteAddr, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"game-server/internal/metrics"
+	"game-server/internal/model"
+)
+
+var (
+	ErrCorrespondenceNotFound = errors.New("correspondence game not found")
+	ErrCorrespondenceStale    = errors.New("correspondence game was updated elsewhere")
+)
+
+// correspondenceColumns reads games stored before moves were kept, whose
+// move_history is NULL.
+const correspondenceColumns = `id, black_player_id, white_player_id, days_per_move, rule_set, rated, board_state, COALESCE(move_history, ''), current_player_id,
+	move_count, last_x, last_y, status, winner_id, move_deadline, created_at, updated_at`
+
+func CreateCorrespondenceGame(g *model.CorrespondenceGame) error {
+	board, err := json.Marshal(g.Board)
+	if err != nil {
+		return err
+	}
+	moves, err := marshalMoves(g.Moves)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO correspondence_games
+			  (black_player_id, white_player_id, days_per_move, rule_set, rated, board_state, move_history, current_player_id, move_count, last_x, last_y, status, winner_id, move_deadline)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	start := time.Now()
+	result, err := DB.Exec(query, g.BlackPlayerID, g.WhitePlayerID, g.DaysPerMove, g.RuleSet, g.Rated, string(board), moves, g.CurrentPlayer,
+		g.MoveCount, g.LastX, g.LastY, g.Status, g.WinnerID, g.Deadline)
+	metrics.ObserveDB("create_correspondence_game", start, err)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	g.ID = id
+	return nil
+}
+
+// UpdateCorrespondenceGame stores the new state only if nobody else has moved
+// since prevMoveCount was read.
+func UpdateCorrespondenceGame(g *model.CorrespondenceGame, prevMoveCount int) error {
+	board, err := json.Marshal(g.Board)
+	if err != nil {
+		return err
+	}
+	moves, err := marshalMoves(g.Moves)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE correspondence_games
+			  SET board_state = ?, move_history = ?, current_player_id = ?, move_count = ?, last_x = ?, last_y = ?, status = ?, winner_id = ?, move_deadline = ?
+			  WHERE id = ? AND status = ? AND move_count = ?`
+	start := time.Now()
+	result, err := DB.Exec(query, string(board), moves, g.CurrentPlayer, g.MoveCount, g.LastX, g.LastY, g.Status, g.WinnerID,
+		g.Deadline, g.ID, model.CorrespondenceStatusActive, prevMoveCount)
+	metrics.ObserveDB("update_correspondence_game", start, err)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrCorrespondenceStale
+	}
+	return nil
+}
+
+func GetCorrespondenceGame(id int64) (*model.CorrespondenceGame, error) {
+	query := `SELECT ` + correspondenceColumns + ` FROM correspondence_games WHERE id = ?`
+	start := time.Now()
+	g, err := scanCorrespondenceGame(DB.QueryRow(query, id))
+	metrics.ObserveDB("get_correspondence_game", start, err)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCorrespondenceNotFound
+		}
+		return nil, err
+	}
+	return g, nil
+}
+
+func GetActiveCorrespondenceGames(userID int64) ([]*model.CorrespondenceGame, error) {
+	query := `SELECT ` + correspondenceColumns + ` FROM correspondence_games
+			  WHERE (black_player_id = ? OR white_player_id = ?) AND status = ?
+			  ORDER BY move_deadline ASC`
+
+	start := time.Now()
+	rows, err := DB.Query(query, userID, userID, model.CorrespondenceStatusActive)
+	metrics.ObserveDB("get_active_correspondence_games", start, err)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	games := make([]*model.CorrespondenceGame, 0)
+	for rows.Next() {
+		g, err := scanCorrespondenceGame(rows)
+		if err != nil {
+			return nil, err
+		}
+		games = append(games, g)
+	}
+	return games, rows.Err()
+}
+
+// GetUserCorrespondenceGames returns every correspondence game of userID,
+// finished or not, oldest first.
+func GetUserCorrespondenceGames(userID int64) ([]*model.CorrespondenceGame, error) {
+	query := `SELECT ` + correspondenceColumns + ` FROM correspondence_games
+			  WHERE black_player_id = ? OR white_player_id = ?
+			  ORDER BY created_at ASC`
+
+	start := time.Now()
+	rows, err := DB.Query(query, userID, userID)
+	metrics.ObserveDB("get_user_correspondence_games", start, err)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	games := make([]*model.CorrespondenceGame, 0)
+	for rows.Next() {
+		g, err := scanCorrespondenceGame(rows)
+		if err != nil {
+			return nil, err
+		}
+		games = append(games, g)
+	}
+	return games, rows.Err()
+}
+
+func GetOverdueCorrespondenceGames(now time.Time) ([]*model.CorrespondenceGame, error) {
+	query := `SELECT ` + correspondenceColumns + ` FROM correspondence_games
+			  WHERE status = ? AND move_deadline < ?`
+
+	start := time.Now()
+	rows, err := DB.Query(query, model.CorrespondenceStatusActive, now)
+	metrics.ObserveDB("get_overdue_correspondence_games", start, err)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	games := make([]*model.CorrespondenceGame, 0)
+	for rows.Next() {
+		g, err := scanCorrespondenceGame(rows)
+		if err != nil {
+			return nil, err
+		}
+		games = append(games, g)
+	}
+	return games, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCorrespondenceGame(row rowScanner) (*model.CorrespondenceGame, error) {
+	g := &model.CorrespondenceGame{}
+	var board, moves string
+	var deadline sql.NullTime
+	err := row.Scan(
+		&g.ID,
+		&g.BlackPlayerID,
+		&g.WhitePlayerID,
+		&g.DaysPerMove,
+		&g.RuleSet,
+		&g.Rated,
+		&board,
+		&moves,
+		&g.CurrentPlayer,
+		&g.MoveCount,
+		&g.LastX,
+		&g.LastY,
+		&g.Status,
+		&g.WinnerID,
+		&deadline,
+		&g.CreatedAt,
+		&g.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if deadline.Valid {
+		g.Deadline = deadline.Time
+	}
+	if err := json.Unmarshal([]byte(board), &g.Board); err != nil {
+		return nil, err
+	}
+	if moves != "" {
+		if err := json.Unmarshal([]byte(moves), &g.Moves); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
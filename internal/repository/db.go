@@ -1,7 +1,9 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 
 	"game-server/internal/config"
@@ -11,6 +13,8 @@ import (
 
 var DB *sql.DB
 
+var ErrDBNotInitialized = errors.New("database not initialized")
+
 func InitDB() error {
 	cfg := config.GlobalConfig.Database
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&parseTime=True&loc=Local",
@@ -38,6 +42,13 @@ func InitDB() error {
 	return nil
 }
 
+func Ping(ctx context.Context) error {
+	if DB == nil {
+		return ErrDBNotInitialized
+	}
+	return DB.PingContext(ctx)
+}
+
 func CloseDB() {
 	if DB != nil {
 		DB.Close()
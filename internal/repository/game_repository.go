@@ -6,25 +6,88 @@ import (
 	"errors"
 	"fmt"
 	"time"
+
+	"game-server/internal/metrics"
+	"game-server/internal/model"
 )
 
 var ErrGameNotFound = errors.New("game not found")
 
 type GameRecord struct {
-	ID            int64
-	RoomID        int64
-	BlackPlayerID int64
-	WhitePlayerID int64
-	WinnerID      int64
-	BoardState    string
-	MoveHistory   string
-	CreatedAt     time.Time
-	EndedAt       time.Time
+	ID            int64      `json:"id"`
+	RoomID        int64      `json:"room_id"`
+	BlackPlayerID int64      `json:"black_player_id"`
+	WhitePlayerID int64      `json:"white_player_id"`
+	WinnerID      int64      `json:"winner_id"`
+	BoardState    string     `json:"board_state"`
+	MoveHistory   string     `json:"move_history,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	EndedAt       *time.Time `json:"ended_at,omitempty"`
+}
+
+// gameColumns reads unfinished games too, whose winner and board are NULL,
+// and games stored before moves were kept.
+const gameColumns = `id, room_id, black_player_id, white_player_id, COALESCE(winner_id, 0), COALESCE(board_state, ''),
+	COALESCE(move_history, ''), created_at, ended_at`
+
+func scanGameRecord(row rowScanner) (*GameRecord, error) {
+	record := &GameRecord{}
+	err := row.Scan(
+		&record.ID,
+		&record.RoomID,
+		&record.BlackPlayerID,
+		&record.WhitePlayerID,
+		&record.WinnerID,
+		&record.BoardState,
+		&record.MoveHistory,
+		&record.CreatedAt,
+		&record.EndedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// SaveGameRecord stores a finished two-player game with its moves and
+// returns its ID. A winner of 0 is a draw.
+func SaveGameRecord(game *model.Game, winner int64) (int64, error) {
+	board, err := json.Marshal(game.Board)
+	if err != nil {
+		return 0, err
+	}
+	moves, err := marshalMoves(game.Moves)
+	if err != nil {
+		return 0, err
+	}
+
+	query := `INSERT INTO games (room_id, black_player_id, white_player_id, winner_id, board_state, move_history, created_at, ended_at)
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	winnerID := sql.NullInt64{Int64: winner, Valid: winner != 0}
+	start := time.Now()
+	result, err := DB.Exec(query, game.RoomID, game.Players[0], game.Players[1], winnerID,
+		string(board), moves, game.StartedAt, time.Now())
+	metrics.ObserveDB("save_game_record", start, err)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// marshalMoves encodes moves for a move_history column.
+func marshalMoves(moves []model.Move) (string, error) {
+	if moves == nil {
+		moves = []model.Move{}
+	}
+	data, err := json.Marshal(moves)
+	return string(data), err
 }
 
 func CreateGameRecord(roomID, blackPlayerID, whitePlayerID int64) (int64, error) {
 	query := `INSERT INTO games (room_id, black_player_id, white_player_id, created_at) VALUES (?, ?, ?, ?)`
+	start := time.Now()
 	result, err := DB.Exec(query, roomID, blackPlayerID, whitePlayerID, time.Now())
+	metrics.ObserveDB("create_game_record", start, err)
 	if err != nil {
 		return 0, err
 	}
@@ -33,23 +96,17 @@ func CreateGameRecord(roomID, blackPlayerID, whitePlayerID int64) (int64, error)
 
 func UpdateGameResult(gameID, winnerID int64, boardState string) error {
 	query := `UPDATE games SET winner_id = ?, board_state = ?, ended_at = ? WHERE id = ?`
+	start := time.Now()
 	_, err := DB.Exec(query, winnerID, boardState, time.Now(), gameID)
+	metrics.ObserveDB("update_game_result", start, err)
 	return err
 }
 
 func GetGameByID(id int64) (*GameRecord, error) {
-	record := &GameRecord{}
-	query := `SELECT id, room_id, black_player_id, white_player_id, winner_id, board_state, created_at, ended_at FROM games WHERE id = ?`
-	err := DB.QueryRow(query, id).Scan(
-		&record.ID,
-		&record.RoomID,
-		&record.BlackPlayerID,
-		&record.WhitePlayerID,
-		&record.WinnerID,
-		&record.BoardState,
-		&record.CreatedAt,
-		&record.EndedAt,
-	)
+	query := `SELECT ` + gameColumns + ` FROM games WHERE id = ?`
+	start := time.Now()
+	record, err := scanGameRecord(DB.QueryRow(query, id))
+	metrics.ObserveDB("get_game_by_id", start, err)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrGameNotFound
@@ -60,64 +117,81 @@ func GetGameByID(id int64) (*GameRecord, error) {
 }
 
 func GetUserGames(userID int64, limit, offset int) ([]*GameRecord, error) {
-	query := `SELECT id, room_id, black_player_id, white_player_id, winner_id, board_state, created_at, ended_at 
+	query := `SELECT ` + gameColumns + `
 			  FROM games 
 			  WHERE black_player_id = ? OR white_player_id = ? 
 			  ORDER BY created_at DESC 
 			  LIMIT ? OFFSET ?`
 
+	start := time.Now()
 	rows, err := DB.Query(query, userID, userID, limit, offset)
+	metrics.ObserveDB("get_user_games", start, err)
 	if err != nil {
 		return nil, err
 	}
+	return collectGameRecords(rows)
+}
+
+// GetAllUserGames returns every game of userID, oldest first.
+func GetAllUserGames(userID int64) ([]*GameRecord, error) {
+	query := `SELECT ` + gameColumns + `
+			  FROM games
+			  WHERE black_player_id = ? OR white_player_id = ?
+			  ORDER BY created_at ASC`
+
+	start := time.Now()
+	rows, err := DB.Query(query, userID, userID)
+	metrics.ObserveDB("get_all_user_games", start, err)
+	if err != nil {
+		return nil, err
+	}
+	return collectGameRecords(rows)
+}
+
+func collectGameRecords(rows *sql.Rows) ([]*GameRecord, error) {
 	defer rows.Close()
 
 	records := make([]*GameRecord, 0)
 	for rows.Next() {
-		record := &GameRecord{}
-		err := rows.Scan(
-			&record.ID,
-			&record.RoomID,
-			&record.BlackPlayerID,
-			&record.WhitePlayerID,
-			&record.WinnerID,
-			&record.BoardState,
-			&record.CreatedAt,
-			&record.EndedAt,
-		)
+		record, err := scanGameRecord(rows)
 		if err != nil {
 			return nil, err
 		}
 		records = append(records, record)
 	}
-
-	return records, nil
+	return records, rows.Err()
 }
 
 func GetUserGameCount(userID int64) (int, error) {
 	var count int
 	query := `SELECT COUNT(*) FROM games WHERE black_player_id = ? OR white_player_id = ?`
+	start := time.Now()
 	err := DB.QueryRow(query, userID, userID).Scan(&count)
+	metrics.ObserveDB("get_user_game_count", start, err)
 	return count, err
 }
 
 type RankEntry struct {
-	UserID    int64  `json:"user_id"`
-	Username  string `json:"username"`
-	Score     int    `json:"score"`
-	WinCount  int    `json:"win_count"`
-	LoseCount int    `json:"lose_count"`
-	WinRate   string `json:"win_rate"`
-	Rank      int    `json:"rank"`
+	UserID      int64  `json:"user_id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name,omitempty"`
+	Score       int    `json:"score"`
+	WinCount    int    `json:"win_count"`
+	LoseCount   int    `json:"lose_count"`
+	WinRate     string `json:"win_rate"`
+	Rank        int    `json:"rank"`
 }
 
 func GetLeaderboard(limit, offset int) ([]*RankEntry, error) {
-	query := `SELECT id, username, score, win_count, lose_count 
+	query := `SELECT id, username, display_name, score, win_count, lose_count 
 			  FROM users 
+			  WHERE role <> 'guest'
 			  ORDER BY score DESC 
 			  LIMIT ? OFFSET ?`
 
+	start := time.Now()
 	rows, err := DB.Query(query, limit, offset)
+	metrics.ObserveDB("get_leaderboard", start, err)
 	if err != nil {
 		return nil, err
 	}
@@ -130,6 +204,7 @@ func GetLeaderboard(limit, offset int) ([]*RankEntry, error) {
 		err := rows.Scan(
 			&entry.UserID,
 			&entry.Username,
+			&entry.DisplayName,
 			&entry.Score,
 			&entry.WinCount,
 			&entry.LoseCount,
@@ -153,10 +228,16 @@ func GetLeaderboard(limit, offset int) ([]*RankEntry, error) {
 	return entries, nil
 }
 
+// GetUserRank returns the leaderboard position of userID, or 0 for guests,
+// who are not ranked.
 func GetUserRank(userID int64) (int, error) {
-	query := `SELECT COUNT(*) + 1 FROM users WHERE score > (SELECT score FROM users WHERE id = ?)`
+	query := `SELECT CASE WHEN u.role = 'guest' THEN 0
+			  ELSE (SELECT COUNT(*) + 1 FROM users WHERE role <> 'guest' AND score > u.score) END
+			  FROM users u WHERE u.id = ?`
 	var rank int
+	start := time.Now()
 	err := DB.QueryRow(query, userID).Scan(&rank)
+	metrics.ObserveDB("get_user_rank", start, err)
 	return rank, err
 }
 
@@ -167,12 +248,16 @@ func SaveBoardState(roomID int64, board [][]int) error {
 	}
 
 	query := `UPDATE games SET board_state = ? WHERE room_id = ? ORDER BY id DESC LIMIT 1`
+	start := time.Now()
 	_, err = DB.Exec(query, string(data), roomID)
+	metrics.ObserveDB("save_board_state", start, err)
 	return err
 }
 
 func GetUserStats(userID int64) (score, winCount, loseCount int, err error) {
 	query := `SELECT score, win_count, lose_count FROM users WHERE id = ?`
+	start := time.Now()
 	err = DB.QueryRow(query, userID).Scan(&score, &winCount, &loseCount)
+	metrics.ObserveDB("get_user_stats", start, err)
 	return
 }
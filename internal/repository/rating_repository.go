@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"time"
+
+	"game-server/internal/metrics"
+	"game-server/internal/model"
+)
+
+// GetUserRatingHistory returns every score change of userID, oldest first.
+func GetUserRatingHistory(userID int64) ([]*model.RatingChange, error) {
+	query := `SELECT id, user_id, game_type, game_id, delta, score, created_at
+			  FROM rating_history WHERE user_id = ? ORDER BY id ASC`
+
+	start := time.Now()
+	rows, err := DB.Query(query, userID)
+	metrics.ObserveDB("get_user_rating_history", start, err)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := make([]*model.RatingChange, 0)
+	for rows.Next() {
+		c := &model.RatingChange{}
+		if err := rows.Scan(&c.ID, &c.UserID, &c.GameType, &c.GameID, &c.Delta, &c.Score, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
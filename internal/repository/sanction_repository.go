@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"game-server/internal/metrics"
+	"game-server/internal/model"
+)
+
+var ErrSanctionNotFound = errors.New("sanction not found")
+
+const sanctionColumns = `id, user_id, kind, reason, issued_by, created_at, expires_at, revoked_at`
+
+func CreateSanction(s *model.Sanction) error {
+	query := `INSERT INTO user_sanctions (user_id, kind, reason, issued_by, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)`
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = time.Now()
+	}
+	start := time.Now()
+	result, err := DB.Exec(query, s.UserID, s.Kind, s.Reason, s.IssuedBy, s.CreatedAt, s.ExpiresAt)
+	metrics.ObserveDB("create_sanction", start, err)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	s.ID = id
+	return nil
+}
+
+// GetActiveSanction returns the sanction of one of kinds in force for userID
+// at now. Sanctions without expiry win over the one expiring last.
+func GetActiveSanction(userID int64, kinds []model.SanctionKind, now time.Time) (*model.Sanction, error) {
+	if len(kinds) == 0 {
+		return nil, ErrSanctionNotFound
+	}
+
+	args := []interface{}{userID, now}
+	for _, k := range kinds {
+		args = append(args, k)
+	}
+	query := `SELECT ` + sanctionColumns + ` FROM user_sanctions
+			  WHERE user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)
+			  AND kind IN (?` + strings.Repeat(", ?", len(kinds)-1) + `)
+			  ORDER BY expires_at IS NULL DESC, expires_at DESC
+			  LIMIT 1`
+
+	start := time.Now()
+	s, err := scanSanction(DB.QueryRow(query, args...))
+	metrics.ObserveDB("get_active_sanction", start, err)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSanctionNotFound
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+func GetSanction(id int64) (*model.Sanction, error) {
+	query := `SELECT ` + sanctionColumns + ` FROM user_sanctions WHERE id = ?`
+
+	start := time.Now()
+	s, err := scanSanction(DB.QueryRow(query, id))
+	metrics.ObserveDB("get_sanction", start, err)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSanctionNotFound
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+func GetUserSanctions(userID int64) ([]*model.Sanction, error) {
+	query := `SELECT ` + sanctionColumns + ` FROM user_sanctions WHERE user_id = ? ORDER BY id DESC`
+
+	start := time.Now()
+	rows, err := DB.Query(query, userID)
+	metrics.ObserveDB("get_user_sanctions", start, err)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sanctions := make([]*model.Sanction, 0)
+	for rows.Next() {
+		s, err := scanSanction(rows)
+		if err != nil {
+			return nil, err
+		}
+		sanctions = append(sanctions, s)
+	}
+	return sanctions, rows.Err()
+}
+
+func RevokeSanction(id int64, now time.Time) error {
+	query := `UPDATE user_sanctions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`
+	start := time.Now()
+	result, err := DB.Exec(query, now, id)
+	metrics.ObserveDB("revoke_sanction", start, err)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrSanctionNotFound
+	}
+	return nil
+}
+
+func scanSanction(row rowScanner) (*model.Sanction, error) {
+	s := &model.Sanction{}
+	var expiresAt, revokedAt sql.NullTime
+	if err := row.Scan(&s.ID, &s.UserID, &s.Kind, &s.Reason, &s.IssuedBy, &s.CreatedAt, &expiresAt, &revokedAt); err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		s.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		s.RevokedAt = &revokedAt.Time
+	}
+	return s, nil
+}
@@ -3,17 +3,26 @@ package repository
 import (
 	"database/sql"
 	"errors"
+	"time"
 
+	"game-server/internal/metrics"
 	"game-server/internal/model"
+
+	"github.com/go-sql-driver/mysql"
 )
 
 var ErrUserNotFound = errors.New("user not found")
 var ErrUserAlreadyExists = errors.New("user already exists")
 
 func CreateUser(user *model.User) error {
-	query := `INSERT INTO users (username, password, score, win_count, lose_count) VALUES (?, ?, ?, ?, ?)`
-	result, err := DB.Exec(query, user.Username, user.Password, user.Score, user.WinCount, user.LoseCount)
+	query := `INSERT INTO users (username, password, role, score, win_count, lose_count) VALUES (?, ?, ?, ?, ?, ?)`
+	start := time.Now()
+	result, err := DB.Exec(query, user.Username, user.Password, user.Role, user.Score, user.WinCount, user.LoseCount)
+	metrics.ObserveDB("create_user", start, err)
 	if err != nil {
+		if isDuplicateEntry(err) {
+			return ErrUserAlreadyExists
+		}
 		return err
 	}
 	id, err := result.LastInsertId()
@@ -24,18 +33,35 @@ func CreateUser(user *model.User) error {
 	return nil
 }
 
-func GetUserByUsername(username string) (*model.User, error) {
+const userColumns = `id, username, password, role, display_name, avatar_id, country, bio, score, win_count, lose_count, created_at`
+
+func scanUser(row *sql.Row) (*model.User, error) {
 	user := &model.User{}
-	query := `SELECT id, username, password, score, win_count, lose_count, created_at FROM users WHERE username = ?`
-	err := DB.QueryRow(query, username).Scan(
+	err := row.Scan(
 		&user.ID,
 		&user.Username,
 		&user.Password,
+		&user.Role,
+		&user.DisplayName,
+		&user.AvatarID,
+		&user.Country,
+		&user.Bio,
 		&user.Score,
 		&user.WinCount,
 		&user.LoseCount,
 		&user.CreatedAt,
 	)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func GetUserByUsername(username string) (*model.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users WHERE username = ?`
+	start := time.Now()
+	user, err := scanUser(DB.QueryRow(query, username))
+	metrics.ObserveDB("get_user_by_username", start, err)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrUserNotFound
@@ -46,17 +72,10 @@ func GetUserByUsername(username string) (*model.User, error) {
 }
 
 func GetUserByID(id int64) (*model.User, error) {
-	user := &model.User{}
-	query := `SELECT id, username, password, score, win_count, lose_count, created_at FROM users WHERE id = ?`
-	err := DB.QueryRow(query, id).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Password,
-		&user.Score,
-		&user.WinCount,
-		&user.LoseCount,
-		&user.CreatedAt,
-	)
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = ?`
+	start := time.Now()
+	user, err := scanUser(DB.QueryRow(query, id))
+	metrics.ObserveDB("get_user_by_id", start, err)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrUserNotFound
@@ -66,13 +85,178 @@ func GetUserByID(id int64) (*model.User, error) {
 	return user, nil
 }
 
-func UpdateUserScore(userID int64, scoreDelta int, isWin bool) error {
+// UpdateUserProfile stores the editable profile fields of user.
+func UpdateUserProfile(user *model.User) error {
+	query := `UPDATE users SET display_name = ?, avatar_id = ?, country = ?, bio = ? WHERE id = ?`
+	start := time.Now()
+	result, err := DB.Exec(query, user.DisplayName, user.AvatarID, user.Country, user.Bio, user.ID)
+	metrics.ObserveDB("update_user_profile", start, err)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		// MySQL reports 0 for an unchanged row too; tell the two apart.
+		if _, err := GetUserByID(user.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateUserScore applies the result of one game to userID and adds the
+// change to the user's rating history.
+func UpdateUserScore(userID int64, scoreDelta int, isWin bool, gameType model.GameType, gameID int64) (err error) {
 	var query string
 	if isWin {
 		query = `UPDATE users SET score = score + ?, win_count = win_count + 1 WHERE id = ?`
 	} else {
 		query = `UPDATE users SET score = score + ?, lose_count = lose_count + 1 WHERE id = ?`
 	}
-	_, err := DB.Exec(query, scoreDelta, userID)
+	start := time.Now()
+	defer func() { metrics.ObserveDB("update_user_score", start, err) }()
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.Exec(query, scoreDelta, userID); err != nil {
+		return err
+	}
+	history := `INSERT INTO rating_history (user_id, game_type, game_id, delta, score, created_at)
+				SELECT id, ?, ?, ?, score, ? FROM users WHERE id = ?`
+	if _, err = tx.Exec(history, gameType, gameID, scoreDelta, time.Now(), userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ClaimGuest gives a guest account a username and password and makes it a
+// player. It fails with ErrUserNotFound if userID is not a guest.
+func ClaimGuest(userID int64, username, hash string) error {
+	query := `UPDATE users SET username = ?, password = ?, role = 'player' WHERE id = ? AND role = 'guest'`
+	start := time.Now()
+	result, err := DB.Exec(query, username, hash, userID)
+	metrics.ObserveDB("claim_guest", start, err)
+	if err != nil {
+		if isDuplicateEntry(err) {
+			return ErrUserAlreadyExists
+		}
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// StaleGuestIDs lists guest accounts created before cutoff that never
+// played a game. Whether they are still logged in is up to the caller.
+func StaleGuestIDs(cutoff time.Time, limit int) ([]int64, error) {
+	query := `SELECT id FROM users u
+			  WHERE u.role = 'guest' AND u.created_at < ?
+			  AND NOT EXISTS (SELECT 1 FROM games g WHERE g.black_player_id = u.id OR g.white_player_id = u.id)
+			  AND NOT EXISTS (SELECT 1 FROM correspondence_games c WHERE c.black_player_id = u.id OR c.white_player_id = u.id)
+			  LIMIT ?`
+	start := time.Now()
+	rows, err := DB.Query(query, cutoff, limit)
+	metrics.ObserveDB("stale_guest_ids", start, err)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// DeleteGuest removes a guest account; other roles are left alone.
+func DeleteGuest(userID int64) error {
+	query := `DELETE FROM users WHERE id = ? AND role = 'guest'`
+	start := time.Now()
+	_, err := DB.Exec(query, userID)
+	metrics.ObserveDB("delete_guest", start, err)
+	return err
+}
+
+// isDuplicateEntry reports a unique key violation, e.g. a taken username.
+func isDuplicateEntry(err error) bool {
+	var me *mysql.MySQLError
+	return errors.As(err, &me) && me.Number == 1062
+}
+
+func UpdateUserPassword(userID int64, hash string) error {
+	query := `UPDATE users SET password = ? WHERE id = ?`
+	start := time.Now()
+	_, err := DB.Exec(query, hash, userID)
+	metrics.ObserveDB("update_user_password", start, err)
+	return err
+}
+
+func UpdateUserRole(userID int64, role model.Role) error {
+	query := `UPDATE users SET role = ? WHERE id = ?`
+	start := time.Now()
+	_, err := DB.Exec(query, role, userID)
+	metrics.ObserveDB("update_user_role", start, err)
 	return err
 }
+
+// DeleteUserAccount removes userID, its sanctions and its rating history.
+// Game records stay for the opponents; the user's side of them is replaced
+// with model.DeletedUserID.
+func DeleteUserAccount(userID int64) (err error) {
+	start := time.Now()
+	defer func() { metrics.ObserveDB("delete_user_account", start, err) }()
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	statements := []string{
+		`UPDATE games SET black_player_id = ? WHERE black_player_id = ?`,
+		`UPDATE games SET white_player_id = ? WHERE white_player_id = ?`,
+		`UPDATE games SET winner_id = ? WHERE winner_id = ?`,
+		`UPDATE correspondence_games SET black_player_id = ? WHERE black_player_id = ?`,
+		`UPDATE correspondence_games SET white_player_id = ? WHERE white_player_id = ?`,
+		`UPDATE correspondence_games SET current_player_id = ? WHERE current_player_id = ?`,
+		`UPDATE correspondence_games SET winner_id = ? WHERE winner_id = ?`,
+	}
+	for _, query := range statements {
+		if _, err = tx.Exec(query, model.DeletedUserID, userID); err != nil {
+			return err
+		}
+	}
+	if _, err = tx.Exec(`DELETE FROM user_sanctions WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`DELETE FROM rating_history WHERE user_id = ?`, userID); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`DELETE FROM users WHERE id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return tx.Commit()
+}
@@ -4,27 +4,54 @@ import (
 	"log"
 	"net/http"
 
+	"game-server/internal/config"
 	"game-server/internal/handler"
+	"game-server/internal/model"
+	"game-server/internal/service"
 
 	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// upgrader offers permessage-deflate; whether a frame is actually
+// compressed is decided per message by the protocol's compress threshold.
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true
 	},
+	EnableCompression: true,
 }
 
 type Router struct {
-	handler   *handler.HTTPHandler
-	wsHandler *handler.WSHandler
+	handler      *handler.HTTPHandler
+	wsHandler    *handler.WSHandler
+	adminHandler *handler.AdminHandler
+	auth         *handler.Authenticator
 }
 
-func NewRouter() *Router {
-	return &Router{
-		handler:   handler.NewHTTPHandler(),
-		wsHandler: handler.NewWSHandler(),
+func NewRouter(tournaments *service.TournamentService) *Router {
+	r := &Router{
+		handler:      handler.NewHTTPHandler(tournaments),
+		wsHandler:    handler.NewWSHandler(tournaments),
+		adminHandler: handler.NewAdminHandler(),
+		auth:         handler.NewAuthenticator(config.GlobalConfig.Admin.Token),
 	}
+	r.adminHandler.AddTarget(r.wsHandler)
+	return r
+}
+
+func (r *Router) WSHandler() *handler.WSHandler {
+	return r.wsHandler
+}
+
+// AddAdminTarget makes another transport, such as the TCP handler, visible
+// to the admin API.
+func (r *Router) AddAdminTarget(t handler.AdminTarget) {
+	r.adminHandler.AddTarget(t)
+}
+
+func (r *Router) SetJanitor(j *service.Janitor) {
+	r.handler.SetJanitor(j)
 }
 
 func (r *Router) Setup() *http.ServeMux {
@@ -32,7 +59,40 @@ func (r *Router) Setup() *http.ServeMux {
 
 	mux.HandleFunc("POST /api/register", r.handler.Register)
 	mux.HandleFunc("POST /api/login", r.handler.Login)
-	mux.HandleFunc("GET /api/user/{id}", r.handler.GetUser)
+	mux.HandleFunc("POST /api/token/refresh", r.handler.RefreshToken)
+	mux.HandleFunc("POST /api/guest", r.handler.GuestLogin)
+	mux.HandleFunc("POST /api/guest/claim", r.auth.RequireSession(r.handler.ClaimAccount))
+	mux.HandleFunc("POST /api/password", r.auth.RequireSession(r.handler.ChangePassword))
+	mux.HandleFunc("POST /api/password/reset", r.handler.RequestPasswordReset)
+	mux.HandleFunc("POST /api/password/reset/confirm", r.handler.ResetPassword)
+	mux.HandleFunc("GET /api/user/{id}", r.auth.Identify(r.handler.GetUser))
+	mux.HandleFunc("PUT /api/profile", r.auth.RequireSession(r.handler.UpdateProfile))
+	mux.HandleFunc("GET /api/account/export", r.auth.RequireSession(r.handler.ExportAccount))
+	mux.HandleFunc("DELETE /api/account", r.auth.RequireSession(r.handler.DeleteAccount))
+	mux.HandleFunc("POST /api/logout", r.auth.RequireSession(r.handler.Logout))
+	mux.HandleFunc("GET /api/sessions", r.auth.RequireSession(r.handler.ListSessions))
+	mux.HandleFunc("DELETE /api/sessions/{id}", r.auth.RequireSession(r.handler.RevokeSession))
+	mux.HandleFunc("GET /api/tournaments", r.handler.ListTournaments)
+	mux.HandleFunc("GET /api/tournament/{id}/bracket", r.handler.GetTournamentBracket)
+
+	mux.Handle("GET /metrics", promhttp.Handler())
+	mux.HandleFunc("GET /healthz", r.handler.Healthz)
+	mux.HandleFunc("GET /readyz", r.handler.Readyz)
+
+	admin, auth := r.adminHandler, r.auth
+	mux.HandleFunc("GET /admin/users/online", auth.Require(model.PermViewServer, admin.ListOnlineUsers))
+	mux.HandleFunc("GET /admin/rooms", auth.Require(model.PermViewServer, admin.ListRooms))
+	mux.HandleFunc("GET /admin/games", auth.Require(model.PermViewServer, admin.ListGames))
+	mux.HandleFunc("GET /admin/janitor/stats", auth.Require(model.PermViewServer, r.handler.GetJanitorStats))
+	mux.HandleFunc("POST /admin/games/{transport}/{room_id}/end", auth.Require(model.PermManageGames, admin.ForceEndGame))
+	mux.HandleFunc("POST /admin/users/{id}/kick", auth.Require(model.PermModerate, admin.KickUser))
+	mux.HandleFunc("POST /admin/users/{id}/ban", auth.Require(model.PermModerate, admin.BanUser))
+	mux.HandleFunc("GET /admin/users/{id}/sanctions", auth.Require(model.PermModerate, admin.ListSanctions))
+	mux.HandleFunc("POST /admin/users/{id}/sanctions", auth.Require(model.PermModerate, admin.CreateSanction))
+	mux.HandleFunc("DELETE /admin/sanctions/{id}", auth.Require(model.PermModerate, admin.RevokeSanction))
+	mux.HandleFunc("PUT /admin/users/{id}/role", auth.Require(model.PermManageRoles, admin.SetRole))
+	mux.HandleFunc("POST /admin/announce", auth.Require(model.PermAnnounce, admin.Announce))
+	mux.HandleFunc("GET /admin/audit", auth.Require(model.PermViewAudit, admin.AuditLog))
 
 	mux.HandleFunc("/ws", r.handleWebSocket)
 
@@ -42,6 +102,11 @@ func (r *Router) Setup() *http.ServeMux {
 }
 
 func (r *Router) handleWebSocket(w http.ResponseWriter, req *http.Request) {
+	if service.IsDraining() {
+		http.Error(w, service.ErrServerDraining.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, req, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade error: %v", err)
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"log"
+	"time"
+
+	"game-server/internal/model"
+	"game-server/internal/repository"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const sessionReasonAccountDeleted = "account deleted"
+
+// exportNotes tell the user what the export cannot contain.
+var exportNotes = []string{
+	"Chat messages are relayed to the room and never stored, so there is no chat history to export.",
+	"Games finished before moves were recorded keep only their final board, and score changes from before rating history was recorded show only in the current score.",
+}
+
+// AccountExport is everything stored about one user: profile, games with
+// their moves, and every rating change. Notes lists what is not kept.
+type AccountExport struct {
+	ExportedAt          time.Time                   `json:"exported_at"`
+	Profile             *model.User                 `json:"profile"`
+	Rating              AccountRating               `json:"rating"`
+	RatingHistory       []*model.RatingChange       `json:"rating_history"`
+	Games               []*repository.GameRecord    `json:"games"`
+	CorrespondenceGames []*model.CorrespondenceGame `json:"correspondence_games"`
+	Sanctions           []*model.Sanction           `json:"sanctions"`
+	Sessions            []*Session                  `json:"sessions"`
+	Notes               []string                    `json:"notes"`
+}
+
+type AccountRating struct {
+	Score     int `json:"score"`
+	WinCount  int `json:"win_count"`
+	LoseCount int `json:"lose_count"`
+	Rank      int `json:"rank"`
+}
+
+// ExportAccount collects the data of userID for download.
+func (s *UserService) ExportAccount(userID int64) (*AccountExport, error) {
+	user, err := repository.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &AccountExport{
+		ExportedAt: time.Now(),
+		Profile:    user,
+		Rating: AccountRating{
+			Score:     user.Score,
+			WinCount:  user.WinCount,
+			LoseCount: user.LoseCount,
+		},
+		Notes: exportNotes,
+	}
+	if export.Rating.Rank, err = repository.GetUserRank(userID); err != nil {
+		return nil, err
+	}
+	if export.RatingHistory, err = repository.GetUserRatingHistory(userID); err != nil {
+		return nil, err
+	}
+	if export.Games, err = repository.GetAllUserGames(userID); err != nil {
+		return nil, err
+	}
+	if export.CorrespondenceGames, err = repository.GetUserCorrespondenceGames(userID); err != nil {
+		return nil, err
+	}
+	if export.Sanctions, err = repository.GetUserSanctions(userID); err != nil {
+		return nil, err
+	}
+	if export.Sessions, err = s.sessions.List(userID); err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// DeleteAccount removes userID after checking its password; guests have
+// none. Every session ends, running correspondence games are resigned and
+// the user's side of finished games is anonymised.
+func (s *UserService) DeleteAccount(userID int64, req *model.DeleteAccountRequest) error {
+	user, err := repository.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+
+	if user.Role != model.RoleGuest {
+		if err := s.limiter.Check(user.Username, req.IP); err != nil {
+			return err
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+			if lockErr := s.limiter.Fail(user.Username, req.IP); lockErr != nil {
+				return lockErr
+			}
+			return ErrInvalidPassword
+		}
+	}
+
+	if _, err := s.sessions.RevokeAll(userID, "", nil, sessionReasonAccountDeleted); err != nil {
+		return err
+	}
+
+	games, err := repository.GetActiveCorrespondenceGames(userID)
+	if err != nil {
+		return err
+	}
+	for _, g := range games {
+		winner := g.Opponent(userID)
+		if err := s.corrService.Resign(g.ID, winner); err != nil {
+			log.Printf("Failed to resign correspondence game %d of deleted user %d: %v", g.ID, userID, err)
+			continue
+		}
+		if g.Rated {
+			repository.UpdateUserScore(winner, 25, true, model.GameTypeCorrespondence, g.ID)
+		}
+	}
+
+	if err := repository.DeleteUserAccount(userID); err != nil {
+		return err
+	}
+	log.Printf("User %d (%s) deleted their account", userID, user.Username)
+	return nil
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"sync"
+
+	"game-server/internal/model"
+)
+
+// AccountEvent reports that the name or role of a user changed, e.g. when a
+// guest claims the account.
+type AccountEvent struct {
+	UserID   int64
+	Username string
+	Role     model.Role
+}
+
+var (
+	accountListenersMu sync.RWMutex
+	accountListeners   []func(AccountEvent)
+)
+
+// SubscribeAccountEvents registers fn to be called whenever an account is
+// renamed, so live connections of every transport show the new identity.
+func SubscribeAccountEvents(fn func(AccountEvent)) {
+	accountListenersMu.Lock()
+	accountListeners = append(accountListeners, fn)
+	accountListenersMu.Unlock()
+}
+
+func publishAccountEvent(ev AccountEvent) {
+	accountListenersMu.RLock()
+	listeners := make([]func(AccountEvent), len(accountListeners))
+	copy(listeners, accountListeners)
+	accountListenersMu.RUnlock()
+
+	for _, fn := range listeners {
+		fn(ev)
+	}
+}
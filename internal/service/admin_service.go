@@ -0,0 +1,86 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"game-server/internal/model"
+	"game-server/internal/repository"
+)
+
+var (
+	ErrUserNotOnline = errors.New("user not online")
+	ErrGuestRole     = errors.New("guest role cannot be assigned or removed")
+)
+
+type AdminService struct {
+	sessions *SessionService
+}
+
+func NewAdminService() *AdminService {
+	return &AdminService{
+		sessions: NewSessionService(),
+	}
+}
+
+// Audit writes an operator action to the audit table. detail is stored as
+// JSON so the exact request can be reviewed later.
+func (s *AdminService) Audit(actor, action, target string, detail interface{}, remoteAddr string) error {
+	data, err := json.Marshal(detail)
+	if err != nil {
+		return err
+	}
+
+	return repository.CreateAuditEntry(&model.AuditEntry{
+		Actor:      actor,
+		Action:     action,
+		Target:     target,
+		Detail:     string(data),
+		RemoteAddr: remoteAddr,
+	})
+}
+
+func (s *AdminService) AuditLog(limit, offset int) ([]*model.AuditEntry, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return repository.ListAuditEntries(limit, offset)
+}
+
+func (s *AdminService) GetUser(userID int64) (*model.User, error) {
+	return repository.GetUserByID(userID)
+}
+
+// SetRole changes the role of userID. Existing sessions pick up the new
+// role immediately.
+func (s *AdminService) SetRole(userID int64, role model.Role) (*model.User, error) {
+	if _, err := model.ParseRole(string(role)); err != nil {
+		return nil, err
+	}
+
+	if role == model.RoleGuest {
+		return nil, ErrGuestRole
+	}
+
+	user, err := repository.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role == model.RoleGuest {
+		// Guests become players by claiming the account.
+		return nil, ErrGuestRole
+	}
+	if err := repository.UpdateUserRole(userID, role); err != nil {
+		return nil, err
+	}
+	user.Role = role
+
+	if err := s.sessions.UpdateRole(userID, role); err != nil {
+		log.Printf("Failed to update sessions of user %d to role %s: %v", userID, role, err)
+	}
+	return user, nil
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"game-server/internal/model"
+	"game-server/internal/repository"
+)
+
+var ErrNotCorrespondencePlayer = errors.New("not a player of this correspondence game")
+
+type CorrespondenceService struct{}
+
+func NewCorrespondenceService() *CorrespondenceService {
+	return &CorrespondenceService{}
+}
+
+func NormalizeDaysPerMove(days int) int {
+	if days <= 0 {
+		return model.DefaultDaysPerMove
+	}
+	if days > model.MaxDaysPerMove {
+		return model.MaxDaysPerMove
+	}
+	return days
+}
+
+func (s *CorrespondenceService) Create(game *model.Game, daysPerMove int, rated bool) (*model.CorrespondenceGame, error) {
+	if len(game.Players) < 2 {
+		return nil, errors.New("not enough players")
+	}
+
+	g := &model.CorrespondenceGame{
+		BlackPlayerID: game.Players[0],
+		WhitePlayerID: game.Players[1],
+		DaysPerMove:   NormalizeDaysPerMove(daysPerMove),
+		RuleSet:       game.RuleSet,
+		Rated:         rated,
+		Board:         game.GetBoardCopy(),
+		Moves:         game.Moves,
+		CurrentPlayer: game.CurrentPlayer(),
+		LastX:         -1,
+		LastY:         -1,
+		Status:        model.CorrespondenceStatusActive,
+	}
+	g.Deadline = time.Now().Add(time.Duration(g.DaysPerMove) * 24 * time.Hour)
+
+	if err := repository.CreateCorrespondenceGame(g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (s *CorrespondenceService) RecordMove(gameID int64, daysPerMove int, game *model.Game, x, y int) error {
+	g := &model.CorrespondenceGame{
+		ID:            gameID,
+		Board:         game.GetBoardCopy(),
+		Moves:         game.Moves,
+		CurrentPlayer: game.CurrentPlayer(),
+		MoveCount:     game.MoveCount,
+		LastX:         x,
+		LastY:         y,
+		Status:        model.CorrespondenceStatusActive,
+		Deadline:      time.Now().Add(time.Duration(NormalizeDaysPerMove(daysPerMove)) * 24 * time.Hour),
+	}
+	if game.IsFinished() {
+		g.Status = model.CorrespondenceStatusFinished
+		g.WinnerID = game.Winner
+	}
+
+	return repository.UpdateCorrespondenceGame(g, game.MoveCount-1)
+}
+
+func (s *CorrespondenceService) Resign(gameID, winner int64) error {
+	g, err := repository.GetCorrespondenceGame(gameID)
+	if err != nil {
+		return err
+	}
+	if !g.IsActive() {
+		return model.ErrGameAlreadyOver
+	}
+
+	g.Status = model.CorrespondenceStatusFinished
+	g.WinnerID = winner
+	return repository.UpdateCorrespondenceGame(g, g.MoveCount)
+}
+
+func (s *CorrespondenceService) GetGame(gameID, userID int64) (*model.CorrespondenceGame, error) {
+	g, err := repository.GetCorrespondenceGame(gameID)
+	if err != nil {
+		return nil, err
+	}
+	if !g.HasPlayer(userID) {
+		return nil, ErrNotCorrespondencePlayer
+	}
+
+	if g.IsOverdue(time.Now()) {
+		s.timeout(g)
+	}
+	return g, nil
+}
+
+func (s *CorrespondenceService) ListActive(userID int64) ([]*model.CorrespondenceGame, error) {
+	games, err := repository.GetActiveCorrespondenceGames(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	active := make([]*model.CorrespondenceGame, 0, len(games))
+	for _, g := range games {
+		if g.IsOverdue(now) {
+			s.timeout(g)
+			continue
+		}
+		active = append(active, g)
+	}
+	return active, nil
+}
+
+func (s *CorrespondenceService) ListYourTurn(userID int64) ([]*model.CorrespondenceGame, error) {
+	games, err := s.ListActive(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	yours := make([]*model.CorrespondenceGame, 0, len(games))
+	for _, g := range games {
+		if g.CurrentPlayer == userID {
+			yours = append(yours, g)
+		}
+	}
+	return yours, nil
+}
+
+func (s *CorrespondenceService) ExpireOverdue() (int, error) {
+	games, err := repository.GetOverdueCorrespondenceGames(time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, g := range games {
+		if s.timeout(g) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *CorrespondenceService) timeout(g *model.CorrespondenceGame) bool {
+	loser := g.CurrentPlayer
+	winner := g.Opponent(loser)
+
+	g.Status = model.CorrespondenceStatusFinished
+	g.WinnerID = winner
+	if err := repository.UpdateCorrespondenceGame(g, g.MoveCount); err != nil {
+		return false
+	}
+
+	if g.Rated {
+		repository.UpdateUserScore(winner, 25, true, model.GameTypeCorrespondence, g.ID)
+		repository.UpdateUserScore(loser, -20, false, model.GameTypeCorrespondence, g.ID)
+	}
+
+	log.Printf("Correspondence game %d timed out, winner: %d", g.ID, winner)
+	return true
+}
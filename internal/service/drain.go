@@ -0,0 +1,29 @@
+package service
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var ErrServerDraining = errors.New("server is shutting down")
+
+var drainingSince atomic.Int64
+
+// StartDraining switches the process into drain mode: existing players may
+// finish their games, but nothing new is started.
+func StartDraining() {
+	drainingSince.CompareAndSwap(0, time.Now().UnixNano())
+}
+
+func IsDraining() bool {
+	return drainingSince.Load() != 0
+}
+
+func DrainingSince() time.Time {
+	since := drainingSince.Load()
+	if since == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, since)
+}
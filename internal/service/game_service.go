@@ -5,11 +5,13 @@ import (
 	"sync"
 
 	"game-server/internal/model"
+	"game-server/internal/repository"
 )
 
 var (
 	ErrGameNotFound      = errors.New("game not found")
 	ErrRoomAlreadyInGame = errors.New("room already has a game")
+	ErrWinnerNotInGame   = errors.New("winner is not a player in this game")
 )
 
 type GameService struct {
@@ -23,7 +25,7 @@ func NewGameService() *GameService {
 	}
 }
 
-func (s *GameService) StartGame(roomID int64, players []int64) (*model.Game, error) {
+func (s *GameService) StartGame(roomID int64, players []int64, settings model.RoomSettings) (*model.Game, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -31,12 +33,24 @@ func (s *GameService) StartGame(roomID int64, players []int64) (*model.Game, err
 		return nil, ErrRoomAlreadyInGame
 	}
 
-	game := model.NewGame(roomID, players)
+	game := model.NewGameWithRules(roomID, players, settings.BoardSize, settings.RuleSet)
 	s.games[roomID] = game
 
 	return game, nil
 }
 
+func (s *GameService) RestoreGame(game *model.Game) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.games[game.RoomID]; exists {
+		return ErrRoomAlreadyInGame
+	}
+
+	s.games[game.RoomID] = game
+	return nil
+}
+
 func (s *GameService) GetGame(roomID int64) (*model.Game, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -49,16 +63,29 @@ func (s *GameService) GetGame(roomID int64) (*model.Game, error) {
 	return game, nil
 }
 
-func (s *GameService) MakeMove(roomID, playerID int64, x, y int) error {
+// MakeMove plays a stone and returns its move number, counting from 1.
+func (s *GameService) MakeMove(roomID, playerID int64, x, y int) (int, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	game, ok := s.games[roomID]
 	if !ok {
-		return ErrGameNotFound
+		return 0, ErrGameNotFound
+	}
+
+	if err := game.MakeMove(playerID, x, y); err != nil {
+		return 0, err
 	}
+	return game.MoveCount, nil
+}
 
-	return game.MakeMove(playerID, x, y)
+// Record stores a finished game with its moves and returns its ID in the
+// games table. winner is 0 for a draw.
+func (s *GameService) Record(game *model.Game, winner int64) (int64, error) {
+	if len(game.Players) < 2 {
+		return 0, errors.New("not enough players")
+	}
+	return repository.SaveGameRecord(game, winner)
 }
 
 func (s *GameService) EndGame(roomID int64) {
@@ -105,6 +132,37 @@ func (s *GameService) Forfeit(roomID, playerID int64) (int64, error) {
 	return winner, nil
 }
 
+// Finish ends a running game with the given winner; 0 ends it without one.
+func (s *GameService) Finish(roomID, winner int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	game, ok := s.games[roomID]
+	if !ok {
+		return ErrGameNotFound
+	}
+	if game.IsFinished() {
+		return model.ErrGameAlreadyOver
+	}
+
+	if winner != 0 {
+		found := false
+		for _, p := range game.Players {
+			if p == winner {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return ErrWinnerNotInGame
+		}
+	}
+
+	game.Winner = winner
+	game.State = model.GameStateFinished
+	return nil
+}
+
 func (s *GameService) GetBoard(roomID int64) ([][]int, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -128,3 +186,30 @@ func (s *GameService) IsPlayerTurn(roomID, playerID int64) (bool, error) {
 
 	return game.CurrentPlayer() == playerID, nil
 }
+
+// ExpireTurn forfeits the player to move when the move clock runs out. It does
+// nothing if game is no longer the room's game or a move was made since
+// moveCount was read.
+func (s *GameService) ExpireTurn(roomID int64, game *model.Game, moveCount int) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.games[roomID]
+	if !ok || current != game || game.MoveCount != moveCount || game.IsFinished() {
+		return 0, false
+	}
+
+	winner := game.Forfeit(game.CurrentPlayer())
+	return winner, winner != 0
+}
+
+func (s *GameService) RoomIDs() []int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := make([]int64, 0, len(s.games))
+	for id := range s.games {
+		ids = append(ids, id)
+	}
+	return ids
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"game-server/internal/repository"
+	"game-server/pkg/redis"
+)
+
+const defaultHealthTimeout = 2 * time.Second
+
+const (
+	HealthStatusOK       = "ok"
+	HealthStatusDegraded = "degraded"
+	HealthStatusDraining = "draining"
+
+	DependencyUp   = "up"
+	DependencyDown = "down"
+)
+
+type DependencyStatus struct {
+	Status    string `json:"status"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+type HealthReport struct {
+	Status        string                      `json:"status"`
+	Draining      bool                        `json:"draining"`
+	DrainingSince *time.Time                  `json:"draining_since,omitempty"`
+	Dependencies  map[string]DependencyStatus `json:"dependencies"`
+}
+
+// Ready reports whether the instance should receive new traffic.
+func (r *HealthReport) Ready() bool {
+	return r.Status == HealthStatusOK
+}
+
+type HealthService struct {
+	timeout time.Duration
+	checks  map[string]func(ctx context.Context) error
+}
+
+func NewHealthService(timeout time.Duration) *HealthService {
+	if timeout <= 0 {
+		timeout = defaultHealthTimeout
+	}
+	return &HealthService{
+		timeout: timeout,
+		checks: map[string]func(ctx context.Context) error{
+			"mysql": repository.Ping,
+			"redis": redis.Ping,
+		},
+	}
+}
+
+// Check pings every dependency in parallel, each bounded by the configured
+// timeout, and combines the results with the drain state.
+func (s *HealthService) Check(ctx context.Context) *HealthReport {
+	report := &HealthReport{
+		Status:       HealthStatusOK,
+		Dependencies: make(map[string]DependencyStatus, len(s.checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range s.checks {
+		wg.Add(1)
+		go func(name string, check func(ctx context.Context) error) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, s.timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check(checkCtx)
+			status := DependencyStatus{
+				Status:    DependencyUp,
+				LatencyMS: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				status.Status = DependencyDown
+				status.Error = err.Error()
+			}
+
+			mu.Lock()
+			report.Dependencies[name] = status
+			if err != nil {
+				report.Status = HealthStatusDegraded
+			}
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	if IsDraining() {
+		since := DrainingSince()
+		report.Draining = true
+		report.DrainingSince = &since
+		report.Status = HealthStatusDraining
+	}
+
+	return report
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"game-server/internal/repository"
+	"game-server/pkg/redis"
+)
+
+const (
+	DefaultJanitorInterval  = 30 * time.Second
+	DefaultHeartbeatTimeout = 90 * time.Second
+	DefaultRoomTimeout      = 30 * time.Minute
+
+	guestSweepBatch = 100
+)
+
+// SweepTarget is a connection handler the janitor can clean up after.
+type SweepTarget interface {
+	EvictIdle(timeout time.Duration) int
+	CleanRooms(inactiveTimeout time.Duration) (empty, inactive int)
+	IsOnline(userID int64) bool
+}
+
+type JanitorStats struct {
+	Runs                  int64     `json:"runs"`
+	Failures              int64     `json:"failures"`
+	EvictedConnections    int64     `json:"evicted_connections"`
+	EmptyRooms            int64     `json:"empty_rooms"`
+	InactiveRooms         int64     `json:"inactive_rooms"`
+	StaleOnlineKeys       int64     `json:"stale_online_keys"`
+	ExpiredCorrespondence int64     `json:"expired_correspondence"`
+	ExpiredGuests         int64     `json:"expired_guests"`
+	LastRun               time.Time `json:"last_run"`
+}
+
+// Janitor periodically evicts dead connections, removes abandoned rooms and
+// clears presence keys left behind by connections that never said goodbye.
+type Janitor struct {
+	interval         time.Duration
+	heartbeatTimeout time.Duration
+	roomTimeout      time.Duration
+	targets          []SweepTarget
+	corrService      *CorrespondenceService
+	sessions         *SessionService
+
+	mu    sync.Mutex
+	stats JanitorStats
+}
+
+func NewJanitor(interval, heartbeatTimeout, roomTimeout time.Duration, targets ...SweepTarget) *Janitor {
+	if interval <= 0 {
+		interval = DefaultJanitorInterval
+	}
+	if heartbeatTimeout <= 0 {
+		heartbeatTimeout = DefaultHeartbeatTimeout
+	}
+	if roomTimeout <= 0 {
+		roomTimeout = DefaultRoomTimeout
+	}
+
+	return &Janitor{
+		interval:         interval,
+		heartbeatTimeout: heartbeatTimeout,
+		roomTimeout:      roomTimeout,
+		targets:          targets,
+		corrService:      NewCorrespondenceService(),
+		sessions:         NewSessionService(),
+	}
+}
+
+// Start runs the janitor until ctx is cancelled. A panicking sweep is logged
+// and counted as a failure; the schedule keeps going.
+func (j *Janitor) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+
+		log.Printf("Janitor started, interval %s, heartbeat timeout %s", j.interval, j.heartbeatTimeout)
+		for {
+			select {
+			case <-ctx.Done():
+				log.Println("Janitor stopped")
+				return
+			case <-ticker.C:
+				j.runSupervised()
+			}
+		}
+	}()
+}
+
+func (j *Janitor) Stats() JanitorStats {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.stats
+}
+
+func (j *Janitor) runSupervised() {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Janitor run panicked: %v", r)
+			j.mu.Lock()
+			j.stats.Failures++
+			j.mu.Unlock()
+		}
+	}()
+	j.RunOnce()
+}
+
+// RunOnce performs a single sweep and returns what it cleaned.
+func (j *Janitor) RunOnce() JanitorStats {
+	var run JanitorStats
+
+	for _, t := range j.targets {
+		run.EvictedConnections += int64(t.EvictIdle(j.heartbeatTimeout))
+
+		empty, inactive := t.CleanRooms(j.roomTimeout)
+		run.EmptyRooms += int64(empty)
+		run.InactiveRooms += int64(inactive)
+	}
+
+	stale, err := j.sweepOnlineKeys()
+	if err != nil {
+		log.Printf("Janitor failed to sweep online keys: %v", err)
+	}
+	run.StaleOnlineKeys = int64(stale)
+
+	expired, err := j.corrService.ExpireOverdue()
+	if err != nil {
+		log.Printf("Janitor failed to expire correspondence games: %v", err)
+	}
+	run.ExpiredCorrespondence = int64(expired)
+
+	guests, err := j.sweepGuests()
+	if err != nil {
+		log.Printf("Janitor failed to remove stale guests: %v", err)
+	}
+	run.ExpiredGuests = int64(guests)
+
+	run.Runs = 1
+	run.LastRun = time.Now()
+
+	j.mu.Lock()
+	j.stats.Runs += run.Runs
+	j.stats.EvictedConnections += run.EvictedConnections
+	j.stats.EmptyRooms += run.EmptyRooms
+	j.stats.InactiveRooms += run.InactiveRooms
+	j.stats.StaleOnlineKeys += run.StaleOnlineKeys
+	j.stats.ExpiredCorrespondence += run.ExpiredCorrespondence
+	j.stats.ExpiredGuests += run.ExpiredGuests
+	j.stats.LastRun = run.LastRun
+	j.mu.Unlock()
+
+	if run.EvictedConnections+run.EmptyRooms+run.InactiveRooms+run.StaleOnlineKeys+run.ExpiredCorrespondence+run.ExpiredGuests > 0 {
+		log.Printf("Janitor cleaned %d idle connections, %d empty rooms, %d inactive rooms, %d stale online keys, %d overdue correspondence games, %d stale guests",
+			run.EvictedConnections, run.EmptyRooms, run.InactiveRooms, run.StaleOnlineKeys, run.ExpiredCorrespondence, run.ExpiredGuests)
+	}
+	return run
+}
+
+// sweepOnlineKeys deletes online:{id} keys of users that are not connected to
+// any transport of this server, e.g. after a crash skipped SetUserOffline.
+func (j *Janitor) sweepOnlineKeys() (int, error) {
+	ctx := context.Background()
+
+	count := 0
+	iter := redis.Client.Scan(ctx, 0, OnlineKeyPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		userID, err := strconv.ParseInt(strings.TrimPrefix(key, OnlineKeyPrefix), 10, 64)
+		if err != nil || j.isOnline(userID) {
+			continue
+		}
+		if err := redis.Client.Del(ctx, key).Err(); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, iter.Err()
+}
+
+// sweepGuests deletes guest accounts that never played a game and whose
+// sessions have all expired, so they can no longer be logged in to.
+func (j *Janitor) sweepGuests() (int, error) {
+	ids, err := repository.StaleGuestIDs(time.Now().Add(-RefreshTTL()), guestSweepBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, id := range ids {
+		if j.isOnline(id) {
+			continue
+		}
+		if sessions, err := j.sessions.List(id); err != nil || len(sessions) > 0 {
+			continue
+		}
+		if err := repository.DeleteGuest(id); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func (j *Janitor) isOnline(userID int64) bool {
+	for _, t := range j.targets {
+		if t.IsOnline(userID) {
+			return true
+		}
+	}
+	return false
+}
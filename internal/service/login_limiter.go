@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"game-server/internal/config"
+	"game-server/pkg/redis"
+)
+
+const (
+	DefaultMaxAttempts    = 5
+	DefaultIPMaxAttempts  = 20
+	DefaultAttemptWindow  = 15 * time.Minute
+	DefaultLockout        = time.Minute
+	DefaultMaxLockout     = time.Hour
+	DefaultRegisterPerIP  = 5
+	DefaultRegisterWindow = time.Hour
+	DefaultResetPerIP     = 5
+	DefaultResetPerUser   = 3
+	DefaultResetWindow    = time.Hour
+
+	loginFailPrefix  = "login_fail:"
+	loginLockPrefix  = "login_lock:"
+	loginLevelPrefix = "login_lock_level:"
+	registerPrefix   = "register_ip:"
+	resetPrefix      = "reset_req:"
+)
+
+// LockoutScope says what a LockoutError was counted against.
+type LockoutScope string
+
+const (
+	LockoutUsername LockoutScope = "username"
+	LockoutIP       LockoutScope = "ip"
+	LockoutRegister LockoutScope = "register"
+	LockoutReset    LockoutScope = "reset"
+)
+
+// LockoutError is returned while a username or IP is locked out. RetryAfter
+// is how long until the next attempt is allowed.
+type LockoutError struct {
+	Scope      LockoutScope
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	wait := e.RetryAfter.Round(time.Second)
+	if wait < time.Second {
+		wait = time.Second
+	}
+	switch e.Scope {
+	case LockoutRegister:
+		return fmt.Sprintf("too many registrations, try again in %s", wait)
+	case LockoutReset:
+		return fmt.Sprintf("too many password reset requests, try again in %s", wait)
+	case LockoutIP:
+		return fmt.Sprintf("too many failed logins from this address, try again in %s", wait)
+	default:
+		return fmt.Sprintf("too many failed logins for this account, try again in %s", wait)
+	}
+}
+
+var loginLimits atomic.Value
+
+// SetLoginLimits configures the limiter, filling in defaults for zero
+// values.
+func SetLoginLimits(cfg config.LimitsConfig) {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+	if cfg.IPMaxAttempts <= 0 {
+		cfg.IPMaxAttempts = DefaultIPMaxAttempts
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = DefaultAttemptWindow
+	}
+	if cfg.Lockout <= 0 {
+		cfg.Lockout = DefaultLockout
+	}
+	if cfg.MaxLockout < cfg.Lockout {
+		cfg.MaxLockout = max(DefaultMaxLockout, cfg.Lockout)
+	}
+	if cfg.RegisterPerIP <= 0 {
+		cfg.RegisterPerIP = DefaultRegisterPerIP
+	}
+	if cfg.RegisterWindow <= 0 {
+		cfg.RegisterWindow = DefaultRegisterWindow
+	}
+	if cfg.ResetPerIP <= 0 {
+		cfg.ResetPerIP = DefaultResetPerIP
+	}
+	if cfg.ResetPerUser <= 0 {
+		cfg.ResetPerUser = DefaultResetPerUser
+	}
+	if cfg.ResetWindow <= 0 {
+		cfg.ResetWindow = DefaultResetWindow
+	}
+	loginLimits.Store(cfg)
+}
+
+func currentLoginLimits() config.LimitsConfig {
+	if cfg, ok := loginLimits.Load().(config.LimitsConfig); ok {
+		return cfg
+	}
+	SetLoginLimits(config.LimitsConfig{})
+	return loginLimits.Load().(config.LimitsConfig)
+}
+
+// LoginLimiter counts failed logins per username and per IP in Redis, so
+// the counts are shared by HTTP, TCP and WebSocket. If Redis fails the
+// limiter lets requests through rather than locking everyone out.
+type LoginLimiter struct{}
+
+func NewLoginLimiter() *LoginLimiter {
+	return &LoginLimiter{}
+}
+
+// Check returns a LockoutError if username or ip is locked out.
+func (l *LoginLimiter) Check(username, ip string) error {
+	ctx := context.Background()
+
+	for _, sub := range l.subjects(username, ip) {
+		ttl, err := redis.Client.PTTL(ctx, loginLockPrefix+sub.key).Result()
+		if err != nil {
+			log.Printf("Login limiter check failed: %v", err)
+			return nil
+		}
+		if ttl > 0 {
+			return &LockoutError{Scope: sub.scope, RetryAfter: ttl}
+		}
+	}
+	return nil
+}
+
+// Fail records a failed login. Once a counter reaches its threshold the
+// subject is locked out, for twice as long as the previous lockout, and
+// the LockoutError is returned.
+func (l *LoginLimiter) Fail(username, ip string) error {
+	ctx := context.Background()
+	cfg := currentLoginLimits()
+
+	var lockout error
+	for _, sub := range l.subjects(username, ip) {
+		limit := cfg.MaxAttempts
+		if sub.scope == LockoutIP {
+			limit = cfg.IPMaxAttempts
+		}
+
+		n, err := l.incr(ctx, loginFailPrefix+sub.key, cfg.Window)
+		if err != nil {
+			log.Printf("Login limiter failed to count attempt: %v", err)
+			return nil
+		}
+		if n < int64(limit) {
+			continue
+		}
+
+		d, err := l.lock(ctx, sub.key, cfg)
+		if err != nil {
+			log.Printf("Login limiter failed to lock %s: %v", sub.scope, err)
+			continue
+		}
+		if lockout == nil {
+			lockout = &LockoutError{Scope: sub.scope, RetryAfter: d}
+		}
+	}
+	return lockout
+}
+
+// Succeed clears the failure count and lockout history of username after
+// a correct password. The IP counter stays, so one known account cannot
+// be used to reset it.
+func (l *LoginLimiter) Succeed(username string) {
+	ctx := context.Background()
+	key := l.usernameKey(username)
+	if err := redis.Client.Del(ctx, loginFailPrefix+key, loginLevelPrefix+key).Err(); err != nil {
+		log.Printf("Login limiter failed to reset %q: %v", username, err)
+	}
+}
+
+// AllowRegister counts a registration attempt from ip and returns a
+// LockoutError once the IP exceeds its quota for the window.
+func (l *LoginLimiter) AllowRegister(ip string) error {
+	if ip == "" {
+		return nil
+	}
+	cfg := currentLoginLimits()
+	return l.quota(context.Background(), LockoutRegister, registerPrefix+ip, cfg.RegisterPerIP, cfg.RegisterWindow)
+}
+
+// AllowPasswordReset counts a password reset request from ip for username
+// and returns a LockoutError once either exceeds its quota for the window.
+// Limiting the username keeps anyone from flooding a user with reset
+// messages or replacing their pending token over and over.
+func (l *LoginLimiter) AllowPasswordReset(username, ip string) error {
+	ctx := context.Background()
+	cfg := currentLoginLimits()
+	if ip != "" {
+		if err := l.quota(ctx, LockoutReset, resetPrefix+"ip:"+ip, cfg.ResetPerIP, cfg.ResetWindow); err != nil {
+			return err
+		}
+	}
+	return l.quota(ctx, LockoutReset, resetPrefix+l.usernameKey(username), cfg.ResetPerUser, cfg.ResetWindow)
+}
+
+// quota counts one hit on key and returns a LockoutError of scope once the
+// hits within window exceed limit.
+func (l *LoginLimiter) quota(ctx context.Context, scope LockoutScope, key string, limit int, window time.Duration) error {
+	n, err := l.incr(ctx, key, window)
+	if err != nil {
+		log.Printf("Limiter failed for %s: %v", scope, err)
+		return nil
+	}
+	if n <= int64(limit) {
+		return nil
+	}
+
+	ttl, err := redis.Client.PTTL(ctx, key).Result()
+	if err != nil || ttl <= 0 {
+		ttl = window
+	}
+	return &LockoutError{Scope: scope, RetryAfter: ttl}
+}
+
+// lock starts the next lockout of key and returns its duration. The level
+// is remembered for one window after the lockout ends.
+func (l *LoginLimiter) lock(ctx context.Context, key string, cfg config.LimitsConfig) (time.Duration, error) {
+	level, err := redis.Client.Incr(ctx, loginLevelPrefix+key).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	d := cfg.Lockout
+	for i := int64(1); i < level && d < cfg.MaxLockout; i++ {
+		d *= 2
+	}
+	d = min(d, cfg.MaxLockout)
+
+	pipe := redis.Client.TxPipeline()
+	pipe.Set(ctx, loginLockPrefix+key, level, d)
+	pipe.Expire(ctx, loginLevelPrefix+key, d+cfg.Window)
+	pipe.Del(ctx, loginFailPrefix+key)
+	_, err = pipe.Exec(ctx)
+	return d, err
+}
+
+// incrWindow bumps a counter whose window starts at the first hit.
+const incrWindow = `local n = redis.call("INCR", KEYS[1])
+if n == 1 then redis.call("PEXPIRE", KEYS[1], ARGV[1]) end
+return n`
+
+func (l *LoginLimiter) incr(ctx context.Context, key string, window time.Duration) (int64, error) {
+	return redis.Client.Eval(ctx, incrWindow, []string{key}, window.Milliseconds()).Int64()
+}
+
+type limitSubject struct {
+	scope LockoutScope
+	key   string
+}
+
+func (l *LoginLimiter) subjects(username, ip string) []limitSubject {
+	subs := []limitSubject{{scope: LockoutUsername, key: l.usernameKey(username)}}
+	if ip != "" {
+		subs = append(subs, limitSubject{scope: LockoutIP, key: "ip:" + ip})
+	}
+	return subs
+}
+
+func (l *LoginLimiter) usernameKey(username string) string {
+	return "user:" + strings.ToLower(strings.TrimSpace(username))
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"game-server/internal/model"
+	"game-server/internal/repository"
+)
+
+// SanctionError is returned when an active sanction blocks an action. It
+// carries the sanction so callers can tell the user why and until when.
+type SanctionError struct {
+	Sanction *model.Sanction
+}
+
+func (e *SanctionError) Error() string {
+	var msg string
+	switch e.Sanction.Kind {
+	case model.SanctionBan:
+		msg = "account is banned"
+	case model.SanctionSuspension:
+		msg = fmt.Sprintf("account is suspended until %s", e.Sanction.ExpiresAt.Format(time.RFC3339))
+	case model.SanctionMute:
+		msg = "you are muted"
+		if e.Sanction.ExpiresAt != nil {
+			msg = fmt.Sprintf("you are muted until %s", e.Sanction.ExpiresAt.Format(time.RFC3339))
+		}
+	default:
+		msg = "action blocked by moderation"
+	}
+	if e.Sanction.Reason != "" {
+		msg += ": " + e.Sanction.Reason
+	}
+	return msg
+}
+
+type ModerationService struct {
+	sessions *SessionService
+}
+
+func NewModerationService() *ModerationService {
+	return &ModerationService{
+		sessions: NewSessionService(),
+	}
+}
+
+// Sanction records a ban, suspension or mute against userID. A zero duration
+// means no expiry. Bans and suspensions also end every session the user
+// has and close their connections, so stored tokens stop working right away.
+func (s *ModerationService) Sanction(userID int64, kind model.SanctionKind, reason, issuedBy string, duration time.Duration) (*model.Sanction, error) {
+	if err := model.ValidateSanction(kind, reason, duration); err != nil {
+		return nil, err
+	}
+	if _, err := repository.GetUserByID(userID); err != nil {
+		return nil, err
+	}
+
+	sanction := &model.Sanction{
+		UserID:    userID,
+		Kind:      kind,
+		Reason:    reason,
+		IssuedBy:  issuedBy,
+		CreatedAt: time.Now(),
+	}
+	if duration > 0 {
+		expiresAt := sanction.CreatedAt.Add(duration)
+		sanction.ExpiresAt = &expiresAt
+	}
+
+	if err := repository.CreateSanction(sanction); err != nil {
+		return nil, err
+	}
+
+	if sanction.BlocksLogin() {
+		reason := (&SanctionError{Sanction: sanction}).Error()
+		if n, err := s.sessions.RevokeAll(userID, "", nil, reason); err != nil {
+			log.Printf("Failed to end sessions of user %d: %v", userID, err)
+		} else if n > 0 {
+			log.Printf("Ended %d sessions of user %d after %s", n, userID, kind)
+		}
+	}
+
+	return sanction, nil
+}
+
+func (s *ModerationService) Get(id int64) (*model.Sanction, error) {
+	return repository.GetSanction(id)
+}
+
+func (s *ModerationService) Revoke(id int64) error {
+	return repository.RevokeSanction(id, time.Now())
+}
+
+func (s *ModerationService) List(userID int64) ([]*model.Sanction, error) {
+	return repository.GetUserSanctions(userID)
+}
+
+// Active returns the sanctions of userID that currently apply.
+func (s *ModerationService) Active(userID int64) ([]*model.Sanction, error) {
+	all, err := repository.GetUserSanctions(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	active := make([]*model.Sanction, 0, len(all))
+	for _, sanction := range all {
+		if sanction.ActiveAt(now) {
+			active = append(active, sanction)
+		}
+	}
+	return active, nil
+}
+
+// CheckLogin returns a *SanctionError if userID is banned or suspended.
+func (s *ModerationService) CheckLogin(userID int64) error {
+	return s.check(userID, model.SanctionBan, model.SanctionSuspension)
+}
+
+// CheckChat returns a *SanctionError if userID is muted.
+func (s *ModerationService) CheckChat(userID int64) error {
+	return s.check(userID, model.SanctionMute)
+}
+
+func (s *ModerationService) check(userID int64, kinds ...model.SanctionKind) error {
+	sanction, err := repository.GetActiveSanction(userID, kinds, time.Now())
+	if err != nil {
+		if errors.Is(err, repository.ErrSanctionNotFound) {
+			return nil
+		}
+		return err
+	}
+	return &SanctionError{Sanction: sanction}
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"game-server/internal/model"
+)
+
+// ResetNotifier delivers password reset tokens to users. Accounts have no
+// e-mail address yet, so the built-in notifiers only record the token for
+// an operator; a mail or SMS notifier can be plugged in with
+// SetResetNotifier.
+type ResetNotifier interface {
+	SendPasswordReset(user *model.User, token string, expiresAt time.Time) error
+}
+
+// LogNotifier writes reset tokens to the server log.
+type LogNotifier struct{}
+
+func (LogNotifier) SendPasswordReset(user *model.User, token string, expiresAt time.Time) error {
+	log.Printf("Password reset for user %d (%s): token %s, expires %s",
+		user.ID, user.Username, token, expiresAt.Format(time.RFC3339))
+	return nil
+}
+
+// FileNotifier appends reset tokens to a file, one line per request.
+type FileNotifier struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func (n *FileNotifier) SendPasswordReset(user *model.User, token string, expiresAt time.Time) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	f, err := os.OpenFile(n.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%s\tuser=%d\tusername=%s\ttoken=%s\texpires=%s\n",
+		time.Now().Format(time.RFC3339), user.ID, user.Username, token, expiresAt.Format(time.RFC3339))
+	return err
+}
+
+// NewResetNotifier builds the notifier named in the config: "log" (the
+// default) or "file".
+func NewResetNotifier(kind, path string) (ResetNotifier, error) {
+	switch kind {
+	case "", "log":
+		return LogNotifier{}, nil
+	case "file":
+		if path == "" {
+			return nil, fmt.Errorf("password.notifier_file is required for the file notifier")
+		}
+		return &FileNotifier{Path: path}, nil
+	default:
+		return nil, fmt.Errorf("unknown password.notifier %q", kind)
+	}
+}
+
+var (
+	notifierMu    sync.RWMutex
+	resetNotifier ResetNotifier = LogNotifier{}
+)
+
+func SetResetNotifier(n ResetNotifier) {
+	notifierMu.Lock()
+	resetNotifier = n
+	notifierMu.Unlock()
+}
+
+func currentResetNotifier() ResetNotifier {
+	notifierMu.RLock()
+	defer notifierMu.RUnlock()
+	return resetNotifier
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"game-server/internal/config"
+)
+
+var (
+	ErrPasswordTooShort   = errors.New("password is too short")
+	ErrPasswordTooLong    = errors.New("password is too long")
+	ErrPasswordWeak       = errors.New("password does not meet the requirements")
+	ErrPasswordCommon     = errors.New("password is too common")
+	ErrPasswordIsUsername = errors.New("password must not contain the username")
+)
+
+const (
+	DefaultPasswordMinLength = 8
+	DefaultResetTTL          = 30 * time.Minute
+
+	// maxPasswordBytes is the most bcrypt looks at; longer passwords would
+	// silently match on their prefix.
+	maxPasswordBytes = 72
+)
+
+type passwordPolicy struct {
+	cfg    config.PasswordConfig
+	common map[string]struct{}
+}
+
+var (
+	policyMu sync.RWMutex
+	policy   = &passwordPolicy{cfg: config.PasswordConfig{MinLength: DefaultPasswordMinLength, ResetTTL: DefaultResetTTL}}
+)
+
+// SetPasswordPolicy installs the password rules and loads the common
+// password list.
+func SetPasswordPolicy(cfg config.PasswordConfig) error {
+	if cfg.MinLength <= 0 {
+		cfg.MinLength = DefaultPasswordMinLength
+	}
+	if cfg.MinLength > maxPasswordBytes {
+		return fmt.Errorf("password.min_length must be at most %d", maxPasswordBytes)
+	}
+	if cfg.ResetTTL <= 0 {
+		cfg.ResetTTL = DefaultResetTTL
+	}
+
+	p := &passwordPolicy{cfg: cfg, common: map[string]struct{}{}}
+	if cfg.CommonList != "" {
+		if err := p.loadCommon(cfg.CommonList); err != nil {
+			return fmt.Errorf("load password.common_list: %w", err)
+		}
+	}
+
+	policyMu.Lock()
+	policy = p
+	policyMu.Unlock()
+	return nil
+}
+
+func currentPasswordPolicy() *passwordPolicy {
+	policyMu.RLock()
+	defer policyMu.RUnlock()
+	return policy
+}
+
+func (p *passwordPolicy) loadCommon(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.common[strings.ToLower(line)] = struct{}{}
+	}
+	return scanner.Err()
+}
+
+// ValidatePassword checks password against the configured rules. The
+// errors wrap the Err* values above with a human readable detail.
+func ValidatePassword(password, username string) error {
+	p := currentPasswordPolicy()
+	cfg := p.cfg
+
+	if n := utf8.RuneCountInString(password); n < cfg.MinLength {
+		return fmt.Errorf("%w: at least %d characters", ErrPasswordTooShort, cfg.MinLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("%w: at most %d bytes", ErrPasswordTooLong, maxPasswordBytes)
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	var missing []string
+	if cfg.RequireLower && !lower {
+		missing = append(missing, "a lowercase letter")
+	}
+	if cfg.RequireUpper && !upper {
+		missing = append(missing, "an uppercase letter")
+	}
+	if cfg.RequireDigit && !digit {
+		missing = append(missing, "a digit")
+	}
+	if cfg.RequireSymbol && !symbol {
+		missing = append(missing, "a symbol")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: needs %s", ErrPasswordWeak, strings.Join(missing, ", "))
+	}
+
+	lowered := strings.ToLower(password)
+	if _, ok := p.common[lowered]; ok {
+		return ErrPasswordCommon
+	}
+	if name := strings.ToLower(strings.TrimSpace(username)); name != "" && strings.Contains(lowered, name) {
+		return ErrPasswordIsUsername
+	}
+	return nil
+}
+
+// PasswordResetTTL is how long a reset token stays valid.
+func PasswordResetTTL() time.Duration {
+	return currentPasswordPolicy().cfg.ResetTTL
+}
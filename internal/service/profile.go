@@ -0,0 +1,313 @@
+package service
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"game-server/internal/config"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	ErrUsernameRequired    = errors.New("username is required")
+	ErrUsernameTooShort    = errors.New("username is too short")
+	ErrUsernameTooLong     = errors.New("username is too long")
+	ErrUsernameInvalid     = errors.New("username may only contain letters, digits, _ and - and must start with a letter or digit")
+	ErrNameMixedScript     = errors.New("name mixes Latin, Cyrillic or Greek letters")
+	ErrNameReserved        = errors.New("name is reserved")
+	ErrProfanity           = errors.New("contains a disallowed word")
+	ErrDisplayNameTooLong  = errors.New("display name is too long")
+	ErrDisplayNameInvalid  = errors.New("display name contains invalid characters")
+	ErrDisplayNameTaken    = errors.New("display name is another player's username")
+	ErrBioTooLong          = errors.New("bio is too long")
+	ErrBioInvalid          = errors.New("bio contains invalid characters")
+	ErrInvalidCountry      = errors.New("country must be an ISO 3166-1 alpha-2 code")
+	ErrInvalidAvatar       = errors.New("avatar id is out of range")
+	ErrEmptyProfileRequest = errors.New("nothing to update")
+)
+
+const (
+	DefaultUsernameMinLength = 2
+	DefaultUsernameMaxLength = 20
+	DisplayNameMaxLength     = 30
+	BioMaxLength             = 200
+	MaxAvatarID              = 99
+
+	// maxUsernameLength is the width of users.username.
+	maxUsernameLength = 50
+)
+
+type namePolicy struct {
+	cfg       config.UsernameConfig
+	reserved  map[string]struct{}
+	profanity []string
+}
+
+var (
+	namePolicyMu sync.RWMutex
+	names        = &namePolicy{
+		cfg:      config.UsernameConfig{MinLength: DefaultUsernameMinLength, MaxLength: DefaultUsernameMaxLength},
+		reserved: map[string]struct{}{},
+	}
+)
+
+// SetUsernamePolicy installs the username rules and loads the reserved
+// and profanity lists.
+func SetUsernamePolicy(cfg config.UsernameConfig) error {
+	if cfg.MinLength <= 0 {
+		cfg.MinLength = DefaultUsernameMinLength
+	}
+	if cfg.MaxLength <= 0 {
+		cfg.MaxLength = DefaultUsernameMaxLength
+	}
+	if cfg.MaxLength > maxUsernameLength {
+		return fmt.Errorf("username.max_length must be at most %d", maxUsernameLength)
+	}
+	if cfg.MinLength > cfg.MaxLength {
+		return errors.New("username.min_length must not exceed username.max_length")
+	}
+
+	p := &namePolicy{cfg: cfg, reserved: map[string]struct{}{}}
+	if cfg.ReservedList != "" {
+		words, err := loadWordList(cfg.ReservedList)
+		if err != nil {
+			return fmt.Errorf("load username.reserved_list: %w", err)
+		}
+		for _, w := range words {
+			p.reserved[w] = struct{}{}
+		}
+	}
+	if cfg.ProfanityList != "" {
+		words, err := loadWordList(cfg.ProfanityList)
+		if err != nil {
+			return fmt.Errorf("load username.profanity_list: %w", err)
+		}
+		p.profanity = words
+	}
+
+	namePolicyMu.Lock()
+	names = p
+	namePolicyMu.Unlock()
+	return nil
+}
+
+func currentNamePolicy() *namePolicy {
+	namePolicyMu.RLock()
+	defer namePolicyMu.RUnlock()
+	return names
+}
+
+// loadWordList reads one word per line, skipping blanks and # comments.
+// Words are stored in skeleton form so they match however they are
+// written in a name.
+func loadWordList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if w := skeleton(line); w != "" {
+			words = append(words, w)
+		}
+	}
+	return words, scanner.Err()
+}
+
+// CanonicalUsername is the form a username is stored and looked up in:
+// NFKC normalized, so full-width and other compatibility forms collapse to
+// their plain letters, and trimmed. Login uses it without validating, so
+// accounts created before the rules existed keep working.
+func CanonicalUsername(username string) string {
+	return strings.TrimSpace(norm.NFKC.String(username))
+}
+
+// NormalizeUsername returns the canonical form of a new username, or an
+// error if it breaks the rules: length, allowed characters, mixed scripts,
+// the guest prefix, reserved names and profanity.
+func NormalizeUsername(username string) (string, error) {
+	p := currentNamePolicy()
+	name := CanonicalUsername(username)
+
+	n := utf8.RuneCountInString(name)
+	switch {
+	case n == 0:
+		return "", ErrUsernameRequired
+	case n < p.cfg.MinLength:
+		return "", fmt.Errorf("%w: at least %d characters", ErrUsernameTooShort, p.cfg.MinLength)
+	case n > p.cfg.MaxLength:
+		return "", fmt.Errorf("%w: at most %d characters", ErrUsernameTooLong, p.cfg.MaxLength)
+	}
+
+	for i, r := range name {
+		ok := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if !ok && i > 0 {
+			ok = r == '_' || r == '-'
+		}
+		if !ok {
+			return "", ErrUsernameInvalid
+		}
+	}
+
+	if isGuestName(name) {
+		return "", ErrNameReserved
+	}
+	if err := p.checkName(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// NormalizeDisplayName returns the canonical form of a display name. An
+// empty result clears the display name, so the username is shown instead.
+func NormalizeDisplayName(displayName string) (string, error) {
+	name := strings.Join(strings.Fields(norm.NFKC.String(displayName)), " ")
+	if name == "" {
+		return "", nil
+	}
+	if utf8.RuneCountInString(name) > DisplayNameMaxLength {
+		return "", fmt.Errorf("%w: at most %d characters", ErrDisplayNameTooLong, DisplayNameMaxLength)
+	}
+	for _, r := range name {
+		if !unicode.IsGraphic(r) {
+			return "", ErrDisplayNameInvalid
+		}
+	}
+
+	if isGuestName(name) {
+		return "", ErrNameReserved
+	}
+	if err := currentNamePolicy().checkName(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// NormalizeBio trims bio and checks its length, characters and wording.
+// Line breaks are kept.
+func NormalizeBio(bio string) (string, error) {
+	bio = strings.TrimSpace(norm.NFC.String(bio))
+	if utf8.RuneCountInString(bio) > BioMaxLength {
+		return "", fmt.Errorf("%w: at most %d characters", ErrBioTooLong, BioMaxLength)
+	}
+	for _, r := range bio {
+		if r != '\n' && !unicode.IsGraphic(r) {
+			return "", ErrBioInvalid
+		}
+	}
+	if currentNamePolicy().profane(bio) {
+		return "", ErrProfanity
+	}
+	return bio, nil
+}
+
+// NormalizeCountry returns the upper-case ISO 3166-1 alpha-2 code of
+// country. An empty country is allowed.
+func NormalizeCountry(country string) (string, error) {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if country == "" {
+		return "", nil
+	}
+	if len(country) != 2 {
+		return "", ErrInvalidCountry
+	}
+	region, err := language.ParseRegion(country)
+	if err != nil || !region.IsCountry() {
+		return "", ErrInvalidCountry
+	}
+	return region.String(), nil
+}
+
+func ValidateAvatarID(id int) error {
+	if id < 0 || id > MaxAvatarID {
+		return fmt.Errorf("%w: 0-%d", ErrInvalidAvatar, MaxAvatarID)
+	}
+	return nil
+}
+
+// checkName rejects names that could pass for someone else: look-alike
+// letters from several scripts, reserved names in any spelling, and
+// profanity.
+func (p *namePolicy) checkName(name string) error {
+	if mixesScripts(name) {
+		return ErrNameMixedScript
+	}
+	key := skeleton(strings.TrimRightFunc(name, unicode.IsDigit))
+	if _, ok := p.reserved[key]; ok {
+		return ErrNameReserved
+	}
+	if p.profane(name) {
+		return ErrProfanity
+	}
+	return nil
+}
+
+func (p *namePolicy) profane(text string) bool {
+	if len(p.profanity) == 0 {
+		return false
+	}
+	key := skeleton(text)
+	for _, w := range p.profanity {
+		if strings.Contains(key, w) {
+			return true
+		}
+	}
+	return false
+}
+
+var leetReplacer = strings.NewReplacer(
+	"0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s",
+)
+
+// skeleton reduces s to the form used to compare against word lists:
+// NFKC, lower case, common digit-for-letter swaps undone and everything
+// that is not a letter dropped, so "Adm1n", "a_d_m_i_n" and "ＡＤＭＩＮ"
+// all become "admin".
+func skeleton(s string) string {
+	s = leetReplacer.Replace(strings.ToLower(norm.NFKC.String(s)))
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// mixesScripts reports whether s uses letters from more than one of the
+// Latin, Cyrillic and Greek scripts, whose look-alike letters are the usual
+// way to impersonate a name.
+func mixesScripts(s string) bool {
+	var latin, cyrillic, greek bool
+	for _, r := range s {
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin = true
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic = true
+		case unicode.Is(unicode.Greek, r):
+			greek = true
+		}
+	}
+	n := 0
+	for _, used := range []bool{latin, cyrillic, greek} {
+		if used {
+			n++
+		}
+	}
+	return n > 1
+}
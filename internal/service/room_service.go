@@ -16,6 +16,16 @@ var (
 	ErrNotInRoom         = errors.New("not in room")
 	ErrNotRoomCreator    = errors.New("not room creator")
 	ErrRoomAlreadyExists = errors.New("room already exists")
+	ErrGameNotFinished   = errors.New("game not finished")
+	ErrNoRematchRequest  = errors.New("no rematch request from opponent")
+	ErrRematchPending    = errors.New("rematch already requested")
+	ErrRematchNotAllowed = errors.New("rematch not allowed in this room")
+	ErrRoomInGame        = errors.New("game already in progress")
+	ErrTournamentRoom    = errors.New("not allowed in tournament rooms")
+	ErrRoomLocked        = errors.New("room is locked")
+	ErrCannotKickSelf    = errors.New("cannot kick yourself")
+	ErrRoomRated         = errors.New("guests can only join casual rooms")
+	ErrRoomCasualOnly    = errors.New("a guest is in this room, it cannot be rated")
 )
 
 type RoomService struct {
@@ -41,6 +51,82 @@ func (s *RoomService) CreateRoom(name string, creatorID int64) (*model.Room, err
 	return room, nil
 }
 
+func (s *RoomService) CreateTournamentRoom(name string, creatorID, tournamentID int64, matchID int) (*model.Room, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := atomic.AddInt64(&s.idCounter, 1)
+	room := model.NewRoom(id, name, creatorID)
+	room.TournamentID = tournamentID
+	room.MatchID = matchID
+	s.rooms[id] = room
+
+	return room, nil
+}
+
+func (s *RoomService) CreateCorrespondenceRoom(name string, creatorID int64, daysPerMove int) (*model.Room, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := atomic.AddInt64(&s.idCounter, 1)
+	room := model.NewRoom(id, name, creatorID)
+	room.Correspondence = true
+	room.DaysPerMove = daysPerMove
+	s.rooms[id] = room
+
+	return room, nil
+}
+
+func (s *RoomService) RestoreCorrespondenceRoom(name string, g *model.CorrespondenceGame) (*model.Room, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, room := range s.rooms {
+		if room.GameID == g.ID {
+			return room, nil
+		}
+	}
+
+	id := atomic.AddInt64(&s.idCounter, 1)
+	room := model.NewRoom(id, name, g.BlackPlayerID)
+	room.Players = g.Players()
+	room.Status = model.RoomStatusPlaying
+	room.Correspondence = true
+	room.DaysPerMove = g.DaysPerMove
+	room.GameID = g.ID
+	room.Settings.RuleSet = g.RuleSet
+	room.Settings.BoardSize = len(g.Board)
+	room.Settings.Rated = g.Rated
+	s.rooms[id] = room
+
+	return room, nil
+}
+
+func (s *RoomService) GetRoomByGameID(gameID int64) (*model.Room, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, room := range s.rooms {
+		if room.GameID == gameID {
+			return room, nil
+		}
+	}
+	return nil, ErrRoomNotFound
+}
+
+func (s *RoomService) SetRoomGameID(roomID, gameID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room, ok := s.rooms[roomID]
+	if !ok {
+		return ErrRoomNotFound
+	}
+
+	room.GameID = gameID
+	return nil
+}
+
 func (s *RoomService) GetRoom(roomID int64) (*model.Room, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -53,6 +139,31 @@ func (s *RoomService) GetRoom(roomID int64) (*model.Room, error) {
 }
 
 func (s *RoomService) JoinRoom(roomID, userID int64) error {
+	return s.join(roomID, userID, false)
+}
+
+// JoinRoomCasual adds a player who may not play rated games, i.e. a guest.
+// Rated rooms are refused, and the room stays casual from then on.
+func (s *RoomService) JoinRoomCasual(roomID, userID int64) error {
+	return s.join(roomID, userID, true)
+}
+
+// MakeCasual turns a new room into a casual-only one, for rooms created by
+// guests.
+func (s *RoomService) MakeCasual(roomID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room, ok := s.rooms[roomID]
+	if !ok {
+		return ErrRoomNotFound
+	}
+	room.Settings.Rated = false
+	room.CasualOnly = true
+	return nil
+}
+
+func (s *RoomService) join(roomID, userID int64, casual bool) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -69,6 +180,17 @@ func (s *RoomService) JoinRoom(roomID, userID int64) error {
 		return ErrRoomFull
 	}
 
+	if room.Locked {
+		return ErrRoomLocked
+	}
+
+	if casual {
+		if room.Settings.Rated {
+			return ErrRoomRated
+		}
+		room.CasualOnly = true
+	}
+
 	room.AddPlayer(userID)
 	return nil
 }
@@ -112,7 +234,7 @@ func (s *RoomService) ListWaitingRooms() []*model.Room {
 
 	rooms := make([]*model.Room, 0)
 	for _, room := range s.rooms {
-		if room.Status == model.RoomStatusWaiting {
+		if room.Status == model.RoomStatusWaiting && !room.IsTournament() {
 			rooms = append(rooms, room)
 		}
 	}
@@ -215,10 +337,205 @@ func (s *RoomService) CleanInactiveRooms(timeout time.Duration) int {
 	count := 0
 	now := time.Now()
 	for id, room := range s.rooms {
-		if now.Sub(room.CreatedAt) > timeout && room.Status == model.RoomStatusWaiting && len(room.Players) == 1 {
+		if now.Sub(room.CreatedAt) > timeout && room.Status == model.RoomStatusWaiting && len(room.Players) == 1 && !room.IsTournament() {
 			delete(s.rooms, id)
 			count++
 		}
 	}
 	return count
 }
+
+func (s *RoomService) RecordResult(roomID, winner int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room, ok := s.rooms[roomID]
+	if !ok {
+		return ErrRoomNotFound
+	}
+
+	room.RecordResult(winner)
+	return nil
+}
+
+// RequestRematch records a rematch offer. If the opponent had already offered
+// one, the rematch is accepted straight away and true is returned.
+func (s *RoomService) RequestRematch(roomID, userID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room, err := s.rematchRoom(roomID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	if room.RematchFrom != 0 && room.RematchFrom != userID {
+		s.resetForRematch(room)
+		return true, nil
+	}
+	if room.RematchFrom == userID {
+		return false, ErrRematchPending
+	}
+
+	room.RematchFrom = userID
+	return false, nil
+}
+
+func (s *RoomService) AcceptRematch(roomID, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room, err := s.rematchRoom(roomID, userID)
+	if err != nil {
+		return err
+	}
+
+	if room.RematchFrom == 0 || room.RematchFrom == userID {
+		return ErrNoRematchRequest
+	}
+
+	s.resetForRematch(room)
+	return nil
+}
+
+func (s *RoomService) rematchRoom(roomID, userID int64) (*model.Room, error) {
+	room, ok := s.rooms[roomID]
+	if !ok {
+		return nil, ErrRoomNotFound
+	}
+	if !room.HasPlayer(userID) {
+		return nil, ErrNotInRoom
+	}
+	if room.IsTournament() || room.Correspondence {
+		return nil, ErrRematchNotAllowed
+	}
+	if room.Status != model.RoomStatusFinished {
+		return nil, ErrGameNotFinished
+	}
+	if !room.CanStart() {
+		return nil, errors.New("not enough players")
+	}
+	return room, nil
+}
+
+func (s *RoomService) resetForRematch(room *model.Room) {
+	room.RematchFrom = 0
+	room.GameID = 0
+	room.SwapColors()
+	room.Status = model.RoomStatusWaiting
+}
+
+// UpdateSettings replaces the room settings. Only the creator may change them
+// and only while no game is running; every change clears the ready flags so
+// both players have to confirm the new settings.
+func (s *RoomService) UpdateSettings(roomID, userID int64, settings model.RoomSettings) (*model.Room, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room, ok := s.rooms[roomID]
+	if !ok {
+		return nil, ErrRoomNotFound
+	}
+	if room.CreatorID != userID {
+		return nil, ErrNotRoomCreator
+	}
+	if room.IsTournament() {
+		return nil, ErrTournamentRoom
+	}
+	if room.Status == model.RoomStatusPlaying {
+		return nil, ErrRoomInGame
+	}
+
+	settings.Normalize()
+	if room.Correspondence {
+		settings.MoveTimeLimit = 0
+	}
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	if settings.Rated && room.CasualOnly {
+		return nil, ErrRoomCasualOnly
+	}
+
+	room.Settings = settings
+	room.ClearReady()
+	return room, nil
+}
+
+// SetReady toggles the player's ready flag. It returns true once both players
+// are ready; the colours are assigned and the flags cleared so the caller can
+// start the game.
+func (s *RoomService) SetReady(roomID, userID int64, ready bool) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room, ok := s.rooms[roomID]
+	if !ok {
+		return false, ErrRoomNotFound
+	}
+	if !room.HasPlayer(userID) {
+		return false, ErrNotInRoom
+	}
+	if room.IsTournament() {
+		return false, ErrTournamentRoom
+	}
+	if room.Status == model.RoomStatusPlaying {
+		return false, ErrRoomInGame
+	}
+
+	room.SetReady(userID, ready)
+	if !room.AllReady() {
+		return false, nil
+	}
+
+	room.AssignColors()
+	room.ClearReady()
+	return true, nil
+}
+
+// KickPlayer removes a waiting player from the room. Only the creator may kick,
+// and never while a game is running.
+func (s *RoomService) KickPlayer(roomID, creatorID, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room, ok := s.rooms[roomID]
+	if !ok {
+		return ErrRoomNotFound
+	}
+	if room.CreatorID != creatorID {
+		return ErrNotRoomCreator
+	}
+	if creatorID == userID {
+		return ErrCannotKickSelf
+	}
+	if room.IsTournament() {
+		return ErrTournamentRoom
+	}
+	if room.Status == model.RoomStatusPlaying {
+		return ErrRoomInGame
+	}
+	if !room.RemovePlayer(userID) {
+		return ErrNotInRoom
+	}
+	return nil
+}
+
+func (s *RoomService) SetLocked(roomID, userID int64, locked bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room, ok := s.rooms[roomID]
+	if !ok {
+		return ErrRoomNotFound
+	}
+	if room.CreatorID != userID {
+		return ErrNotRoomCreator
+	}
+	if room.IsTournament() {
+		return ErrTournamentRoom
+	}
+
+	room.Locked = locked
+	return nil
+}
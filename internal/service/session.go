@@ -2,11 +2,17 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
+	"game-server/internal/model"
 	"game-server/pkg/redis"
 )
 
@@ -16,15 +22,28 @@ var (
 )
 
 const (
-	SessionKeyPrefix = "session:"
-	SessionTTL       = 24 * time.Hour
+	SessionKeyPrefix     = "session:"
+	UserSessionKeyPrefix = "user_sessions:"
+	RefreshKeyPrefix     = "refresh:"
+	OnlineKeyPrefix      = "online:"
+	// SessionTTL bounds the online marker of a connected user.
+	SessionTTL = 24 * time.Hour
+
+	maxDeviceLength = 128
+	usedRefreshMark = "used:"
 )
 
+// Session is the server-side record behind a login. Clients never see it
+// directly: they hold an access token naming the session and a refresh
+// token that renews it. Revoking the session stops all refreshes.
 type Session struct {
-	UserID    int64  `json:"user_id"`
-	Username  string `json:"username"`
-	Token     string `json:"token"`
-	CreatedAt int64  `json:"created_at"`
+	ID        string     `json:"id"`
+	UserID    int64      `json:"user_id"`
+	Username  string     `json:"username"`
+	Role      model.Role `json:"role"`
+	Device    string     `json:"device"`
+	IP        string     `json:"ip"`
+	CreatedAt int64      `json:"created_at"`
 }
 
 type SessionService struct{}
@@ -33,12 +52,25 @@ func NewSessionService() *SessionService {
 	return &SessionService{}
 }
 
-func (s *SessionService) Create(userID int64, username, token string) error {
-	sess := &Session{
-		UserID:    userID,
-		Username:  username,
-		Token:     token,
-		CreatedAt: time.Now().Unix(),
+// Start creates sess and issues its first token pair.
+func (s *SessionService) Start(sess *Session) (*TokenPair, error) {
+	if err := s.Create(sess); err != nil {
+		return nil, err
+	}
+	return s.issue(sess)
+}
+
+// Create stores sess and adds it to the user's session list. ID and
+// CreatedAt are set here.
+func (s *SessionService) Create(sess *Session) error {
+	id, err := randomHex(8)
+	if err != nil {
+		return err
+	}
+	sess.ID = id
+	sess.CreatedAt = time.Now().Unix()
+	if len(sess.Device) > maxDeviceLength {
+		sess.Device = sess.Device[:maxDeviceLength]
 	}
 
 	data, err := json.Marshal(sess)
@@ -47,14 +79,97 @@ func (s *SessionService) Create(userID int64, username, token string) error {
 	}
 
 	ctx := context.Background()
-	key := SessionKeyPrefix + token
+	ttl := RefreshTTL()
+	userKey := userSessionKey(sess.UserID)
+
+	pipe := redis.Client.TxPipeline()
+	pipe.Set(ctx, SessionKeyPrefix+sess.ID, data, ttl)
+	pipe.SAdd(ctx, userKey, sess.ID)
+	pipe.Expire(ctx, userKey, ttl)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Reissue signs a new access token for session id, e.g. after the user's
+// name or role changed. The refresh token stays valid.
+func (s *SessionService) Reissue(id string) (string, time.Duration, error) {
+	sess, err := s.Get(id)
+	if err != nil {
+		return "", 0, err
+	}
+	return IssueAccessToken(sess)
+}
+
+// issue signs an access token for sess and stores a new refresh token.
+func (s *SessionService) issue(sess *Session) (*TokenPair, error) {
+	access, ttl, err := IssueAccessToken(sess)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	if err := redis.Client.Set(ctx, refreshKey(refresh), sess.ID, RefreshTTL()).Err(); err != nil {
+		return nil, err
+	}
 
-	return redis.Client.Set(ctx, key, data, SessionTTL).Err()
+	return &TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresIn:    int64(ttl.Seconds()),
+	}, nil
 }
 
-func (s *SessionService) Get(token string) (*Session, error) {
+// rotateRefresh marks a refresh token as used and returns its session ID.
+// A token that was used before comes back with the usedRefreshMark prefix.
+const rotateRefresh = `local v = redis.call("GET", KEYS[1])
+if not v then return false end
+if string.sub(v, 1, 5) == "used:" then return v end
+redis.call("SET", KEYS[1], "used:" .. v, "KEEPTTL")
+return v`
+
+// Rotate trades a refresh token for a new token pair. Each refresh token
+// works once; presenting one again means it was copied, so the whole
+// session is revoked and ErrRefreshTokenReused returned.
+func (s *SessionService) Rotate(refreshToken string) (*Session, *TokenPair, error) {
 	ctx := context.Background()
-	key := SessionKeyPrefix + token
+
+	id, err := redis.Client.Eval(ctx, rotateRefresh, []string{refreshKey(refreshToken)}).Text()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil, ErrRefreshTokenInvalid
+		}
+		return nil, nil, err
+	}
+
+	if reused, ok := strings.CutPrefix(id, usedRefreshMark); ok {
+		if err := s.Revoke(reused, nil, "refresh token reused"); err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return nil, nil, err
+		}
+		return nil, nil, ErrRefreshTokenReused
+	}
+
+	sess, err := s.Get(id)
+	if err != nil {
+		return nil, nil, ErrRefreshTokenInvalid
+	}
+	if err := s.Refresh(id, sess.UserID); err != nil {
+		return nil, nil, err
+	}
+
+	pair, err := s.issue(sess)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sess, pair, nil
+}
+
+func (s *SessionService) Get(id string) (*Session, error) {
+	ctx := context.Background()
+	key := SessionKeyPrefix + id
 
 	data, err := redis.Client.Get(ctx, key).Bytes()
 	if err != nil {
@@ -65,46 +180,215 @@ func (s *SessionService) Get(token string) (*Session, error) {
 	if err := json.Unmarshal(data, &sess); err != nil {
 		return nil, err
 	}
-
 	return &sess, nil
 }
 
-func (s *SessionService) Validate(token string) (*Session, error) {
-	sess, err := s.Get(token)
+func (s *SessionService) Delete(id string) error {
+	ctx := context.Background()
+	key := SessionKeyPrefix + id
+
+	if sess, err := s.Get(id); err == nil {
+		redis.Client.SRem(ctx, userSessionKey(sess.UserID), id)
+	}
+	return redis.Client.Del(ctx, key).Err()
+}
+
+// Revoke ends one session and closes the connections that use it, except
+// keep, a handler's client value that is logging out itself. Refresh tokens
+// of the session stop working; access tokens run out on their own.
+func (s *SessionService) Revoke(id string, keep interface{}, reason string) error {
+	sess, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	if err := s.Delete(id); err != nil {
+		return err
+	}
+
+	publishSessionEvent(SessionEvent{UserID: sess.UserID, SessionIDs: []string{id}, Keep: keep, Reason: reason})
+	return nil
+}
+
+// RevokeOwn ends session id if it belongs to userID.
+func (s *SessionService) RevokeOwn(userID int64, id, reason string) error {
+	sess, err := s.Get(id)
+	if err != nil || sess.UserID != userID {
+		return ErrSessionNotFound
+	}
+	return s.Revoke(id, nil, reason)
+}
+
+// RevokeAll ends every session of userID except exceptID, which may be
+// empty, and closes all of the user's connections except keep. It returns
+// how many sessions were removed.
+func (s *SessionService) RevokeAll(userID int64, exceptID string, keep interface{}, reason string) (int, error) {
+	ctx := context.Background()
+	userKey := userSessionKey(userID)
+
+	ids, err := redis.Client.SMembers(ctx, userKey).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	keys := make([]string, 0, len(ids))
+	revoked := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id == exceptID {
+			continue
+		}
+		keys = append(keys, SessionKeyPrefix+id)
+		revoked = append(revoked, id)
+	}
+
+	if len(revoked) > 0 {
+		pipe := redis.Client.TxPipeline()
+		pipe.Del(ctx, keys...)
+		pipe.SRem(ctx, userKey, stringsToArgs(revoked)...)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	publishSessionEvent(SessionEvent{UserID: userID, Keep: keep, Reason: reason})
+	return len(revoked), nil
+}
+
+// EnforcePolicy runs after sess was created. Under the single-session
+// policy it ends the user's other sessions and closes every connection of
+// the user except keep. It returns how many sessions were ended.
+func (s *SessionService) EnforcePolicy(sess *Session, keep interface{}) (int, error) {
+	if CurrentSessionPolicy() != SessionPolicySingle {
+		return 0, nil
+	}
+	return s.RevokeAll(sess.UserID, sess.ID, keep, "logged in from another device")
+}
+
+// List returns the live sessions of userID, oldest first. Sessions that
+// already expired are dropped from the user's set on the way.
+func (s *SessionService) List(userID int64) ([]*Session, error) {
+	ctx := context.Background()
+	userKey := userSessionKey(userID)
+
+	ids, err := redis.Client.SMembers(ctx, userKey).Result()
 	if err != nil {
 		return nil, err
 	}
 
-	return sess, nil
+	sessions := make([]*Session, 0, len(ids))
+	for _, id := range ids {
+		sess, err := s.Get(id)
+		if err != nil {
+			redis.Client.SRem(ctx, userKey, id)
+			continue
+		}
+		sessions = append(sessions, sess)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt < sessions[j].CreatedAt
+	})
+	return sessions, nil
 }
 
-func (s *SessionService) Delete(token string) error {
+func stringsToArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
+
+// UpdateRole rewrites the role stored in every session of userID. Routes
+// that check the live session see it at once; access tokens carry the new
+// role from their next refresh.
+func (s *SessionService) UpdateRole(userID int64, role model.Role) error {
+	return s.update(userID, func(sess *Session) { sess.Role = role })
+}
+
+// UpdateUsername rewrites the username stored in every session of userID.
+func (s *SessionService) UpdateUsername(userID int64, username string) error {
+	return s.update(userID, func(sess *Session) { sess.Username = username })
+}
+
+func (s *SessionService) update(userID int64, fn func(*Session)) error {
 	ctx := context.Background()
-	key := SessionKeyPrefix + token
-	return redis.Client.Del(ctx, key).Err()
+
+	ids, err := redis.Client.SMembers(ctx, userSessionKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		sess, err := s.Get(id)
+		if err != nil {
+			continue
+		}
+		fn(sess)
+
+		data, err := json.Marshal(sess)
+		if err != nil {
+			return err
+		}
+		if err := redis.Client.Set(ctx, SessionKeyPrefix+id, data, redis.KeepTTL).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (s *SessionService) Refresh(token string) error {
+// Refresh extends the lifetime of session id of userID, e.g. while its
+// connection is active. The user's session list is extended with it so
+// that List and RevokeAll keep seeing the session.
+func (s *SessionService) Refresh(id string, userID int64) error {
 	ctx := context.Background()
-	key := SessionKeyPrefix + token
-	return redis.Client.Expire(ctx, key, SessionTTL).Err()
+	ttl := RefreshTTL()
+
+	pipe := redis.Client.TxPipeline()
+	pipe.Expire(ctx, SessionKeyPrefix+id, ttl)
+	pipe.Expire(ctx, userSessionKey(userID), ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func userSessionKey(userID int64) string {
+	return fmt.Sprintf("%s%d", UserSessionKeyPrefix, userID)
+}
+
+// refreshKey stores refresh tokens hashed, so a Redis dump does not leak
+// usable tokens.
+func refreshKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return RefreshKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
 
-func (s *SessionService) SetUserOnline(userID int64, token string) error {
+func (s *SessionService) SetUserOnline(userID int64, sessionID string) error {
 	ctx := context.Background()
-	key := fmt.Sprintf("online:%d", userID)
-	return redis.Client.Set(ctx, key, token, SessionTTL).Err()
+	key := fmt.Sprintf("%s%d", OnlineKeyPrefix, userID)
+	return redis.Client.Set(ctx, key, sessionID, SessionTTL).Err()
 }
 
-func (s *SessionService) SetUserOffline(userID int64) error {
+// releaseOnline deletes the online marker only if it still belongs to the
+// given session, so a connection closing late does not mark a user offline
+// who has logged in again elsewhere.
+const releaseOnline = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`
+
+func (s *SessionService) SetUserOffline(userID int64, sessionID string) error {
 	ctx := context.Background()
-	key := fmt.Sprintf("online:%d", userID)
-	return redis.Client.Del(ctx, key).Err()
+	key := fmt.Sprintf("%s%d", OnlineKeyPrefix, userID)
+	return redis.Client.Eval(ctx, releaseOnline, []string{key}, sessionID).Err()
 }
 
 func (s *SessionService) IsUserOnline(userID int64) (bool, error) {
 	ctx := context.Background()
-	key := fmt.Sprintf("online:%d", userID)
+	key := fmt.Sprintf("%s%d", OnlineKeyPrefix, userID)
 	n, err := redis.Client.Exists(ctx, key).Result()
 	return n > 0, err
 }
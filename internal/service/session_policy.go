@@ -0,0 +1,89 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+type SessionPolicy string
+
+const (
+	// SessionPolicyMulti lets a user stay logged in on several devices.
+	SessionPolicyMulti SessionPolicy = "multi"
+	// SessionPolicySingle ends every other session when the user logs in,
+	// and closes the older connections with a notice.
+	SessionPolicySingle SessionPolicy = "single"
+)
+
+var sessionPolicy atomic.Value
+
+func SetSessionPolicy(p SessionPolicy) error {
+	switch p {
+	case "":
+		p = SessionPolicyMulti
+	case SessionPolicyMulti, SessionPolicySingle:
+	default:
+		return fmt.Errorf("unknown session policy %q", p)
+	}
+	sessionPolicy.Store(p)
+	return nil
+}
+
+func CurrentSessionPolicy() SessionPolicy {
+	if p, ok := sessionPolicy.Load().(SessionPolicy); ok {
+		return p
+	}
+	return SessionPolicyMulti
+}
+
+// SessionEvent asks the connection handlers to close connections of UserID:
+// those logged in to one of SessionIDs, or all of them if SessionIDs is nil.
+// Keep is a connection handler's own client value that must stay open.
+type SessionEvent struct {
+	UserID     int64
+	SessionIDs []string
+	Keep       interface{}
+	Reason     string
+}
+
+// Matches reports whether a connection of the event's user, logged in to
+// sessionID, has to be closed. client is the handler's value for it.
+func (e SessionEvent) Matches(client interface{}, sessionID string) bool {
+	if client == e.Keep {
+		return false
+	}
+	if e.SessionIDs == nil {
+		return true
+	}
+	for _, id := range e.SessionIDs {
+		if id == sessionID {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	sessionListenersMu sync.RWMutex
+	sessionListeners   []func(SessionEvent)
+)
+
+// SubscribeSessionEvents registers fn to be called whenever sessions are
+// revoked, so every transport can drop the affected connections.
+func SubscribeSessionEvents(fn func(SessionEvent)) {
+	sessionListenersMu.Lock()
+	sessionListeners = append(sessionListeners, fn)
+	sessionListenersMu.Unlock()
+}
+
+func publishSessionEvent(ev SessionEvent) {
+	sessionListenersMu.RLock()
+	listeners := make([]func(SessionEvent), len(sessionListeners))
+	copy(listeners, sessionListeners)
+	sessionListenersMu.RUnlock()
+
+	for _, fn := range listeners {
+		fn(ev)
+	}
+}
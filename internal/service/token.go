@@ -0,0 +1,186 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"game-server/internal/config"
+	"game-server/internal/model"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrInvalidToken        = errors.New("invalid or expired token")
+	ErrRefreshTokenInvalid = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used, session revoked")
+)
+
+const (
+	DefaultAccessTTL  = 15 * time.Minute
+	DefaultRefreshTTL = 30 * 24 * time.Hour
+
+	tokenIssuer = "gomoku"
+)
+
+// AccessClaims is the payload of an access token. It carries everything a
+// connection needs after login, so verifying it does not touch Redis.
+type AccessClaims struct {
+	UserID    int64      `json:"uid"`
+	Username  string     `json:"name"`
+	Role      model.Role `json:"role"`
+	SessionID string     `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// TokenPair is handed to the client on login and on every refresh.
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	// ExpiresIn is the access token lifetime in seconds.
+	ExpiresIn int64
+}
+
+type tokenKeys struct {
+	method     jwt.SigningMethod
+	signKey    interface{}
+	verifyKey  interface{}
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+var (
+	keysMu sync.RWMutex
+	keys   *tokenKeys
+)
+
+// InitTokens loads the signing key. Without a configured HS256 secret a
+// random one is generated, so tokens stop working after a restart.
+func InitTokens(cfg config.AuthConfig) error {
+	k := &tokenKeys{
+		accessTTL:  cfg.AccessTTL,
+		refreshTTL: cfg.RefreshTTL,
+	}
+	if k.accessTTL <= 0 {
+		k.accessTTL = DefaultAccessTTL
+	}
+	if k.refreshTTL <= 0 {
+		k.refreshTTL = DefaultRefreshTTL
+	}
+
+	switch cfg.Algorithm {
+	case "", "HS256":
+		secret := []byte(cfg.Secret)
+		if len(secret) == 0 {
+			log.Println("auth.secret is empty, using a random key: access tokens will not survive a restart")
+			secret = randomSecret()
+		}
+		k.method, k.signKey, k.verifyKey = jwt.SigningMethodHS256, secret, secret
+	case "EdDSA":
+		pem, err := os.ReadFile(cfg.PrivateKeyFile)
+		if err != nil {
+			return fmt.Errorf("read auth.private_key_file: %w", err)
+		}
+		key, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+		if err != nil {
+			return fmt.Errorf("parse auth.private_key_file: %w", err)
+		}
+		priv, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return errors.New("auth.private_key_file is not an Ed25519 key")
+		}
+		k.method, k.signKey, k.verifyKey = jwt.SigningMethodEdDSA, crypto.Signer(priv), priv.Public()
+	default:
+		return fmt.Errorf("unknown auth.algorithm %q", cfg.Algorithm)
+	}
+
+	keysMu.Lock()
+	keys = k
+	keysMu.Unlock()
+	return nil
+}
+
+func currentKeys() *tokenKeys {
+	keysMu.RLock()
+	k := keys
+	keysMu.RUnlock()
+	if k != nil {
+		return k
+	}
+
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	if keys == nil {
+		secret := randomSecret()
+		keys = &tokenKeys{
+			method:     jwt.SigningMethodHS256,
+			signKey:    secret,
+			verifyKey:  secret,
+			accessTTL:  DefaultAccessTTL,
+			refreshTTL: DefaultRefreshTTL,
+		}
+	}
+	return keys
+}
+
+func randomSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return secret
+}
+
+// RefreshTTL is how long a refresh token, and the session behind it, lives
+// without being used.
+func RefreshTTL() time.Duration {
+	return currentKeys().refreshTTL
+}
+
+// IssueAccessToken signs a short-lived access token for sess.
+func IssueAccessToken(sess *Session) (string, time.Duration, error) {
+	k := currentKeys()
+	now := time.Now()
+
+	claims := &AccessClaims{
+		UserID:    sess.UserID,
+		Username:  sess.Username,
+		Role:      sess.Role,
+		SessionID: sess.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			Subject:   strconv.FormatInt(sess.UserID, 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(k.accessTTL)),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(k.method, claims).SignedString(k.signKey)
+	if err != nil {
+		return "", 0, err
+	}
+	return token, k.accessTTL, nil
+}
+
+// VerifyAccessToken checks the signature and expiry of an access token. It
+// does not know whether the session was revoked since the token was issued.
+func VerifyAccessToken(token string) (*AccessClaims, error) {
+	k := currentKeys()
+
+	claims := &AccessClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return k.verifyKey, nil
+	}, jwt.WithValidMethods([]string{k.method.Alg()}), jwt.WithIssuer(tokenIssuer), jwt.WithExpirationRequired())
+	if err != nil || claims.UserID == 0 || claims.SessionID == "" {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
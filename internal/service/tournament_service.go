@@ -0,0 +1,395 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"game-server/internal/model"
+	"game-server/internal/repository"
+)
+
+var (
+	ErrTournamentNotFound = errors.New("tournament not found")
+	ErrNotTournamentOwner = errors.New("not tournament creator")
+	ErrWrongTransport     = errors.New("match room is on another connection type, check in over the same one as your opponent")
+)
+
+const (
+	DefaultTournamentPlayers = 16
+	MaxTournamentPlayers     = 64
+	DefaultNoShowTimeout     = 2 * time.Minute
+)
+
+type TournamentEventType int
+
+const (
+	TournamentEventMatchReady TournamentEventType = iota
+	TournamentEventTiebreak
+	TournamentEventMatchFinished
+	TournamentEventFinished
+)
+
+type TournamentEvent struct {
+	Type         TournamentEventType
+	TournamentID int64
+	Match        model.TournamentMatch
+	Champion     int64
+	Deadline     time.Time
+}
+
+type TournamentService struct {
+	tournaments map[int64]*model.Tournament
+	listeners   []func(TournamentEvent)
+	mu          sync.RWMutex
+	idCounter   int64
+}
+
+func NewTournamentService() *TournamentService {
+	return &TournamentService{
+		tournaments: make(map[int64]*model.Tournament),
+	}
+}
+
+func (s *TournamentService) Subscribe(fn func(TournamentEvent)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
+
+func (s *TournamentService) CreateTournament(name string, format model.TournamentFormat, creatorID int64, maxPlayers int, noShowTimeout time.Duration) (*model.Tournament, error) {
+	if format != model.TournamentSingleElimination && format != model.TournamentDoubleElimination {
+		return nil, model.ErrInvalidBracketFormat
+	}
+	if maxPlayers <= 0 {
+		maxPlayers = DefaultTournamentPlayers
+	}
+	if maxPlayers > MaxTournamentPlayers {
+		maxPlayers = MaxTournamentPlayers
+	}
+	if noShowTimeout <= 0 {
+		noShowTimeout = DefaultNoShowTimeout
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := atomic.AddInt64(&s.idCounter, 1)
+	t := model.NewTournament(id, name, format, creatorID, maxPlayers, noShowTimeout)
+	s.tournaments[id] = t
+	return t, nil
+}
+
+func (s *TournamentService) GetTournament(id int64) (*model.Tournament, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.tournaments[id]
+	if !ok {
+		return nil, ErrTournamentNotFound
+	}
+	return t, nil
+}
+
+func (s *TournamentService) ListTournaments() []*model.Tournament {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]*model.Tournament, 0, len(s.tournaments))
+	for _, t := range s.tournaments {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+func (s *TournamentService) GetBracket(id int64) (*model.Bracket, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.tournaments[id]
+	if !ok {
+		return nil, ErrTournamentNotFound
+	}
+	return t.Bracket(), nil
+}
+
+func (s *TournamentService) Register(id, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tournaments[id]
+	if !ok {
+		return ErrTournamentNotFound
+	}
+	return t.AddPlayer(userID)
+}
+
+// Start seeds the bracket by score. Scores come from the database, so they
+// are loaded before taking the lock.
+func (s *TournamentService) Start(id, userID int64) error {
+	scores := loadScores(s.Players(id))
+
+	s.mu.Lock()
+	t, ok := s.tournaments[id]
+	if !ok {
+		s.mu.Unlock()
+		return ErrTournamentNotFound
+	}
+	if t.CreatorID != userID {
+		s.mu.Unlock()
+		return ErrNotTournamentOwner
+	}
+	if t.Status != model.TournamentStatusRegistering {
+		s.mu.Unlock()
+		return model.ErrTournamentStarted
+	}
+
+	ready, err := t.BuildBracket(seedByScore(t.Players, scores))
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	events := s.readyEvents(t, ready)
+	s.mu.Unlock()
+
+	s.publish(events)
+	return nil
+}
+
+func (s *TournamentService) Players(id int64) []int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.tournaments[id]
+	if !ok {
+		return nil
+	}
+	players := make([]int64, len(t.Players))
+	copy(players, t.Players)
+	return players
+}
+
+// CheckIn marks the player as present for the match. seat is called with the
+// match's current room (0 if none) and must return the room the player now
+// sits in, so both players always end up in the same room. Once the match
+// has a room, only check-ins over that room's transport are accepted; a
+// player turned away for that still counts as present at the deadline.
+func (s *TournamentService) CheckIn(id int64, matchID int, userID int64, transport string, seat func(roomID int64) (int64, error)) (model.TournamentMatch, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tournaments[id]
+	if !ok {
+		return model.TournamentMatch{}, false, ErrTournamentNotFound
+	}
+	m := t.GetMatch(matchID)
+	if m == nil {
+		return model.TournamentMatch{}, false, model.ErrMatchNotFound
+	}
+	if !m.HasPlayer(userID) {
+		return model.TournamentMatch{}, false, model.ErrNotInMatch
+	}
+	if m.Status != model.MatchStatusReady {
+		return model.TournamentMatch{}, false, model.ErrMatchNotReady
+	}
+	if m.RoomID != 0 && m.Transport != transport {
+		m.MarkPresent(userID)
+		return model.TournamentMatch{}, false, ErrWrongTransport
+	}
+
+	roomID, err := seat(m.RoomID)
+	if err != nil {
+		return model.TournamentMatch{}, false, err
+	}
+	m.RoomID = roomID
+	m.Transport = transport
+
+	both := m.CheckIn(userID)
+	return *m, both, nil
+}
+
+func (s *TournamentService) StartMatch(id int64, matchID int) (model.TournamentMatch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tournaments[id]
+	if !ok {
+		return model.TournamentMatch{}, ErrTournamentNotFound
+	}
+	m := t.GetMatch(matchID)
+	if m == nil {
+		return model.TournamentMatch{}, model.ErrMatchNotFound
+	}
+	if m.Status != model.MatchStatusReady {
+		return model.TournamentMatch{}, model.ErrMatchNotReady
+	}
+
+	m.Status = model.MatchStatusPlaying
+	m.Games++
+	return *m, nil
+}
+
+// ReportResult records the outcome of a match game. A draw does not finish the
+// match: the colours are swapped and tiebreak is reported as true so the caller
+// can start the additional game.
+func (s *TournamentService) ReportResult(id int64, matchID int, winner int64) (match model.TournamentMatch, tiebreak bool, err error) {
+	s.mu.Lock()
+	t, ok := s.tournaments[id]
+	if !ok {
+		s.mu.Unlock()
+		return model.TournamentMatch{}, false, ErrTournamentNotFound
+	}
+	m := t.GetMatch(matchID)
+	if m == nil {
+		s.mu.Unlock()
+		return model.TournamentMatch{}, false, model.ErrMatchNotFound
+	}
+	if m.Status != model.MatchStatusPlaying {
+		s.mu.Unlock()
+		return model.TournamentMatch{}, false, model.ErrMatchNotReady
+	}
+
+	if winner == 0 {
+		m.Tiebreak()
+		match = *m
+		s.mu.Unlock()
+
+		s.publish([]TournamentEvent{{
+			Type:         TournamentEventTiebreak,
+			TournamentID: id,
+			Match:        match,
+		}})
+		return match, true, nil
+	}
+
+	events, err := s.finishMatch(t, m, winner, false)
+	if err != nil {
+		s.mu.Unlock()
+		return model.TournamentMatch{}, false, err
+	}
+	match = *m
+	s.mu.Unlock()
+
+	s.publish(events)
+	return match, false, nil
+}
+
+func (s *TournamentService) finishMatch(t *model.Tournament, m *model.TournamentMatch, winner int64, forfeit bool) ([]TournamentEvent, error) {
+	ready, err := t.FinishMatch(m, winner, forfeit)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []TournamentEvent{{
+		Type:         TournamentEventMatchFinished,
+		TournamentID: t.ID,
+		Match:        *m,
+	}}
+	events = append(events, s.readyEvents(t, ready)...)
+
+	if t.Status == model.TournamentStatusFinished {
+		events = append(events, TournamentEvent{
+			Type:         TournamentEventFinished,
+			TournamentID: t.ID,
+			Champion:     t.Champion,
+		})
+	}
+	return events, nil
+}
+
+func (s *TournamentService) readyEvents(t *model.Tournament, ready []*model.TournamentMatch) []TournamentEvent {
+	events := make([]TournamentEvent, 0, len(ready))
+	for _, m := range ready {
+		deadline := m.ReadyAt.Add(t.NoShowTimeout)
+		tournamentID, matchID := t.ID, m.ID
+		time.AfterFunc(t.NoShowTimeout, func() {
+			s.forfeitNoShow(tournamentID, matchID)
+		})
+
+		events = append(events, TournamentEvent{
+			Type:         TournamentEventMatchReady,
+			TournamentID: t.ID,
+			Match:        *m,
+			Deadline:     deadline,
+		})
+	}
+	return events
+}
+
+func (s *TournamentService) forfeitNoShow(id int64, matchID int) {
+	s.mu.Lock()
+	t, ok := s.tournaments[id]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	m := t.GetMatch(matchID)
+	if m == nil || m.Status != model.MatchStatusReady {
+		s.mu.Unlock()
+		return
+	}
+
+	// Both turned up, but over different transports. That must not decide
+	// the match, so they get another check-in period.
+	if m.Present(m.Player1) && m.Present(m.Player2) {
+		m.Renew()
+		events := s.readyEvents(t, []*model.TournamentMatch{m})
+		s.mu.Unlock()
+		s.publish(events)
+		return
+	}
+
+	// When neither player showed up the higher seed advances, so the bracket
+	// always keeps moving.
+	winner := m.Player1
+	if !m.Present(m.Player1) && m.Present(m.Player2) {
+		winner = m.Player2
+	}
+
+	events, err := s.finishMatch(t, m, winner, true)
+	s.mu.Unlock()
+	if err != nil {
+		return
+	}
+
+	s.publish(events)
+}
+
+func (s *TournamentService) publish(events []TournamentEvent) {
+	s.mu.RLock()
+	listeners := make([]func(TournamentEvent), len(s.listeners))
+	copy(listeners, s.listeners)
+	s.mu.RUnlock()
+
+	for _, e := range events {
+		for _, fn := range listeners {
+			fn(e)
+		}
+	}
+}
+
+func loadScores(players []int64) map[int64]int {
+	scores := make(map[int64]int, len(players))
+	for _, p := range players {
+		score, _, _, err := repository.GetUserStats(p)
+		if err != nil {
+			score = 0
+		}
+		scores[p] = score
+	}
+	return scores
+}
+
+// seedByScore orders players by score, highest first. A player who
+// registered after the scores were loaded counts as 0.
+func seedByScore(players []int64, scores map[int64]int) []int64 {
+	seeds := make([]int64, len(players))
+	copy(seeds, players)
+	sort.SliceStable(seeds, func(i, j int) bool {
+		return scores[seeds[i]] > scores[seeds[j]]
+	})
+	return seeds
+}
@@ -1,26 +1,70 @@
 package service
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
 
 	"game-server/internal/model"
 	"game-server/internal/repository"
+	"game-server/pkg/redis"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
-var ErrInvalidPassword = errors.New("invalid password")
+var (
+	ErrNotGuest          = errors.New("account is not a guest")
+	ErrInvalidPassword   = errors.New("invalid password")
+	ErrSamePassword      = errors.New("new password must differ from the old one")
+	ErrResetTokenInvalid = errors.New("invalid or expired reset token")
+)
+
+const (
+	PasswordResetKeyPrefix     = "pwreset:"
+	UserPasswordResetKeyPrefix = "pwreset_user:"
+
+	sessionReasonPasswordChanged = "password changed"
+	sessionReasonPasswordReset   = "password reset"
+
+	// GuestUsernamePrefix starts every generated guest name. Registered
+	// accounts cannot use it.
+	GuestUsernamePrefix = "guest_"
+	guestNameAttempts   = 5
+)
 
-type UserService struct{}
+type UserService struct {
+	moderation  *ModerationService
+	sessions    *SessionService
+	limiter     *LoginLimiter
+	corrService *CorrespondenceService
+}
 
 func NewUserService() *UserService {
-	return &UserService{}
+	return &UserService{
+		moderation:  NewModerationService(),
+		sessions:    NewSessionService(),
+		limiter:     NewLoginLimiter(),
+		corrService: NewCorrespondenceService(),
+	}
 }
 
 func (s *UserService) Register(req *model.UserRegisterRequest) (*model.User, error) {
-	_, err := repository.GetUserByUsername(req.Username)
+	if err := s.limiter.AllowRegister(req.IP); err != nil {
+		return nil, err
+	}
+	username, err := NormalizeUsername(req.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = repository.GetUserByUsername(username)
 	if err == nil {
 		return nil, repository.ErrUserAlreadyExists
 	}
@@ -28,14 +72,19 @@ func (s *UserService) Register(req *model.UserRegisterRequest) (*model.User, err
 		return nil, err
 	}
 
+	if err := ValidatePassword(req.Password, username); err != nil {
+		return nil, err
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, err
 	}
 
 	user := &model.User{
-		Username: req.Username,
+		Username: username,
 		Password: string(hashedPassword),
+		Role:     model.RolePlayer,
 		Score:    1000,
 	}
 
@@ -46,30 +95,329 @@ func (s *UserService) Register(req *model.UserRegisterRequest) (*model.User, err
 	return user, nil
 }
 
-func (s *UserService) Login(req *model.UserLoginRequest) (*model.User, string, error) {
-	user, err := repository.GetUserByUsername(req.Username)
+// Login checks the credentials. The caller starts a session for the user.
+// Failed attempts are counted per username and IP; while either is locked
+// out a *LockoutError is returned without looking at the password.
+func (s *UserService) Login(req *model.UserLoginRequest) (*model.User, error) {
+	username := CanonicalUsername(req.Username)
+	if err := s.limiter.Check(username, req.IP); err != nil {
+		return nil, err
+	}
+
+	user, err := repository.GetUserByUsername(username)
 	if err != nil {
-		return nil, "", err
+		if errors.Is(err, repository.ErrUserNotFound) {
+			if lockErr := s.limiter.Fail(username, req.IP); lockErr != nil {
+				return nil, lockErr
+			}
+		}
+		return nil, err
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		return nil, "", ErrInvalidPassword
+		if lockErr := s.limiter.Fail(username, req.IP); lockErr != nil {
+			return nil, lockErr
+		}
+		return nil, ErrInvalidPassword
+	}
+	s.limiter.Succeed(username)
+
+	if err := s.moderation.CheckLogin(user.ID); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// CreateGuest creates a temporary account with a generated name and no
+// password. Guests count against the registration limit of their IP.
+func (s *UserService) CreateGuest(ip string) (*model.User, error) {
+	if err := s.limiter.AllowRegister(ip); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < guestNameAttempts; i++ {
+		suffix, err := randomHex(4)
+		if err != nil {
+			return nil, err
+		}
+
+		user := &model.User{
+			Username: GuestUsernamePrefix + suffix,
+			Role:     model.RoleGuest,
+			Score:    1000,
+		}
+		err = repository.CreateUser(user)
+		if errors.Is(err, repository.ErrUserAlreadyExists) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+	return nil, errors.New("could not pick a guest name")
+}
+
+// ClaimGuest turns guest userID into a player with the given username and
+// password. The account keeps its ID, so its game history stays. Sessions
+// of the user pick up the new name and role.
+func (s *UserService) ClaimGuest(userID int64, req *model.ClaimAccountRequest) (*model.User, error) {
+	user, err := repository.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role != model.RoleGuest {
+		return nil, ErrNotGuest
+	}
+	username, err := NormalizeUsername(req.Username)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidatePassword(req.Password, username); err != nil {
+		return nil, err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	if err := repository.ClaimGuest(userID, username, string(hash)); err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, ErrNotGuest
+		}
+		return nil, err
+	}
+
+	user.Username = username
+	user.Role = model.RolePlayer
+	if err := s.sessions.UpdateUsername(userID, user.Username); err != nil {
+		log.Printf("Failed to rename sessions of user %d: %v", userID, err)
+	}
+	if err := s.sessions.UpdateRole(userID, user.Role); err != nil {
+		log.Printf("Failed to update sessions of user %d to role %s: %v", userID, user.Role, err)
+	}
+	publishAccountEvent(AccountEvent{UserID: userID, Username: user.Username, Role: user.Role})
+	return user, nil
+}
+
+func isGuestName(username string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(username)), GuestUsernamePrefix)
+}
+
+// UpdateProfile applies the non-nil fields of req to the profile of userID
+// after normalizing and checking them.
+func (s *UserService) UpdateProfile(userID int64, req *model.UpdateProfileRequest) (*model.User, error) {
+	if req.DisplayName == nil && req.AvatarID == nil && req.Country == nil && req.Bio == nil {
+		return nil, ErrEmptyProfileRequest
+	}
+
+	user, err := repository.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.DisplayName != nil {
+		if user.DisplayName, err = NormalizeDisplayName(*req.DisplayName); err != nil {
+			return nil, err
+		}
+		if err := checkDisplayNameOwner(user); err != nil {
+			return nil, err
+		}
+	}
+	if req.AvatarID != nil {
+		if err := ValidateAvatarID(*req.AvatarID); err != nil {
+			return nil, err
+		}
+		user.AvatarID = *req.AvatarID
+	}
+	if req.Country != nil {
+		if user.Country, err = NormalizeCountry(*req.Country); err != nil {
+			return nil, err
+		}
+	}
+	if req.Bio != nil {
+		if user.Bio, err = NormalizeBio(*req.Bio); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := repository.UpdateUserProfile(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// checkDisplayNameOwner stops user from showing up under another
+// account's username.
+func checkDisplayNameOwner(user *model.User) error {
+	if user.DisplayName == "" || strings.EqualFold(user.DisplayName, user.Username) {
+		return nil
+	}
+	other, err := repository.GetUserByUsername(user.DisplayName)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if other.ID != user.ID {
+		return ErrDisplayNameTaken
+	}
+	return nil
+}
+
+// ChangePassword replaces the password of userID after checking the old
+// one, and ends every other session of the user. sessionID and keep are
+// the session and connection making the change; they stay logged in. It
+// returns how many sessions were ended.
+func (s *UserService) ChangePassword(userID int64, sessionID string, keep interface{}, req *model.ChangePasswordRequest) (int, error) {
+	user, err := repository.GetUserByID(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.limiter.Check(user.Username, req.IP); err != nil {
+		return 0, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.OldPassword)); err != nil {
+		if lockErr := s.limiter.Fail(user.Username, req.IP); lockErr != nil {
+			return 0, lockErr
+		}
+		return 0, ErrInvalidPassword
+	}
+	if req.NewPassword == req.OldPassword {
+		return 0, ErrSamePassword
+	}
+
+	if err := s.setPassword(user, req.NewPassword); err != nil {
+		return 0, err
+	}
+	return s.sessions.RevokeAll(userID, sessionID, keep, sessionReasonPasswordChanged)
+}
+
+// RequestPasswordReset sends a one-time reset token for username through
+// the configured ResetNotifier. A new request replaces the previous token.
+// Requests are limited per ip and per username. Unknown usernames are not
+// reported and count the same, so callers cannot probe which accounts
+// exist.
+func (s *UserService) RequestPasswordReset(username, ip string) error {
+	if err := s.limiter.AllowPasswordReset(CanonicalUsername(username), ip); err != nil {
+		return err
+	}
+
+	user, err := repository.GetUserByUsername(CanonicalUsername(username))
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+	if user.Role == model.RoleGuest {
+		// Guests have no password to recover.
+		return nil
 	}
 
 	token, err := generateToken()
 	if err != nil {
-		return nil, "", err
+		return err
 	}
 
-	return user, token, nil
+	ctx := context.Background()
+	ttl := PasswordResetTTL()
+	userKey := fmt.Sprintf("%s%d", UserPasswordResetKeyPrefix, user.ID)
+	tokenKey := resetKey(token)
+
+	if old, err := redis.Client.Get(ctx, userKey).Result(); err == nil {
+		redis.Client.Del(ctx, old)
+	}
+
+	pipe := redis.Client.TxPipeline()
+	pipe.Set(ctx, tokenKey, user.ID, ttl)
+	pipe.Set(ctx, userKey, tokenKey, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	if err := currentResetNotifier().SendPasswordReset(user, token, time.Now().Add(ttl)); err != nil {
+		redis.Client.Del(ctx, tokenKey, userKey)
+		return err
+	}
+	return nil
+}
+
+// ResetPassword sets a new password with a token from RequestPasswordReset.
+// The token works once. All sessions of the user are ended and a login
+// lockout on the username is lifted.
+func (s *UserService) ResetPassword(req *model.PasswordResetConfirm) error {
+	ctx := context.Background()
+	tokenKey := resetKey(req.Token)
+
+	idStr, err := redis.Client.Get(ctx, tokenKey).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return ErrResetTokenInvalid
+		}
+		return err
+	}
+	userID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return ErrResetTokenInvalid
+	}
+
+	user, err := repository.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	// Check the password before using up the token, so a rejected password
+	// can be retried.
+	if err := ValidatePassword(req.NewPassword, user.Username); err != nil {
+		return err
+	}
+
+	n, err := redis.Client.Del(ctx, tokenKey).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrResetTokenInvalid
+	}
+	redis.Client.Del(ctx, fmt.Sprintf("%s%d", UserPasswordResetKeyPrefix, userID))
+
+	if err := s.setPassword(user, req.NewPassword); err != nil {
+		return err
+	}
+	s.limiter.Succeed(user.Username)
+	if _, err := s.sessions.RevokeAll(userID, "", nil, sessionReasonPasswordReset); err != nil {
+		log.Printf("Failed to end sessions of user %d after password reset: %v", userID, err)
+	}
+	return nil
+}
+
+func (s *UserService) setPassword(user *model.User, password string) error {
+	if err := ValidatePassword(password, user.Username); err != nil {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return repository.UpdateUserPassword(user.ID, string(hash))
+}
+
+// resetKey stores reset tokens hashed, like refresh tokens.
+func resetKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return PasswordResetKeyPrefix + hex.EncodeToString(sum[:])
 }
 
 func (s *UserService) GetUserByID(id int64) (*model.User, error) {
 	return repository.GetUserByID(id)
 }
 
-func (s *UserService) UpdateScore(userID int64, scoreDelta int, isWin bool) error {
-	return repository.UpdateUserScore(userID, scoreDelta, isWin)
+func (s *UserService) UpdateScore(userID int64, scoreDelta int, isWin bool, gameType model.GameType, gameID int64) error {
+	return repository.UpdateUserScore(userID, scoreDelta, isWin, gameType, gameID)
 }
 
 func (s *UserService) GetUserStats(userID int64) (score, winCount, loseCount int, err error) {
@@ -1,8 +1,8 @@
 package protocol
 
 import (
-	"encoding/json"
 	"errors"
+	"reflect"
 )
 
 var (
@@ -10,16 +10,43 @@ var (
 	ErrPacketTooLarge = errors.New("packet too large")
 	ErrUnknownMsgType = errors.New("unknown message type")
 	ErrInvalidPayload = errors.New("invalid payload")
+	ErrCompressionOff = errors.New("compression not negotiated")
 )
 
-type Codec struct{}
+// Codec frames messages into packets using one Serializer. A connection
+// starts with JSON and may switch after Hello.
+type Codec struct {
+	serializer Serializer
+	// compressAt is the payload size from which packets are deflated; 0
+	// means compression was not negotiated.
+	compressAt int
+}
 
 func NewCodec() *Codec {
-	return &Codec{}
+	return NewCodecWith(JSON)
+}
+
+func NewCodecWith(s Serializer) *Codec {
+	return &Codec{serializer: s}
+}
+
+func (c *Codec) Serializer() Serializer {
+	return c.serializer
+}
+
+// WithCompression returns a codec that deflates payloads of at least
+// threshold bytes and accepts compressed packets.
+func (c *Codec) WithCompression(threshold int) *Codec {
+	return &Codec{serializer: c.serializer, compressAt: threshold}
+}
+
+// Compresses reports whether compression was negotiated.
+func (c *Codec) Compresses() bool {
+	return c.compressAt > 0
 }
 
 func (c *Codec) Encode(msg Message, seq uint16) ([]byte, error) {
-	payload, err := json.Marshal(msg)
+	payload, err := c.serializer.Marshal(msg)
 	if err != nil {
 		return nil, err
 	}
@@ -28,21 +55,69 @@ func (c *Codec) Encode(msg Message, seq uint16) ([]byte, error) {
 		return nil, ErrPacketTooLarge
 	}
 
+	var flags uint8
+	if c.Compresses() && len(payload) >= c.compressAt {
+		if z, ok := compress(payload); ok {
+			payload = z
+			flags |= FlagCompressed
+		}
+	}
+
 	p := NewPacket(msg.MessageType(), seq, payload)
+	p.Flags = flags
 	return p.Encode()
 }
 
 func (c *Codec) Decode(p *Packet) (Message, error) {
-	if len(p.Payload) == 0 {
-		return nil, ErrInvalidPayload
+	msg, err := newMessage(p.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := p.Payload
+	if p.Flags&FlagCompressed != 0 {
+		if !c.Compresses() {
+			return nil, ErrCompressionOff
+		}
+		if payload, err = decompress(payload); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.serializer.Unmarshal(payload, msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// TypeName returns the Go name of the message registered for t, or
+// "unknown" when the type is not part of the protocol.
+func TypeName(t uint16) string {
+	msg, err := newMessage(t)
+	if err != nil {
+		return "unknown"
 	}
+	return reflect.TypeOf(msg).Elem().Name()
+}
 
+func newMessage(t uint16) (Message, error) {
 	var msg Message
-	switch p.Type {
+	switch t {
 	case TypePing:
 		msg = &PingReq{}
 	case TypePong:
 		msg = &PongResp{}
+	case TypeServerShutdown:
+		msg = &ServerShutdown{}
+	case TypeSystemAnnouncement:
+		msg = &SystemAnnouncement{}
+	case TypeForceDisconnect:
+		msg = &ForceDisconnect{}
+	case TypeHello:
+		msg = &HelloReq{}
+	case TypeHelloResp:
+		msg = &HelloResp{}
 	case TypeLogin:
 		msg = &LoginReq{}
 	case TypeLoginResp:
@@ -51,6 +126,34 @@ func (c *Codec) Decode(p *Packet) (Message, error) {
 		msg = &RegisterReq{}
 	case TypeRegisterResp:
 		msg = &RegisterResp{}
+	case TypeLogout:
+		msg = &LogoutReq{}
+	case TypeLogoutResp:
+		msg = &LogoutResp{}
+	case TypeSessionList:
+		msg = &SessionListReq{}
+	case TypeSessionListResp:
+		msg = &SessionListResp{}
+	case TypeRefreshToken:
+		msg = &RefreshTokenReq{}
+	case TypeRefreshTokenResp:
+		msg = &RefreshTokenResp{}
+	case TypeChangePassword:
+		msg = &ChangePasswordReq{}
+	case TypeChangePasswordResp:
+		msg = &ChangePasswordResp{}
+	case TypeGuestLogin:
+		msg = &GuestLoginReq{}
+	case TypeGuestLoginResp:
+		msg = &GuestLoginResp{}
+	case TypeClaimAccount:
+		msg = &ClaimAccountReq{}
+	case TypeClaimAccountResp:
+		msg = &ClaimAccountResp{}
+	case TypeUpdateProfile:
+		msg = &UpdateProfileReq{}
+	case TypeUpdateProfileResp:
+		msg = &UpdateProfileResp{}
 	case TypeCreateRoom:
 		msg = &CreateRoomReq{}
 	case TypeCreateRoomResp:
@@ -73,6 +176,36 @@ func (c *Codec) Decode(p *Packet) (Message, error) {
 		msg = &PlayerJoin{}
 	case TypePlayerLeave:
 		msg = &PlayerLeave{}
+	case TypeRoomSettings:
+		msg = &RoomSettingsReq{}
+	case TypeRoomSettingsResp:
+		msg = &RoomSettingsResp{}
+	case TypeRoomSettingsUpdate:
+		msg = &RoomSettingsUpdate{}
+	case TypeReady:
+		msg = &ReadyReq{}
+	case TypeReadyResp:
+		msg = &ReadyResp{}
+	case TypeReadyUpdate:
+		msg = &ReadyUpdate{}
+	case TypeKickPlayer:
+		msg = &KickPlayerReq{}
+	case TypeKickPlayerResp:
+		msg = &KickPlayerResp{}
+	case TypeLockRoom:
+		msg = &LockRoomReq{}
+	case TypeLockRoomResp:
+		msg = &LockRoomResp{}
+	case TypeRoomLockUpdate:
+		msg = &RoomLockUpdate{}
+	case TypeRoomOwnerChange:
+		msg = &RoomOwnerChange{}
+	case TypeChat:
+		msg = &ChatReq{}
+	case TypeChatResp:
+		msg = &ChatResp{}
+	case TypeChatMessage:
+		msg = &ChatMessage{}
 	case TypeMove:
 		msg = &MoveReq{}
 	case TypeMoveResp:
@@ -83,10 +216,30 @@ func (c *Codec) Decode(p *Packet) (Message, error) {
 		msg = &GameStart{}
 	case TypeBoardUpdate:
 		msg = &BoardUpdate{}
+	case TypeBoardDelta:
+		msg = &BoardDelta{}
+	case TypeBoardSync:
+		msg = &BoardSyncReq{}
 	case TypeForfeitReq:
 		msg = &ForfeitReq{}
 	case TypeForfeitResp:
 		msg = &ForfeitResp{}
+	case TypeRematchRequest:
+		msg = &RematchRequest{}
+	case TypeRematchAccept:
+		msg = &RematchAccept{}
+	case TypeRematchResp:
+		msg = &RematchResp{}
+	case TypeCorrespondenceList:
+		msg = &CorrespondenceListReq{}
+	case TypeCorrespondenceListResp:
+		msg = &CorrespondenceListResp{}
+	case TypeCorrespondenceOpen:
+		msg = &CorrespondenceOpenReq{}
+	case TypeCorrespondenceOpenResp:
+		msg = &CorrespondenceOpenResp{}
+	case TypeCorrespondenceTurn:
+		msg = &CorrespondenceTurn{}
 	case TypeLeaderboardReq:
 		msg = &LeaderboardReq{}
 	case TypeLeaderboardResp:
@@ -95,16 +248,36 @@ func (c *Codec) Decode(p *Packet) (Message, error) {
 		msg = &UserStatsReq{}
 	case TypeUserStatsResp:
 		msg = &UserStatsResp{}
+	case TypeTournamentCreate:
+		msg = &TournamentCreateReq{}
+	case TypeTournamentCreateResp:
+		msg = &TournamentCreateResp{}
+	case TypeTournamentJoin:
+		msg = &TournamentJoinReq{}
+	case TypeTournamentJoinResp:
+		msg = &TournamentJoinResp{}
+	case TypeTournamentStart:
+		msg = &TournamentStartReq{}
+	case TypeTournamentStartResp:
+		msg = &TournamentStartResp{}
+	case TypeTournamentBracket:
+		msg = &TournamentBracketReq{}
+	case TypeTournamentBracketResp:
+		msg = &TournamentBracketResp{}
+	case TypeTournamentCheckIn:
+		msg = &TournamentCheckInReq{}
+	case TypeTournamentCheckInResp:
+		msg = &TournamentCheckInResp{}
+	case TypeTournamentMatchReady:
+		msg = &TournamentMatchReady{}
+	case TypeTournamentMatchResult:
+		msg = &TournamentMatchResult{}
 	case TypeError:
 		msg = &ErrorResp{}
 	default:
 		return nil, ErrUnknownMsgType
 	}
 
-	if err := json.Unmarshal(p.Payload, msg); err != nil {
-		return nil, err
-	}
-
 	return msg, nil
 }
 
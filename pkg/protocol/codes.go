@@ -0,0 +1,25 @@
+package protocol
+
+// Response codes beyond the HTTP-style ones (200, 400, 401, ...) that
+// clients need to tell apart.
+const (
+	// CodeAccountBanned rejects a login for a permanently banned account.
+	CodeAccountBanned = 4031
+	// CodeAccountSuspended rejects a login until the suspension expires.
+	CodeAccountSuspended = 4032
+	// CodeMuted rejects a chat message from a muted user.
+	CodeMuted = 4033
+
+	// CodeUsernameLocked rejects a login after too many failed attempts
+	// for the username.
+	CodeUsernameLocked = 4291
+	// CodeIPLocked rejects a login after too many failed attempts from
+	// the client's IP.
+	CodeIPLocked = 4292
+	// CodeRegisterLimited rejects a registration from an IP that created
+	// too many accounts recently.
+	CodeRegisterLimited = 4293
+	// CodeResetLimited rejects a password reset request when the IP or the
+	// username asked for too many recently.
+	CodeResetLimited = 4294
+)
@@ -0,0 +1,49 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"sync"
+)
+
+var flateWriters = sync.Pool{
+	New: func() any {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	},
+}
+
+// compress deflates payload. It reports false when that would not make the
+// payload any smaller, as with short or already compact messages.
+func compress(payload []byte) ([]byte, bool) {
+	var buf bytes.Buffer
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+	w.Reset(&buf)
+	if _, err := w.Write(payload); err != nil {
+		return nil, false
+	}
+	if err := w.Close(); err != nil {
+		return nil, false
+	}
+	if buf.Len() >= len(payload) {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// decompress inflates payload. The result is held to MaxBodyLen like an
+// uncompressed payload, so a small packet cannot expand without bound.
+func decompress(payload []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(payload))
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, MaxBodyLen+1))
+	if err != nil {
+		return nil, ErrInvalidPayload
+	}
+	if len(data) > MaxBodyLen {
+		return nil, ErrPacketTooLarge
+	}
+	return data, nil
+}
@@ -0,0 +1,122 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestCodecCompression(t *testing.T) {
+	resp := &LeaderboardResp{Code: 200, Message: "ok"}
+	for i := 0; i < 100; i++ {
+		resp.Ranks = append(resp.Ranks, &RankEntry{UserID: int64(i), Username: fmt.Sprintf("player%d", i), Rank: i + 1})
+	}
+
+	for _, s := range allSerializers {
+		codec := NewCodecWith(s).WithCompression(256)
+		data, err := codec.Encode(resp, 7)
+		if err != nil {
+			t.Fatalf("%s: encode: %v", s.Name(), err)
+		}
+		pkt, err := ReadPacket(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: read: %v", s.Name(), err)
+		}
+		if pkt.Flags&FlagCompressed == 0 {
+			t.Errorf("%s: large payload was not compressed", s.Name())
+		}
+		got, err := codec.Decode(pkt)
+		if err != nil {
+			t.Fatalf("%s: decode: %v", s.Name(), err)
+		}
+		if !reflect.DeepEqual(got, resp) {
+			t.Errorf("%s: compressed round trip changed the message", s.Name())
+		}
+		if _, err := NewCodecWith(s).Decode(pkt); err != ErrCompressionOff {
+			t.Errorf("%s: got %v without negotiated compression, want %v", s.Name(), err, ErrCompressionOff)
+		}
+	}
+}
+
+func TestCodecCompressionThreshold(t *testing.T) {
+	resp := &LeaderboardResp{Code: 200, Message: "ok"}
+
+	for _, s := range allSerializers {
+		codec := NewCodecWith(s).WithCompression(256)
+		data, err := codec.Encode(resp, 7)
+		if err != nil {
+			t.Fatalf("%s: encode: %v", s.Name(), err)
+		}
+		pkt, err := ReadPacket(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: read: %v", s.Name(), err)
+		}
+		if pkt.Flags != 0 {
+			t.Errorf("%s: payload below the threshold sent with flags %#x", s.Name(), pkt.Flags)
+		}
+		if int(pkt.Len) != len(data) {
+			t.Errorf("%s: length %d, want %d", s.Name(), pkt.Len, len(data))
+		}
+		got, err := codec.Decode(pkt)
+		if err != nil {
+			t.Fatalf("%s: decode: %v", s.Name(), err)
+		}
+		if !reflect.DeepEqual(got, resp) {
+			t.Errorf("%s: round trip changed the message", s.Name())
+		}
+	}
+}
+
+func TestDecodeHeaderFlags(t *testing.T) {
+	header := func(word uint32) []byte {
+		buf := make([]byte, HeaderLen)
+		binary.BigEndian.PutUint32(buf[0:4], word)
+		binary.BigEndian.PutUint16(buf[4:6], TypeLeaderboardResp)
+		return buf
+	}
+
+	p, err := DecodeHeader(bytes.NewReader(header(uint32(FlagCompressed)<<24 | 300)))
+	if err != nil {
+		t.Fatalf("compressed header: %v", err)
+	}
+	if p.Len != 300 || p.Flags != FlagCompressed {
+		t.Errorf("got length %d flags %#x, want 300 and %#x", p.Len, p.Flags, FlagCompressed)
+	}
+
+	if _, err := DecodeHeader(bytes.NewReader(header(1<<31 | 300))); err != ErrInvalidPacket {
+		t.Errorf("unknown flag: got %v, want %v", err, ErrInvalidPacket)
+	}
+}
+
+func TestDecompressLimit(t *testing.T) {
+	deflate := func(n int) []byte {
+		var buf bytes.Buffer
+		w, _ := flate.NewWriter(&buf, flate.BestCompression)
+		w.Write(make([]byte, n))
+		w.Close()
+		return buf.Bytes()
+	}
+
+	if data, err := decompress(deflate(MaxBodyLen)); err != nil || len(data) != MaxBodyLen {
+		t.Errorf("payload of MaxBodyLen: got %d bytes, %v", len(data), err)
+	}
+
+	// A few hundred bytes of zeros on the wire that inflate past the limit.
+	bomb := deflate(MaxBodyLen + 1)
+	if _, err := decompress(bomb); err != ErrPacketTooLarge {
+		t.Errorf("oversized payload: got %v, want %v", err, ErrPacketTooLarge)
+	}
+
+	p := NewPacket(TypeLeaderboardResp, 1, bomb)
+	p.Flags = FlagCompressed
+	if _, err := NewCodecWith(JSON).WithCompression(256).Decode(p); err != ErrPacketTooLarge {
+		t.Errorf("decode oversized payload: got %v, want %v", err, ErrPacketTooLarge)
+	}
+
+	if _, err := decompress([]byte("not deflate")); err != ErrInvalidPayload {
+		t.Errorf("corrupt payload: got %v, want %v", err, ErrInvalidPayload)
+	}
+}
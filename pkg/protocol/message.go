@@ -3,6 +3,7 @@ package protocol
 const (
 	TypePing            uint16 = 1000
 	TypePong            uint16 = 1001
+	TypeServerShutdown  uint16 = 1002
 	TypeLogin           uint16 = 2001
 	TypeLoginResp       uint16 = 2002
 	TypeRegister        uint16 = 2003
@@ -29,26 +30,325 @@ const (
 	TypeLeaderboardResp uint16 = 5002
 	TypeUserStatsReq    uint16 = 5003
 	TypeUserStatsResp   uint16 = 5004
-	TypeError           uint16 = 9999
+
+	TypeRematchRequest uint16 = 4008
+	TypeRematchAccept  uint16 = 4009
+	TypeRematchResp    uint16 = 4010
+	TypeBoardDelta     uint16 = 4011
+	TypeBoardSync      uint16 = 4012
+
+	TypeRoomSettings       uint16 = 3101
+	TypeRoomSettingsResp   uint16 = 3102
+	TypeRoomSettingsUpdate uint16 = 3103
+	TypeReady              uint16 = 3104
+	TypeReadyResp          uint16 = 3105
+	TypeReadyUpdate        uint16 = 3106
+	TypeKickPlayer         uint16 = 3107
+	TypeKickPlayerResp     uint16 = 3108
+	TypeLockRoom           uint16 = 3109
+	TypeLockRoomResp       uint16 = 3110
+	TypeRoomLockUpdate     uint16 = 3111
+	TypeRoomOwnerChange    uint16 = 3112
+
+	TypeChat        uint16 = 3201
+	TypeChatResp    uint16 = 3202
+	TypeChatMessage uint16 = 3203
+
+	TypeCorrespondenceList     uint16 = 4101
+	TypeCorrespondenceListResp uint16 = 4102
+	TypeCorrespondenceOpen     uint16 = 4103
+	TypeCorrespondenceOpenResp uint16 = 4104
+	TypeCorrespondenceTurn     uint16 = 4105
+
+	TypeTournamentCreate      uint16 = 6001
+	TypeTournamentCreateResp  uint16 = 6002
+	TypeTournamentJoin        uint16 = 6003
+	TypeTournamentJoinResp    uint16 = 6004
+	TypeTournamentStart       uint16 = 6005
+	TypeTournamentStartResp   uint16 = 6006
+	TypeTournamentBracket     uint16 = 6007
+	TypeTournamentBracketResp uint16 = 6008
+	TypeTournamentCheckIn     uint16 = 6009
+	TypeTournamentCheckInResp uint16 = 6010
+	TypeTournamentMatchReady  uint16 = 6011
+	TypeTournamentMatchResult uint16 = 6012
+
+	TypeSystemAnnouncement uint16 = 1003
+	TypeForceDisconnect    uint16 = 1004
+	TypeHello              uint16 = 1005
+	TypeHelloResp          uint16 = 1006
+
+	TypeLogout          uint16 = 2005
+	TypeLogoutResp      uint16 = 2006
+	TypeSessionList     uint16 = 2007
+	TypeSessionListResp uint16 = 2008
+
+	TypeRefreshToken     uint16 = 2009
+	TypeRefreshTokenResp uint16 = 2010
+
+	TypeChangePassword     uint16 = 2011
+	TypeChangePasswordResp uint16 = 2012
+
+	TypeGuestLogin       uint16 = 2013
+	TypeGuestLoginResp   uint16 = 2014
+	TypeClaimAccount     uint16 = 2015
+	TypeClaimAccountResp uint16 = 2016
+
+	TypeUpdateProfile     uint16 = 2017
+	TypeUpdateProfileResp uint16 = 2018
+
+	TypeError uint16 = 9999
 )
 
 type Message interface {
 	MessageType() uint16
 }
 
+type ServerShutdown struct {
+	Message  string `json:"message"`
+	Deadline int64  `json:"deadline"`
+}
+
+func (m *ServerShutdown) MessageType() uint16 { return TypeServerShutdown }
+
+// SystemAnnouncement is an operator message pushed to every connection.
+type SystemAnnouncement struct {
+	Message   string `json:"message"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+func (m *SystemAnnouncement) MessageType() uint16 { return TypeSystemAnnouncement }
+
+// ForceDisconnect is sent right before the server closes a connection on an
+// operator's request.
+type ForceDisconnect struct {
+	Reason string `json:"reason"`
+}
+
+func (m *ForceDisconnect) MessageType() uint16 { return TypeForceDisconnect }
+
+// Protocol versions. Version 1 is the protocol before Hello existed; a
+// connection that never sends Hello is treated as version 1.
+const (
+	ProtocolVersion1 = 1
+	ProtocolVersion  = 2
+)
+
+// Optional features a client can ask for in Hello.
+const (
+	// FeatureChat delivers ChatMessage pushes. Clients without a chat view
+	// leave it out.
+	FeatureChat = "chat"
+	// FeatureDeltaBoard replaces the full BoardUpdate after each move with
+	// a BoardDelta. Snapshots are still sent as BoardUpdate.
+	FeatureDeltaBoard = "delta_board"
+	// FeatureCompression lets both sides deflate packet payloads and mark
+	// them with FlagCompressed. TCP only; WebSocket connections use
+	// permessage-deflate instead.
+	FeatureCompression = "compression"
+)
+
+// HelloReq opens a connection. Codecs lists the payload formats the client
+// can use, most preferred first, and Features the optional features it
+// understands. Hello and its response are JSON; every later packet uses
+// the codec named in HelloResp.
+type HelloReq struct {
+	Codecs        []string `json:"codecs,omitempty"`
+	Version       int      `json:"version"`
+	Client        string   `json:"client,omitempty"`
+	ClientVersion string   `json:"client_version,omitempty"`
+	Features      []string `json:"features,omitempty"`
+}
+
+func (m *HelloReq) MessageType() uint16 { return TypeHello }
+
+// HelloResp answers Hello with the server's protocol version range, the
+// chosen codec and the features both sides support. A version outside
+// MinVersion-Version is rejected with 426 and the connection is closed.
+type HelloResp struct {
+	Code       int      `json:"code"`
+	Message    string   `json:"message"`
+	Codec      string   `json:"codec"`
+	Version    int      `json:"version"`
+	MinVersion int      `json:"min_version"`
+	Features   []string `json:"features,omitempty"`
+	// CompressThreshold is the payload size from which the server
+	// compresses packets, set when FeatureCompression was agreed on.
+	CompressThreshold int `json:"compress_threshold,omitempty"`
+}
+
+func (m *HelloResp) MessageType() uint16 { return TypeHelloResp }
+
 type LoginReq struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Token    string `json:"token,omitempty"`
+	// Device is a free-form label shown in the user's session list.
+	Device string `json:"device,omitempty"`
 }
 
 func (m *LoginReq) MessageType() uint16 { return TypeLogin }
 
+// LogoutReq ends the current session. With All set it ends every session
+// of the user; with SessionID set it ends that other session instead and
+// the current connection stays logged in.
+type LogoutReq struct {
+	All       bool   `json:"all,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+}
+
+func (m *LogoutReq) MessageType() uint16 { return TypeLogout }
+
+type LogoutResp struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Revoked int    `json:"revoked"`
+}
+
+func (m *LogoutResp) MessageType() uint16 { return TypeLogoutResp }
+
+type SessionListReq struct{}
+
+func (m *SessionListReq) MessageType() uint16 { return TypeSessionList }
+
+type SessionInfo struct {
+	ID        string `json:"id"`
+	Device    string `json:"device"`
+	IP        string `json:"ip"`
+	CreatedAt int64  `json:"created_at"`
+	Current   bool   `json:"current"`
+}
+
+type SessionListResp struct {
+	Code     int            `json:"code"`
+	Message  string         `json:"message"`
+	Sessions []*SessionInfo `json:"sessions"`
+}
+
+func (m *SessionListResp) MessageType() uint16 { return TypeSessionListResp }
+
+// RefreshTokenReq trades a refresh token for a new access and refresh
+// token. It does not need a login, so a client whose access token expired
+// can renew it before logging in with the new one.
+type RefreshTokenReq struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (m *RefreshTokenReq) MessageType() uint16 { return TypeRefreshToken }
+
+type RefreshTokenResp struct {
+	Code         int    `json:"code"`
+	Message      string `json:"message"`
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+}
+
+func (m *RefreshTokenResp) MessageType() uint16 { return TypeRefreshTokenResp }
+
+// ChangePasswordReq sets a new password. Every other session of the user
+// is ended; this connection stays logged in.
+type ChangePasswordReq struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+func (m *ChangePasswordReq) MessageType() uint16 { return TypeChangePassword }
+
+type ChangePasswordResp struct {
+	Code       int    `json:"code"`
+	Message    string `json:"message"`
+	Revoked    int    `json:"revoked"`
+	RetryAfter int64  `json:"retry_after,omitempty"`
+}
+
+func (m *ChangePasswordResp) MessageType() uint16 { return TypeChangePasswordResp }
+
+// GuestLoginReq creates a temporary account and logs in to it. Guests can
+// only play casual games.
+type GuestLoginReq struct {
+	Device string `json:"device,omitempty"`
+}
+
+func (m *GuestLoginReq) MessageType() uint16 { return TypeGuestLogin }
+
+type GuestLoginResp struct {
+	Code         int    `json:"code"`
+	Message      string `json:"message"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	UserID       int64  `json:"user_id,omitempty"`
+	Username     string `json:"username,omitempty"`
+	Role         string `json:"role,omitempty"`
+	RetryAfter   int64  `json:"retry_after,omitempty"`
+}
+
+func (m *GuestLoginResp) MessageType() uint16 { return TypeGuestLoginResp }
+
+// ClaimAccountReq turns the guest account of the connection into a regular
+// one. Games played as a guest are kept.
+type ClaimAccountReq struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (m *ClaimAccountReq) MessageType() uint16 { return TypeClaimAccount }
+
+type ClaimAccountResp struct {
+	Code     int    `json:"code"`
+	Message  string `json:"message"`
+	Username string `json:"username,omitempty"`
+	Role     string `json:"role,omitempty"`
+	// Token is a new access token carrying the claimed name.
+	Token     string `json:"token,omitempty"`
+	ExpiresIn int64  `json:"expires_in,omitempty"`
+}
+
+func (m *ClaimAccountResp) MessageType() uint16 { return TypeClaimAccountResp }
+
+// UpdateProfileReq changes the profile of the logged-in user. Omitted
+// fields are kept; an empty string clears a field.
+type UpdateProfileReq struct {
+	DisplayName *string `json:"display_name,omitempty"`
+	AvatarID    *int    `json:"avatar_id,omitempty"`
+	Country     *string `json:"country,omitempty"`
+	Bio         *string `json:"bio,omitempty"`
+}
+
+func (m *UpdateProfileReq) MessageType() uint16 { return TypeUpdateProfile }
+
+type ProfileInfo struct {
+	UserID      int64  `json:"user_id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	AvatarID    int    `json:"avatar_id"`
+	Country     string `json:"country"`
+	Bio         string `json:"bio"`
+}
+
+type UpdateProfileResp struct {
+	Code    int          `json:"code"`
+	Message string       `json:"message"`
+	Profile *ProfileInfo `json:"profile,omitempty"`
+}
+
+func (m *UpdateProfileResp) MessageType() uint16 { return TypeUpdateProfileResp }
+
 type LoginResp struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
-	Token   string `json:"token,omitempty"`
-	UserID  int64  `json:"user_id,omitempty"`
+	// Token is a short-lived access token for logging in again.
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// ExpiresIn is the access token lifetime in seconds.
+	ExpiresIn int64         `json:"expires_in,omitempty"`
+	UserID    int64         `json:"user_id,omitempty"`
+	Role      string        `json:"role,omitempty"`
+	Sanction  *SanctionInfo `json:"sanction,omitempty"`
+	// RetryAfter is set with the lockout codes: seconds until the next
+	// attempt is allowed.
+	RetryAfter int64 `json:"retry_after,omitempty"`
 }
 
 func (m *LoginResp) MessageType() uint16 { return TypeLoginResp }
@@ -61,15 +361,18 @@ type RegisterReq struct {
 func (m *RegisterReq) MessageType() uint16 { return TypeRegister }
 
 type RegisterResp struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
-	UserID  int64  `json:"user_id,omitempty"`
+	Code       int    `json:"code"`
+	Message    string `json:"message"`
+	UserID     int64  `json:"user_id,omitempty"`
+	RetryAfter int64  `json:"retry_after,omitempty"`
 }
 
 func (m *RegisterResp) MessageType() uint16 { return TypeRegisterResp }
 
 type CreateRoomReq struct {
-	RoomName string `json:"room_name"`
+	RoomName       string `json:"room_name"`
+	Correspondence bool   `json:"correspondence,omitempty"`
+	DaysPerMove    int    `json:"days_per_move,omitempty"`
 }
 
 func (m *CreateRoomReq) MessageType() uint16 { return TypeCreateRoom }
@@ -122,15 +425,155 @@ type RoomListResp struct {
 func (m *RoomListResp) MessageType() uint16 { return TypeRoomListResp }
 
 type RoomInfo struct {
-	RoomID    int64   `json:"room_id"`
-	RoomName  string  `json:"room_name"`
-	Players   []int64 `json:"players"`
-	CreatorID int64   `json:"creator_id"`
-	Status    int     `json:"status"`
+	RoomID         int64         `json:"room_id"`
+	RoomName       string        `json:"room_name"`
+	Players        []int64       `json:"players"`
+	CreatorID      int64         `json:"creator_id"`
+	Status         int           `json:"status"`
+	Correspondence bool          `json:"correspondence,omitempty"`
+	DaysPerMove    int           `json:"days_per_move,omitempty"`
+	Settings       *RoomSettings `json:"settings,omitempty"`
+	Ready          []int64       `json:"ready,omitempty"`
+	Locked         bool          `json:"locked,omitempty"`
 }
 
 func (m *RoomInfo) MessageType() uint16 { return TypeRoomInfo }
 
+type RoomSettings struct {
+	RuleSet       string `json:"rule_set"`
+	BoardSize     int    `json:"board_size"`
+	MoveTimeLimit int    `json:"move_time_limit"`
+	Rated         bool   `json:"rated"`
+	CreatorColor  string `json:"creator_color"`
+}
+
+type RoomSettingsReq struct {
+	RoomID   int64        `json:"room_id"`
+	Settings RoomSettings `json:"settings"`
+}
+
+func (m *RoomSettingsReq) MessageType() uint16 { return TypeRoomSettings }
+
+type RoomSettingsResp struct {
+	Code     int           `json:"code"`
+	Message  string        `json:"message"`
+	RoomID   int64         `json:"room_id,omitempty"`
+	Settings *RoomSettings `json:"settings,omitempty"`
+}
+
+func (m *RoomSettingsResp) MessageType() uint16 { return TypeRoomSettingsResp }
+
+type RoomSettingsUpdate struct {
+	RoomID   int64         `json:"room_id"`
+	Settings *RoomSettings `json:"settings"`
+}
+
+func (m *RoomSettingsUpdate) MessageType() uint16 { return TypeRoomSettingsUpdate }
+
+type ReadyReq struct {
+	RoomID int64 `json:"room_id"`
+	Ready  bool  `json:"ready"`
+}
+
+func (m *ReadyReq) MessageType() uint16 { return TypeReady }
+
+type ReadyResp struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	RoomID  int64  `json:"room_id,omitempty"`
+	Ready   bool   `json:"ready"`
+}
+
+func (m *ReadyResp) MessageType() uint16 { return TypeReadyResp }
+
+type ReadyUpdate struct {
+	RoomID int64   `json:"room_id"`
+	UserID int64   `json:"user_id"`
+	Ready  []int64 `json:"ready"`
+}
+
+func (m *ReadyUpdate) MessageType() uint16 { return TypeReadyUpdate }
+
+type KickPlayerReq struct {
+	RoomID int64 `json:"room_id"`
+	UserID int64 `json:"user_id"`
+}
+
+func (m *KickPlayerReq) MessageType() uint16 { return TypeKickPlayer }
+
+type KickPlayerResp struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	RoomID  int64  `json:"room_id,omitempty"`
+	UserID  int64  `json:"user_id,omitempty"`
+}
+
+func (m *KickPlayerResp) MessageType() uint16 { return TypeKickPlayerResp }
+
+type LockRoomReq struct {
+	RoomID int64 `json:"room_id"`
+	Locked bool  `json:"locked"`
+}
+
+func (m *LockRoomReq) MessageType() uint16 { return TypeLockRoom }
+
+type LockRoomResp struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	RoomID  int64  `json:"room_id,omitempty"`
+	Locked  bool   `json:"locked"`
+}
+
+func (m *LockRoomResp) MessageType() uint16 { return TypeLockRoomResp }
+
+type RoomLockUpdate struct {
+	RoomID int64 `json:"room_id"`
+	Locked bool  `json:"locked"`
+}
+
+func (m *RoomLockUpdate) MessageType() uint16 { return TypeRoomLockUpdate }
+
+type RoomOwnerChange struct {
+	RoomID      int64 `json:"room_id"`
+	OwnerID     int64 `json:"owner_id"`
+	PrevOwnerID int64 `json:"prev_owner_id"`
+}
+
+func (m *RoomOwnerChange) MessageType() uint16 { return TypeRoomOwnerChange }
+
+// SanctionInfo explains a CodeAccountBanned, CodeAccountSuspended or
+// CodeMuted response. ExpiresAt is a Unix timestamp, 0 if it never expires.
+type SanctionInfo struct {
+	Kind      string `json:"kind"`
+	Reason    string `json:"reason,omitempty"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+}
+
+type ChatReq struct {
+	RoomID  int64  `json:"room_id"`
+	Content string `json:"content"`
+}
+
+func (m *ChatReq) MessageType() uint16 { return TypeChat }
+
+type ChatResp struct {
+	Code     int           `json:"code"`
+	Message  string        `json:"message"`
+	Sanction *SanctionInfo `json:"sanction,omitempty"`
+}
+
+func (m *ChatResp) MessageType() uint16 { return TypeChatResp }
+
+type ChatMessage struct {
+	RoomID    int64  `json:"room_id"`
+	UserID    int64  `json:"user_id"`
+	Username  string `json:"username"`
+	Content   string `json:"content"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+func (m *ChatMessage) MessageType() uint16 { return TypeChatMessage }
+
 type PlayerJoin struct {
 	RoomID   int64  `json:"room_id"`
 	UserID   int64  `json:"user_id"`
@@ -165,18 +608,29 @@ type MoveResp struct {
 
 func (m *MoveResp) MessageType() uint16 { return TypeMoveResp }
 
+type SeriesScore struct {
+	Players []int64 `json:"players"`
+	Wins    []int   `json:"wins"`
+	Draws   int     `json:"draws"`
+	Games   int     `json:"games"`
+}
+
 type GameOver struct {
-	Winner  int64 `json:"winner"`
-	RoomID  int64 `json:"room_id"`
-	WinLine []int `json:"win_line,omitempty"`
+	Winner  int64        `json:"winner"`
+	RoomID  int64        `json:"room_id"`
+	WinLine []int        `json:"win_line,omitempty"`
+	Reason  string       `json:"reason,omitempty"`
+	Series  *SeriesScore `json:"series,omitempty"`
 }
 
 func (m *GameOver) MessageType() uint16 { return TypeGameOver }
 
 type GameStart struct {
-	RoomID      int64   `json:"room_id"`
-	Players     []int64 `json:"players"`
-	FirstPlayer int64   `json:"first_player"`
+	RoomID      int64         `json:"room_id"`
+	Players     []int64       `json:"players"`
+	FirstPlayer int64         `json:"first_player"`
+	Settings    *RoomSettings `json:"settings,omitempty"`
+	Series      *SeriesScore  `json:"series,omitempty"`
 }
 
 func (m *GameStart) MessageType() uint16 { return TypeGameStart }
@@ -188,10 +642,33 @@ type BoardUpdate struct {
 	LastY         int     `json:"last_y"`
 	LastPlayer    int64   `json:"last_player"`
 	CurrentPlayer int64   `json:"current_player"`
+	MoveNumber    int     `json:"move_number"`
 }
 
 func (m *BoardUpdate) MessageType() uint16 { return TypeBoardUpdate }
 
+// BoardDelta is the one stone a move added. MoveNumber counts the stones on
+// the board, so the first move is 1 and each delta is one more than the
+// last; a client that sees a gap asks for a BoardSync.
+type BoardDelta struct {
+	RoomID        int64 `json:"room_id"`
+	MoveNumber    int   `json:"move_number"`
+	X             int   `json:"x"`
+	Y             int   `json:"y"`
+	Stone         int   `json:"stone"`
+	Player        int64 `json:"player"`
+	CurrentPlayer int64 `json:"current_player"`
+}
+
+func (m *BoardDelta) MessageType() uint16 { return TypeBoardDelta }
+
+// BoardSyncReq asks for a full BoardUpdate of a room's game.
+type BoardSyncReq struct {
+	RoomID int64 `json:"room_id"`
+}
+
+func (m *BoardSyncReq) MessageType() uint16 { return TypeBoardSync }
+
 type ForfeitReq struct {
 	RoomID int64 `json:"room_id"`
 }
@@ -206,6 +683,27 @@ type ForfeitResp struct {
 
 func (m *ForfeitResp) MessageType() uint16 { return TypeForfeitResp }
 
+type RematchRequest struct {
+	RoomID   int64 `json:"room_id"`
+	FromUser int64 `json:"from_user,omitempty"`
+}
+
+func (m *RematchRequest) MessageType() uint16 { return TypeRematchRequest }
+
+type RematchAccept struct {
+	RoomID int64 `json:"room_id"`
+}
+
+func (m *RematchAccept) MessageType() uint16 { return TypeRematchAccept }
+
+type RematchResp struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	RoomID  int64  `json:"room_id,omitempty"`
+}
+
+func (m *RematchResp) MessageType() uint16 { return TypeRematchResp }
+
 type ErrorResp struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
@@ -229,13 +727,14 @@ type LeaderboardReq struct {
 func (m *LeaderboardReq) MessageType() uint16 { return TypeLeaderboardReq }
 
 type RankEntry struct {
-	UserID    int64  `json:"user_id"`
-	Username  string `json:"username"`
-	Score     int    `json:"score"`
-	WinCount  int    `json:"win_count"`
-	LoseCount int    `json:"lose_count"`
-	WinRate   string `json:"win_rate"`
-	Rank      int    `json:"rank"`
+	UserID      int64  `json:"user_id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name,omitempty"`
+	Score       int    `json:"score"`
+	WinCount    int    `json:"win_count"`
+	LoseCount   int    `json:"lose_count"`
+	WinRate     string `json:"win_rate"`
+	Rank        int    `json:"rank"`
 }
 
 type LeaderboardResp struct {
@@ -253,15 +752,188 @@ type UserStatsReq struct {
 func (m *UserStatsReq) MessageType() uint16 { return TypeUserStatsReq }
 
 type UserStatsResp struct {
-	Code      int    `json:"code"`
-	Message   string `json:"message"`
-	UserID    int64  `json:"user_id,omitempty"`
-	Username  string `json:"username,omitempty"`
-	Score     int    `json:"score,omitempty"`
-	WinCount  int    `json:"win_count,omitempty"`
-	LoseCount int    `json:"lose_count,omitempty"`
-	WinRate   string `json:"win_rate,omitempty"`
-	Rank      int    `json:"rank,omitempty"`
+	Code        int    `json:"code"`
+	Message     string `json:"message"`
+	UserID      int64  `json:"user_id,omitempty"`
+	Username    string `json:"username,omitempty"`
+	DisplayName string `json:"display_name,omitempty"`
+	AvatarID    int    `json:"avatar_id,omitempty"`
+	Country     string `json:"country,omitempty"`
+	Bio         string `json:"bio,omitempty"`
+	Score       int    `json:"score,omitempty"`
+	WinCount    int    `json:"win_count,omitempty"`
+	LoseCount   int    `json:"lose_count,omitempty"`
+	WinRate     string `json:"win_rate,omitempty"`
+	Rank        int    `json:"rank,omitempty"`
 }
 
 func (m *UserStatsResp) MessageType() uint16 { return TypeUserStatsResp }
+
+type TournamentCreateReq struct {
+	Name          string `json:"name"`
+	Format        int    `json:"format"`
+	MaxPlayers    int    `json:"max_players,omitempty"`
+	NoShowSeconds int    `json:"no_show_seconds,omitempty"`
+}
+
+func (m *TournamentCreateReq) MessageType() uint16 { return TypeTournamentCreate }
+
+type TournamentCreateResp struct {
+	Code         int    `json:"code"`
+	Message      string `json:"message"`
+	TournamentID int64  `json:"tournament_id,omitempty"`
+}
+
+func (m *TournamentCreateResp) MessageType() uint16 { return TypeTournamentCreateResp }
+
+type TournamentJoinReq struct {
+	TournamentID int64 `json:"tournament_id"`
+}
+
+func (m *TournamentJoinReq) MessageType() uint16 { return TypeTournamentJoin }
+
+type TournamentJoinResp struct {
+	Code         int    `json:"code"`
+	Message      string `json:"message"`
+	TournamentID int64  `json:"tournament_id,omitempty"`
+}
+
+func (m *TournamentJoinResp) MessageType() uint16 { return TypeTournamentJoinResp }
+
+type TournamentStartReq struct {
+	TournamentID int64 `json:"tournament_id"`
+}
+
+func (m *TournamentStartReq) MessageType() uint16 { return TypeTournamentStart }
+
+type TournamentStartResp struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (m *TournamentStartResp) MessageType() uint16 { return TypeTournamentStartResp }
+
+type TournamentBracketReq struct {
+	TournamentID int64 `json:"tournament_id"`
+}
+
+func (m *TournamentBracketReq) MessageType() uint16 { return TypeTournamentBracket }
+
+type TournamentMatchInfo struct {
+	MatchID int    `json:"match_id"`
+	Bracket string `json:"bracket"`
+	Round   int    `json:"round"`
+	Player1 int64  `json:"player1"`
+	Player2 int64  `json:"player2"`
+	Black   int64  `json:"black"`
+	Winner  int64  `json:"winner"`
+	Status  int    `json:"status"`
+	Games   int    `json:"games"`
+	Bye     bool   `json:"bye,omitempty"`
+	Forfeit bool   `json:"forfeit,omitempty"`
+}
+
+type TournamentRoundInfo struct {
+	Bracket string                 `json:"bracket"`
+	Round   int                    `json:"round"`
+	Matches []*TournamentMatchInfo `json:"matches"`
+}
+
+type TournamentBracketResp struct {
+	Code         int                    `json:"code"`
+	Message      string                 `json:"message"`
+	TournamentID int64                  `json:"tournament_id,omitempty"`
+	Name         string                 `json:"name,omitempty"`
+	Format       int                    `json:"format"`
+	Status       int                    `json:"status"`
+	Seeds        []int64                `json:"seeds,omitempty"`
+	Rounds       []*TournamentRoundInfo `json:"rounds,omitempty"`
+	Champion     int64                  `json:"champion,omitempty"`
+}
+
+func (m *TournamentBracketResp) MessageType() uint16 { return TypeTournamentBracketResp }
+
+type TournamentCheckInReq struct {
+	TournamentID int64 `json:"tournament_id"`
+	MatchID      int   `json:"match_id"`
+}
+
+func (m *TournamentCheckInReq) MessageType() uint16 { return TypeTournamentCheckIn }
+
+type TournamentCheckInResp struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	RoomID  int64  `json:"room_id,omitempty"`
+}
+
+func (m *TournamentCheckInResp) MessageType() uint16 { return TypeTournamentCheckInResp }
+
+type TournamentMatchReady struct {
+	TournamentID int64 `json:"tournament_id"`
+	MatchID      int   `json:"match_id"`
+	Opponent     int64 `json:"opponent"`
+	Black        int64 `json:"black"`
+	Deadline     int64 `json:"deadline"`
+}
+
+func (m *TournamentMatchReady) MessageType() uint16 { return TypeTournamentMatchReady }
+
+type TournamentMatchResult struct {
+	TournamentID int64 `json:"tournament_id"`
+	MatchID      int   `json:"match_id"`
+	Winner       int64 `json:"winner"`
+	Loser        int64 `json:"loser"`
+	Forfeit      bool  `json:"forfeit,omitempty"`
+	Tiebreak     bool  `json:"tiebreak,omitempty"`
+	Champion     int64 `json:"champion,omitempty"`
+}
+
+func (m *TournamentMatchResult) MessageType() uint16 { return TypeTournamentMatchResult }
+
+type CorrespondenceGameInfo struct {
+	GameID      int64 `json:"game_id"`
+	RoomID      int64 `json:"room_id,omitempty"`
+	Black       int64 `json:"black"`
+	White       int64 `json:"white"`
+	Opponent    int64 `json:"opponent"`
+	DaysPerMove int   `json:"days_per_move"`
+	MoveCount   int   `json:"move_count"`
+	LastX       int   `json:"last_x"`
+	LastY       int   `json:"last_y"`
+	YourTurn    bool  `json:"your_turn"`
+	Deadline    int64 `json:"deadline"`
+	Finished    bool  `json:"finished,omitempty"`
+	Winner      int64 `json:"winner,omitempty"`
+}
+
+type CorrespondenceListReq struct{}
+
+func (m *CorrespondenceListReq) MessageType() uint16 { return TypeCorrespondenceList }
+
+type CorrespondenceListResp struct {
+	Code    int                       `json:"code"`
+	Message string                    `json:"message"`
+	Games   []*CorrespondenceGameInfo `json:"games,omitempty"`
+}
+
+func (m *CorrespondenceListResp) MessageType() uint16 { return TypeCorrespondenceListResp }
+
+type CorrespondenceOpenReq struct {
+	GameID int64 `json:"game_id"`
+}
+
+func (m *CorrespondenceOpenReq) MessageType() uint16 { return TypeCorrespondenceOpen }
+
+type CorrespondenceOpenResp struct {
+	Code    int                     `json:"code"`
+	Message string                  `json:"message"`
+	Game    *CorrespondenceGameInfo `json:"game,omitempty"`
+}
+
+func (m *CorrespondenceOpenResp) MessageType() uint16 { return TypeCorrespondenceOpenResp }
+
+type CorrespondenceTurn struct {
+	Games []*CorrespondenceGameInfo `json:"games"`
+}
+
+func (m *CorrespondenceTurn) MessageType() uint16 { return TypeCorrespondenceTurn }
@@ -10,8 +10,20 @@ const (
 	MaxBodyLen = 65535
 )
 
+// The top byte of the length word holds flags; packets never come near
+// the 16 MiB the remaining 24 bits can describe.
+const (
+	lenMask = 1<<24 - 1
+
+	// FlagCompressed marks a payload deflated with compress/flate.
+	FlagCompressed uint8 = 1 << 0
+
+	knownFlags = FlagCompressed
+)
+
 type Packet struct {
 	Len     uint32
+	Flags   uint8
 	Type    uint16
 	Seq     uint16
 	Payload []byte
@@ -27,8 +39,11 @@ func NewPacket(msgType uint16, seq uint16, payload []byte) *Packet {
 }
 
 func (p *Packet) Encode() ([]byte, error) {
+	if p.Len > lenMask {
+		return nil, ErrPacketTooLarge
+	}
 	buf := make([]byte, HeaderLen+len(p.Payload))
-	binary.BigEndian.PutUint32(buf[0:4], p.Len)
+	binary.BigEndian.PutUint32(buf[0:4], p.Len|uint32(p.Flags)<<24)
 	binary.BigEndian.PutUint16(buf[4:6], p.Type)
 	binary.BigEndian.PutUint16(buf[6:8], p.Seq)
 	copy(buf[HeaderLen:], p.Payload)
@@ -41,13 +56,15 @@ func DecodeHeader(r io.Reader) (*Packet, error) {
 		return nil, err
 	}
 
+	word := binary.BigEndian.Uint32(header[0:4])
 	p := &Packet{
-		Len:  binary.BigEndian.Uint32(header[0:4]),
-		Type: binary.BigEndian.Uint16(header[4:6]),
-		Seq:  binary.BigEndian.Uint16(header[6:8]),
+		Len:   word & lenMask,
+		Flags: uint8(word >> 24),
+		Type:  binary.BigEndian.Uint16(header[4:6]),
+		Seq:   binary.BigEndian.Uint16(header[6:8]),
 	}
 
-	if p.Len < HeaderLen {
+	if p.Len < HeaderLen || p.Flags&^knownFlags != 0 {
 		return nil, ErrInvalidPacket
 	}
 
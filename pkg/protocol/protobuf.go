@@ -0,0 +1,367 @@
+package protocol
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protobufSerializer writes messages in the protobuf wire format without
+// generated code. The schema follows the Go structs:
+//
+//   - the field number is the field's position in the struct, counting
+//     from 1, so new fields must only ever be appended;
+//   - int and int64 are int64, uint16 is uint32, bool is bool, string is
+//     string and a nested struct is a message;
+//   - []int and []int64 are packed repeated int64, []*T is repeated T, and
+//     [][]int is repeated Row where Row is { repeated int64 cells = 1; };
+//   - pointers to scalars are proto3 optional fields, so a nil pointer and
+//     a pointer to zero stay distinct.
+//
+// As in proto3, zero scalars and empty lists are left out, so an empty
+// list decodes as nil.
+type protobufSerializer struct{}
+
+func (protobufSerializer) Name() string { return CodecProtobuf }
+
+func (protobufSerializer) Marshal(msg Message) ([]byte, error) {
+	v := reflect.ValueOf(msg)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("protobuf: cannot marshal %T", msg)
+	}
+	return appendProtoStruct(nil, v.Elem())
+}
+
+func (protobufSerializer) Unmarshal(data []byte, msg Message) error {
+	v := reflect.ValueOf(msg)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("protobuf: cannot unmarshal into %T", msg)
+	}
+	return consumeProtoStruct(data, v.Elem())
+}
+
+type protoField struct {
+	num   protowire.Number
+	index int
+}
+
+var protoFieldCache sync.Map // reflect.Type -> []protoField
+
+func protoFields(t reflect.Type) []protoField {
+	if cached, ok := protoFieldCache.Load(t); ok {
+		return cached.([]protoField)
+	}
+	var fields []protoField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() || strings.Split(f.Tag.Get("json"), ",")[0] == "-" {
+			continue
+		}
+		fields = append(fields, protoField{num: protowire.Number(i + 1), index: i})
+	}
+	protoFieldCache.Store(t, fields)
+	return fields
+}
+
+func appendProtoStruct(b []byte, v reflect.Value) ([]byte, error) {
+	var err error
+	for _, f := range protoFields(v.Type()) {
+		if b, err = appendProtoValue(b, f.num, v.Field(f.index), false); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// appendProtoValue appends field num holding v. Zero values are skipped
+// unless force is set, which is how optional and repeated elements keep
+// their zeros.
+func appendProtoValue(b []byte, num protowire.Number, v reflect.Value, force bool) ([]byte, error) {
+	switch v.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if !force && v.IsZero() {
+			return b, nil
+		}
+		b = protowire.AppendTag(b, num, protowire.VarintType)
+		return protowire.AppendVarint(b, protoVarint(v)), nil
+	case reflect.Float32, reflect.Float64:
+		if !force && v.IsZero() {
+			return b, nil
+		}
+		b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, math.Float64bits(v.Float())), nil
+	case reflect.String:
+		if !force && v.Len() == 0 {
+			return b, nil
+		}
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendString(b, v.String()), nil
+	case reflect.Struct:
+		if !force && v.IsZero() {
+			return b, nil
+		}
+		body, err := appendProtoStruct(nil, v)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendBytes(b, body), nil
+	case reflect.Pointer:
+		if v.IsNil() {
+			if force && v.Type().Elem().Kind() == reflect.Struct {
+				b = protowire.AppendTag(b, num, protowire.BytesType)
+				return protowire.AppendBytes(b, nil), nil
+			}
+			return b, nil
+		}
+		return appendProtoValue(b, num, v.Elem(), true)
+	case reflect.Slice:
+		return appendProtoSlice(b, num, v)
+	}
+	return nil, fmt.Errorf("protobuf: unsupported field type %s", v.Type())
+}
+
+func appendProtoSlice(b []byte, num protowire.Number, v reflect.Value) ([]byte, error) {
+	if v.Len() == 0 {
+		return b, nil
+	}
+	elem := v.Type().Elem()
+	switch {
+	case elem.Kind() == reflect.Uint8:
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendBytes(b, v.Bytes()), nil
+	case isPackable(elem.Kind()):
+		var body []byte
+		for i := 0; i < v.Len(); i++ {
+			if isFloat(elem.Kind()) {
+				body = protowire.AppendFixed64(body, math.Float64bits(v.Index(i).Float()))
+			} else {
+				body = protowire.AppendVarint(body, protoVarint(v.Index(i)))
+			}
+		}
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		return protowire.AppendBytes(b, body), nil
+	case elem.Kind() == reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			row, err := appendProtoSlice(nil, 1, v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			b = protowire.AppendTag(b, num, protowire.BytesType)
+			b = protowire.AppendBytes(b, row)
+		}
+		return b, nil
+	}
+	var err error
+	for i := 0; i < v.Len(); i++ {
+		if b, err = appendProtoValue(b, num, v.Index(i), true); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func consumeProtoStruct(data []byte, v reflect.Value) error {
+	fields := protoFields(v.Type())
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		index := -1
+		for _, f := range fields {
+			if f.num == num {
+				index = f.index
+				break
+			}
+		}
+		if index < 0 {
+			// Unknown fields come from newer peers; skip them.
+			if n = protowire.ConsumeFieldValue(num, typ, data); n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+
+		n, err := consumeProtoValue(data, typ, v.Field(index))
+		if err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// consumeProtoValue reads one field value of wire type typ into v and
+// returns the number of bytes used.
+func consumeProtoValue(data []byte, typ protowire.Type, v reflect.Value) (int, error) {
+	switch v.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if typ != protowire.VarintType {
+			return 0, ErrInvalidPayload
+		}
+		x, n := protowire.ConsumeVarint(data)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		return n, setProtoVarint(v, x)
+	case reflect.Float32, reflect.Float64:
+		if typ != protowire.Fixed64Type {
+			return 0, ErrInvalidPayload
+		}
+		x, n := protowire.ConsumeFixed64(data)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		v.SetFloat(math.Float64frombits(x))
+		return n, nil
+	case reflect.String:
+		if typ != protowire.BytesType {
+			return 0, ErrInvalidPayload
+		}
+		s, n := protowire.ConsumeString(data)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		v.SetString(s)
+		return n, nil
+	case reflect.Struct:
+		if typ != protowire.BytesType {
+			return 0, ErrInvalidPayload
+		}
+		body, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		return n, consumeProtoStruct(body, v)
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return consumeProtoValue(data, typ, v.Elem())
+	case reflect.Slice:
+		return consumeProtoSlice(data, typ, v)
+	}
+	return 0, fmt.Errorf("protobuf: unsupported field type %s", v.Type())
+}
+
+// consumeProtoSlice appends one occurrence of a repeated field to v.
+// Packed and unpacked scalars are both accepted.
+func consumeProtoSlice(data []byte, typ protowire.Type, v reflect.Value) (int, error) {
+	elem := v.Type().Elem()
+	switch {
+	case elem.Kind() == reflect.Uint8:
+		if typ != protowire.BytesType {
+			return 0, ErrInvalidPayload
+		}
+		b, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		v.SetBytes(append([]byte(nil), b...))
+		return n, nil
+	case isPackable(elem.Kind()) && typ == protowire.BytesType:
+		body, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		wire := protowire.VarintType
+		if isFloat(elem.Kind()) {
+			wire = protowire.Fixed64Type
+		}
+		for len(body) > 0 {
+			item := reflect.New(elem).Elem()
+			m, err := consumeProtoValue(body, wire, item)
+			if err != nil {
+				return 0, err
+			}
+			v.Set(reflect.Append(v, item))
+			body = body[m:]
+		}
+		return n, nil
+	case elem.Kind() == reflect.Slice:
+		if typ != protowire.BytesType {
+			return 0, ErrInvalidPayload
+		}
+		body, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return 0, protowire.ParseError(n)
+		}
+		row := reflect.New(elem).Elem()
+		for len(body) > 0 {
+			num, rowTyp, m := protowire.ConsumeTag(body)
+			if m < 0 {
+				return 0, protowire.ParseError(m)
+			}
+			body = body[m:]
+			if num == 1 {
+				var err error
+				if m, err = consumeProtoSlice(body, rowTyp, row); err != nil {
+					return 0, err
+				}
+			} else if m = protowire.ConsumeFieldValue(num, rowTyp, body); m < 0 {
+				return 0, protowire.ParseError(m)
+			}
+			body = body[m:]
+		}
+		v.Set(reflect.Append(v, row))
+		return n, nil
+	}
+	item := reflect.New(elem).Elem()
+	n, err := consumeProtoValue(data, typ, item)
+	if err != nil {
+		return 0, err
+	}
+	v.Set(reflect.Append(v, item))
+	return n, nil
+}
+
+func protoVarint(v reflect.Value) uint64 {
+	switch v.Kind() {
+	case reflect.Bool:
+		return protowire.EncodeBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(v.Int())
+	}
+	return v.Uint()
+}
+
+func setProtoVarint(v reflect.Value, x uint64) error {
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(protowire.DecodeBool(x))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.OverflowInt(int64(x)) {
+			return ErrInvalidPayload
+		}
+		v.SetInt(int64(x))
+	default:
+		if v.OverflowUint(x) {
+			return ErrInvalidPayload
+		}
+		v.SetUint(x)
+	}
+	return nil
+}
+
+func isPackable(k reflect.Kind) bool {
+	switch k {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func isFloat(k reflect.Kind) bool {
+	return k == reflect.Float32 || k == reflect.Float64
+}
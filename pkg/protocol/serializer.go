@@ -0,0 +1,94 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec names used in Hello.
+const (
+	CodecJSON     = "json"
+	CodecMsgPack  = "msgpack"
+	CodecProtobuf = "protobuf"
+)
+
+// Serializer turns a message into the payload of a Packet and back. Every
+// serializer must round-trip every message type to an equal value.
+type Serializer interface {
+	Name() string
+	Marshal(msg Message) ([]byte, error)
+	Unmarshal(data []byte, msg Message) error
+}
+
+var (
+	JSON     Serializer = jsonSerializer{}
+	MsgPack  Serializer = msgpackSerializer{}
+	Protobuf Serializer = protobufSerializer{}
+)
+
+var serializers = map[string]Serializer{
+	CodecJSON:     JSON,
+	CodecMsgPack:  MsgPack,
+	CodecProtobuf: Protobuf,
+}
+
+// LookupSerializer returns the serializer called name.
+func LookupSerializer(name string) (Serializer, bool) {
+	s, ok := serializers[name]
+	return s, ok
+}
+
+// NegotiateSerializer picks the first codec in offered that the server
+// supports, in the client's order of preference. JSON is used when nothing
+// matches, so every client can fall back to it.
+func NegotiateSerializer(offered []string) Serializer {
+	for _, name := range offered {
+		if s, ok := LookupSerializer(name); ok {
+			return s
+		}
+	}
+	return JSON
+}
+
+type jsonSerializer struct{}
+
+func (jsonSerializer) Name() string { return CodecJSON }
+
+func (jsonSerializer) Marshal(msg Message) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+func (jsonSerializer) Unmarshal(data []byte, msg Message) error {
+	if len(data) == 0 {
+		return ErrInvalidPayload
+	}
+	return json.Unmarshal(data, msg)
+}
+
+// msgpackSerializer uses the json tags, so field names and omitempty match
+// the JSON encoding.
+type msgpackSerializer struct{}
+
+func (msgpackSerializer) Name() string { return CodecMsgPack }
+
+func (msgpackSerializer) Marshal(msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(msg); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackSerializer) Unmarshal(data []byte, msg Message) error {
+	if len(data) == 0 {
+		return ErrInvalidPayload
+	}
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(msg)
+}
@@ -0,0 +1,184 @@
+package protocol
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+var allSerializers = []Serializer{JSON, MsgPack, Protobuf}
+
+// registeredTypes returns every message type newMessage knows.
+func registeredTypes(t *testing.T) []uint16 {
+	t.Helper()
+	var types []uint16
+	for i := 0; i <= math.MaxUint16; i++ {
+		if _, err := newMessage(uint16(i)); err == nil {
+			types = append(types, uint16(i))
+		}
+	}
+	if len(types) == 0 {
+		t.Fatal("no message types registered")
+	}
+	return types
+}
+
+// fill sets every field of v to a distinct non-zero value, so a field a
+// serializer drops or mixes up with another shows up as a difference.
+func fill(v reflect.Value, next *int) {
+	*next++
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(*next))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(*next))
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(float64(*next) + 0.5)
+	case reflect.String:
+		v.SetString(fmt.Sprintf("s%d", *next))
+	case reflect.Pointer:
+		v.Set(reflect.New(v.Type().Elem()))
+		fill(v.Elem(), next)
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 2, 2))
+		for i := 0; i < v.Len(); i++ {
+			fill(v.Index(i), next)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				fill(v.Field(i), next)
+			}
+		}
+	}
+}
+
+func TestRoundTripAllMessages(t *testing.T) {
+	for _, msgType := range registeredTypes(t) {
+		for _, s := range allSerializers {
+			t.Run(fmt.Sprintf("%s/%s", TypeName(msgType), s.Name()), func(t *testing.T) {
+				want, _ := newMessage(msgType)
+				next := int(msgType)
+				fill(reflect.ValueOf(want).Elem(), &next)
+
+				data, err := s.Marshal(want)
+				if err != nil {
+					t.Fatalf("marshal: %v", err)
+				}
+				got, _ := newMessage(msgType)
+				if err := s.Unmarshal(data, got); err != nil {
+					t.Fatalf("unmarshal: %v", err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("round trip changed the message\n got: %+v\nwant: %+v", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestRoundTripEmptyMessages(t *testing.T) {
+	for _, msgType := range registeredTypes(t) {
+		for _, s := range allSerializers {
+			want, _ := newMessage(msgType)
+			data, err := s.Marshal(want)
+			if err != nil {
+				t.Fatalf("%s/%s: marshal: %v", TypeName(msgType), s.Name(), err)
+			}
+			got, _ := newMessage(msgType)
+			if err := s.Unmarshal(data, got); err != nil {
+				t.Fatalf("%s/%s: unmarshal: %v", TypeName(msgType), s.Name(), err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s/%s: got %+v, want %+v", TypeName(msgType), s.Name(), got, want)
+			}
+		}
+	}
+}
+
+func TestRoundTripSlices(t *testing.T) {
+	for _, s := range allSerializers {
+		t.Run(s.Name(), func(t *testing.T) {
+			for _, tc := range []struct {
+				name    string
+				players []int64
+			}{
+				{"nil", nil},
+				{"empty", []int64{}},
+				{"zeros", []int64{0, 0}},
+			} {
+				data, err := s.Marshal(&GameStart{RoomID: 1, Players: tc.players})
+				if err != nil {
+					t.Fatalf("%s: marshal: %v", tc.name, err)
+				}
+				var got GameStart
+				if err := s.Unmarshal(data, &got); err != nil {
+					t.Fatalf("%s: unmarshal: %v", tc.name, err)
+				}
+				if len(got.Players) != len(tc.players) {
+					t.Errorf("%s: got %v, want %v", tc.name, got.Players, tc.players)
+				}
+				for i := range got.Players {
+					if got.Players[i] != tc.players[i] {
+						t.Errorf("%s: got %v, want %v", tc.name, got.Players, tc.players)
+					}
+				}
+				if tc.players == nil && got.Players != nil {
+					t.Errorf("%s: nil list decoded as %#v", tc.name, got.Players)
+				}
+				// Protobuf has no empty list on the wire.
+				if s == Protobuf && len(tc.players) == 0 && got.Players != nil {
+					t.Errorf("%s: empty list decoded as %#v, want nil", tc.name, got.Players)
+				}
+			}
+		})
+	}
+
+	board := [][]int{{0, 1, 0}, {}, {2, 0, 0}}
+	for _, s := range allSerializers {
+		data, err := s.Marshal(&BoardUpdate{RoomID: 1, Board: board})
+		if err != nil {
+			t.Fatalf("%s: marshal: %v", s.Name(), err)
+		}
+		var got BoardUpdate
+		if err := s.Unmarshal(data, &got); err != nil {
+			t.Fatalf("%s: unmarshal: %v", s.Name(), err)
+		}
+		if len(got.Board) != len(board) {
+			t.Fatalf("%s: got %d rows, want %d", s.Name(), len(got.Board), len(board))
+		}
+		for i := range board {
+			if fmt.Sprint(got.Board[i]) != fmt.Sprint(board[i]) {
+				t.Errorf("%s: row %d is %v, want %v", s.Name(), i, got.Board[i], board[i])
+			}
+		}
+	}
+}
+
+func TestRoundTripOptionalFields(t *testing.T) {
+	zero, empty := 0, ""
+	want := &UpdateProfileReq{AvatarID: &zero, Bio: &empty}
+
+	for _, s := range allSerializers {
+		data, err := s.Marshal(want)
+		if err != nil {
+			t.Fatalf("%s: marshal: %v", s.Name(), err)
+		}
+		var got UpdateProfileReq
+		if err := s.Unmarshal(data, &got); err != nil {
+			t.Fatalf("%s: unmarshal: %v", s.Name(), err)
+		}
+		if got.DisplayName != nil || got.Country != nil {
+			t.Errorf("%s: unset fields decoded as set: %+v", s.Name(), got)
+		}
+		if got.AvatarID == nil || *got.AvatarID != 0 {
+			t.Errorf("%s: avatar_id 0 decoded as %v", s.Name(), got.AvatarID)
+		}
+		if got.Bio == nil || *got.Bio != "" {
+			t.Errorf("%s: empty bio decoded as %v", s.Name(), got.Bio)
+		}
+	}
+}
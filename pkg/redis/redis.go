@@ -2,16 +2,27 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"log"
+	"net"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 
 	"game-server/internal/config"
+	"game-server/internal/metrics"
 )
 
 var Client *redis.Client
 
+// KeepTTL makes Set keep the key's current expiry.
+const KeepTTL = redis.KeepTTL
+
+// Nil is returned for a missing key.
+const Nil = redis.Nil
+
+var ErrNotInitialized = errors.New("redis not initialized")
+
 func InitRedis() error {
 	cfg := config.GlobalConfig.Redis
 
@@ -26,6 +37,8 @@ func InitRedis() error {
 		MinIdleConns: 10,
 	})
 
+	Client.AddHook(metricsHook{})
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -37,6 +50,48 @@ func InitRedis() error {
 	return nil
 }
 
+// metricsHook records per-command latency. A missing key (redis.Nil) is a
+// normal result, not an error.
+type metricsHook struct{}
+
+func (metricsHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (metricsHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		metrics.ObserveRedis(cmd.Name(), start, commandError(err))
+		return err
+	}
+}
+
+func (metricsHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+		metrics.ObserveRedis("pipeline", start, commandError(err))
+		return err
+	}
+}
+
+func commandError(err error) error {
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	return err
+}
+
+func Ping(ctx context.Context) error {
+	if Client == nil {
+		return ErrNotInitialized
+	}
+	return Client.Ping(ctx).Err()
+}
+
 func CloseRedis() {
 	if Client != nil {
 		Client.Close()
@@ -6,12 +6,18 @@ CREATE TABLE IF NOT EXISTS users (
     id BIGINT PRIMARY KEY AUTO_INCREMENT,
     username VARCHAR(50) UNIQUE NOT NULL,
     password VARCHAR(100) NOT NULL,
+    role VARCHAR(16) NOT NULL DEFAULT 'player',
+    display_name VARCHAR(50) NOT NULL DEFAULT '',
+    avatar_id INT NOT NULL DEFAULT 0,
+    country CHAR(2) NOT NULL DEFAULT '',
+    bio VARCHAR(500) NOT NULL DEFAULT '',
     score INT DEFAULT 1000,
     win_count INT DEFAULT 0,
     lose_count INT DEFAULT 0,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     INDEX idx_username (username),
-    INDEX idx_score (score)
+    INDEX idx_score (score),
+    INDEX idx_role_created (role, created_at)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
 CREATE TABLE IF NOT EXISTS games (
@@ -21,8 +27,67 @@ CREATE TABLE IF NOT EXISTS games (
     white_player_id BIGINT NOT NULL,
     winner_id BIGINT,
     board_state TEXT,
+    move_history TEXT,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     ended_at TIMESTAMP NULL,
     INDEX idx_room_id (room_id),
     INDEX idx_players (black_player_id, white_player_id)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS correspondence_games (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    black_player_id BIGINT NOT NULL,
+    white_player_id BIGINT NOT NULL,
+    days_per_move INT NOT NULL DEFAULT 3,
+    rule_set VARCHAR(16) NOT NULL DEFAULT 'freestyle',
+    rated TINYINT(1) NOT NULL DEFAULT 1,
+    board_state TEXT NOT NULL,
+    move_history TEXT,
+    current_player_id BIGINT NOT NULL,
+    move_count INT NOT NULL DEFAULT 0,
+    last_x INT NOT NULL DEFAULT -1,
+    last_y INT NOT NULL DEFAULT -1,
+    status TINYINT NOT NULL DEFAULT 0,
+    winner_id BIGINT NOT NULL DEFAULT 0,
+    move_deadline TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_black_status (black_player_id, status),
+    INDEX idx_white_status (white_player_id, status),
+    INDEX idx_status_deadline (status, move_deadline)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS admin_audit_log (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    actor VARCHAR(64) NOT NULL,
+    action VARCHAR(32) NOT NULL,
+    target VARCHAR(64) NOT NULL DEFAULT '',
+    detail TEXT NOT NULL,
+    remote_addr VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_action (action),
+    INDEX idx_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS user_sanctions (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    user_id BIGINT NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    issued_by VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NULL,
+    revoked_at TIMESTAMP NULL,
+    INDEX idx_user_kind (user_id, kind)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE IF NOT EXISTS rating_history (
+    id BIGINT PRIMARY KEY AUTO_INCREMENT,
+    user_id BIGINT NOT NULL,
+    game_type VARCHAR(16) NOT NULL,
+    game_id BIGINT NOT NULL DEFAULT 0,
+    delta INT NOT NULL,
+    score INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_user_created (user_id, created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -1,5 +1,3 @@
-const BOARD_SIZE = 15;
-const CELL_SIZE = 36;
 const PADDING = 21;
 
 let ws = null;
@@ -8,14 +6,39 @@ let currentRoom = null;
 let currentGame = null;
 let myColor = 0;
 let board = [];
+let moveNumber = 0;
+let boardSyncPending = false;
+let boardSize = 15;
+let cellSize = 36;
+let isReady = false;
+let triedRefresh = false;
+let protocolRejected = false;
+
+const PROTOCOL_VERSION = 2;
+const CLIENT_VERSION = '1.2.0';
 
 const MessageType = {
     Ping: 1000,
     Pong: 1001,
+    ServerShutdown: 1002,
+    SystemAnnouncement: 1003,
+    ForceDisconnect: 1004,
+    Hello: 1005,
+    HelloResp: 1006,
     Login: 2001,
     LoginResp: 2002,
     Register: 2003,
     RegisterResp: 2004,
+    Logout: 2005,
+    LogoutResp: 2006,
+    RefreshToken: 2009,
+    RefreshTokenResp: 2010,
+    GuestLogin: 2013,
+    GuestLoginResp: 2014,
+    ClaimAccount: 2015,
+    ClaimAccountResp: 2016,
+    UpdateProfile: 2017,
+    UpdateProfileResp: 2018,
     CreateRoom: 3001,
     CreateRoomResp: 3011,
     JoinRoom: 3002,
@@ -27,6 +50,16 @@ const MessageType = {
     RoomInfo: 3005,
     PlayerJoin: 3015,
     PlayerLeave: 3016,
+    RoomSettings: 3101,
+    RoomSettingsResp: 3102,
+    RoomSettingsUpdate: 3103,
+    Ready: 3104,
+    ReadyResp: 3105,
+    ReadyUpdate: 3106,
+    RoomOwnerChange: 3112,
+    Chat: 3201,
+    ChatResp: 3202,
+    ChatMessage: 3203,
     Move: 4001,
     MoveResp: 4002,
     GameOver: 4003,
@@ -34,6 +67,8 @@ const MessageType = {
     BoardUpdate: 4005,
     ForfeitReq: 4006,
     ForfeitResp: 4007,
+    BoardDelta: 4011,
+    BoardSync: 4012,
     LeaderboardReq: 5001,
     LeaderboardResp: 5002,
     UserStatsReq: 5003,
@@ -47,10 +82,15 @@ function connect() {
 
     ws.onopen = () => {
         console.log('WebSocket connected');
-        const token = localStorage.getItem('token');
-        if (token) {
-            send(MessageType.Login, { token: token });
-        }
+        triedRefresh = false;
+        send(MessageType.Hello, {
+            version: PROTOCOL_VERSION,
+            client: 'gomoku-web',
+            client_version: CLIENT_VERSION,
+            codecs: ['json'],
+            features: ['chat', 'delta_board']
+        });
+        resumeSession();
     };
 
     ws.onmessage = (event) => {
@@ -60,7 +100,9 @@ function connect() {
 
     ws.onclose = () => {
         console.log('WebSocket disconnected');
-        setTimeout(connect, 3000);
+        if (!protocolRejected) {
+            setTimeout(connect, 3000);
+        }
     };
 
     ws.onerror = (error) => {
@@ -68,6 +110,40 @@ function connect() {
     };
 }
 
+// resumeSession logs in with the stored access token, renewing it first
+// when it has expired.
+function resumeSession() {
+    const token = localStorage.getItem('token');
+    const expiresAt = Number(localStorage.getItem('token_expires_at') || 0);
+    if (token && Date.now() < expiresAt) {
+        send(MessageType.Login, { token: token });
+    } else if (!refreshSession()) {
+        clearTokens();
+    }
+}
+
+function refreshSession() {
+    const refreshToken = localStorage.getItem('refresh_token');
+    if (!refreshToken || triedRefresh) {
+        return false;
+    }
+    triedRefresh = true;
+    send(MessageType.RefreshToken, { refresh_token: refreshToken });
+    return true;
+}
+
+function storeTokens(token, refreshToken, expiresIn) {
+    localStorage.setItem('token', token);
+    localStorage.setItem('refresh_token', refreshToken);
+    localStorage.setItem('token_expires_at', String(Date.now() + expiresIn * 1000));
+}
+
+function clearTokens() {
+    localStorage.removeItem('token');
+    localStorage.removeItem('refresh_token');
+    localStorage.removeItem('token_expires_at');
+}
+
 function send(type, payload) {
     if (ws && ws.readyState === WebSocket.OPEN) {
         ws.send(JSON.stringify({ type, payload }));
@@ -76,9 +152,24 @@ function send(type, payload) {
 
 function handleMessage(type, payload) {
     switch (type) {
+        case MessageType.HelloResp:
+            handleHelloResp(payload);
+            break;
         case MessageType.LoginResp:
             handleLoginResp(payload);
             break;
+        case MessageType.RefreshTokenResp:
+            handleRefreshTokenResp(payload);
+            break;
+        case MessageType.GuestLoginResp:
+            handleLoginResp(payload);
+            break;
+        case MessageType.ClaimAccountResp:
+            handleClaimAccountResp(payload);
+            break;
+        case MessageType.UpdateProfileResp:
+            handleUpdateProfileResp(payload);
+            break;
         case MessageType.RegisterResp:
             handleRegisterResp(payload);
             break;
@@ -100,12 +191,36 @@ function handleMessage(type, payload) {
         case MessageType.PlayerLeave:
             handlePlayerLeave(payload);
             break;
+        case MessageType.RoomSettingsResp:
+            handleRoomSettingsResp(payload);
+            break;
+        case MessageType.RoomSettingsUpdate:
+            handleRoomSettingsUpdate(payload);
+            break;
+        case MessageType.ReadyResp:
+            handleReadyResp(payload);
+            break;
+        case MessageType.ReadyUpdate:
+            handleReadyUpdate(payload);
+            break;
+        case MessageType.RoomOwnerChange:
+            handleRoomOwnerChange(payload);
+            break;
+        case MessageType.ChatResp:
+            handleChatResp(payload);
+            break;
+        case MessageType.ChatMessage:
+            handleChatMessage(payload);
+            break;
         case MessageType.GameStart:
             handleGameStart(payload);
             break;
         case MessageType.BoardUpdate:
             handleBoardUpdate(payload);
             break;
+        case MessageType.BoardDelta:
+            handleBoardDelta(payload);
+            break;
         case MessageType.GameOver:
             handleGameOver(payload);
             break;
@@ -115,12 +230,79 @@ function handleMessage(type, payload) {
         case MessageType.UserStatsResp:
             handleUserStatsResp(payload);
             break;
+        case MessageType.ServerShutdown:
+            handleServerShutdown(payload);
+            break;
+        case MessageType.SystemAnnouncement:
+            alert(`系统公告: ${payload.message}`);
+            break;
+        case MessageType.ForceDisconnect:
+            handleForceDisconnect(payload);
+            break;
         case MessageType.Error:
             alert(payload.message);
             break;
     }
 }
 
+function handleHelloResp(payload) {
+    if (payload.code === 426) {
+        protocolRejected = true;
+        alert('客户端版本过旧，请刷新页面');
+    } else if (payload.code !== 200) {
+        console.warn('Hello rejected:', payload.message);
+    }
+}
+
+function handleServerShutdown(payload) {
+    const deadline = new Date(payload.deadline * 1000).toLocaleTimeString();
+    alert(`服务器即将维护重启，进行中的对局需在 ${deadline} 前结束`);
+}
+
+function sendChat(input) {
+    const content = input.value.trim();
+    if (!content || !currentRoom) {
+        return;
+    }
+    send(MessageType.Chat, { room_id: currentRoom.id, content });
+    input.value = '';
+}
+
+function handleChatResp(payload) {
+    if (payload.code !== 200) {
+        appendChat(payload.message, true);
+    }
+}
+
+function handleChatMessage(payload) {
+    if (!currentRoom || payload.room_id !== currentRoom.id) {
+        return;
+    }
+    const time = new Date(payload.timestamp * 1000).toLocaleTimeString();
+    appendChat(`[${time}] ${payload.username}: ${payload.content}`, false);
+}
+
+function appendChat(text, system) {
+    document.querySelectorAll('.chat-log').forEach(log => {
+        const line = document.createElement('div');
+        line.textContent = text;
+        if (system) {
+            line.className = 'chat-system';
+        }
+        log.appendChild(line);
+        log.scrollTop = log.scrollHeight;
+    });
+}
+
+function clearChat() {
+    document.querySelectorAll('.chat-log').forEach(log => log.replaceChildren());
+}
+
+function handleForceDisconnect(payload) {
+    alert(`连接已被服务器断开: ${payload.reason}`);
+    clearSession();
+}
+
 function showTab(tab) {
     document.querySelectorAll('.tab').forEach(t => t.classList.remove('active'));
     document.querySelectorAll('.form').forEach(f => f.classList.add('hidden'));
@@ -143,7 +325,41 @@ function login() {
         return;
     }
     
-    send(MessageType.Login, { username, password });
+    send(MessageType.Login, { username, password, device: 'web' });
+}
+
+function guestLogin() {
+    send(MessageType.GuestLogin, { device: 'web' });
+}
+
+// claimAccount keeps the guest's games under a real username and password.
+function claimAccount() {
+    const username = prompt('请输入用户名:');
+    if (!username) {
+        return;
+    }
+    const password = prompt('请输入密码:');
+    if (!password) {
+        return;
+    }
+    send(MessageType.ClaimAccount, { username: username.trim(), password });
+}
+
+function handleClaimAccountResp(payload) {
+    if (payload.code !== 200) {
+        alert(payload.message);
+        return;
+    }
+    localStorage.setItem('token', payload.token);
+    localStorage.setItem('token_expires_at', String(Date.now() + payload.expires_in * 1000));
+    currentUser.role = payload.role;
+    showUser(payload.username, payload.role);
+    alert('账号已保存');
+}
+
+function showUser(name, role) {
+    document.getElementById('username-display').textContent = `用户: ${name}`;
+    document.getElementById('claim-btn').classList.toggle('hidden', role !== 'guest');
 }
 
 function register() {
@@ -160,15 +376,30 @@ function register() {
 
 function handleLoginResp(payload) {
     if (payload.code === 200) {
-        localStorage.setItem('token', payload.token);
-        currentUser = { id: payload.user_id, token: payload.token };
+        if (payload.refresh_token) {
+            storeTokens(payload.token, payload.refresh_token, payload.expires_in);
+        }
+        triedRefresh = false;
+        currentUser = { id: payload.user_id, token: payload.token, role: payload.role };
         showPage('lobby-page');
-        document.getElementById('username-display').textContent = `用户: ${payload.user_id}`;
+        showUser(payload.username || payload.user_id, payload.role);
         send(MessageType.UserStatsReq, { user_id: payload.user_id });
         send(MessageType.RoomList, {});
         send(MessageType.LeaderboardReq, { limit: 10 });
+    } else if (payload.code === 401 && !payload.sanction && refreshSession()) {
+        // The access token was rejected; try again with a fresh one.
     } else {
-        alert(payload.message);
+        clearTokens();
+        alert(payload.sanction ? `登录被拒绝: ${payload.message}` : payload.message);
+    }
+}
+
+function handleRefreshTokenResp(payload) {
+    if (payload.code === 200) {
+        storeTokens(payload.access_token, payload.refresh_token, payload.expires_in);
+        send(MessageType.Login, { token: payload.access_token });
+    } else {
+        clearTokens();
     }
 }
 
@@ -184,12 +415,40 @@ function handleRegisterResp(payload) {
 function handleUserStatsResp(payload) {
     if (payload.code === 200) {
         document.getElementById('score-display').textContent = `积分: ${payload.score}`;
+        if (currentUser && payload.user_id === currentUser.id) {
+            showUser(payload.display_name || payload.username, currentUser.role);
+        }
     }
 }
 
-function logout() {
-    localStorage.removeItem('token');
+function editDisplayName() {
+    const displayName = prompt('请输入昵称 (留空则显示用户名):');
+    if (displayName !== null) {
+        send(MessageType.UpdateProfile, { display_name: displayName });
+    }
+}
+
+function handleUpdateProfileResp(payload) {
+    if (payload.code !== 200) {
+        alert(payload.message);
+        return;
+    }
+    const profile = payload.profile;
+    showUser(profile.display_name || profile.username, currentUser.role);
+}
+
+function logout(all = false) {
+    if (currentUser) {
+        send(MessageType.Logout, { all });
+    }
+    clearSession();
+}
+
+function clearSession() {
+    clearTokens();
     currentUser = null;
+    currentRoom = null;
+    currentGame = null;
     showPage('auth-page');
 }
 
@@ -202,11 +461,14 @@ function createRoom() {
 
 function handleCreateRoomResp(payload) {
     if (payload.code === 200) {
-        currentRoom = { id: payload.room_id };
+        currentRoom = { id: payload.room_id, settings: null };
+        clearChat();
+        setReady(false);
         showPage('room-page');
         document.getElementById('room-name').textContent = `房间 ${payload.room_id}`;
         document.getElementById('player-1').querySelector('.player-name').textContent = currentUser.id;
         document.getElementById('player-2').querySelector('.player-name').textContent = '等待中...';
+        send(MessageType.RoomList, {});
     } else {
         alert(payload.message);
     }
@@ -218,7 +480,9 @@ function joinRoom(roomId) {
 
 function handleJoinRoomResp(payload) {
     if (payload.code === 200) {
-        currentRoom = { id: payload.room_id };
+        currentRoom = { id: payload.room_id, settings: null };
+        clearChat();
+        setReady(false);
         showPage('room-page');
         document.getElementById('room-name').textContent = `房间 ${payload.room_id}`;
         send(MessageType.RoomList, {});
@@ -238,6 +502,13 @@ function handleLeaveRoomResp(payload) {
 }
 
 function handleRoomListResp(payload) {
+    if (currentRoom && payload.rooms) {
+        const room = payload.rooms.find(r => r.room_id === currentRoom.id);
+        if (room && room.settings) {
+            showRoomSettings(room.settings);
+        }
+    }
+
     const roomList = document.getElementById('room-list');
     roomList.innerHTML = '';
     
@@ -264,14 +535,103 @@ function handleRoomListResp(payload) {
 
 function handlePlayerJoin(payload) {
     document.getElementById('player-2').querySelector('.player-name').textContent = payload.username;
-    document.getElementById('room-status').textContent = '玩家已加入，等待游戏开始...';
+    document.getElementById('room-status').textContent = '玩家已加入，双方准备后开始游戏...';
 }
 
 function handlePlayerLeave(payload) {
+    if (payload.user_id === currentUser.id && payload.reason === 'kicked') {
+        alert('你已被房主移出房间');
+        currentRoom = null;
+        showPage('lobby-page');
+        send(MessageType.RoomList, {});
+        return;
+    }
     document.getElementById('player-2').querySelector('.player-name').textContent = '等待中...';
     document.getElementById('room-status').textContent = '对手已离开，等待新玩家...';
 }
 
+function handleRoomOwnerChange(payload) {
+    if (payload.owner_id === currentUser.id) {
+        document.getElementById('room-status').textContent = '房主已离开，你现在是房主';
+    }
+}
+
+function toggleReady() {
+    if (currentRoom) {
+        send(MessageType.Ready, { room_id: currentRoom.id, ready: !isReady });
+    }
+}
+
+function setReady(ready) {
+    isReady = ready;
+    document.getElementById('ready-btn').textContent = ready ? '取消准备' : '准备';
+}
+
+function handleReadyResp(payload) {
+    if (payload.code === 200) {
+        setReady(payload.ready);
+    } else {
+        alert(payload.message);
+    }
+}
+
+function handleReadyUpdate(payload) {
+    const count = payload.ready ? payload.ready.length : 0;
+    document.getElementById('room-status').textContent = `已准备: ${count}/2`;
+}
+
+function editSettings() {
+    if (!currentRoom) {
+        return;
+    }
+    const current = currentRoom.settings || { rule_set: 'freestyle', board_size: 15, move_time_limit: 0, rated: true, creator_color: 'black' };
+    const ruleSet = prompt('规则 (freestyle / standard):', current.rule_set);
+    if (ruleSet === null) return;
+    const boardSizeInput = prompt('棋盘大小 (9-19):', current.board_size);
+    if (boardSizeInput === null) return;
+    const timeLimit = prompt('每步限时秒数 (0 为不限时):', current.move_time_limit);
+    if (timeLimit === null) return;
+    const color = prompt('房主执子 (black / white / random):', current.creator_color);
+    if (color === null) return;
+    const rated = confirm('是否计分对局？');
+
+    send(MessageType.RoomSettings, {
+        room_id: currentRoom.id,
+        settings: {
+            rule_set: ruleSet.trim(),
+            board_size: parseInt(boardSizeInput, 10) || 15,
+            move_time_limit: parseInt(timeLimit, 10) || 0,
+            rated: rated,
+            creator_color: color.trim()
+        }
+    });
+}
+
+function handleRoomSettingsResp(payload) {
+    if (payload.code === 200) {
+        showRoomSettings(payload.settings);
+        setReady(false);
+    } else {
+        alert(payload.message);
+    }
+}
+
+function handleRoomSettingsUpdate(payload) {
+    showRoomSettings(payload.settings);
+    setReady(false);
+    document.getElementById('room-status').textContent = '房间设置已更改，请重新准备';
+}
+
+function showRoomSettings(settings) {
+    if (currentRoom) {
+        currentRoom.settings = settings;
+    }
+    const rule = settings.rule_set === 'standard' ? '标准 (恰好五连)' : '自由 (五连及以上)';
+    const time = settings.move_time_limit > 0 ? `每步 ${settings.move_time_limit} 秒` : '不限时';
+    document.getElementById('room-settings').textContent =
+        `${rule} | ${settings.board_size}x${settings.board_size} | ${time} | ${settings.rated ? '计分' : '娱乐'}`;
+}
+
 function handleLeaderboardResp(payload) {
     const leaderboard = document.getElementById('leaderboard');
     leaderboard.innerHTML = '';
@@ -283,10 +643,12 @@ function handleLeaderboardResp(payload) {
             div.innerHTML = `
                 <span class="rank-number">${index + 1}</span>
                 <div class="rank-info">
-                    <span class="rank-name">${rank.username}</span>
+                    <span class="rank-name"></span>
                     <span class="rank-score">${rank.score}分 | 胜率 ${rank.win_rate}</span>
                 </div>
             `;
+            // Names are user input; never interpret them as HTML.
+            div.querySelector('.rank-name').textContent = rank.display_name || rank.username;
             leaderboard.appendChild(div);
         });
     }
@@ -301,8 +663,15 @@ function handleGameStart(payload) {
     
     const myIndex = payload.players.indexOf(currentUser.id);
     myColor = myIndex === 0 ? 1 : 2;
+    setReady(false);
+
+    boardSize = payload.settings ? payload.settings.board_size : 15;
+    const canvas = document.getElementById('game-board');
+    cellSize = Math.min(36, (canvas.width - 2 * PADDING) / (boardSize - 1));
     
-    board = Array(BOARD_SIZE).fill(null).map(() => Array(BOARD_SIZE).fill(0));
+    board = Array(boardSize).fill(null).map(() => Array(boardSize).fill(0));
+    moveNumber = 0;
+    boardSyncPending = false;
     
     showPage('game-page');
     initBoard();
@@ -319,23 +688,26 @@ function initBoard() {
     ctx.strokeStyle = '#000';
     ctx.lineWidth = 1;
     
-    for (let i = 0; i < BOARD_SIZE; i++) {
+    for (let i = 0; i < boardSize; i++) {
         ctx.beginPath();
-        ctx.moveTo(PADDING + i * CELL_SIZE, PADDING);
-        ctx.lineTo(PADDING + i * CELL_SIZE, PADDING + (BOARD_SIZE - 1) * CELL_SIZE);
+        ctx.moveTo(PADDING + i * cellSize, PADDING);
+        ctx.lineTo(PADDING + i * cellSize, PADDING + (boardSize - 1) * cellSize);
         ctx.stroke();
         
         ctx.beginPath();
-        ctx.moveTo(PADDING, PADDING + i * CELL_SIZE);
-        ctx.lineTo(PADDING + (BOARD_SIZE - 1) * CELL_SIZE, PADDING + i * CELL_SIZE);
+        ctx.moveTo(PADDING, PADDING + i * cellSize);
+        ctx.lineTo(PADDING + (boardSize - 1) * cellSize, PADDING + i * cellSize);
         ctx.stroke();
     }
     
-    const starPoints = [[3, 3], [3, 11], [11, 3], [11, 11], [7, 7]];
+    const edge = boardSize >= 13 ? 3 : 2;
+    const far = boardSize - 1 - edge;
+    const mid = Math.floor(boardSize / 2);
+    const starPoints = [[edge, edge], [edge, far], [far, edge], [far, far], [mid, mid]];
     ctx.fillStyle = '#000';
     starPoints.forEach(([x, y]) => {
         ctx.beginPath();
-        ctx.arc(PADDING + x * CELL_SIZE, PADDING + y * CELL_SIZE, 4, 0, 2 * Math.PI);
+        ctx.arc(PADDING + x * cellSize, PADDING + y * cellSize, 4, 0, 2 * Math.PI);
         ctx.fill();
     });
     
@@ -349,30 +721,52 @@ function handleCanvasClick(event) {
     
     const canvas = document.getElementById('game-board');
     const rect = canvas.getBoundingClientRect();
-    const x = Math.round((event.clientX - rect.left - PADDING) / CELL_SIZE);
-    const y = Math.round((event.clientY - rect.top - PADDING) / CELL_SIZE);
+    const x = Math.round((event.clientX - rect.left - PADDING) / cellSize);
+    const y = Math.round((event.clientY - rect.top - PADDING) / cellSize);
     
-    if (x >= 0 && x < BOARD_SIZE && y >= 0 && y < BOARD_SIZE && board[x][y] === 0) {
+    if (x >= 0 && x < boardSize && y >= 0 && y < boardSize && board[x][y] === 0) {
         send(MessageType.Move, { room_id: currentRoom.id, x, y });
     }
 }
 
 function handleBoardUpdate(payload) {
     board = payload.board;
+    moveNumber = payload.move_number || 0;
+    boardSyncPending = false;
     currentGame.currentPlayer = payload.current_player;
     
     drawBoard();
     updateTurnInfo();
 }
 
+// handleBoardDelta places the stone of one move. Deltas are numbered, so a
+// missing one shows up as a gap, and the whole board is fetched again.
+function handleBoardDelta(payload) {
+    if (boardSyncPending || payload.move_number <= moveNumber) {
+        return;
+    }
+    if (payload.move_number !== moveNumber + 1) {
+        boardSyncPending = true;
+        send(MessageType.BoardSync, { room_id: payload.room_id });
+        return;
+    }
+
+    board[payload.x][payload.y] = payload.stone;
+    moveNumber = payload.move_number;
+    currentGame.currentPlayer = payload.current_player;
+
+    drawBoard();
+    updateTurnInfo();
+}
+
 function drawBoard() {
     const canvas = document.getElementById('game-board');
     const ctx = canvas.getContext('2d');
     
     initBoard();
     
-    for (let i = 0; i < BOARD_SIZE; i++) {
-        for (let j = 0; j < BOARD_SIZE; j++) {
+    for (let i = 0; i < boardSize; i++) {
+        for (let j = 0; j < boardSize; j++) {
             if (board[i][j] !== 0) {
                 drawStone(ctx, i, j, board[i][j]);
             }
@@ -381,9 +775,9 @@ function drawBoard() {
 }
 
 function drawStone(ctx, x, y, color) {
-    const cx = PADDING + x * CELL_SIZE;
-    const cy = PADDING + y * CELL_SIZE;
-    const radius = CELL_SIZE / 2 - 2;
+    const cx = PADDING + x * cellSize;
+    const cy = PADDING + y * cellSize;
+    const radius = cellSize / 2 - 2;
     
     ctx.beginPath();
     ctx.arc(cx, cy, radius, 0, 2 * Math.PI);
@@ -432,11 +826,17 @@ function handleGameOver(payload) {
     const modal = document.getElementById('game-over-modal');
     const result = document.getElementById('game-result');
     
-    if (payload.winner === currentUser.id) {
-        result.textContent = '你赢了！';
+    if (payload.reason === 'server shutdown') {
+        result.textContent = '服务器维护，对局已中止';
+        result.style.color = '#e94560';
+    } else if (payload.reason === 'admin' && !payload.winner) {
+        result.textContent = '对局已被管理员结束';
+        result.style.color = '#e94560';
+    } else if (payload.winner === currentUser.id) {
+        result.textContent = payload.reason === 'timeout' ? '对手超时，你赢了！' : '你赢了！';
         result.style.color = '#4ecca3';
     } else {
-        result.textContent = '你输了！';
+        result.textContent = payload.reason === 'timeout' ? '超时，你输了！' : '你输了！';
         result.style.color = '#e94560';
     }
     